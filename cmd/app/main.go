@@ -2,8 +2,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/nzoschke/mixxxlab/pkg/analysis"
 	"github.com/nzoschke/mixxxlab/pkg/server"
@@ -20,8 +30,172 @@ var analyzeCmd = &cobra.Command{
 	Short: "Analyze audio files and create JSON sidecars",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		return runAnalyze(cmd.Context(), args[0], cfg)
+	},
+}
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <file>",
+	Short: "Run all grid analyzers on one file and compare results",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, _ := cmd.Flags().GetBool("json")
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		return runCompare(args[0], cfg, asJSON)
+	},
+}
+
+var analyzeURLCmd = &cobra.Command{
+	Use:   "analyze-url <url>",
+	Short: "Download audio from a URL, analyze it, and compare results",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, _ := cmd.Flags().GetBool("json")
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		return runAnalyzeURL(args[0], cfg, asJSON)
+	},
+}
+
+var compareVersionsCmd = &cobra.Command{
+	Use:   "compare-versions <fileA> <fileB>",
+	Short: "Compare two versions of the same track (e.g. masters or edits)",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, _ := cmd.Flags().GetBool("json")
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		return runCompareVersions(args[0], args[1], cfg, asJSON)
+	},
+}
+
+var forceGridCmd = &cobra.Command{
+	Use:   "force-grid <file>",
+	Short: "Write a constant-tempo grid at an exact BPM into a track's JSON sidecar",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bpm, _ := cmd.Flags().GetFloat64("bpm")
+		firstBeat := -1.0
+		if cmd.Flags().Changed("first-beat") {
+			firstBeat, _ = cmd.Flags().GetFloat64("first-beat")
+		}
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		return runForceGrid(args[0], bpm, firstBeat, cfg)
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export <track.json>",
+	Short: "Export a grid from an analysis sidecar for use in other tools",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		grid, _ := cmd.Flags().GetString("grid")
+		format, _ := cmd.Flags().GetString("format")
 		force, _ := cmd.Flags().GetBool("force")
-		return runAnalyze(args[0], force)
+		return runExport(args[0], grid, format, force)
+	},
+}
+
+var oscCmd = &cobra.Command{
+	Use:   "osc <track.json>",
+	Short: "Send OSC /beat and /downbeat messages in time with a track, starting now",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := analysis.DefaultOSCConfig()
+		cfg.Host, _ = cmd.Flags().GetString("host")
+		cfg.Port, _ = cmd.Flags().GetInt("port")
+		cfg.BeatAddress, _ = cmd.Flags().GetString("beat-address")
+		cfg.DownbeatAddress, _ = cmd.Flags().GetString("downbeat-address")
+		return runOSC(cmd.Context(), args[0], cfg)
+	},
+}
+
+var evaluateCmd = &cobra.Command{
+	Use:   "evaluate <directory>",
+	Short: "Score analyzed tracks against .beats ground-truth annotations",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return analysis.EvaluateDir(args[0], os.Stdout)
+	},
+}
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest <directory>",
+	Short: "Write " + analysis.ManifestFileName + " indexing every analyzed track",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := analysis.WriteManifest(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Indexed %d tracks\n", len(m.Tracks))
+		return nil
+	},
+}
+
+var disagreementsCmd = &cobra.Command{
+	Use:   "disagreements <directory>",
+	Short: "Rank analyzed tracks by how much the grid analyzers disagree",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		top, _ := cmd.Flags().GetInt("top")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		ds, err := analysis.WorstDisagreements(args[0], top)
+		if ds == nil && err != nil {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err) // Unreadable sidecars, left out of the ranking
+		}
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(ds)
+		}
+		return analysis.WriteDisagreements(os.Stdout, ds)
+	},
+}
+
+var mixTransitionsCmd = &cobra.Command{
+	Use:   "mix-transitions <file>",
+	Short: "Find where one track transitions into the next in a DJ mix recording",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		samples, sampleRate, err := analysis.LoadAudioMono(args[0])
+		if err != nil {
+			return fmt.Errorf("load audio: %w", err)
+		}
+		for _, t := range analysis.DetectMixTransitions(samples, sampleRate) {
+			fmt.Printf("%d:%02d\t%.1f\n", int(t)/60, int(t)%60, t)
+		}
+		return nil
+	},
+}
+
+var modelInfoCmd = &cobra.Command{
+	Use:   "model-info <model.onnx|savedmodel>",
+	Short: "Print input/output names, shapes, and dtypes of an ONNX or TensorFlow model",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info, err := analysis.ModelInfo(args[0])
+		if err != nil {
+			return fmt.Errorf("model info: %w", err)
+		}
+		return info.WriteTable(os.Stdout)
 	},
 }
 
@@ -29,33 +203,449 @@ var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Start web server on :8080",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runServe()
+		token, _ := cmd.Flags().GetString("auth-token")
+		return runServe(cmd.Context(), token)
 	},
 }
 
 func init() {
+	rootCmd.PersistentFlags().String("config", "", "Config file (default: ./"+analysis.ConfigFileName+" or the user config dir)")
+	for _, cmd := range []*cobra.Command{analyzeCmd, compareCmd, analyzeURLCmd, compareVersionsCmd, forceGridCmd} {
+		cmd.Flags().String("preset", "", "Analysis preset: fast, balanced, or accurate (other flags override it)")
+		cmd.Flags().StringSlice("analyzers", nil, "Grid analyzers to run (default: all available; mixx-drums is opt-in)")
+		cmd.Flags().String("df-type", "complexsd", "QM detection function: hfc, specdiff, phasedev, complexsd, broadband")
+		cmd.Flags().Float64("input-tempo", 120, "QM tempo hint in BPM (0 for automatic)")
+		cmd.Flags().Bool("constrain-tempo", false, "Constrain QM tempo near --input-tempo")
+		cmd.Flags().Int("beats-per-bar", 4, "Beats per bar for QM downbeat detection")
+		cmd.Flags().Bool("detect-meter", false, "Detect 3/4, 4/4, or 6/8 from QM downbeats, falling back to --beats-per-bar")
+		cmd.Flags().Float64("merge-markers", 0, "Merge cues from all marker analyzers within this many seconds (0 to disable)")
+		cmd.Flags().Float64("tempo-octave-tolerance", analysis.DefaultTempoOctaveTolerance, "Relative tolerance for warning that analyzers disagree by double or half tempo")
+		cmd.Flags().Bool("variable-tempo", false, "Add a tempo curve from QM beat periods to mixx-extended grids")
+		cmd.Flags().String("snap-cues", "", "Snap detected cues within a quarter beat to the nearest beat, downbeat, or bar")
+		cmd.Flags().Int("phrase-bars", analysis.DefaultPhraseBars, "Bars per phrase marker derived from the downbeats (e.g. 8, 16, or 32)")
+		cmd.Flags().Float64("min-bpm", analysis.DefaultBPMRange.Min, "Lowest BPM rekordbox-go and beat_this report, doubling slower tempos")
+		cmd.Flags().Float64("max-bpm", analysis.DefaultBPMRange.Max, "Highest BPM rekordbox-go and beat_this report, halving faster tempos")
+		cmd.Flags().Bool("trim-silence", false, "Trim silent intros and outros before grid analysis (beat times stay in the file's timeline)")
+		cmd.Flags().Float64("silence-threshold-db", analysis.DefaultSilenceThresholdDB, "RMS level in dBFS below which --trim-silence treats audio as silent")
+		cmd.Flags().IntSlice("waveform-levels", nil, "Also store the waveform at these resolutions in pixels per second (e.g. 10,100,1000)")
+		cmd.Flags().String("beatthis-provider", "auto", "beat_this execution provider: auto, cpu, cuda, coreml, or directml")
+		cmd.Flags().Int("beatthis-chunk-size", 0, "Frames (50 per second) per beat_this run; smaller uses less memory (0 for 1500)")
+		cmd.Flags().Int("beatthis-chunk-overlap", 0, "Frames shared by neighbouring beat_this chunks (0 for a tenth of the chunk size)")
+		cmd.Flags().Bool("download-models", false, "Download missing beat_this models from $"+analysis.BeatThisModelsURLEnv)
+	}
 	analyzeCmd.Flags().BoolP("force", "f", false, "Force re-analysis even if JSON exists")
+	analyzeCmd.Flags().Bool("no-refresh", false, "Skip files with existing JSON even if the audio changed")
+	analyzeCmd.Flags().Bool("rehash", false, "Hash whole audio files with SHA-256 to detect changes, re-analyzing files with sampled hashes")
+	analyzeCmd.Flags().Bool("fail-fast", false, "Stop at the first file that fails to analyze")
+	analyzeCmd.Flags().String("format", analysis.FormatJSON, "Output format: json (sidecars) or csv (sidecars plus analysis.csv)")
+	analyzeCmd.Flags().Float64("min-confidence", 0, "Flag tracks below this confidence (0-1) with needs_review for manual review")
+	analyzeCmd.Flags().Bool("manifest", false, "Also keep "+analysis.ManifestFileName+" indexing every analyzed track")
+	compareCmd.Flags().Bool("json", false, "Output comparison as JSON")
+	analyzeURLCmd.Flags().Bool("json", false, "Output comparison as JSON")
+	compareVersionsCmd.Flags().Bool("json", false, "Output comparison as JSON")
+	forceGridCmd.Flags().Float64("bpm", 0, "Exact tempo of the grid")
+	forceGridCmd.Flags().Float64("first-beat", 0, "Time of the first downbeat in seconds (default: from the detected grid)")
+	_ = forceGridCmd.MarkFlagRequired("bpm")
+	exportCmd.Flags().String("grid", "", "Grid to export (default: the preferred successful grid)")
+	exportCmd.Flags().BoolP("force", "f", false, "Export a grid that fails validation (beats past the end, bad intervals, or an implausible BPM)")
+	exportCmd.Flags().String("format", "npy", "Export format: npy (NumPy arrays of beats, downbeats, and detection function) serato (Serato Markers2 GEOB frame data), mixxx (Mixxx BeatGrid protobuf), mixxx-beatmap (Mixxx BeatMap protobuf), traktor (Traktor NML), csv (beat times, downbeats, and confidence), or labels (Audacity/Sonic Visualiser label tracks of beats and phrases)")
+	oscDefaults := analysis.DefaultOSCConfig()
+	oscCmd.Flags().String("host", oscDefaults.Host, "OSC destination host")
+	oscCmd.Flags().Int("port", oscDefaults.Port, "OSC destination UDP port")
+	oscCmd.Flags().String("beat-address", oscDefaults.BeatAddress, "OSC address for beats")
+	oscCmd.Flags().String("downbeat-address", oscDefaults.DownbeatAddress, "OSC address for downbeats")
+	disagreementsCmd.Flags().Int("top", 20, "Number of tracks to list (0 for all)")
+	disagreementsCmd.Flags().Bool("json", false, "Output disagreements as JSON")
+	serveCmd.Flags().String("auth-token", "", "Require this bearer token on mutating endpoints")
 	rootCmd.AddCommand(analyzeCmd)
+	rootCmd.AddCommand(compareCmd)
+	rootCmd.AddCommand(analyzeURLCmd)
+	rootCmd.AddCommand(compareVersionsCmd)
+	rootCmd.AddCommand(forceGridCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(oscCmd)
+	rootCmd.AddCommand(evaluateCmd)
+	rootCmd.AddCommand(manifestCmd)
+	rootCmd.AddCommand(disagreementsCmd)
+	rootCmd.AddCommand(mixTransitionsCmd)
+	rootCmd.AddCommand(modelInfoCmd)
 	rootCmd.AddCommand(serveCmd)
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	// Ctrl-C cancels the command's context so long analyses stop cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
-func runAnalyze(dir string, force bool) error {
-	analyzer, err := analysis.New()
+// loadConfig loads defaults, then the config file, then any flags the user set on cmd.
+func loadConfig(cmd *cobra.Command) (*analysis.Config, error) {
+	path, _ := cmd.Flags().GetString("config")
+	if path == "" {
+		path = analysis.FindConfig()
+	}
+
+	flags := cmd.Flags()
+	var flagErr error
+	cfg, err := analysis.LoadConfig(path, func(cfg *analysis.Config) {
+		// The preset goes first so the flags below override it
+		if flags.Changed("preset") {
+			name, _ := flags.GetString("preset")
+			var preset analysis.AnalysisPreset
+			if preset, flagErr = analysis.ParseAnalysisPreset(name); flagErr == nil {
+				flagErr = preset.Apply(cfg)
+			}
+		}
+		if flags.Changed("analyzers") {
+			names, _ := flags.GetStringSlice("analyzers")
+			cfg.Analyzers = nil
+			for _, name := range names {
+				cfg.Analyzers = append(cfg.Analyzers, analysis.AnalyzerType(name))
+			}
+		}
+		if flags.Changed("df-type") {
+			name, _ := flags.GetString("df-type")
+			cfg.QM.DFType, flagErr = analysis.ParseDetectionFunctionType(name)
+		}
+		if flags.Changed("input-tempo") {
+			cfg.QM.InputTempo, _ = flags.GetFloat64("input-tempo")
+		}
+		if flags.Changed("constrain-tempo") {
+			cfg.QM.ConstrainTempo, _ = flags.GetBool("constrain-tempo")
+		}
+		if flags.Changed("beats-per-bar") {
+			cfg.QM.BeatsPerBar, _ = flags.GetInt("beats-per-bar")
+		}
+		if flags.Changed("detect-meter") {
+			cfg.QM.DetectMeter, _ = flags.GetBool("detect-meter")
+		}
+		if flags.Changed("merge-markers") {
+			cfg.MergeMarkers, _ = flags.GetFloat64("merge-markers")
+		}
+		if flags.Changed("tempo-octave-tolerance") {
+			cfg.TempoOctaveTolerance, _ = flags.GetFloat64("tempo-octave-tolerance")
+		}
+		if flags.Changed("waveform-levels") {
+			cfg.WaveformLevels, _ = flags.GetIntSlice("waveform-levels")
+		}
+		if flags.Changed("beatthis-provider") {
+			name, _ := flags.GetString("beatthis-provider")
+			cfg.BeatThisProvider = analysis.BeatThisProvider(name)
+		}
+		if flags.Changed("beatthis-chunk-size") {
+			cfg.BeatThisChunkSize, _ = flags.GetInt("beatthis-chunk-size")
+		}
+		if flags.Changed("beatthis-chunk-overlap") {
+			cfg.BeatThisChunkOverlap, _ = flags.GetInt("beatthis-chunk-overlap")
+		}
+		if flags.Changed("variable-tempo") {
+			cfg.VariableTempo, _ = flags.GetBool("variable-tempo")
+		}
+		if flags.Changed("snap-cues") {
+			mode, _ := flags.GetString("snap-cues")
+			cfg.SnapCues = analysis.SnapMode(mode)
+		}
+		if flags.Changed("phrase-bars") {
+			cfg.PhraseBars, _ = flags.GetInt("phrase-bars")
+		}
+		if flags.Changed("min-bpm") {
+			cfg.BPMRange.Min, _ = flags.GetFloat64("min-bpm")
+		}
+		if flags.Changed("max-bpm") {
+			cfg.BPMRange.Max, _ = flags.GetFloat64("max-bpm")
+		}
+		if flags.Changed("trim-silence") {
+			cfg.TrimSilence, _ = flags.GetBool("trim-silence")
+		}
+		if flags.Changed("silence-threshold-db") {
+			cfg.SilenceThresholdDB, _ = flags.GetFloat64("silence-threshold-db")
+		}
+		if flags.Changed("download-models") {
+			cfg.DownloadModels, _ = flags.GetBool("download-models")
+		}
+		if flags.Changed("force") {
+			cfg.Output.Force, _ = flags.GetBool("force")
+		}
+		if flags.Changed("no-refresh") {
+			cfg.Output.NoRefresh, _ = flags.GetBool("no-refresh")
+		}
+		if flags.Changed("rehash") {
+			cfg.Output.Rehash, _ = flags.GetBool("rehash")
+		}
+		if flags.Changed("fail-fast") {
+			cfg.Output.FailFast, _ = flags.GetBool("fail-fast")
+		}
+		if flags.Changed("format") {
+			cfg.Output.Format, _ = flags.GetString("format")
+		}
+		if flags.Changed("min-confidence") {
+			cfg.Output.MinConfidence, _ = flags.GetFloat64("min-confidence")
+		}
+		if flags.Changed("manifest") {
+			cfg.Output.Manifest, _ = flags.GetBool("manifest")
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+	if err == nil {
+		cfg.Logf = logf
+	}
+	return cfg, err
+}
+
+// logf prints a progress message from the analysis library on its own line.
+func logf(format string, args ...any) {
+	fmt.Printf(format+"\n", args...)
+}
+
+func runAnalyze(ctx context.Context, dir string, cfg *analysis.Config) error {
+	analyzer, err := analysis.NewWithConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("create analyzer: %w", err)
+	}
+	defer analyzer.Close()
+
+	return analyzer.AnalyzeDirWithContext(ctx, dir, cfg.Output)
+}
+
+func runCompare(path string, cfg *analysis.Config, asJSON bool) error {
+	return printComparison(cfg, asJSON, func(a *analysis.Analyzer) (*analysis.TrackAnalysis, error) {
+		return a.AnalyzeFileWithPath(path)
+	})
+}
+
+func runAnalyzeURL(url string, cfg *analysis.Config, asJSON bool) error {
+	return printComparison(cfg, asJSON, func(a *analysis.Analyzer) (*analysis.TrackAnalysis, error) {
+		return a.AnalyzeURL(url)
+	})
+}
+
+func runCompareVersions(pathA, pathB string, cfg *analysis.Config, asJSON bool) error {
+	analyzer, err := analysis.NewWithConfig(cfg)
 	if err != nil {
 		return fmt.Errorf("create analyzer: %w", err)
 	}
 	defer analyzer.Close()
 
-	return analyzer.AnalyzeDir(dir, force)
+	c, err := analyzer.CompareTracks(pathA, pathB)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	}
+	return c.WriteTable(os.Stdout)
+}
+
+// runForceGrid adds a ForceGrid grid to the JSON sidecar of the audio file at
+// path, analyzing the file first if it has no sidecar. A negative firstBeat
+// anchors the grid on the detected grid's first downbeat.
+func runForceGrid(path string, bpm, firstBeat float64, cfg *analysis.Config) error {
+	jsonPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+	ta, err := analysis.ReadTrackAnalysis(jsonPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		analyzer, err := analysis.NewWithConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("create analyzer: %w", err)
+		}
+		defer analyzer.Close()
+		if ta, err = analyzer.AnalyzeFileWithPath(path); err != nil {
+			return fmt.Errorf("analyze: %w", err)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if firstBeat < 0 {
+		delete(ta.Grids, string(analysis.AnalyzerForced)) // Anchor on a detected grid
+		g := ta.DefaultGrid(nil)
+		switch {
+		case g == nil || len(g.Beats) == 0:
+			return fmt.Errorf("%s: no detected beats to anchor on, set --first-beat", path)
+		case g.DownbeatOne > 0:
+			firstBeat = float64(g.DownbeatOne)
+		case len(g.Downbeats) > 0:
+			firstBeat = g.Beats[g.Downbeats[0]]
+		default:
+			firstBeat = g.Beats[0]
+		}
+	}
+
+	g := analysis.ForceGrid(bpm, firstBeat, float64(ta.Duration))
+	if g.Error != "" {
+		return errors.New(g.Error)
+	}
+	if ta.Grids == nil {
+		ta.Grids = make(map[string]*analysis.GridAnalysis)
+	}
+	ta.Grids[string(analysis.AnalyzerForced)] = g
+	if err := ta.WriteJSON(jsonPath); err != nil {
+		return fmt.Errorf("write JSON: %w", err)
+	}
+	fmt.Printf("Wrote %d beats at %.2f BPM from %.3fs to %s\n", len(g.Beats), bpm, firstBeat, jsonPath)
+	return nil
+}
+
+// runExport writes the named grid (or the default grid) of the sidecar at
+// jsonPath in format, next to the sidecar. A grid that fails validation is
+// refused unless force is set.
+func runExport(jsonPath, gridName, format string, force bool) error {
+	ta, err := analysis.ReadTrackAnalysis(jsonPath)
+	if err != nil {
+		return err
+	}
+
+	g := ta.DefaultGrid(nil)
+	if gridName != "" {
+		g = ta.Grids[gridName]
+	}
+	if g == nil || g.Error != "" {
+		return fmt.Errorf("%s: no successful grid %q", jsonPath, gridName)
+	}
+
+	switch format {
+	case "npy":
+		paths, err := analysis.ExportGridNPY(g, float64(ta.Duration), strings.TrimSuffix(jsonPath, filepath.Ext(jsonPath)), force)
+		for _, path := range paths {
+			fmt.Println("Wrote", path)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", jsonPath, err)
+		}
+		return nil
+	case "serato":
+		data, err := analysis.ExportSeratoMarkers(ta, gridName, force)
+		if err != nil {
+			return fmt.Errorf("%s: %w", jsonPath, err)
+		}
+		path := strings.TrimSuffix(jsonPath, filepath.Ext(jsonPath)) + ".serato-markers2"
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+		fmt.Println("Wrote", path)
+		return nil
+	case "mixxx", "mixxx-beatmap":
+		opts := analysis.MixxxBeatsOptions{BeatMap: format == "mixxx-beatmap", Duration: float64(ta.Duration), Force: force}
+		data, err := analysis.ExportMixxxBeatGridWithOptions(g, ta.SampleRate, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", jsonPath, err)
+		}
+		version := analysis.MixxxBeatGridVersion
+		if opts.BeatMap {
+			version = analysis.MixxxBeatMapVersion
+		}
+		path := strings.TrimSuffix(jsonPath, filepath.Ext(jsonPath)) + ".mixxx-beats"
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s (beats_version %s)\n", path, version)
+		return nil
+	case "csv":
+		var buf bytes.Buffer
+		if err := analysis.ExportBeatsCSV(g, float64(ta.Duration), &buf, force); err != nil {
+			return fmt.Errorf("%s: %w", jsonPath, err)
+		}
+		path := strings.TrimSuffix(jsonPath, filepath.Ext(jsonPath)) + ".beats.csv"
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		fmt.Println("Wrote", path)
+		return nil
+	case "labels":
+		base := strings.TrimSuffix(jsonPath, filepath.Ext(jsonPath))
+		var buf bytes.Buffer
+		if err := analysis.ExportLabelTrack(g, float64(ta.Duration), &buf, force); err != nil {
+			return fmt.Errorf("%s: %w", jsonPath, err)
+		}
+		path := base + ".labels.txt"
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		fmt.Println("Wrote", path)
+
+		// Phrases are optional: only tracks with markers have them
+		buf.Reset()
+		if err := analysis.ExportPhraseLabels(ta, &buf); err != nil {
+			return nil
+		}
+		path = base + ".phrases.txt"
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		fmt.Println("Wrote", path)
+		return nil
+	case "traktor":
+		var buf bytes.Buffer
+		if err := analysis.ExportTraktorNML(ta, gridName, &buf, force); err != nil {
+			return fmt.Errorf("%s: %w", jsonPath, err)
+		}
+		path := strings.TrimSuffix(jsonPath, filepath.Ext(jsonPath)) + ".nml"
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		fmt.Println("Wrote", path)
+		return nil
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// runOSC plays the default grid of the sidecar at jsonPath as OSC messages.
+func runOSC(ctx context.Context, jsonPath string, cfg analysis.OSCConfig) error {
+	ta, err := analysis.ReadTrackAnalysis(jsonPath)
+	if err != nil {
+		return err
+	}
+	g := ta.DefaultGrid(nil)
+	if g == nil {
+		return fmt.Errorf("%s: no successful grid", jsonPath)
+	}
+
+	s, err := analysis.NewOSCSender(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	fmt.Printf("Sending %d beats at %.2f BPM to %s:%d\n", len(g.Beats), g.BPM, cfg.Host, cfg.Port)
+	return s.PlayGrid(ctx, g, time.Now())
+}
+
+// printComparison runs analyze with an analyzer built from cfg and prints the
+// comparison of its grids.
+func printComparison(cfg *analysis.Config, asJSON bool, analyze func(*analysis.Analyzer) (*analysis.TrackAnalysis, error)) error {
+	analyzer, err := analysis.NewWithConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("create analyzer: %w", err)
+	}
+	defer analyzer.Close()
+
+	start := time.Now()
+	ta, err := analyze(analyzer)
+	if err != nil {
+		return fmt.Errorf("analyze: %w", err)
+	}
+
+	c := analysis.Compare(ta)
+	c.Elapsed = time.Since(start).Seconds()
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	}
+	return c.WriteTable(os.Stdout)
 }
 
-func runServe() error {
-	return server.Run()
+func runServe(ctx context.Context, authToken string) error {
+	return server.Run(ctx, authToken)
 }
@@ -2,44 +2,132 @@
 package analysis
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"maps"
+	"math"
 	"os"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"sort"
 	"strings"
+	"time"
+
+	ort "github.com/yalue/onnxruntime_go"
 )
 
 // TrackAnalysis represents the JSON output for a track with separate grid and marker results.
 type TrackAnalysis struct {
-	File       string                  `json:"file"`
-	Duration   float64                 `json:"duration"`
-	SampleRate int                     `json:"sample_rate"`
+	SchemaVersion int `json:"schema_version"` // Sidecar format version, see CurrentSchemaVersion
+
+	File       string                     `json:"file"`
+	Duration   Seconds                    `json:"duration"`
+	SampleRate int                        `json:"sample_rate"`
 	Grids      map[string]*GridAnalysis   `json:"grids"`             // Beat grid strategies
 	Markers    map[string]*MarkerAnalysis `json:"markers,omitempty"` // Cue/phrase marker strategies
-	Waveform   *Waveform               `json:"waveform,omitempty"`
+	Waveform   *Waveform                  `json:"waveform,omitempty"`
+	Metadata   *TrackMetadata             `json:"metadata,omitempty"`  // Title/artist/album tags
+	Versions   map[string]string          `json:"versions,omitempty"`  // Library/model versions that produced this result
+	QMConfig   *QMConfig                  `json:"qm_config,omitempty"` // QM-DSP settings of the mixx-extended and mixx-drums grids
+	Key        *KeyResult                 `json:"key,omitempty"`       // Musical key from qm-dsp
+	Loudness   *LoudnessResult            `json:"loudness,omitempty"`  // EBU R128 loudness and ReplayGain
+
+	// Warnings are problems that didn't stop the analysis, e.g. a marker
+	// analyzer that failed. Grid-specific warnings are on each GridAnalysis.
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Confidence is the TrackConfidence of the grids, and NeedsReview is set
+	// when it falls below AnalyzeDirOptions.MinConfidence.
+	Confidence  float64 `json:"confidence"`
+	NeedsReview bool    `json:"needs_review,omitempty"`
+
+	// TempoWarnings name the analyzer pairs whose BPMs are double, half, or
+	// another power of two apart (see TempoWarnings).
+	TempoWarnings []string `json:"tempo_warnings,omitempty"`
+
+	// TrimmedLeading and TrimmedTrailing are the silence trimmed from each
+	// end before grid analysis (see Config.TrimSilence). Beat and marker
+	// times are in the original file's timeline either way.
+	TrimmedLeading  Seconds `json:"trimmed_leading,omitempty"`
+	TrimmedTrailing Seconds `json:"trimmed_trailing,omitempty"`
+
+	// ContentHash identifies the audio that was analyzed (see ContentHash),
+	// and AnalyzerVersion the analysis it went through. AnalyzeDir re-analyzes
+	// a track when either no longer matches.
+	ContentHash     string `json:"content_hash,omitempty"`
+	AnalyzerVersion string `json:"analyzer_version,omitempty"`
+
+	// WaveformLevels holds the waveform at each resolution in
+	// Config.WaveformLevels, keyed by pixels per second, when configured.
+	WaveformLevels map[int]*Waveform `json:"waveform_levels,omitempty"`
+
+	// Timings are the wall-clock seconds each analyzer took, keyed by grid
+	// name or by "cues" and "structure" for the marker analyzers, with the
+	// audio decoding they share under "decode". mixx-extended reads the file
+	// itself, so its time includes decoding.
+	Timings map[string]float64 `json:"timings,omitempty"`
 }
 
+// TimingDecode is the Timings key of the shared audio decoding.
+const TimingDecode = "decode"
+
 // GridAnalysis represents beat detection results from a single grid analyzer.
 type GridAnalysis struct {
 	BPM   float64   `json:"bpm"`
 	Beats []float64 `json:"beats"`
 	Error string    `json:"error,omitempty"`
 
+	// Sanity-check warnings (e.g. sample rate or duration mismatches)
+	Warnings []string `json:"warnings,omitempty"`
+
+	// AnalysisSampleRate is the rate the analyzer actually ran at after any
+	// resampling (e.g. 22050 for beat_this), which bounds its beat resolution
+	AnalysisSampleRate int `json:"analysis_sample_rate,omitempty"`
+
+	// Stem is set when beats were detected on a separated stem (e.g. "drums")
+	Stem string `json:"stem,omitempty"`
+
 	// Downbeat detection (indices into Beats that are downbeats)
-	Downbeats []int `json:"downbeats,omitempty"`
+	Downbeats   []int   `json:"downbeats,omitempty"`
+	DownbeatOne Seconds `json:"downbeat_one,omitempty"`  // Most likely true bar-one
+	BeatsPerBar int     `json:"beats_per_bar,omitempty"` // Meter of the downbeats, e.g. 3 for 3/4
+
+	// FirstDownbeat anchors the grid for exporters and DJ software that
+	// store a constant grid as one beat and a BPM: the first downbeat, or
+	// the first beat without downbeats (see computeGridAnchor)
+	FirstDownbeat float64 `json:"first_downbeat,omitempty"`
+
+	// BeatConfidence is each beat's normalized strength (0-1), aligned to Beats
+	BeatConfidence []float64 `json:"beat_confidence,omitempty"`
+
+	// TempoCurve tracks a drifting tempo when variable tempo is configured
+	TempoCurve []TempoPoint `json:"tempo_curve,omitempty"`
 
 	// Extended data from QM-DSP two-stage process (optional)
 	DetectionFunction []float64 `json:"detection_function,omitempty"` // Stage 1: onset strength
 	BeatPeriods       []int     `json:"beat_periods,omitempty"`       // Stage 2: tempo per window
+	ModalBPM          float64   `json:"modal_bpm,omitempty"`          // Most common tempo in BeatPeriods, an alternative to BPM
 	StepSizeFrames    int       `json:"step_size_frames,omitempty"`   // DF frame step in samples
 	WindowSize        int       `json:"window_size,omitempty"`        // FFT window size
 }
 
+// TempoPoint is a point of a tempo curve: the tempo from Time until the next point.
+type TempoPoint struct {
+	Time Seconds `json:"time"`
+	BPM  float64 `json:"bpm"`
+}
+
 // MarkerAnalysis represents cue points and phrases from a single marker analyzer.
 type MarkerAnalysis struct {
 	CuePoints []CuePoint `json:"cue_points,omitempty"` // Detected cue points
 	Phrases   []Phrase   `json:"phrases,omitempty"`    // Detected phrases/sections
+	Segments  []Segment  `json:"segments,omitempty"`   // Structural segments with display colors
 	Error     string     `json:"error,omitempty"`
 }
 
@@ -48,13 +136,14 @@ type Segment struct {
 	Start float64 `json:"start"` // Start time in seconds
 	End   float64 `json:"end"`   // End time in seconds
 	Type  int     `json:"type"`  // Segment type (0 to num_clusters-1)
+	Color string  `json:"color"` // Display color for the segment type ("#rrggbb")
 }
 
 // Phrase represents a musical phrase/section detected by SongFormer.
 type Phrase struct {
-	Time     float64 `json:"time"`     // Start time in seconds
+	Time     Seconds `json:"time"`     // Start time
 	Label    string  `json:"label"`    // Original label (intro, verse, chorus, etc.)
-	Duration float64 `json:"duration"` // Duration in seconds (calculated)
+	Duration Seconds `json:"duration"` // Duration (calculated)
 }
 
 // Waveform contains downsampled waveform data for visualization.
@@ -62,6 +151,17 @@ type Waveform struct {
 	PixelsPerSec int       `json:"pixels_per_sec"`
 	Peaks        []float64 `json:"peaks"`
 	Troughs      []float64 `json:"troughs"`
+
+	// RMS is the root-mean-square level of each pixel, in the same full-scale
+	// units as Peaks (0-1). Only set when requested with WaveformOptions.RMS.
+	RMS []float64 `json:"rms,omitempty"`
+}
+
+// WaveformOptions controls GenerateWaveformWithOptions.
+type WaveformOptions struct {
+	// RMS also computes the RMS energy envelope, which shows perceived
+	// loudness (e.g. drops and breakdowns) better than peaks.
+	RMS bool
 }
 
 // AnalyzerType represents the type of analyzer to use.
@@ -74,30 +174,70 @@ const (
 	AnalyzerRekordboxGo  AnalyzerType = "rekordbox-go"  // TensorFlow Go bindings (Rekordbox model)
 	AnalyzerBeatThis     AnalyzerType = "beatthis"      // CPJKU/beat_this via ONNX (small model)
 	AnalyzerBeatThisFull AnalyzerType = "beatthis-full" // CPJKU/beat_this via ONNX (full model)
+	AnalyzerMixxDrums    AnalyzerType = "mixx-drums"    // CGO qm-dsp on a Demucs drum stem (opt-in, slow)
+	AnalyzerForced       AnalyzerType = "forced"        // Manual constant-tempo grid from ForceGrid
+	AnalyzerConsensus    AnalyzerType = "consensus"     // Grid voted from the other analyzers by ConsensusGrid
 )
 
 // Analyzer wraps multiple beat analyzers for comparison.
 type Analyzer struct {
-	mlPython      *MLAnalyzer
-	tfGo          *TFAnalyzer
-	cue           *CueAnalyzer
-	beatThis      *BeatThisAnalyzer
-	beatThisFull  *BeatThisAnalyzer
-	songformer    *SongFormerAnalyzer
+	grids      []GridAnalyzer // Registered grid analyzers, in registration order
+	mlPython   *MLAnalyzer
+	cue        *CueAnalyzer
+	songformer *SongFormerAnalyzer
+	stems      *StemSeparator
+	key        *KeyAnalyzer
+
+	qmConfig     *QMConfig      // nil uses DefaultQMConfig
+	analyzers    []AnalyzerType // Grid analyzers to run, empty for all available
+	mergeMarkers float64        // Cue merge tolerance in seconds, 0 disables
+	octaveTol    float64        // Tempo octave warning tolerance, 0 uses DefaultTempoOctaveTolerance
+	waveformLvls []int          // Waveform pyramid resolutions, empty for none
+	varTempo     bool           // Add tempo curves to QM grids
+	trimSilence  bool           // Trim silent intros and outros before grid analysis
+	silenceDB    float64        // Silence threshold in dBFS, 0 uses DefaultSilenceThresholdDB
+	snapCues     SnapMode       // Grid lines to snap detected cues to, "" for none
+	phraseBars   int            // Bars per derived phrase marker, 0 uses DefaultPhraseBars
 }
 
-// New creates a new Analyzer with all available implementations.
+// New creates a new Analyzer with all available implementations, including
+// grid analyzers registered with RegisterGridAnalyzer.
 func New() (*Analyzer, error) {
+	return NewWithConfig(nil)
+}
+
+// NewWithConfig creates a new Analyzer that runs the grid analyzers selected in
+// cfg with its QM-DSP settings. Unselected analyzers are not initialized.
+// A nil cfg selects all available analyzers with default settings.
+// Opt-in analyzers (mixx-drums) only run when listed explicitly.
+func NewWithConfig(cfg *Config) (*Analyzer, error) {
 	a := &Analyzer{}
+	if cfg != nil {
+		qm := cfg.QM
+		a.qmConfig = &qm
+		a.analyzers = cfg.Analyzers
+		a.mergeMarkers = cfg.MergeMarkers
+		a.octaveTol = cfg.TempoOctaveTolerance
+		a.waveformLvls = cfg.WaveformLevels
+		a.varTempo = cfg.VariableTempo
+		a.trimSilence = cfg.TrimSilence
+		a.silenceDB = cfg.SilenceThresholdDB
+		a.snapCues = cfg.SnapCues
+		a.phraseBars = cfg.PhraseBars
+	}
 
-	// Try to initialize ML Python analyzer
-	if ml, err := NewMLAnalyzer(); err == nil {
-		a.mlPython = ml
+	// Download missing beat_this models before initializing them
+	if cfg != nil && cfg.DownloadModels && (a.enabled(AnalyzerBeatThis) || a.enabled(AnalyzerBeatThisFull)) {
+		if _, err := EnsureBeatThisModels(cfg.Logf); err != nil {
+			return nil, fmt.Errorf("download beat_this models: %w", err)
+		}
 	}
 
-	// Try to initialize TensorFlow Go analyzer
-	if tf, err := NewTFAnalyzer(); err == nil {
-		a.tfGo = tf
+	// Try to initialize ML Python analyzer
+	if a.enabled(AnalyzerRekordboxPy) {
+		if ml, err := NewMLAnalyzer(); err == nil {
+			a.mlPython = ml
+		}
 	}
 
 	// Try to initialize Cue analyzer
@@ -105,14 +245,26 @@ func New() (*Analyzer, error) {
 		a.cue = cue
 	}
 
-	// Try to initialize beat_this analyzer (small model)
-	if bt, err := NewBeatThisAnalyzer(); err == nil {
-		a.beatThis = bt
+	// Try to initialize the registered grid analyzers: mixx, rekordbox-go,
+	// beatthis and beatthis-full (on the GPU if available), then custom ones
+	factoryCfg := cfg
+	if factoryCfg == nil {
+		factoryCfg = DefaultConfig()
+	}
+	for _, r := range registeredGridAnalyzers() {
+		if !a.enabled(r.name) {
+			continue
+		}
+		if g, err := r.factory(factoryCfg); err == nil {
+			a.grids = append(a.grids, g)
+		}
 	}
 
-	// Try to initialize beat_this analyzer (full model)
-	if btFull, err := NewBeatThisAnalyzerFull(); err == nil {
-		a.beatThisFull = btFull
+	// Try to initialize Demucs stem separator (opt-in, slow)
+	if slices.Contains(a.analyzers, AnalyzerMixxDrums) {
+		if stems, err := NewStemSeparator(); err == nil {
+			a.stems = stems
+		}
 	}
 
 	// Try to initialize SongFormer analyzer (music structure)
@@ -120,25 +272,34 @@ func New() (*Analyzer, error) {
 		a.songformer = sf
 	}
 
+	// Key detection uses the same qm-dsp library as the grid analyzers
+	a.key = NewKeyAnalyzer()
+
 	return a, nil
 }
 
+// gridAnalyzers returns the GridAnalyzers to run. mixx needs no setup, so it
+// runs whenever it is enabled, even on an Analyzer not made by NewWithConfig.
+func (a *Analyzer) gridAnalyzers() []GridAnalyzer {
+	if !a.enabled(AnalyzerMixx) || slices.ContainsFunc(a.grids, func(g GridAnalyzer) bool { return g.Name() == string(AnalyzerMixx) }) {
+		return a.grids
+	}
+	return append([]GridAnalyzer{mixxGridAnalyzer{}}, a.grids...)
+}
+
+// enabled reports whether the grid analyzer at is selected to run.
+func (a *Analyzer) enabled(at AnalyzerType) bool {
+	return len(a.analyzers) == 0 || slices.Contains(a.analyzers, at)
+}
+
 // Close releases resources.
 func (a *Analyzer) Close() error {
 	var errs []error
-	if a.tfGo != nil {
-		if err := a.tfGo.Close(); err != nil {
-			errs = append(errs, err)
-		}
-	}
-	if a.beatThis != nil {
-		if err := a.beatThis.Close(); err != nil {
-			errs = append(errs, err)
-		}
-	}
-	if a.beatThisFull != nil {
-		if err := a.beatThisFull.Close(); err != nil {
-			errs = append(errs, err)
+	for _, g := range a.grids {
+		if c, ok := g.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
 		}
 	}
 	if len(errs) > 0 {
@@ -147,76 +308,183 @@ func (a *Analyzer) Close() error {
 	return nil
 }
 
+// ToolVersion returns the mixxxlab module version from the build info,
+// falling back to the VCS revision for development builds.
+func ToolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && (version == "" || version == "(devel)") {
+			version = s.Value
+		}
+	}
+	if version == "" {
+		return "(devel)"
+	}
+	return version
+}
+
+// Versions returns the versions of the tool, libraries, and models used by this
+// Analyzer, keyed by component name.
+func (a *Analyzer) Versions() map[string]string {
+	versions := map[string]string{
+		"mixxxlab": ToolVersion(),
+		"qm-dsp":   QMVersion(),
+	}
+	for _, g := range a.grids {
+		if _, ok := g.(*BeatThisAnalyzer); ok {
+			versions["onnxruntime"] = ort.GetVersion()
+		}
+		if v, ok := g.(interface{ Version() string }); ok {
+			versions[g.Name()] = v.Version()
+		}
+	}
+	return versions
+}
+
 // AnalyzeFileWithPath analyzes a single audio file with all available analyzers.
 func (a *Analyzer) AnalyzeFileWithPath(audioPath string) (*TrackAnalysis, error) {
+	return a.AnalyzeFileWithContext(context.Background(), audioPath)
+}
+
+// AnalyzeFileWithContext is AnalyzeFileWithPath with cancellation. ctx is checked
+// before each analyzer stage, and ctx.Err() is returned as soon as it is cancelled;
+// a stage that is already running finishes first. Progress is reported to a
+// callback set with WithProgress.
+func (a *Analyzer) AnalyzeFileWithContext(ctx context.Context, audioPath string) (*TrackAnalysis, error) {
+	ctx, progress := startProgress(ctx, a.fileStages())
 	result := &TrackAnalysis{
-		File:    filepath.Base(audioPath),
-		Grids:   make(map[string]*GridAnalysis),
-		Markers: make(map[string]*MarkerAnalysis),
+		File:     filepath.Base(audioPath),
+		Grids:    make(map[string]*GridAnalysis),
+		Markers:  make(map[string]*MarkerAnalysis),
+		Versions: a.Versions(),
+		Timings:  make(map[string]float64),
+
+		SchemaVersion:   CurrentSchemaVersion,
+		AnalyzerVersion: AnalyzerVersion,
+	}
+	if a.enabled(AnalyzerMixxExtended) || a.stems != nil {
+		result.QMConfig = a.effectiveQMConfig()
+	}
+	if hash, err := ContentHash(audioPath, false); err == nil {
+		result.ContentHash = hash
+	}
+	if w := audioFormatWarning(audioPath); w != "" {
+		result.Warnings = append(result.Warnings, w)
 	}
 
-	// Run qm-dsp analyzer (CGO) - basic output
-	if qmResult, err := AnalyzeFile(audioPath); err != nil {
-		result.Grids[string(AnalyzerMixx)] = &GridAnalysis{Error: err.Error()}
-	} else {
-		result.Duration = qmResult.Duration
-		result.SampleRate = qmResult.SampleRate
-		result.Grids[string(AnalyzerMixx)] = &GridAnalysis{
-			BPM:   qmResult.BPM,
-			Beats: qmResult.Beats,
+	// Run qm-dsp-extended analyzer (CGO) - full two-stage Mixxx process with segmentation
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// Decoded audio, shared with the waveform, key, and loudness when mixx-extended
+	// streams it for progress or the grid analyzers run
+	var samples []float32
+	var sampleRate int
+	var loadErr error
+
+	// Trimming silence needs the decoded audio before any grid analyzer runs.
+	// Grids are analyzed on gridSamples and shifted back by the leading silence.
+	var gridSamples []float32
+	if a.trimSilence {
+		start := time.Now()
+		samples, sampleRate, loadErr = LoadAudioMono(audioPath)
+		result.Timings[TimingDecode] = secondsSince(start)
+		if loadErr == nil {
+			result.Duration = FramesToSeconds(len(samples), float64(sampleRate))
+			result.SampleRate = sampleRate
+			var lead, trail float64
+			gridSamples, lead, trail = TrimSilence(samples, sampleRate, a.silenceDB)
+			result.TrimmedLeading, result.TrimmedTrailing = Seconds(lead), Seconds(trail)
 		}
 	}
+	lead := float64(result.TrimmedLeading)
 
-	// Run qm-dsp-extended analyzer (CGO) - full two-stage Mixxx process with segmentation
-	segConfig := DefaultSegmenterConfig()
-	if qmExResult, err := AnalyzeFileQMFull(audioPath, nil, &segConfig); err != nil {
-		result.Grids[string(AnalyzerMixxExtended)] = &GridAnalysis{Error: err.Error()}
-	} else {
-		if result.Duration == 0 {
-			result.Duration = qmExResult.Duration
-			result.SampleRate = qmExResult.SampleRate
-		}
-
-		// Grid analysis
-		result.Grids[string(AnalyzerMixxExtended)] = &GridAnalysis{
-			BPM:               qmExResult.BPM,
-			Beats:             qmExResult.Beats,
-			DetectionFunction: qmExResult.DetectionFunction,
-			BeatPeriods:       qmExResult.BeatPeriods,
-			StepSizeFrames:    qmExResult.StepSizeFrames,
-			WindowSize:        qmExResult.WindowSize,
-			Downbeats:         qmExResult.Downbeats,
-		}
-
-		// Convert cues from QM beat analysis for markers
-		var cues []CuePoint
-		for _, cue := range qmExResult.Cues {
-			cueType := "unknown"
-			switch cue.Type {
-			case CueTypeDownbeat:
-				cueType = "downbeat"
-			case CueTypePhrase:
-				cueType = "phrase"
-			case CueTypeSection:
-				cueType = "section"
-			case CueTypeEnergy:
-				cueType = "energy"
+	if a.enabled(AnalyzerMixxExtended) {
+		progress.begin(string(AnalyzerMixxExtended))
+		segConfig := DefaultSegmenterConfig()
+		start := time.Now()
+		var qmExResult *QMResult
+		var err error
+		switch {
+		case !a.trimSilence:
+			qmExResult, err = a.analyzeFileQMFull(ctx, audioPath, &segConfig)
+		case loadErr != nil:
+			err = fmt.Errorf("failed to load audio: %w", loadErr)
+		default:
+			qmExResult, err = AnalyzeSamplesQMContext(ctx, gridSamples, sampleRate, a.qmConfig, &segConfig)
+		}
+		result.Timings[string(AnalyzerMixxExtended)] = secondsSince(start)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err != nil {
+			result.Grids[string(AnalyzerMixxExtended)] = &GridAnalysis{Error: err.Error()}
+		} else {
+			if result.Duration == 0 {
+				result.Duration = qmExResult.Duration
+				result.SampleRate = qmExResult.SampleRate
+			}
+
+			grid := a.qmGrid(qmExResult)
+			shiftGrid(grid, lead)
+			result.Grids[string(AnalyzerMixxExtended)] = grid
+			cues := qmCuePoints(qmExResult)
+			segments := qmSegments(qmExResult, segConfig.NumClusters)
+			if len(cues) > 0 || len(segments) > 0 {
+				result.Markers["beats"] = &MarkerAnalysis{CuePoints: cues, Segments: segments}
+				shiftMarkers(result.Markers["beats"], lead)
 			}
-			cues = append(cues, CuePoint{
-				Time:       cue.Time,
-				Type:       cueType,
-				Confidence: cue.Confidence,
-				Name:       fmt.Sprintf("%s-%d", cueType, cue.TypeIndex),
-			})
 		}
-		if len(cues) > 0 {
-			result.Markers["beats"] = &MarkerAnalysis{CuePoints: cues}
+	}
+
+	// Run the registered grid analyzers on audio decoded once for all of them
+	grids := a.gridAnalyzers()
+	if len(grids) > 0 && samples == nil && !a.trimSilence {
+		start := time.Now()
+		samples, sampleRate, loadErr = LoadAudioMono(audioPath)
+		result.Timings[TimingDecode] = secondsSince(start)
+		if loadErr == nil && result.Duration == 0 {
+			result.Duration = FramesToSeconds(len(samples), float64(sampleRate))
+			result.SampleRate = sampleRate
+		} else if loadErr == nil {
+			// mixx-extended read the file with libsndfile, so its duration
+			// is an independent check on our decoder's sample rate
+			result.Warnings = append(result.Warnings, SampleRateWarnings(len(samples), sampleRate, result.Duration)...)
+		}
+	}
+	if !a.trimSilence {
+		gridSamples = samples
+	}
+	for _, g := range grids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		progress.begin(g.Name())
+		if loadErr != nil {
+			result.Grids[g.Name()] = &GridAnalysis{Error: fmt.Sprintf("failed to load audio: %v", loadErr)}
+		} else {
+			start := time.Now()
+			grid := analyzeGrid(g, gridSamples, sampleRate)
+			shiftGrid(grid, lead)
+			result.Grids[g.Name()] = grid
+			result.Timings[g.Name()] = secondsSince(start)
 		}
 	}
 
 	// Run ML Python analyzer
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if a.mlPython != nil {
-		if mlResult, err := a.mlPython.AnalyzeFile(audioPath); err != nil {
+		progress.begin(string(AnalyzerRekordboxPy))
+		start := time.Now()
+		mlResult, err := a.mlPython.AnalyzeFile(audioPath)
+		result.Timings[string(AnalyzerRekordboxPy)] = secondsSince(start)
+		if err != nil {
 			result.Grids[string(AnalyzerRekordboxPy)] = &GridAnalysis{Error: err.Error()}
 		} else {
 			if result.Duration == 0 {
@@ -224,104 +492,474 @@ func (a *Analyzer) AnalyzeFileWithPath(audioPath string) (*TrackAnalysis, error)
 				result.SampleRate = mlResult.SampleRate
 			}
 			result.Grids[string(AnalyzerRekordboxPy)] = &GridAnalysis{
-				BPM:   mlResult.BPM,
-				Beats: mlResult.Beats,
+				BPM:                mlResult.BPM,
+				Beats:              mlResult.Beats,
+				Warnings:           withDurationCheck(mlResult.Warnings, mlResult.Duration, result.Duration),
+				AnalysisSampleRate: rekordboxSampleRate,
 			}
 		}
 	}
 
-	// Run TensorFlow Go analyzer
-	if a.tfGo != nil {
-		if tfResult, err := a.tfGo.AnalyzeFile(audioPath); err != nil {
-			result.Grids[string(AnalyzerRekordboxGo)] = &GridAnalysis{Error: err.Error()}
-		} else {
-			if result.Duration == 0 {
-				result.Duration = tfResult.Duration
-				result.SampleRate = tfResult.SampleRate
-			}
-			result.Grids[string(AnalyzerRekordboxGo)] = &GridAnalysis{
-				BPM:   tfResult.BPM,
-				Beats: tfResult.Beats,
-			}
-		}
+	// Run qm-dsp-extended on the Demucs drum stem
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if a.stems != nil {
+		progress.begin(string(AnalyzerMixxDrums))
+		start := time.Now()
+		result.Grids[string(AnalyzerMixxDrums)] = a.analyzeDrumStem(audioPath)
+		result.Timings[string(AnalyzerMixxDrums)] = secondsSince(start)
 	}
 
-	// Run beat_this analyzer (small model)
-	if a.beatThis != nil {
-		if btResult, err := a.beatThis.AnalyzeFile(audioPath); err != nil {
-			result.Grids[string(AnalyzerBeatThis)] = &GridAnalysis{Error: err.Error()}
-		} else {
-			if result.Duration == 0 {
-				result.Duration = btResult.Duration
-				result.SampleRate = btResult.SampleRate
-			}
-			result.Grids[string(AnalyzerBeatThis)] = &GridAnalysis{
-				BPM:       btResult.BPM,
-				Beats:     btResult.Beats,
-				Downbeats: btResult.Downbeats,
-			}
+	if len(result.Grids) == 0 {
+		return nil, fmt.Errorf("no grid analyzers available")
+	}
+
+	// Read tag metadata and flag BPM tags that disagree with the detected BPM
+	if md, err := ReadMetadata(audioPath); err == nil && *md != (TrackMetadata{}) {
+		if g := result.DefaultGrid(nil); g != nil {
+			md.CheckBPM(g.BPM)
 		}
+		result.Metadata = md
 	}
 
-	// Run beat_this analyzer (full model)
-	if a.beatThisFull != nil {
-		if btResult, err := a.beatThisFull.AnalyzeFile(audioPath); err != nil {
-			result.Grids[string(AnalyzerBeatThisFull)] = &GridAnalysis{Error: err.Error()}
+	// Decode once for the waveform, key, and loudness. Without audio only the
+	// waveform failure is reported, as the others fail for the same reason.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	progress.begin("audio")
+	var err error
+	if samples == nil {
+		start := time.Now()
+		samples, sampleRate, err = LoadAudioMono(audioPath)
+		result.Timings[TimingDecode] += secondsSince(start)
+	}
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("could not generate waveform: load audio: %v", err))
+	} else {
+		// Generate waveform data
+		if waveform, err := waveformFromSamples(samples, sampleRate, 100, WaveformOptions{}); err != nil { // 100 pixels per second
+			result.Warnings = append(result.Warnings, fmt.Sprintf("could not generate waveform: %v", err))
 		} else {
-			if result.Duration == 0 {
-				result.Duration = btResult.Duration
-				result.SampleRate = btResult.SampleRate
+			result.Waveform = waveform
+		}
+		if len(a.waveformLvls) > 0 {
+			if levels, err := waveformPyramidFromSamples(samples, sampleRate, a.waveformLvls); err != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("could not generate waveform levels: %v", err))
+			} else {
+				result.WaveformLevels = levels
 			}
-			result.Grids[string(AnalyzerBeatThisFull)] = &GridAnalysis{
-				BPM:       btResult.BPM,
-				Beats:     btResult.Beats,
-				Downbeats: btResult.Downbeats,
+		}
+
+		// Detect musical key
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if a.key != nil {
+			if key, err := a.key.AnalyzeSamples(samples, sampleRate); err != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("could not detect key: %v", err))
+			} else {
+				result.Key = key
 			}
 		}
-	}
 
-	if len(result.Grids) == 0 {
-		return nil, fmt.Errorf("no grid analyzers available")
+		// Measure loudness
+		if loudness, err := MeasureLoudness(samples, sampleRate); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("could not measure loudness: %v", err))
+		} else {
+			result.Loudness = loudness
+		}
 	}
 
-	// Generate waveform data
-	waveform, err := GenerateWaveform(audioPath, 100) // 100 pixels per second
-	if err != nil {
-		fmt.Printf("  Warning: could not generate waveform: %v\n", err)
-	} else {
-		result.Waveform = waveform
-	}
+	a.finishGrids(result)
 
 	// Detect cue points with Mixx analyzer (SampleCNN features)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if a.cue != nil {
-		if cueResult, err := a.cue.AnalyzeFile(audioPath, 8, 8.0); err != nil {
-			fmt.Printf("  Warning: could not detect cue points: %v\n", err)
+		progress.begin("cues")
+		start := time.Now()
+		cueResult, err := a.cue.AnalyzeFile(audioPath, 8, 8.0)
+		result.Timings["cues"] = secondsSince(start)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("could not detect cue points: %v", err))
 		} else {
-			result.Markers["mixx"] = &MarkerAnalysis{CuePoints: cueResult.CuePoints}
+			result.Markers["mixx"] = &MarkerAnalysis{CuePoints: a.snapToGrid(result, cueResult.CuePoints)}
 		}
 	}
 
 	// Analyze music structure (phrases/sections) with SongFormer
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if a.songformer != nil {
-		if sfResult, err := a.songformer.AnalyzeFile(audioPath); err != nil {
-			fmt.Printf("  Warning: could not analyze music structure: %v\n", err)
+		progress.begin("structure")
+		start := time.Now()
+		sfResult, err := a.songformer.AnalyzeFile(audioPath)
+		result.Timings["structure"] = secondsSince(start)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("could not analyze music structure: %v", err))
 		} else {
 			result.Markers["songformer"] = &MarkerAnalysis{Phrases: sfResult.Phrases}
 		}
 	}
 
+	// Combine overlapping markers from multiple sources
+	if a.mergeMarkers > 0 && len(result.Markers) > 1 {
+		result.Markers[MarkerMerged] = MergeMarkers(result.Markers, a.mergeMarkers)
+	}
+
+	progress.finish()
 	return result, nil
 }
 
+// fileStages returns the number of progress stages AnalyzeFileWithContext runs:
+// one per enabled analyzer, plus decoded audio, cues, and structure.
+func (a *Analyzer) fileStages() int {
+	stages := 1 + len(a.gridAnalyzers()) // Waveform, key, and loudness
+	for _, on := range []bool{
+		a.enabled(AnalyzerMixxExtended),
+		a.mlPython != nil,
+		a.stems != nil,
+		a.cue != nil,
+		a.songformer != nil,
+	} {
+		if on {
+			stages++
+		}
+	}
+	return stages
+}
+
+// analyzeFileQMFull runs the full two-stage QM-DSP analysis of a file, read
+// with libsndfile in a single CGO call. With progress tracked in ctx, the
+// stage reports the fraction of frames processed.
+func (a *Analyzer) analyzeFileQMFull(ctx context.Context, audioPath string, segConfig *SegmenterConfig) (*QMResult, error) {
+	progress := progressFrom(ctx)
+	if progress == nil {
+		return AnalyzeFileQMFull(audioPath, a.qmConfig, segConfig)
+	}
+	cfg := DefaultQMConfig()
+	if a.qmConfig != nil {
+		cfg = *a.qmConfig
+	}
+	next := cfg.ProgressFunc
+	cfg.ProgressFunc = func(processed, total int64) {
+		if total > 0 {
+			progress.update(float64(processed) / float64(total))
+		}
+		if next != nil {
+			next(processed, total)
+		}
+	}
+	return AnalyzeFileQMFull(audioPath, &cfg, segConfig)
+}
+
+// AnalyzeLoaded runs grid analyzers on already-decoded mono samples so callers
+// (e.g. tests) can share one decode across analyzers. If analyzers is empty, all
+// available analyzers that accept samples are run.
+//
+// mixx-extended and the registered grid analyzers (mixx, rekordbox-go, beatthis,
+// beatthis-full, and custom ones) accept samples. rekordbox-py runs as a Python subprocess and requires a file path, so it is
+// reported as a grid error; cue and structure markers are not produced.
+func (a *Analyzer) AnalyzeLoaded(samples []float32, sampleRate int, analyzers []AnalyzerType) (*TrackAnalysis, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	if len(analyzers) == 0 {
+		if a.enabled(AnalyzerMixxExtended) {
+			analyzers = append(analyzers, AnalyzerMixxExtended)
+		}
+		for _, g := range a.gridAnalyzers() {
+			analyzers = append(analyzers, AnalyzerType(g.Name()))
+		}
+	}
+
+	duration := FramesToSeconds(len(samples), float64(sampleRate))
+	result := &TrackAnalysis{
+		SchemaVersion: CurrentSchemaVersion,
+		Duration:      duration,
+		SampleRate:    sampleRate,
+		Grids:         make(map[string]*GridAnalysis),
+		Markers:       make(map[string]*MarkerAnalysis),
+	}
+
+	// Grids are analyzed without the silent intro and outro if configured,
+	// and shifted back by the leading silence
+	gridSamples := samples
+	if a.trimSilence {
+		var lead, trail float64
+		gridSamples, lead, trail = TrimSilence(samples, sampleRate, a.silenceDB)
+		result.TrimmedLeading, result.TrimmedTrailing = Seconds(lead), Seconds(trail)
+	}
+	lead := float64(result.TrimmedLeading)
+
+	for _, at := range analyzers {
+		switch at {
+		case AnalyzerMixxExtended:
+			segConfig := DefaultSegmenterConfig()
+			if qmExResult, err := AnalyzeSamplesQM(gridSamples, sampleRate, a.qmConfig, &segConfig); err != nil {
+				result.Grids[string(at)] = &GridAnalysis{Error: err.Error()}
+			} else {
+				grid := a.qmGrid(qmExResult)
+				shiftGrid(grid, lead)
+				result.Grids[string(at)] = grid
+				cues := qmCuePoints(qmExResult)
+				segments := qmSegments(qmExResult, segConfig.NumClusters)
+				if len(cues) > 0 || len(segments) > 0 {
+					result.Markers["beats"] = &MarkerAnalysis{CuePoints: cues, Segments: segments}
+					shiftMarkers(result.Markers["beats"], lead)
+				}
+			}
+
+		case AnalyzerRekordboxPy:
+			result.Grids[string(at)] = &GridAnalysis{Error: "rekordbox-py requires a file path"}
+
+		default:
+			grids := a.gridAnalyzers()
+			i := slices.IndexFunc(grids, func(g GridAnalyzer) bool { return g.Name() == string(at) })
+			if i < 0 {
+				if isRegisteredGridAnalyzer(at) {
+					continue // Not available, e.g. its model isn't installed
+				}
+				return nil, fmt.Errorf("unknown analyzer: %s", at)
+			}
+			grid := analyzeGrid(grids[i], gridSamples, sampleRate)
+			shiftGrid(grid, lead)
+			result.Grids[string(at)] = grid
+		}
+	}
+
+	if waveform, err := waveformFromSamples(samples, sampleRate, 100, WaveformOptions{}); err == nil {
+		result.Waveform = waveform
+	}
+	a.finishGrids(result)
+
+	return result, nil
+}
+
+// finishGrids derives everything that depends on the analyzed grids, so
+// AnalyzeFileWithContext and AnalyzeLoaded results have the same shape.
+func (a *Analyzer) finishGrids(result *TrackAnalysis) {
+	// Drop non-finite values that would break JSON encoding
+	for _, g := range result.Grids {
+		sanitizeGrid(g)
+	}
+
+	// Flag analyzers that disagree by a tempo octave
+	result.TempoWarnings = TempoWarnings(result.Grids, a.tempoOctaveTolerance())
+
+	// Vote a single best-guess grid from the analyzers
+	if g := ConsensusGrid(result.Grids); g != nil {
+		result.Grids[string(AnalyzerConsensus)] = g
+	}
+
+	// Estimate bars for analyzers that only report beats
+	deriveMissingDownbeats(result, a.beatsPerBar())
+
+	// Pick the true bar-one for grids with downbeats, using waveform energy
+	applyDownbeatOne(result)
+	anchorGrids(result)
+	a.addPhraseMarkers(result)
+	result.Confidence = TrackConfidence(result)
+}
+
+// analyzeGrid runs g, reporting a failure as the grid's error.
+func analyzeGrid(g GridAnalyzer, samples []float32, sampleRate int) *GridAnalysis {
+	grid, err := g.Analyze(samples, sampleRate)
+	if err == nil && grid == nil {
+		err = errors.New("no grid")
+	}
+	if err != nil {
+		return &GridAnalysis{Error: err.Error()}
+	}
+	return grid
+}
+
+// qmExtendedGrid converts a full two-stage QM-DSP result into a grid analysis.
+func qmExtendedGrid(r *QMResult) *GridAnalysis {
+	return &GridAnalysis{
+		BPM:                r.BPM,
+		Beats:              r.Beats,
+		AnalysisSampleRate: r.SampleRate,
+		DetectionFunction:  r.DetectionFunction,
+		BeatPeriods:        r.BeatPeriods,
+		ModalBPM:           ModalBPM(r.BeatPeriods, r),
+		StepSizeFrames:     r.StepSizeFrames,
+		WindowSize:         r.WindowSize,
+		Downbeats:          r.Downbeats,
+		BeatsPerBar:        r.BeatsPerBar,
+		BeatConfidence:     r.BeatConfidence,
+	}
+}
+
+// qmGrid converts a full QM-DSP result like qmExtendedGrid, adding the tempo
+// curve when variable tempo is configured.
+func (a *Analyzer) qmGrid(r *QMResult) *GridAnalysis {
+	g := qmExtendedGrid(r)
+	if a.varTempo {
+		g.TempoCurve = r.TempoCurve()
+	}
+	return g
+}
+
+// qmCuePoints converts cues from QM beat analysis into marker cue points.
+func qmCuePoints(r *QMResult) []CuePoint {
+	var cues []CuePoint
+	for _, cue := range r.Cues {
+		cueType := "unknown"
+		switch cue.Type {
+		case CueTypeDownbeat:
+			cueType = "downbeat"
+		case CueTypePhrase:
+			cueType = "phrase"
+		case CueTypeSection:
+			cueType = "section"
+		case CueTypeEnergy:
+			cueType = "energy"
+		}
+		cues = append(cues, CuePoint{
+			Time:       cue.Time,
+			Type:       cueType,
+			Confidence: cue.Confidence,
+			Name:       fmt.Sprintf("%s-%d", cueType, cue.TypeIndex),
+			Color:      CueColor(cueType),
+		})
+	}
+	return cues
+}
+
+// applyDownbeatOne picks the true bar-one for grids with downbeats, using waveform energy.
+func applyDownbeatOne(result *TrackAnalysis) {
+	if result.Waveform == nil {
+		return
+	}
+	for _, g := range result.Grids {
+		if len(g.Downbeats) == 0 {
+			continue
+		}
+		downbeatTimes := make([]float64, 0, len(g.Downbeats))
+		for _, idx := range g.Downbeats {
+			if idx >= 0 && idx < len(g.Beats) {
+				downbeatTimes = append(downbeatTimes, g.Beats[idx])
+			}
+		}
+		energy := WaveformBeatEnergy(result.Waveform, g.Beats)
+		g.DownbeatOne = Seconds(FindDownbeatOne(g.Beats, downbeatTimes, energy))
+	}
+}
+
+// snapToGrid snaps cues to the configured grid lines of the default grid.
+func (a *Analyzer) snapToGrid(result *TrackAnalysis, cues []CuePoint) []CuePoint {
+	g := result.DefaultGrid(nil)
+	if a.snapCues == "" || g == nil {
+		return cues
+	}
+	return SnapCuesToGrid(cues, g.Beats, g.Downbeats, a.snapCues)
+}
+
+// addPhraseMarkers adds bar-phrase cues from the default grid's downbeats.
+func (a *Analyzer) addPhraseMarkers(result *TrackAnalysis) {
+	bars := a.phraseBars
+	if bars == 0 {
+		bars = DefaultPhraseBars
+	}
+	g := result.DefaultGrid(nil)
+	if g == nil {
+		return
+	}
+	if cues := DerivePhraseMarkers(g.Downbeats, g.Beats, bars); len(cues) > 0 {
+		result.Markers[MarkerPhrases] = &MarkerAnalysis{CuePoints: cues}
+	}
+}
+
+// anchorGrids sets the FirstDownbeat of each grid with beats.
+func anchorGrids(result *TrackAnalysis) {
+	for _, g := range result.Grids {
+		g.FirstDownbeat, _ = computeGridAnchor(g)
+	}
+}
+
+// deriveMissingDownbeats fills in downbeats from waveform beat energy for grids
+// whose analyzer reported beats without downbeats.
+func deriveMissingDownbeats(result *TrackAnalysis, beatsPerBar int) {
+	if result.Waveform == nil {
+		return
+	}
+	for _, g := range result.Grids {
+		if len(g.Beats) == 0 || len(g.Downbeats) > 0 {
+			continue
+		}
+		energy := WaveformBeatEnergy(result.Waveform, g.Beats)
+		g.Downbeats = DeriveDownbeats(g.Beats, beatsPerBar, energy)
+		g.BeatsPerBar = beatsPerBar
+	}
+}
+
+// effectiveQMConfig returns a copy of the QM-DSP configuration the analyzer
+// runs with, the defaults if none was set.
+func (a *Analyzer) effectiveQMConfig() *QMConfig {
+	cfg := DefaultQMConfig()
+	if a.qmConfig != nil {
+		cfg = *a.qmConfig
+	}
+	return &cfg
+}
+
+// beatsPerBar returns the configured bar length for downbeat detection.
+func (a *Analyzer) beatsPerBar() int {
+	if a.qmConfig != nil {
+		return a.qmConfig.BeatsPerBar
+	}
+	return DefaultQMConfig().BeatsPerBar
+}
+
+// tempoOctaveTolerance returns the configured tempo octave warning tolerance.
+func (a *Analyzer) tempoOctaveTolerance() float64 {
+	if a.octaveTol > 0 {
+		return a.octaveTol
+	}
+	return DefaultTempoOctaveTolerance
+}
+
+// secondsSince returns the wall-clock time since start in seconds, to the
+// millisecond.
+func secondsSince(start time.Time) float64 {
+	return math.Round(time.Since(start).Seconds()*1000) / 1000
+}
+
+// withDurationCheck appends a warning if an analyzer's decoded duration disagrees
+// with the reference duration reported by libsndfile.
+func withDurationCheck(warnings []string, duration, reference Seconds) []string {
+	if w := durationMismatchWarning(duration, reference); w != "" {
+		warnings = append(warnings, w+" - check the decoder sample rate")
+	}
+	return warnings
+}
+
 // GenerateWaveform creates downsampled waveform data for visualization.
 // pixelsPerSec controls the resolution (e.g., 100 = 100 data points per second).
 func GenerateWaveform(audioPath string, pixelsPerSec int) (*Waveform, error) {
+	return GenerateWaveformWithOptions(audioPath, pixelsPerSec, WaveformOptions{})
+}
+
+// GenerateWaveformWithOptions is GenerateWaveform with optional data such as
+// the RMS envelope.
+func GenerateWaveformWithOptions(audioPath string, pixelsPerSec int, opts WaveformOptions) (*Waveform, error) {
 	// Load audio samples
 	samples, sampleRate, err := LoadAudioMono(audioPath)
 	if err != nil {
 		return nil, fmt.Errorf("load audio: %w", err)
 	}
 
+	return waveformFromSamples(samples, sampleRate, pixelsPerSec, opts)
+}
+
+// waveformFromSamples downsamples decoded mono samples into peak/trough pairs,
+// and RMS levels if requested.
+func waveformFromSamples(samples []float32, sampleRate, pixelsPerSec int, opts WaveformOptions) (*Waveform, error) {
 	// Calculate samples per pixel
 	samplesPerPixel := sampleRate / pixelsPerSec
 	if samplesPerPixel < 1 {
@@ -335,6 +973,10 @@ func GenerateWaveform(audioPath string, pixelsPerSec int) (*Waveform, error) {
 
 	peaks := make([]float64, numPixels)
 	troughs := make([]float64, numPixels)
+	var rms []float64
+	if opts.RMS {
+		rms = make([]float64, numPixels)
+	}
 
 	for i := 0; i < numPixels; i++ {
 		start := i * samplesPerPixel
@@ -356,20 +998,148 @@ func GenerateWaveform(audioPath string, pixelsPerSec int) (*Waveform, error) {
 
 		peaks[i] = float64(maxVal)
 		troughs[i] = float64(minVal)
+
+		if rms != nil {
+			var sumSq float64
+			for _, s := range samples[start:end] {
+				sumSq += float64(s) * float64(s)
+			}
+			rms[i] = min(math.Sqrt(sumSq/float64(end-start)), 1)
+		}
 	}
 
 	return &Waveform{
 		PixelsPerSec: pixelsPerSec,
 		Peaks:        peaks,
 		Troughs:      troughs,
+		RMS:          rms,
 	}, nil
 }
 
+// Output formats supported by AnalyzeDirWithOptions in addition to JSON sidecars.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// AnalyzeDirOptions controls how AnalyzeDirWithOptions processes a directory.
+type AnalyzeDirOptions struct {
+	// Force re-analyzes files even if an up-to-date JSON sidecar exists. A
+	// sidecar is up to date when its AnalyzerVersion is current and its
+	// ContentHash matches the audio.
+	Force bool `yaml:"force"`
+
+	// NoRefresh skips files with any existing JSON sidecar, even if the audio
+	// file has changed since it was analyzed.
+	NoRefresh bool `yaml:"no_refresh"`
+
+	// Rehash hashes whole audio files with SHA-256 instead of sampling their
+	// size and ends. Sidecars with a sampled hash are re-analyzed.
+	Rehash bool `yaml:"rehash"`
+
+	// FailFast returns the first per-file analysis error, including a grid
+	// analyzer error, instead of logging it and continuing with the remaining files.
+	FailFast bool `yaml:"fail_fast"`
+
+	// Format is FormatJSON (sidecars only) or FormatCSV, which additionally
+	// writes analysis.csv in dir with one row per track.
+	Format string `yaml:"format"`
+
+	// Manifest keeps a library.json index of every analyzed track in dir,
+	// rewritten as each file is analyzed.
+	Manifest bool `yaml:"manifest"`
+
+	// MinConfidence flags tracks whose TrackConfidence is below it with
+	// NeedsReview, for a manual review queue. Zero disables flagging.
+	MinConfidence float64 `yaml:"min_confidence"`
+}
+
+// gridError returns the first grid analyzer error in name order, or nil.
+func (ta *TrackAnalysis) gridError() error {
+	names := make([]string, 0, len(ta.Grids))
+	for name := range ta.Grids {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if g := ta.Grids[name]; g.Error != "" {
+			return fmt.Errorf("%s: %s", name, g.Error)
+		}
+	}
+	return nil
+}
+
 // AnalyzeDir recursively analyzes all audio files in a directory.
 // For each audio file, it creates a corresponding .json sidecar file.
-// If force is true, existing JSON files are overwritten.
+// Existing JSON files are kept unless the audio file has been modified since;
+// if force is true, they are always overwritten.
 func (a *Analyzer) AnalyzeDir(dir string, force bool) error {
-	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+	return a.AnalyzeDirWithOptions(dir, AnalyzeDirOptions{Force: force})
+}
+
+// AnalyzeDirWithOptions recursively analyzes all audio files in a directory
+// and writes a .json sidecar for each, plus any additional output format.
+func (a *Analyzer) AnalyzeDirWithOptions(dir string, opts AnalyzeDirOptions) error {
+	return a.AnalyzeDirWithContext(context.Background(), dir, opts)
+}
+
+// AnalyzeDirWithContext is AnalyzeDirWithOptions with cancellation. Once ctx is
+// cancelled, the current file is abandoned without writing its sidecar and
+// ctx.Err() is returned.
+func (a *Analyzer) AnalyzeDirWithContext(ctx context.Context, dir string, opts AnalyzeDirOptions) error {
+	var csvOut *csv.Writer
+	switch opts.Format {
+	case "", FormatJSON:
+	case FormatCSV:
+		f, err := os.Create(filepath.Join(dir, "analysis.csv"))
+		if err != nil {
+			return fmt.Errorf("create CSV: %w", err)
+		}
+		defer f.Close()
+
+		csvOut = csv.NewWriter(f)
+		defer csvOut.Flush()
+		if err := csvOut.Write(csvHeader()); err != nil {
+			return fmt.Errorf("write CSV: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported format: %s", opts.Format)
+	}
+
+	// appendCSV adds a track row to the CSV output, if enabled
+	appendCSV := func(ta *TrackAnalysis) error {
+		if csvOut == nil {
+			return nil
+		}
+		if err := csvOut.Write(csvRow(ta)); err != nil {
+			return fmt.Errorf("write CSV: %w", err)
+		}
+		csvOut.Flush()
+		return csvOut.Error()
+	}
+
+	var manifest *Manifest
+	seen := make(map[string]bool)
+	if opts.Manifest {
+		var err error
+		if manifest, err = ReadManifest(dir); err != nil {
+			return fmt.Errorf("read manifest: %w", err)
+		}
+	}
+
+	// updateManifest records a track in the manifest, if enabled
+	updateManifest := func(path, jsonPath string, ta *TrackAnalysis) error {
+		if manifest == nil {
+			return nil
+		}
+		manifest.Update(dir, path, jsonPath, ta)
+		if err := manifest.Write(dir); err != nil {
+			return fmt.Errorf("write manifest: %w", err)
+		}
+		return nil
+	}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -383,22 +1153,51 @@ func (a *Analyzer) AnalyzeDir(dir string, force bool) error {
 			return nil
 		}
 
-		// Check if JSON already exists
+		// Check if JSON already exists for the same audio content and analyzer version
 		jsonPath := strings.TrimSuffix(path, ext) + ".json"
-		if !force {
+		seen[manifestPath(dir, path)] = true
+		if !opts.Force {
 			if _, err := os.Stat(jsonPath); err == nil {
-				fmt.Printf("Skipping %s (already analyzed)\n", filepath.Base(path))
-				return nil
+				if existing, upToDate := sidecarUpToDate(path, jsonPath, opts.Rehash); opts.NoRefresh || upToDate {
+					fmt.Printf("Skipping %s (already analyzed)\n", filepath.Base(path))
+					if existing != nil {
+						if err := appendCSV(existing); err != nil {
+							return err
+						}
+						return updateManifest(path, jsonPath, existing)
+					}
+					return nil
+				}
 			}
 		}
 
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		fmt.Printf("Analyzing %s...\n", filepath.Base(path))
 
-		analysis, err := a.AnalyzeFileWithPath(path)
+		analysis, err := a.AnalyzeFileWithContext(ctx, path)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
+			if opts.FailFast {
+				return fmt.Errorf("analyze %s: %w", path, err)
+			}
 			fmt.Printf("  Error: %v\n", err)
 			return nil // Continue with other files
 		}
+		if opts.FailFast {
+			if err := analysis.gridError(); err != nil {
+				return fmt.Errorf("analyze %s: %w", path, err)
+			}
+		}
+		analysis.NeedsReview = analysis.Confidence < opts.MinConfidence
+		if opts.Rehash {
+			if analysis.ContentHash, err = ContentHash(path, true); err != nil {
+				return err
+			}
+		}
 
 		// Write JSON sidecar
 		data, err := json.MarshalIndent(analysis, "", "  ")
@@ -410,8 +1209,28 @@ func (a *Analyzer) AnalyzeDir(dir string, force bool) error {
 			return fmt.Errorf("write JSON: %w", err)
 		}
 
+		if err := appendCSV(analysis); err != nil {
+			return err
+		}
+		if err := updateManifest(path, jsonPath, analysis); err != nil {
+			return err
+		}
+
 		// Print summary for each grid analyzer
+		for _, w := range analysis.Warnings {
+			fmt.Printf("  Warning: %s\n", w)
+		}
 		fmt.Printf("  Duration: %.1fs\n", analysis.Duration)
+		if g := analysis.DefaultGrid(nil); g != nil {
+			fmt.Printf("  BPM: %.1f\n", g.BPM)
+		}
+		if analysis.Key != nil {
+			fmt.Printf("  Key: %s (%s)\n", analysis.Key.Key, analysis.Key.Name)
+		}
+		if analysis.Loudness != nil {
+			fmt.Printf("  Loudness: %.1f LUFS, true peak %.1f dBTP, ReplayGain %+.2f dB\n",
+				analysis.Loudness.Integrated, analysis.Loudness.TruePeak, analysis.Loudness.ReplayGain)
+		}
 		fmt.Printf("  Grids:\n")
 		for name, g := range analysis.Grids {
 			if g.Error != "" {
@@ -420,6 +1239,19 @@ func (a *Analyzer) AnalyzeDir(dir string, force bool) error {
 				fmt.Printf("    %s: BPM=%.1f, Beats=%d\n", name, g.BPM, len(g.Beats))
 			}
 		}
+		if len(analysis.Timings) > 0 {
+			parts := []string{}
+			for _, name := range slices.Sorted(maps.Keys(analysis.Timings)) {
+				parts = append(parts, fmt.Sprintf("%s %.2fs", name, analysis.Timings[name]))
+			}
+			fmt.Printf("  Timings: %s\n", strings.Join(parts, ", "))
+		}
+		for _, w := range analysis.TempoWarnings {
+			fmt.Printf("  Tempo warning: %s\n", w)
+		}
+		if analysis.NeedsReview {
+			fmt.Printf("  Needs review: confidence %.2f below %.2f\n", analysis.Confidence, opts.MinConfidence)
+		}
 		if analysis.Waveform != nil {
 			fmt.Printf("  Waveform: %d samples at %d px/sec\n",
 				len(analysis.Waveform.Peaks), analysis.Waveform.PixelsPerSec)
@@ -444,6 +1276,16 @@ func (a *Analyzer) AnalyzeDir(dir string, force bool) error {
 
 		return nil
 	})
+	if err != nil || manifest == nil {
+		return err
+	}
+
+	// Drop tracks deleted since the manifest was last written
+	manifest.Retain(seen)
+	if err := manifest.Write(dir); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
 }
 
 // isSupportedAudio returns true if the file extension is a supported audio format.
@@ -456,6 +1298,48 @@ func isSupportedAudio(ext string) bool {
 	}
 }
 
+// ReadTrackAnalysis reads a JSON sidecar written by WriteJSON or AnalyzeDir,
+// migrating it to the current schema with ParseTrackAnalysis.
+func ReadTrackAnalysis(path string) (*TrackAnalysis, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ta, err := ParseTrackAnalysis(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return ta, nil
+}
+
+// DefaultGridPreference is the order in which grids are trusted when a single
+// authoritative BPM or beat grid is needed. A forced grid is a manual override,
+// so it comes first.
+var DefaultGridPreference = []AnalyzerType{
+	AnalyzerForced,
+	AnalyzerBeatThisFull,
+	AnalyzerBeatThis,
+	AnalyzerMixxExtended,
+	AnalyzerMixx,
+	AnalyzerRekordboxGo,
+	AnalyzerRekordboxPy,
+}
+
+// DefaultGrid returns the first available grid without an error in preference
+// order, or nil if none succeeded. A nil pref uses DefaultGridPreference.
+func (ta *TrackAnalysis) DefaultGrid(pref []AnalyzerType) *GridAnalysis {
+	if pref == nil {
+		pref = DefaultGridPreference
+	}
+	for _, name := range pref {
+		if g, ok := ta.Grids[string(name)]; ok && g.Error == "" {
+			return g
+		}
+	}
+	return nil
+}
+
 // WriteJSON writes the analysis to a JSON file.
 func (ta *TrackAnalysis) WriteJSON(path string) error {
 	data, err := json.MarshalIndent(ta, "", "  ")
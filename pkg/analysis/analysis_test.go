@@ -0,0 +1,257 @@
+package analysis
+
+import (
+	"context"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeDirRefresh(t *testing.T) {
+	dir := t.TempDir()
+	audioPath := filepath.Join(dir, "track.mp3")
+	jsonPath := filepath.Join(dir, "track.json")
+
+	// writeSidecar writes a marker sidecar for the current audio that
+	// re-analysis would replace
+	writeSidecar := func(version string) {
+		hash, err := ContentHash(audioPath, false)
+		require.NoError(t, err)
+		ta := &TrackAnalysis{
+			File:            "track.mp3",
+			Grids:           map[string]*GridAnalysis{string(AnalyzerMixx): {BPM: 120}},
+			ContentHash:     hash,
+			AnalyzerVersion: version,
+		}
+		require.NoError(t, ta.WriteJSON(jsonPath))
+	}
+	sidecarKept := func() bool {
+		ta, err := ReadTrackAnalysis(jsonPath)
+		require.NoError(t, err)
+		return ta.Grids[string(AnalyzerMixx)] != nil && ta.Grids[string(AnalyzerMixx)].BPM == 120
+	}
+
+	require.NoError(t, os.WriteFile(audioPath, []byte("original"), 0644))
+	writeSidecar(AnalyzerVersion)
+
+	a := &Analyzer{}
+	require.NoError(t, a.AnalyzeDir(dir, false))
+	assert.True(t, sidecarKept(), "up-to-date sidecar should be skipped")
+
+	// Touching the audio without changing it keeps the sidecar
+	now := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(audioPath, now, now))
+	require.NoError(t, a.AnalyzeDir(dir, false))
+	assert.True(t, sidecarKept(), "unchanged audio should be skipped")
+
+	// Re-encoding the audio under the same name makes the sidecar stale
+	require.NoError(t, os.WriteFile(audioPath, []byte("re-encoded"), 0644))
+	require.NoError(t, a.AnalyzeDirWithOptions(dir, AnalyzeDirOptions{NoRefresh: true}))
+	assert.True(t, sidecarKept(), "--no-refresh should keep stale sidecars")
+
+	require.NoError(t, a.AnalyzeDir(dir, false))
+	assert.False(t, sidecarKept(), "changed audio should be re-analyzed")
+	ta, err := ReadTrackAnalysis(jsonPath)
+	require.NoError(t, err)
+	assert.Equal(t, AnalyzerVersion, ta.AnalyzerVersion)
+	hash, err := ContentHash(audioPath, false)
+	require.NoError(t, err)
+	assert.Equal(t, hash, ta.ContentHash)
+
+	// So does a sidecar from another analyzer version
+	writeSidecar("0")
+	require.NoError(t, a.AnalyzeDir(dir, false))
+	assert.False(t, sidecarKept(), "old analyzer version should be re-analyzed")
+
+	// Rehashing replaces sampled hashes with full ones, then keeps them
+	writeSidecar(AnalyzerVersion)
+	require.NoError(t, a.AnalyzeDirWithOptions(dir, AnalyzeDirOptions{Rehash: true}))
+	assert.False(t, sidecarKept(), "sampled hash should be re-analyzed with --rehash")
+	ta, err = ReadTrackAnalysis(jsonPath)
+	require.NoError(t, err)
+	hash, err = ContentHash(audioPath, true)
+	require.NoError(t, err)
+	assert.Equal(t, hash, ta.ContentHash)
+
+	ta.Grids[string(AnalyzerMixx)] = &GridAnalysis{BPM: 120}
+	require.NoError(t, ta.WriteJSON(jsonPath))
+	require.NoError(t, a.AnalyzeDir(dir, false))
+	assert.True(t, sidecarKept(), "full hash should be checked in full")
+}
+
+func TestVersions(t *testing.T) {
+	// Without ONNX models only the tool and qm-dsp versions are recorded
+	v := (&Analyzer{}).Versions()
+	assert.Equal(t, QMVersion(), v["qm-dsp"])
+	assert.NotEmpty(t, v["mixxxlab"])
+	assert.NotContains(t, v, "onnxruntime")
+	assert.NotContains(t, v, string(AnalyzerBeatThis))
+
+	bt := &BeatThisAnalyzer{modelSize: "small", modelHash: "0123456789abcdef0123"}
+	assert.Equal(t, "small sha256:0123456789ab", bt.Version())
+	bt.modelHash = "0123"
+	assert.Equal(t, "small sha256:0123", bt.Version())
+	assert.Equal(t, " sha256:", (&BeatThisAnalyzer{}).Version())
+	bt.provider, bt.postProcess = BeatThisProviderCPU, PostProcessDBN
+	assert.Equal(t, "small sha256:0123 dbn cpu", bt.Version())
+}
+
+func TestAnalyzeFileQMConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "track.mp3")
+	require.NoError(t, os.WriteFile(path, []byte("not audio"), 0644))
+
+	// The QM settings are recorded when a QM grid analyzer runs
+	qm := DefaultQMConfig()
+	qm.DFType = DFTypeHFC
+	qm.InputTempo = 0
+	a := &Analyzer{analyzers: []AnalyzerType{AnalyzerMixxExtended}, qmConfig: &qm}
+	ta, err := a.AnalyzeFileWithPath(path)
+	require.NoError(t, err)
+	assert.Equal(t, &qm, ta.QMConfig)
+
+	// And survive a round trip through the sidecar
+	jsonPath := filepath.Join(dir, "track.json")
+	require.NoError(t, ta.WriteJSON(jsonPath))
+	data, err := os.ReadFile(jsonPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"df_type": "hfc"`)
+	assert.Contains(t, string(data), `"input_tempo": 0`)
+	read, err := ReadTrackAnalysis(jsonPath)
+	require.NoError(t, err)
+	assert.Equal(t, &qm, read.QMConfig)
+
+	a = &Analyzer{analyzers: []AnalyzerType{AnalyzerMixx}}
+	ta, err = a.AnalyzeFileWithPath(path)
+	require.NoError(t, err)
+	assert.Nil(t, ta.QMConfig)
+}
+
+func TestAnalyzeDirFailFast(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.mp3", "b.mp3"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("not audio"), 0644))
+	}
+
+	// Default continues past errors and writes sidecars recording them
+	a := &Analyzer{}
+	require.NoError(t, a.AnalyzeDir(dir, false))
+	assert.FileExists(t, filepath.Join(dir, "b.json"))
+
+	// Fail-fast stops at the first file
+	require.NoError(t, os.Remove(filepath.Join(dir, "a.json")))
+	require.NoError(t, os.Remove(filepath.Join(dir, "b.json")))
+	err := a.AnalyzeDirWithOptions(dir, AnalyzeDirOptions{FailFast: true})
+	assert.ErrorContains(t, err, "a.mp3")
+	assert.NoFileExists(t, filepath.Join(dir, "a.json"))
+	assert.NoFileExists(t, filepath.Join(dir, "b.json"))
+}
+
+func TestAnalyzeFileTimings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	writeSilentMonoMP3(t, path, 200)
+
+	// Each analyzer is timed, with the decode they share timed once
+	a := &Analyzer{analyzers: []AnalyzerType{"fake"}, grids: []GridAnalyzer{&fakeGridAnalyzer{}}}
+	ta, err := a.AnalyzeFileWithPath(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{TimingDecode, "fake"}, slices.Sorted(maps.Keys(ta.Timings)))
+	for name, secs := range ta.Timings {
+		assert.GreaterOrEqual(t, secs, 0.0, name)
+	}
+}
+
+func TestAnalyzeFileWarnings(t *testing.T) {
+	// An undecodable file can't produce a waveform
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	require.NoError(t, os.WriteFile(path, []byte("not audio"), 0644))
+
+	// Capture stdout, which the library must not write to
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stdout = w
+	a := &Analyzer{analyzers: []AnalyzerType{AnalyzerMixx}}
+	ta, err := a.AnalyzeFileWithPath(path)
+	os.Stdout = stdout
+	require.NoError(t, w.Close())
+	out, readErr := io.ReadAll(r)
+	require.NoError(t, readErr)
+
+	require.NoError(t, err)
+	require.Len(t, ta.Warnings, 1)
+	assert.Contains(t, ta.Warnings[0], "could not generate waveform")
+	assert.Empty(t, string(out))
+	assert.Equal(t, ta.Warnings, Compare(ta).Warnings)
+
+	// MP3 data with a .wav extension decodes, with a warning rather than output
+	path = filepath.Join(t.TempDir(), "track.wav")
+	writeSilentMonoMP3(t, path, 100)
+	r, w, err = os.Pipe()
+	require.NoError(t, err)
+	os.Stdout = w
+	ta, err = a.AnalyzeFileWithPath(path)
+	os.Stdout = stdout
+	require.NoError(t, w.Close())
+	out, readErr = io.ReadAll(r)
+	require.NoError(t, readErr)
+
+	require.NoError(t, err)
+	assert.Contains(t, ta.Warnings, "track.wav contains mp3 data despite .wav extension")
+	assert.Empty(t, string(out))
+}
+
+func TestAnalyzeWithContextCancelled(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "track.mp3")
+	writeSilentMonoMP3(t, path, 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	a := &Analyzer{analyzers: []AnalyzerType{AnalyzerMixx}}
+	_, err := a.AnalyzeFileWithContext(ctx, path)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Cancelled directory analysis stops without writing sidecars
+	err = a.AnalyzeDirWithContext(ctx, dir, AnalyzeDirOptions{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoFileExists(t, filepath.Join(dir, "track.json"))
+
+	// The streaming QM analyzer stops between chunks
+	samples := make([]float32, 4*qmProcessChunkFrames)
+	_, err = AnalyzeSamplesQMContext(ctx, samples, 44100, nil, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestAnalyzeFileProgress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	writeSilentMonoMP3(t, path, 400)
+
+	a := &Analyzer{analyzers: []AnalyzerType{AnalyzerMixxExtended}}
+	plain, err := a.AnalyzeFileWithContext(context.Background(), path)
+	require.NoError(t, err)
+
+	var stage []float64
+	ctx := WithProgress(context.Background(), func(p Progress) {
+		if p.Stage == string(AnalyzerMixxExtended) {
+			stage = append(stage, p.Percent)
+		}
+	})
+	ta, err := a.AnalyzeFileWithContext(ctx, path)
+	require.NoError(t, err)
+
+	// mixx-extended reports progress within its stage, and reads the file
+	// the same way with or without progress
+	require.Greater(t, len(stage), 1)
+	assert.Greater(t, stage[len(stage)-1], stage[0])
+	assert.Equal(t, plain.Grids[string(AnalyzerMixxExtended)], ta.Grids[string(AnalyzerMixxExtended)])
+	assert.Equal(t, plain.Duration, ta.Duration)
+}
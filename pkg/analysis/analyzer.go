@@ -16,6 +16,7 @@ package analysis
 */
 import "C"
 import (
+	"cmp"
 	"errors"
 	"unsafe"
 )
@@ -28,15 +29,16 @@ type AnalyzeOut struct {
 	Beats       []float64 // Beats contains the timestamps of detected beats in seconds.
 	SampleRate  int       // SampleRate is the sample rate of the audio file in Hz.
 	TotalFrames int64     // TotalFrames is the total number of audio frames in the file.
-	Duration    float64   // Duration is the total duration of the audio file in seconds.
+	Duration    Seconds   // Duration is the total duration of the audio file.
+	BeatsPerBar int       // BeatsPerBar is the meter bars are counted in.
 }
 
-// Bars returns the number of bars (4 beats per bar) in the track.
+// Bars returns the number of bars of BeatsPerBar beats (4 if unset) in the track.
 func (r *AnalyzeOut) Bars() float64 {
 	if len(r.Beats) == 0 {
 		return 0
 	}
-	return float64(len(r.Beats)) / 4.0
+	return float64(len(r.Beats)) / float64(cmp.Or(r.BeatsPerBar, 4))
 }
 
 // AnalyzeFile analyzes an audio file and returns BPM and beat grid information.
@@ -63,7 +65,8 @@ func AnalyzeFile(filepath string) (*AnalyzeOut, error) {
 		BPM:         float64(cresult.bpm),
 		SampleRate:  int(cresult.sample_rate),
 		TotalFrames: int64(cresult.total_frames),
-		Duration:    float64(cresult.duration),
+		Duration:    Seconds(cresult.duration),
+		BeatsPerBar: DefaultQMConfig().BeatsPerBar,
 	}
 
 	// Copy beats array
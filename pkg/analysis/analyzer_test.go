@@ -1,9 +1,6 @@
 package analysis
 
 import (
-	"io"
-	"net/http"
-	"os"
 	"path/filepath"
 	"testing"
 
@@ -148,7 +145,7 @@ func TestTracks(t *testing.T) {
 
 			assert.InDelta(t, tt.outMixxx.BPM, mixxx.BPM, 1.0, "Mixxx BPM")
 			assert.Equal(t, tt.outMixxx.SampleRate, mixxx.SampleRate, "Mixxx SampleRate")
-			assert.InDelta(t, tt.outMixxx.Duration, mixxx.Duration, 0.1, "Mixxx Duration")
+			assert.InDelta(t, float64(tt.outMixxx.Duration), float64(mixxx.Duration), 0.1, "Mixxx Duration")
 			assert.NotEmpty(t, mixxx.Beats, "Mixxx Beats")
 
 			t.Logf("Mixxx: BPM=%.2f, Bars=%.1f, Beats=%d, Duration=%.2fs",
@@ -160,7 +157,7 @@ func TestTracks(t *testing.T) {
 				require.NoError(t, err, "Python TF analysis failed")
 
 				assert.InDelta(t, tt.outPyTF.BPM, pyTF.BPM, 2.0, "Python TF BPM")
-				assert.InDelta(t, tt.outPyTF.Duration, pyTF.Duration, 0.5, "Python TF Duration")
+				assert.InDelta(t, float64(tt.outPyTF.Duration), float64(pyTF.Duration), 0.5, "Python TF Duration")
 				assert.NotEmpty(t, pyTF.Beats, "Python TF Beats")
 
 				t.Logf("PyTF:  BPM=%.2f, Bars=%.1f, Beats=%d, Duration=%.2fs",
@@ -173,7 +170,7 @@ func TestTracks(t *testing.T) {
 				require.NoError(t, err, "Go TF analysis failed")
 
 				assert.InDelta(t, tt.outGoTF.BPM, goTF.BPM, 2.0, "Go TF BPM")
-				assert.InDelta(t, tt.outGoTF.Duration, goTF.Duration, 0.5, "Go TF Duration")
+				assert.InDelta(t, float64(tt.outGoTF.Duration), float64(goTF.Duration), 0.5, "Go TF Duration")
 				assert.NotEmpty(t, goTF.Beats, "Go TF Beats")
 
 				t.Logf("GoTF:  BPM=%.2f, Bars=%.1f, Beats=%d, Duration=%.2fs",
@@ -183,31 +180,87 @@ func TestTracks(t *testing.T) {
 	}
 }
 
-func get(t *testing.T, url string) string {
-	t.Helper()
+func TestAnalyzeLoaded(t *testing.T) {
+	// 4 seconds of 120 BPM clicks at 44.1kHz, decoded once and shared
+	const sampleRate = 44100
+	samples := make([]float32, 4*sampleRate)
+	for beat := 0; beat < 8; beat++ {
+		start := beat * sampleRate / 2
+		for j := start; j < start+200; j++ {
+			samples[j] = 0.9
+		}
+	}
+
+	a := &Analyzer{}
+	ta, err := a.AnalyzeLoaded(samples, sampleRate, []AnalyzerType{AnalyzerRekordboxPy})
+	require.NoError(t, err)
+	assert.InDelta(t, 4.0, float64(ta.Duration), 1e-9)
+	assert.Equal(t, sampleRate, ta.SampleRate)
+	require.NotNil(t, ta.Waveform)
+	assert.Len(t, ta.Waveform.Peaks, 400)
+
+	// Path-only analyzers are reported, not silently dropped
+	require.Contains(t, ta.Grids, string(AnalyzerRekordboxPy))
+	assert.Contains(t, ta.Grids[string(AnalyzerRekordboxPy)].Error, "file path")
 
-	dir := "fixtures"
-	require.NoError(t, os.MkdirAll(dir, 0755))
+	_, err = a.AnalyzeLoaded(samples, sampleRate, []AnalyzerType{"bogus"})
+	assert.Error(t, err)
+
+	_, err = a.AnalyzeLoaded(samples, 0, nil)
+	assert.Error(t, err)
+}
 
-	name := filepath.Base(url)
-	path := filepath.Join(dir, name)
-	if _, err := os.Stat(path); err == nil {
-		return path
+func TestAnalysisSampleRate(t *testing.T) {
+	// 10 seconds of 120 BPM clicks at 48kHz so every analyzer must resample
+	const sampleRate = 48000
+	samples := make([]float32, 10*sampleRate)
+	for start := 0; start < len(samples); start += sampleRate / 2 {
+		for j := start; j < start+200; j++ {
+			samples[j] = 0.9
+		}
 	}
 
-	t.Logf("Downloading %s...", name)
+	t.Run("qm-dsp", func(t *testing.T) {
+		a := &Analyzer{}
+		ta, err := a.AnalyzeLoaded(samples, sampleRate, []AnalyzerType{AnalyzerMixx, AnalyzerMixxExtended})
+		require.NoError(t, err)
+		assert.Equal(t, sampleRate, ta.Grids[string(AnalyzerMixx)].AnalysisSampleRate)
+		assert.Equal(t, sampleRate, ta.Grids[string(AnalyzerMixxExtended)].AnalysisSampleRate)
+	})
 
-	resp, err := http.Get(url)
-	require.NoError(t, err)
-	defer resp.Body.Close()
+	t.Run("beatthis", func(t *testing.T) {
+		bt, err := NewBeatThisAnalyzer()
+		if err != nil {
+			t.Skip("beat_this not available:", err)
+		}
+		defer bt.Close()
 
-	require.Equal(t, http.StatusOK, resp.StatusCode)
+		a := &Analyzer{grids: []GridAnalyzer{bt}}
+		ta, err := a.AnalyzeLoaded(samples, sampleRate, []AnalyzerType{AnalyzerBeatThis})
+		require.NoError(t, err)
+		assert.Equal(t, 22050, ta.Grids[string(AnalyzerBeatThis)].AnalysisSampleRate)
+	})
 
-	f, err := os.Create(path)
-	require.NoError(t, err)
-	defer f.Close()
+	t.Run("tensorflow", func(t *testing.T) {
+		tf, err := NewTFAnalyzer()
+		if err != nil {
+			t.Skip("TF Analyzer not available:", err)
+		}
+		defer tf.Close()
+
+		a := &Analyzer{grids: []GridAnalyzer{tf}}
+		ta, err := a.AnalyzeLoaded(samples, sampleRate, []AnalyzerType{AnalyzerRekordboxGo})
+		require.NoError(t, err)
+		assert.Equal(t, 44100, ta.Grids[string(AnalyzerRekordboxGo)].AnalysisSampleRate)
+	})
+}
+
+func get(t *testing.T, url string) string {
+	t.Helper()
+
+	t.Logf("Fetching %s...", filepath.Base(url))
 
-	_, err = io.Copy(f, resp.Body)
+	path, err := FetchFixture(url, "fixtures", "")
 	require.NoError(t, err)
 
 	return path
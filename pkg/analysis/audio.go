@@ -5,40 +5,483 @@ package analysis
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/hajimehoshi/go-mp3"
 )
 
-// LoadAudioMono loads an audio file and returns mono float32 samples and sample rate.
+// LoadAudioMonoOptions configures LoadAudioMonoWithOptions.
+type LoadAudioMonoOptions struct {
+	// CompensateDelay skips the MP3 encoder and decoder delay so transients
+	// line up with browser playback. Other formats have no delay to skip.
+	CompensateDelay bool
+
+	// MaxDuration stops decoding after this much audio, e.g. to analyze only
+	// the start of a long mix. Default: 0 (the whole file)
+	MaxDuration Seconds
+}
+
+// maxFrames returns the number of frames MaxDuration allows at sampleRate,
+// or 0 for no limit.
+func (o LoadAudioMonoOptions) maxFrames(sampleRate int) int {
+	if o.MaxDuration <= 0 {
+		return 0
+	}
+	return max(o.MaxDuration.Frames(float64(sampleRate)), 1)
+}
+
+// truncateFrames shortens channel buffers to at most n frames if n > 0.
+func truncateFrames(channels [][]float32, n int) [][]float32 {
+	for ch, c := range channels {
+		if n > 0 && len(c) > n {
+			channels[ch] = c[:n]
+		}
+	}
+	return channels
+}
+
+// LoadAudioMono loads an audio file and returns mono float32 samples and sample rate,
+// averaging the channels from LoadAudioStereo.
 func LoadAudioMono(path string) ([]float32, int, error) {
+	return LoadAudioMonoWithOptions(path, LoadAudioMonoOptions{CompensateDelay: true})
+}
+
+// LoadAudioMonoWithOptions is LoadAudioMono with explicit options.
+func LoadAudioMonoWithOptions(path string, opts LoadAudioMonoOptions) ([]float32, int, error) {
+	channels, sampleRate, err := loadAudio(path, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return mixDown(channels), sampleRate, nil
+}
+
+// LoadAudioStereo loads an audio file and returns one float32 buffer per channel
+// plus the sample rate, with MP3 delay compensated. Mono sources return a single channel.
+func LoadAudioStereo(path string) ([][]float32, int, error) {
+	return loadAudio(path, LoadAudioMonoOptions{CompensateDelay: true})
+}
+
+// loadAudio decodes path to channel buffers. The native decoder for the
+// content's format (see sniffAudioFormat) is tried first, so mislabeled files
+// still load (see audioFormatWarning), then the decoder for the extension, then
+// ffmpeg if it is installed. Formats without a native decoder go straight to
+// ffmpeg.
+func loadAudio(path string, opts LoadAudioMonoOptions) ([][]float32, int, error) {
+	ext := normalizeAudioExt(strings.ToLower(filepath.Ext(path)))
+
+	format, err := sniffAudioFormat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var errs []error
+	for _, f := range slices.Compact([]string{format, ext}) {
+		channels, sampleRate, ok, err := loadNative(f, path, opts)
+		if !ok {
+			continue
+		}
+		if err == nil {
+			return channels, sampleRate, nil
+		}
+		errs = append(errs, err)
+	}
+
+	channels, sampleRate, err := loadFFmpeg(path, opts)
+	switch {
+	case err == nil:
+		return channels, sampleRate, nil
+	case errors.Is(err, exec.ErrNotFound) && len(errs) > 0:
+		return nil, 0, errors.Join(errs...)
+	case errors.Is(err, exec.ErrNotFound):
+		if format == "" {
+			format = ext
+		}
+		return nil, 0, fmt.Errorf("unsupported audio format: %s (install ffmpeg to decode)", format)
+	default:
+		return nil, 0, errors.Join(append(errs, err)...)
+	}
+}
+
+// loadNative decodes path with the native decoder for format, reporting
+// false if there is none.
+func loadNative(format, path string, opts LoadAudioMonoOptions) ([][]float32, int, bool, error) {
+	var channels [][]float32
+	var sampleRate int
+	var err error
+	switch format {
+	case ".mp3":
+		channels, sampleRate, err = loadMP3(path, opts)
+	case ".flac":
+		channels, sampleRate, err = loadFLAC(path, opts)
+	case ".wav":
+		channels, sampleRate, err = loadWAV(path, opts)
+	case ".ogg":
+		channels, sampleRate, err = loadOGG(path, opts)
+	default:
+		return nil, 0, false, nil
+	}
+	return channels, sampleRate, true, err
+}
+
+// mixDown averages channel buffers to mono. A single channel is returned as-is.
+func mixDown(channels [][]float32) []float32 {
+	if len(channels) == 1 {
+		return channels[0]
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+	samples := make([]float32, len(channels[0]))
+	for i := range samples {
+		var sum float32
+		for _, c := range channels {
+			sum += c[i]
+		}
+		samples[i] = sum / float32(len(channels))
+	}
+	return samples
+}
+
+// InterleaveChannels interleaves channel buffers frame by frame, the layout
+// QMAnalyzer.Process expects from NewQMAnalyzer(sampleRate, len(channels), ...).
+func InterleaveChannels(channels [][]float32) []float32 {
+	if len(channels) == 0 {
+		return nil
+	}
+	n := len(channels[0])
+	out := make([]float32, n*len(channels))
+	for ch, c := range channels {
+		for i, v := range c[:n] {
+			out[i*len(channels)+ch] = v
+		}
+	}
+	return out
+}
+
+// deinterleave splits interleaved frames into one buffer per channel.
+// A trailing partial frame is dropped.
+func deinterleave(interleaved []float32, numChannels int) [][]float32 {
+	n := len(interleaved) / numChannels
+	channels := make([][]float32, numChannels)
+	for ch := range channels {
+		channels[ch] = make([]float32, n)
+		for i := range n {
+			channels[ch][i] = interleaved[i*numChannels+ch]
+		}
+	}
+	return channels
+}
+
+// audioMagic maps content signatures to the canonical extension of their format.
+// Offset is where the signature starts in the file.
+var audioMagic = []struct {
+	offset int
+	magic  string
+	format string
+}{
+	{0, "fLaC", ".flac"},
+	{0, "OggS", ".ogg"},
+	{8, "WAVE", ".wav"},
+	{8, "AIFF", ".aiff"},
+	{8, "AIFC", ".aiff"},
+	{4, "ftyp", ".m4a"},
+}
+
+// id3v2Size returns the length of the ID3v2 tag at the start of data,
+// including its header and any footer, or 0 if there is none. Taggers
+// prepend these to FLAC and WAV files as well as MP3s.
+func id3v2Size(data []byte) int {
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return 0
+	}
+	size := 10 + syncsafe(data[6:10])
+	if data[5]&0x10 != 0 {
+		size += 10 // Footer
+	}
+	return size
+}
+
+// sniffAudioFormat detects the audio container from the file's magic bytes,
+// after any ID3v2 tag. Returns the canonical extension (e.g. ".wav") or "" if
+// the content is unrecognized.
+func sniffAudioFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(f, header)
+	header = header[:n]
+	if size := id3v2Size(header); size > 0 {
+		n, _ = f.ReadAt(header[:cap(header)], int64(size))
+		header = header[:n]
+	}
+
+	for _, m := range audioMagic {
+		end := m.offset + len(m.magic)
+		if end <= len(header) && string(header[m.offset:end]) == m.magic {
+			return m.format, nil
+		}
+	}
+
+	// Bare MPEG audio frame sync (11 set bits, Layer III), or ADTS AAC (Layer 0)
+	if len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0 {
+		if header[1]&0x06 == 0 {
+			return ".aac", nil
+		}
+		return ".mp3", nil
+	}
+
+	return "", nil
+}
+
+// audioFormatWarning describes a file whose content doesn't match its
+// extension, e.g. MP3 data in a .wav, or returns "" if it matches or either
+// is unrecognized.
+func audioFormatWarning(path string) string {
 	ext := strings.ToLower(filepath.Ext(path))
+	format, err := sniffAudioFormat(path)
+	if err != nil || format == "" || format == normalizeAudioExt(ext) {
+		return ""
+	}
+	return fmt.Sprintf("%s contains %s data despite %s extension",
+		filepath.Base(path), strings.TrimPrefix(format, "."), ext)
+}
 
+// normalizeAudioExt maps extension aliases to the canonical form used by sniffAudioFormat.
+func normalizeAudioExt(ext string) string {
 	switch ext {
-	case ".mp3":
-		return loadMP3Mono(path)
+	case ".aif":
+		return ".aiff"
+	case ".mp4":
+		return ".m4a"
 	default:
-		return nil, 0, fmt.Errorf("unsupported audio format: %s", ext)
+		return ext
 	}
 }
 
+// loadFFmpeg decodes any format ffmpeg understands to float32 channel buffers
+// at the file's native sample rate. Returns exec.ErrNotFound if ffmpeg is not installed.
+func loadFFmpeg(path string, opts LoadAudioMonoOptions) ([][]float32, int, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, 0, err
+	}
+	ffprobe, err := exec.LookPath("ffprobe")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	out, err := exec.Command(ffprobe,
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=sample_rate,channels",
+		"-of", "default=noprint_wrappers=1",
+		path,
+	).Output()
+	if err != nil {
+		return nil, 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	var sampleRate, numChannels int
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch key {
+		case "sample_rate":
+			sampleRate, err = strconv.Atoi(value)
+		case "channels":
+			numChannels, err = strconv.Atoi(value)
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("ffprobe %s %q: %w", key, value, err)
+		}
+	}
+	if sampleRate <= 0 || numChannels <= 0 {
+		return nil, 0, fmt.Errorf("ffprobe found no audio stream: %q", strings.TrimSpace(string(out)))
+	}
+
+	args := []string{"-v", "error", "-i", path}
+	if opts.MaxDuration > 0 {
+		args = append(args, "-t", strconv.FormatFloat(float64(opts.MaxDuration), 'f', -1, 64))
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(ffmpeg, append(args, "-f", "f32le", "-")...)
+	cmd.Stderr = &stderr
+	pcm, err := cmd.Output()
+	if err != nil {
+		return nil, 0, fmt.Errorf("ffmpeg decode failed: %w: %s", err, stderr.String())
+	}
+
+	interleaved := make([]float32, len(pcm)/4)
+	for i := range interleaved {
+		interleaved[i] = math.Float32frombits(binary.LittleEndian.Uint32(pcm[i*4:]))
+	}
+
+	return truncateFrames(deinterleave(interleaved, numChannels), opts.maxFrames(sampleRate)), sampleRate, nil
+}
+
+// Plausible audio sample rate bounds in Hz.
+const (
+	minPlausibleSampleRate = 8000
+	maxPlausibleSampleRate = 192000
+)
+
+// Resample ratios beyond this factor (either direction) degrade analysis quality.
+const maxResampleRatio = 4.0
+
+// Implied and expected durations differing by more than this fraction are reported.
+const durationMismatchTolerance = 0.05
+
+// SampleRateWarnings sanity-checks a sample rate against the number of samples.
+// expectedDuration is an independent duration (e.g. from file metadata or another
+// decoder); pass 0 if unknown. Returns human-readable warnings.
+func SampleRateWarnings(numSamples, sampleRate int, expectedDuration Seconds) []string {
+	var warnings []string
+
+	if sampleRate < minPlausibleSampleRate || sampleRate > maxPlausibleSampleRate {
+		warnings = append(warnings, fmt.Sprintf(
+			"implausible sample rate %d Hz (expected %d-%d Hz)",
+			sampleRate, minPlausibleSampleRate, maxPlausibleSampleRate))
+	}
+
+	if sampleRate > 0 && expectedDuration > 0 {
+		implied := FramesToSeconds(numSamples, float64(sampleRate))
+		if w := durationMismatchWarning(implied, expectedDuration); w != "" {
+			warnings = append(warnings, fmt.Sprintf("%s - actual rate is likely %d Hz",
+				w, int(math.Round(float64(numSamples)/float64(expectedDuration)))))
+		}
+	}
+
+	return warnings
+}
+
+// durationMismatchWarning returns a warning if implied and expected durations disagree.
+func durationMismatchWarning(implied, expected Seconds) string {
+	if implied <= 0 || expected <= 0 {
+		return ""
+	}
+	if math.Abs(float64(implied-expected))/float64(expected) <= durationMismatchTolerance {
+		return ""
+	}
+	return fmt.Sprintf("implied duration %.2fs does not match expected %.2fs", implied, expected)
+}
+
+// resampleRatioWarning returns a warning if resampling from srcRate to dstRate is extreme.
+func resampleRatioWarning(srcRate, dstRate int) string {
+	if srcRate <= 0 || dstRate <= 0 {
+		return ""
+	}
+	ratio := float64(srcRate) / float64(dstRate)
+	if ratio <= maxResampleRatio && ratio >= 1/maxResampleRatio {
+		return ""
+	}
+	return fmt.Sprintf("extreme resample ratio %.2f (%d Hz -> %d Hz)", ratio, srcRate, dstRate)
+}
+
+// resampleLinear resamples audio from srcRate to dstRate using linear
+// interpolation, as the beat_this and rekordbox-go analyzers require.
+func resampleLinear(samples []float32, srcRate, dstRate int) []float32 {
+	if srcRate == dstRate {
+		return samples
+	}
+
+	// Round rather than truncate so the resampled duration matches the source;
+	// float error in len/ratio would otherwise drop a sample (e.g. 48 kHz to 22.05 kHz)
+	ratio := float64(srcRate) / float64(dstRate)
+	newLen := int(math.Round(float64(len(samples)) * float64(dstRate) / float64(srcRate)))
+	result := make([]float32, newLen)
+
+	for i := 0; i < newLen; i++ {
+		srcIdx := float64(i) * ratio
+		srcIdxInt := int(srcIdx)
+		frac := float32(srcIdx - float64(srcIdxInt))
+
+		if srcIdxInt+1 < len(samples) {
+			result[i] = samples[srcIdxInt]*(1-frac) + samples[srcIdxInt+1]*frac
+		} else if srcIdxInt < len(samples) {
+			result[i] = samples[srcIdxInt]
+		}
+	}
+
+	return result
+}
+
 // Additional samples that go-mp3 produces compared to browser's decoder
 // Measured: browser first transient at 48446, go-mp3 at 50735
 // LAME header said 1365, so go-mp3 adds: 50735 - 48446 - 1365 = 924 samples
-const goMP3DecoderDelay = 924
+// The measurement was at goMP3DecoderDelayRate; other rates scale it.
+const (
+	goMP3DecoderDelay     = 924
+	goMP3DecoderDelayRate = 44100
+)
 
 // Default encoder delay if we can't read it from the LAME header
 const defaultEncoderDelay = 576
 
-// readMP3Delay reads the total delay to skip for an MP3 file.
-// Combines LAME encoder delay (from header) + go-mp3 decoder delay.
-func readMP3Delay(path string) int {
+// go-mp3 decodes every stream to 16-bit stereo: 2 channels x 2 bytes per frame.
+const goMP3BytesPerFrame = 4
+
+// readMP3Channels returns the channel count (1 or 2) from the first MPEG audio
+// frame header, skipping any ID3v2 tag. Defaults to 2 if no header is found.
+func readMP3Channels(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 2
+	}
+	defer f.Close()
+
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return 2
+	}
+	offset := int64(id3v2Size(header))
+
+	buf := make([]byte, 8192)
+	n, err := f.ReadAt(buf, offset)
+	if n < 4 && err != nil {
+		return 2
+	}
+	buf = buf[:n]
+
+	// Find the first frame sync (11 set bits) with a valid layer
+	for i := 0; i+3 < len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 || buf[i+1]&0x06 == 0 {
+			continue
+		}
+		// Channel mode is the top 2 bits of the 4th header byte; 0b11 is single channel
+		if buf[i+3]>>6 == 0x03 {
+			return 1
+		}
+		return 2
+	}
+
+	return 2
+}
+
+// readMP3Delay reads the total delay to skip for an MP3 file decoded at sampleRate.
+// Combines LAME encoder delay (from header, already in samples) + go-mp3 decoder
+// delay, scaled from the rate it was measured at.
+func readMP3Delay(path string, sampleRate int) int {
 	lameDelay := readLAMEEncoderDelay(path)
-	return lameDelay + goMP3DecoderDelay
+	return lameDelay + goMP3DecoderDelaySamples(sampleRate)
+}
+
+// goMP3DecoderDelaySamples returns the go-mp3 decoder delay in samples at sampleRate.
+func goMP3DecoderDelaySamples(sampleRate int) int {
+	if sampleRate <= 0 {
+		return goMP3DecoderDelay
+	}
+	return int(math.Round(goMP3DecoderDelay * float64(sampleRate) / goMP3DecoderDelayRate))
 }
 
 // readLAMEEncoderDelay reads the encoder delay from LAME/Xing header if present.
@@ -83,11 +526,10 @@ func readLAMEEncoderDelay(path string) int {
 	return delay
 }
 
-// loadMP3Mono loads an MP3 file and returns mono float32 samples.
-func loadMP3Mono(path string) ([]float32, int, error) {
-	// Read total delay (encoder + decoder)
-	totalDelay := readMP3Delay(path)
-
+// loadMP3 loads an MP3 file and returns float32 channel buffers: one for
+// single-channel sources, left and right otherwise. With CompensateDelay, the
+// encoder and decoder delay is skipped to align with browser playback.
+func loadMP3(path string, opts LoadAudioMonoOptions) ([][]float32, int, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to open file: %w", err)
@@ -100,34 +542,46 @@ func loadMP3Mono(path string) ([]float32, int, error) {
 	}
 
 	sampleRate := decoder.SampleRate()
+	sourceChannels := readMP3Channels(path)
+	totalDelay := 0
+	if opts.CompensateDelay {
+		totalDelay = readMP3Delay(path, sampleRate)
+	}
 
-	// Read all PCM data (16-bit stereo interleaved)
-	pcmData, err := io.ReadAll(decoder)
+	// Read the PCM data (16-bit stereo interleaved), up to MaxDuration
+	var pcm io.Reader = decoder
+	if n := opts.maxFrames(sampleRate); n > 0 {
+		pcm = io.LimitReader(decoder, int64(n+totalDelay)*goMP3BytesPerFrame)
+	}
+	pcmData, err := io.ReadAll(pcm)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to decode MP3: %w", err)
 	}
 
-	// Convert to mono float32
-	// MP3 decoder outputs 16-bit signed stereo (4 bytes per sample pair)
-	numSamplePairs := len(pcmData) / 4
-	samples := make([]float32, numSamplePairs)
+	// Convert to float32 normalized to [-1, 1]
+	// go-mp3 always outputs 16-bit signed stereo (4 bytes per sample pair),
+	// duplicating single-channel sources into both channels, so those keep
+	// only the left
+	numSamplePairs := len(pcmData) / goMP3BytesPerFrame
+	channels := make([][]float32, sourceChannels)
+	for ch := range channels {
+		channels[ch] = make([]float32, numSamplePairs)
+	}
 
 	for i := range numSamplePairs {
-		offset := i * 4
-		// Read left and right channels as signed 16-bit
-		left := int16(binary.LittleEndian.Uint16(pcmData[offset:]))
-		right := int16(binary.LittleEndian.Uint16(pcmData[offset+2:]))
-
-		// Mix to mono and normalize to [-1, 1]
-		mono := (float32(left) + float32(right)) / 2.0
-		samples[i] = mono / 32768.0
+		offset := i * goMP3BytesPerFrame
+		for ch, c := range channels {
+			c[i] = float32(int16(binary.LittleEndian.Uint16(pcmData[offset+2*ch:]))) / 32768.0
+		}
 	}
 
 	// Skip delay at the start to match browser audio playback
 	// Browser decoders compensate for MP3 encoder delay automatically
-	if len(samples) > totalDelay {
-		samples = samples[totalDelay:]
+	if totalDelay > 0 && numSamplePairs > totalDelay {
+		for ch, c := range channels {
+			channels[ch] = c[totalDelay:]
+		}
 	}
 
-	return samples, sampleRate, nil
+	return truncateFrames(channels, opts.maxFrames(sampleRate)), sampleRate, nil
 }
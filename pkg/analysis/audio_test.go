@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"testing"
@@ -38,9 +39,6 @@ func TestMP3Decoding(t *testing.T) {
 	lameDelay := readLAMEEncoderDelay(testFile)
 	t.Logf("LAME encoder delay from header: %d samples", lameDelay)
 
-	totalDelay := readMP3Delay(testFile)
-	t.Logf("Total delay (LAME + decoder): %d samples", totalDelay)
-
 	// Load raw samples WITHOUT delay compensation
 	f, err := os.Open(testFile)
 	if err != nil {
@@ -55,6 +53,9 @@ func TestMP3Decoding(t *testing.T) {
 	}
 
 	t.Logf("Sample rate: %d Hz", sampleRate)
+
+	totalDelay := readMP3Delay(testFile, sampleRate)
+	t.Logf("Total delay (LAME + decoder): %d samples", totalDelay)
 	t.Logf("Total samples: %d (%.2f seconds)", len(samples), float64(len(samples))/float64(sampleRate))
 
 	// Find first significant transient (above threshold)
@@ -189,3 +190,264 @@ func loadMP3MonoRaw(path string) ([]float32, int, error) {
 
 	return samples, sampleRate, nil
 }
+
+func TestSampleRateWarnings(t *testing.T) {
+	// Plausible rate and matching duration: no warnings
+	if w := SampleRateWarnings(441000, 44100, 10.0); len(w) != 0 {
+		t.Errorf("Expected no warnings, got %v", w)
+	}
+
+	// Implausible rates
+	for _, rate := range []int{4000, 384000} {
+		if w := SampleRateWarnings(441000, rate, 0); len(w) != 1 {
+			t.Errorf("Expected 1 warning for %d Hz, got %v", rate, w)
+		}
+	}
+
+	// 48 kHz audio labeled as 44.1 kHz implies the wrong duration
+	w := SampleRateWarnings(480000, 44100, 10.0)
+	if len(w) != 1 {
+		t.Fatalf("Expected duration mismatch warning, got %v", w)
+	}
+	if want := "implied duration 10.88s does not match expected 10.00s - actual rate is likely 48000 Hz"; w[0] != want {
+		t.Errorf("Expected %q, got %q", want, w[0])
+	}
+
+	// Within tolerance of the expected duration: no warning
+	if w := SampleRateWarnings(441000, 44100, 10.2); len(w) != 0 {
+		t.Errorf("Expected no warnings within tolerance, got %v", w)
+	}
+
+	// Resample ratio
+	if w := resampleRatioWarning(44100, 22050); w != "" {
+		t.Errorf("Expected no warning for 2x resample, got %q", w)
+	}
+	if w := resampleRatioWarning(192000, 22050); w == "" {
+		t.Error("Expected warning for extreme resample ratio")
+	}
+}
+
+// writeSilentMonoMP3 writes a valid single-channel MPEG-1 Layer III file of silent frames.
+func writeSilentMonoMP3(t *testing.T, path string, frames int) {
+	t.Helper()
+	writeSilentMonoMP3Rate(t, path, frames, 44100)
+}
+
+// writeSilentMonoMP3Rate writes silent single-channel MPEG-1 Layer III frames at
+// sampleRate, which must be 44100, 48000, or 32000 Hz.
+func writeSilentMonoMP3Rate(t *testing.T, path string, frames, sampleRate int) {
+	t.Helper()
+
+	rateIndex := map[int]byte{44100: 0, 48000: 1, 32000: 2}[sampleRate]
+
+	// 32 kbps, no padding: 144 * 32000 / sampleRate bytes per frame
+	frameSize := 144 * 32000 / sampleRate
+	frame := make([]byte, frameSize)
+	frame[0] = 0xFF                // Sync
+	frame[1] = 0xFB                // Sync, MPEG-1, Layer III, no CRC
+	frame[2] = 0x10 | rateIndex<<2 // Bitrate index 1 (32 kbps), sample rate index
+	frame[3] = 0xC0                // Channel mode 0b11 (single channel)
+	// Side info and main data stay zero, which decodes to silence
+
+	data := make([]byte, 0, frameSize*frames)
+	for range frames {
+		data = append(data, frame...)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write MP3: %v", err)
+	}
+}
+
+func TestLoadAudioMonoMonoSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mono.mp3")
+	frames := 200
+	writeSilentMonoMP3(t, path, frames)
+
+	if ch := readMP3Channels(path); ch != 1 {
+		t.Fatalf("Expected 1 channel, got %d", ch)
+	}
+
+	samples, sampleRate, err := LoadAudioMono(path)
+	if err != nil {
+		t.Fatalf("LoadAudioMono failed: %v", err)
+	}
+	if sampleRate != 44100 {
+		t.Errorf("Expected 44100 Hz, got %d", sampleRate)
+	}
+
+	// 1152 samples per frame, minus the default encoder + decoder delay
+	expected := frames*1152 - readMP3Delay(path, 44100)
+	if len(samples) != expected {
+		t.Errorf("Expected %d samples (%.3fs), got %d (%.3fs)",
+			expected, float64(expected)/44100, len(samples), float64(len(samples))/44100)
+	}
+	for i, s := range samples {
+		if s != 0 {
+			t.Fatalf("Expected silence, got %f at sample %d", s, i)
+		}
+	}
+
+	// Single-channel sources load as one channel, not duplicated stereo
+	channels, _, err := LoadAudioStereo(path)
+	if err != nil {
+		t.Fatalf("LoadAudioStereo failed: %v", err)
+	}
+	if len(channels) != 1 || len(channels[0]) != expected {
+		t.Errorf("Expected 1 channel of %d samples, got %d channels", expected, len(channels))
+	}
+}
+
+func TestLoadAudioMaxDuration(t *testing.T) {
+	dir := t.TempDir()
+	mp3 := filepath.Join(dir, "long.mp3")
+	writeSilentMonoMP3(t, mp3, 400)
+	flac := filepath.Join(dir, "long.flac")
+	tone := make([]int64, 10*44100)
+	if err := os.WriteFile(flac, encodeTestFLAC(tone, tone), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// Decoding stops at MaxDuration, after any MP3 delay is skipped
+	for _, path := range []string{mp3, flac} {
+		samples, sampleRate, err := LoadAudioMonoWithOptions(path, LoadAudioMonoOptions{CompensateDelay: true, MaxDuration: 2})
+		if err != nil {
+			t.Fatalf("%s: LoadAudioMonoWithOptions failed: %v", path, err)
+		}
+		if len(samples) != 2*sampleRate {
+			t.Errorf("%s: Expected %d samples, got %d", path, 2*sampleRate, len(samples))
+		}
+
+		// A limit past the end loads the whole file
+		all, _, err := LoadAudioMono(path)
+		if err != nil {
+			t.Fatalf("%s: LoadAudioMono failed: %v", path, err)
+		}
+		long, _, err := LoadAudioMonoWithOptions(path, LoadAudioMonoOptions{CompensateDelay: true, MaxDuration: 60})
+		if err != nil || len(long) != len(all) {
+			t.Errorf("%s: Expected %d samples, got %d: %v", path, len(all), len(long), err)
+		}
+	}
+}
+
+func TestMP3DelaySampleRate(t *testing.T) {
+	// The decoder delay was measured at 44.1 kHz and scales with the rate
+	if d := goMP3DecoderDelaySamples(44100); d != goMP3DecoderDelay {
+		t.Errorf("Expected %d samples at 44100 Hz, got %d", goMP3DecoderDelay, d)
+	}
+	if d := goMP3DecoderDelaySamples(48000); d != 1006 {
+		t.Errorf("Expected 1006 samples at 48000 Hz, got %d", d)
+	}
+
+	path := filepath.Join(t.TempDir(), "48k.mp3")
+	frames := 100
+	writeSilentMonoMP3Rate(t, path, frames, 48000)
+
+	samples, sampleRate, err := LoadAudioMono(path)
+	if err != nil {
+		t.Fatalf("LoadAudioMono failed: %v", err)
+	}
+	if sampleRate != 48000 {
+		t.Fatalf("Expected 48000 Hz, got %d", sampleRate)
+	}
+
+	// Skipping the same duration of delay as at 44.1 kHz puts the start of the
+	// audio at the same time
+	delaySecs := float64(defaultEncoderDelay)/48000 + float64(goMP3DecoderDelay)/44100
+	raw := frames * 1152
+	if got := float64(raw-len(samples)) / 48000; math.Abs(got-delaySecs) > 1.0/48000 {
+		t.Errorf("Expected %.5fs of delay skipped, got %.5fs", delaySecs, got)
+	}
+
+	// Callers that don't need transient alignment can keep every sample
+	uncompensated, _, err := LoadAudioMonoWithOptions(path, LoadAudioMonoOptions{})
+	if err != nil {
+		t.Fatalf("LoadAudioMonoWithOptions failed: %v", err)
+	}
+	if len(uncompensated) != raw {
+		t.Errorf("Expected %d uncompensated samples, got %d", raw, len(uncompensated))
+	}
+}
+
+func TestSniffAudioFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	// MP3 data renamed to .wav still decodes with the MP3 decoder
+	renamed := filepath.Join(dir, "mislabeled.wav")
+	writeSilentMonoMP3(t, renamed, 50)
+
+	format, err := sniffAudioFormat(renamed)
+	if err != nil {
+		t.Fatalf("sniffAudioFormat failed: %v", err)
+	}
+	if format != ".mp3" {
+		t.Errorf("Expected .mp3, got %q", format)
+	}
+	if w := audioFormatWarning(renamed); w != "mislabeled.wav contains mp3 data despite .wav extension" {
+		t.Errorf("Unexpected format warning %q", w)
+	}
+
+	samples, _, err := LoadAudioMono(renamed)
+	if err != nil {
+		t.Fatalf("LoadAudioMono on renamed MP3 failed: %v", err)
+	}
+	if len(samples) == 0 {
+		t.Error("Expected samples from renamed MP3")
+	}
+
+	// WAV data in a .mp3 is detected as WAV
+	wavAsMP3 := filepath.Join(dir, "wav.mp3")
+	header := []byte("RIFF\x24\x00\x00\x00WAVEfmt ")
+	if err := os.WriteFile(wavAsMP3, header, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if format, _ := sniffAudioFormat(wavAsMP3); format != ".wav" {
+		t.Errorf("Expected .wav, got %q", format)
+	}
+
+	// Unrecognized content
+	junk := filepath.Join(dir, "junk.mp3")
+	if err := os.WriteFile(junk, []byte("not audio"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if format, _ := sniffAudioFormat(junk); format != "" {
+		t.Errorf("Expected no format, got %q", format)
+	}
+	if w := audioFormatWarning(junk); w != "" {
+		t.Errorf("Expected no format warning for unrecognized content, got %q", w)
+	}
+
+	// An ID3v2 tag (here with 4 bytes of padding) is skipped before sniffing,
+	// and the WAV decoder skips it too
+	tagged := filepath.Join(dir, "tagged.wav")
+	wav := []byte("ID3\x04\x00\x00\x00\x00\x00\x04\x00\x00\x00\x00")
+	wav = append(wav, "RIFF\x2c\x00\x00\x00WAVEfmt \x10\x00\x00\x00\x01\x00\x01\x00"...)
+	wav = binary.LittleEndian.AppendUint32(wav, 8000)
+	wav = binary.LittleEndian.AppendUint32(wav, 16000)
+	wav = append(wav, "\x02\x00\x10\x00data\x08\x00\x00\x00"...)
+	wav = append(wav, make([]byte, 8)...)
+	if err := os.WriteFile(tagged, wav, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if format, _ := sniffAudioFormat(tagged); format != ".wav" {
+		t.Errorf("Expected .wav after ID3 tag, got %q", format)
+	}
+	if samples, rate, err := LoadAudioMono(tagged); err != nil || rate != 8000 || len(samples) != 4 {
+		t.Errorf("Expected 4 samples at 8000 Hz from tagged WAV, got %d at %d: %v", len(samples), rate, err)
+	}
+
+	// Content that isn't recognized falls back to the extension's decoder
+	padded := filepath.Join(dir, "padded.mp3")
+	mp3, err := os.ReadFile(renamed)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if err := os.WriteFile(padded, append(make([]byte, 16), mp3...), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if format, _ := sniffAudioFormat(padded); format != "" {
+		t.Errorf("Expected no format for padded MP3, got %q", format)
+	}
+	if samples, _, err := LoadAudioMono(padded); err != nil || len(samples) == 0 {
+		t.Errorf("Expected the MP3 decoder to load padded MP3, got %d samples: %v", len(samples), err)
+	}
+}
@@ -3,10 +3,15 @@
 package analysis
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"sync"
 
@@ -20,8 +25,127 @@ type BeatThisAnalyzer struct {
 	melSession   *ort.DynamicAdvancedSession
 	modelSession *ort.DynamicAdvancedSession
 	modelSize    string // "small" or "full"
+	modelHash    string // sha256 of the model file
 	hopLength    int    // 441 samples at 22050 Hz
 	sampleRate   int    // 22050 Hz
+	postProcess  BeatThisPostProcess
+	provider     BeatThisProvider // Execution provider the sessions run on
+	activations  bool             // Return the activation curves in results
+	chunkSize    int              // Frames per beat tracker run
+	chunkOverlap int              // Frames shared by neighbouring chunks
+	bpmRange     BPMRange         // Range the BPM is normalized into
+}
+
+// BeatThisPostProcess selects how beat_this activations are turned into beats.
+type BeatThisPostProcess string
+
+const (
+	// PostProcessPeak picks thresholded local maxima of the activations.
+	// It is fast but gives irregular beats where activations are weak.
+	PostProcessPeak BeatThisPostProcess = "peak"
+	// PostProcessDBN decodes beats and downbeats jointly with a dynamic
+	// Bayesian network into a tempo-consistent grid, as the beat_this
+	// reference does.
+	PostProcessDBN BeatThisPostProcess = "dbn"
+)
+
+// BeatThisProvider selects the ONNX Runtime execution provider beat_this runs on.
+type BeatThisProvider string
+
+const (
+	// BeatThisProviderAuto uses the platform's accelerator if ONNX Runtime
+	// supports it: CoreML on macOS, CUDA on Linux, and DirectML on Windows.
+	BeatThisProviderAuto BeatThisProvider = "auto"
+	// BeatThisProviderCPU runs on the CPU.
+	BeatThisProviderCPU BeatThisProvider = "cpu"
+	// BeatThisProviderCUDA runs on an NVIDIA GPU.
+	BeatThisProviderCUDA BeatThisProvider = "cuda"
+	// BeatThisProviderCoreML runs on Apple silicon through CoreML.
+	BeatThisProviderCoreML BeatThisProvider = "coreml"
+	// BeatThisProviderDirectML runs on a Windows GPU through DirectML.
+	BeatThisProviderDirectML BeatThisProvider = "directml"
+)
+
+// ParseBeatThisProvider parses an execution provider name, "" meaning auto.
+func ParseBeatThisProvider(name string) (BeatThisProvider, error) {
+	switch p := BeatThisProvider(name); p {
+	case "":
+		return BeatThisProviderAuto, nil
+	case BeatThisProviderAuto, BeatThisProviderCPU, BeatThisProviderCUDA, BeatThisProviderCoreML, BeatThisProviderDirectML:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown beat_this provider %q (want auto, cpu, cuda, coreml, or directml)", name)
+}
+
+// platformProvider resolves auto to the accelerator for goos, or the CPU.
+func (p BeatThisProvider) platformProvider(goos string) BeatThisProvider {
+	if p != BeatThisProviderAuto {
+		return p
+	}
+	switch goos {
+	case "darwin":
+		return BeatThisProviderCoreML
+	case "linux":
+		return BeatThisProviderCUDA
+	case "windows":
+		return BeatThisProviderDirectML
+	}
+	return BeatThisProviderCPU
+}
+
+// BeatThisOptions configures a BeatThisAnalyzer.
+type BeatThisOptions struct {
+	// PostProcess selects the beat decoding. Default: PostProcessPeak
+	PostProcess BeatThisPostProcess
+
+	// Provider selects the execution provider. If it isn't available, the
+	// analyzer falls back to the CPU. Default: BeatThisProviderAuto
+	Provider BeatThisProvider
+
+	// Activations returns the beat and downbeat probability curves in
+	// BeatThisResult, e.g. to plot them over a waveform.
+	Activations bool
+
+	// ChunkSize is the number of 50 fps frames the beat tracker runs on at
+	// once. Smaller chunks use less memory on long mixes. Default: 1500 (30s)
+	ChunkSize int
+
+	// ChunkOverlap is the number of frames neighbouring chunks share and are
+	// crossfaded across. Default: 150 (3s), or a tenth of a custom ChunkSize
+	ChunkOverlap int
+
+	// BPMRange is the range the BPM is normalized into by doubling or
+	// halving. Default: DefaultBPMRange (60-180)
+	BPMRange BPMRange
+
+	// Logf receives the selected execution provider and any fallback from
+	// the requested one. Default: nil (silent)
+	Logf func(format string, args ...any)
+}
+
+// logf calls Logf if it is set.
+func (o BeatThisOptions) logf(format string, args ...any) {
+	if o.Logf != nil {
+		o.Logf(format, args...)
+	}
+}
+
+// chunking returns the chunk size and overlap, applying defaults.
+func (o BeatThisOptions) chunking() (int, int, error) {
+	size, overlap := o.ChunkSize, o.ChunkOverlap
+	if size == 0 {
+		size = beatThisChunkSize
+		if overlap == 0 {
+			overlap = beatThisOverlap
+		}
+	}
+	if overlap == 0 {
+		overlap = size / 10
+	}
+	if size < 0 || overlap < 0 || overlap >= size {
+		return 0, 0, fmt.Errorf("invalid beat_this chunking: overlap %d must be in [0, chunk size %d)", overlap, size)
+	}
+	return size, overlap, nil
 }
 
 // beat_this model parameters
@@ -49,8 +173,35 @@ func NewBeatThisAnalyzerFull() (*BeatThisAnalyzer, error) {
 
 // NewBeatThisAnalyzerWithSize creates a new beat_this analyzer with the specified model size.
 func NewBeatThisAnalyzerWithSize(modelSize string) (*BeatThisAnalyzer, error) {
+	return NewBeatThisAnalyzerWithOptions(modelSize, BeatThisOptions{})
+}
+
+// NewBeatThisAnalyzerWithOptions creates a new beat_this analyzer with the
+// specified model size and options.
+func NewBeatThisAnalyzerWithOptions(modelSize string, opts BeatThisOptions) (*BeatThisAnalyzer, error) {
+	postProcess := opts.PostProcess
+	switch postProcess {
+	case "":
+		postProcess = PostProcessPeak
+	case PostProcessPeak, PostProcessDBN:
+	default:
+		return nil, fmt.Errorf("unknown beat_this post-processing %q (want %s or %s)", postProcess, PostProcessPeak, PostProcessDBN)
+	}
+	provider, err := ParseBeatThisProvider(string(opts.Provider))
+	if err != nil {
+		return nil, err
+	}
+	provider = provider.platformProvider(runtime.GOOS)
+	chunkSize, chunkOverlap, err := opts.chunking()
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.BPMRange.validate(); err != nil {
+		return nil, err
+	}
+
 	// Find models directory
-	modelsDir, err := findBeatThisModels()
+	modelsDir, err := findBeatThisModels("mel.onnx", fmt.Sprintf("model_%s.onnx", modelSize))
 	if err != nil {
 		return nil, err
 	}
@@ -66,13 +217,14 @@ func NewBeatThisAnalyzerWithSize(modelSize string) (*BeatThisAnalyzer, error) {
 		return nil, fmt.Errorf("beat_this model not found at %s - run: uv run export_beat_this.py", modelPath)
 	}
 
+	modelHash, err := hashFile(modelPath)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize ONNX Runtime (once per process)
-	ortInitOnce.Do(func() {
-		ort.SetSharedLibraryPath(getONNXLibPath())
-		ortInitErr = ort.InitializeEnvironment()
-	})
-	if ortInitErr != nil {
-		return nil, fmt.Errorf("failed to initialize ONNX Runtime: %w", ortInitErr)
+	if err := initONNXRuntime(); err != nil {
+		return nil, err
 	}
 
 	// Get model input/output names from ONNX file
@@ -90,15 +242,57 @@ func NewBeatThisAnalyzerWithSize(modelSize string) (*BeatThisAnalyzer, error) {
 		modelOutputNames[i] = info.Name
 	}
 
+	// Fall back to the CPU if the provider isn't in this ONNX Runtime build or
+	// has no device; only warn if it was asked for by name
+	melSession, modelSession, err := newBeatThisSessions(melPath, modelPath, modelOutputNames, provider)
+	if err != nil && provider != BeatThisProviderCPU {
+		if opts.Provider != "" && opts.Provider != BeatThisProviderAuto {
+			opts.logf("Warning: beat_this %s execution provider unavailable, using cpu: %v", provider, err)
+		}
+		provider = BeatThisProviderCPU
+		melSession, modelSession, err = newBeatThisSessions(melPath, modelPath, modelOutputNames, provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	opts.logf("beat_this %s model: %s execution provider", modelSize, provider)
+
+	return &BeatThisAnalyzer{
+		melSession:   melSession,
+		modelSession: modelSession,
+		modelSize:    modelSize,
+		modelHash:    modelHash,
+		hopLength:    beatThisHopLength,
+		sampleRate:   beatThisSampleRate,
+		postProcess:  postProcess,
+		provider:     provider,
+		activations:  opts.Activations,
+		chunkSize:    chunkSize,
+		chunkOverlap: chunkOverlap,
+		bpmRange:     opts.BPMRange,
+	}, nil
+}
+
+// newBeatThisSessions creates the mel spectrogram and beat tracker sessions on
+// provider.
+func newBeatThisSessions(melPath, modelPath string, modelOutputNames []string, provider BeatThisProvider) (*ort.DynamicAdvancedSession, *ort.DynamicAdvancedSession, error) {
+	options, err := beatThisSessionOptions(provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	if options != nil {
+		defer options.Destroy()
+	}
+
 	// Create mel spectrogram session
 	melSession, err := ort.NewDynamicAdvancedSession(
 		melPath,
 		[]string{"audio"},           // input names
 		[]string{"mel_spectrogram"}, // output names
-		nil,
+		options,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create mel session: %w", err)
+		return nil, nil, fmt.Errorf("failed to create mel session: %w", err)
 	}
 
 	// Create beat tracker model session
@@ -107,24 +301,98 @@ func NewBeatThisAnalyzerWithSize(modelSize string) (*BeatThisAnalyzer, error) {
 		modelPath,
 		[]string{"mel_spectrogram"}, // input names
 		modelOutputNames,            // output names (discovered from model)
-		nil,
+		options,
 	)
 	if err != nil {
 		melSession.Destroy()
-		return nil, fmt.Errorf("failed to create model session: %w", err)
+		return nil, nil, fmt.Errorf("failed to create model session: %w", err)
 	}
+	return melSession, modelSession, nil
+}
 
-	return &BeatThisAnalyzer{
-		melSession:   melSession,
-		modelSession: modelSession,
-		modelSize:    modelSize,
-		hopLength:    beatThisHopLength,
-		sampleRate:   beatThisSampleRate,
-	}, nil
+// beatThisSessionOptions returns session options that append provider's
+// execution provider, or nil options for the CPU.
+func beatThisSessionOptions(provider BeatThisProvider) (*ort.SessionOptions, error) {
+	if provider == BeatThisProviderCPU {
+		return nil, nil
+	}
+	options, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session options: %w", err)
+	}
+
+	switch provider {
+	case BeatThisProviderCUDA:
+		var cuda *ort.CUDAProviderOptions
+		if cuda, err = ort.NewCUDAProviderOptions(); err == nil {
+			defer cuda.Destroy()
+			err = options.AppendExecutionProviderCUDA(cuda)
+		}
+	case BeatThisProviderCoreML:
+		err = options.AppendExecutionProviderCoreML(0)
+	case BeatThisProviderDirectML:
+		err = options.AppendExecutionProviderDirectML(0)
+	default:
+		err = fmt.Errorf("unknown provider")
+	}
+	if err != nil {
+		options.Destroy()
+		return nil, fmt.Errorf("%s execution provider: %w", provider, err)
+	}
+	return options, nil
+}
+
+// Provider returns the execution provider the analyzer runs on, which is the
+// CPU if the requested provider wasn't available.
+func (a *BeatThisAnalyzer) Provider() BeatThisProvider {
+	return a.provider
+}
+
+// initONNXRuntime loads the ONNX Runtime shared library once per process.
+func initONNXRuntime() error {
+	ortInitOnce.Do(func() {
+		ort.SetSharedLibraryPath(getONNXLibPath())
+		ortInitErr = ort.InitializeEnvironment()
+	})
+	if ortInitErr != nil {
+		return fmt.Errorf("failed to initialize ONNX Runtime: %w", ortInitErr)
+	}
+	return nil
+}
+
+// Version returns the model size and a short sha256 prefix of the model file,
+// e.g. "small sha256:1a2b3c4d5e6f cpu", with " dbn" before the execution
+// provider for DBN post-processing.
+func (a *BeatThisAnalyzer) Version() string {
+	v := fmt.Sprintf("%s sha256:%s", a.modelSize, a.modelHash[:min(len(a.modelHash), 12)])
+	if a.postProcess == PostProcessDBN {
+		v += " " + string(PostProcessDBN)
+	}
+	if a.provider != "" {
+		v += " " + string(a.provider)
+	}
+	return v
+}
+
+// hashFile returns the hex sha256 of a file.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-// findBeatThisModels locates the beat_this ONNX models directory.
-func findBeatThisModels() (string, error) {
+// findBeatThisModels locates the beat_this ONNX models directory: the first
+// candidate containing all of files, or else the first that exists. Models
+// downloaded to the user cache (see EnsureBeatThisModels) are checked last.
+func findBeatThisModels(files ...string) (string, error) {
 	// Check common locations
 	candidates := []string{
 		"models/beat_this",
@@ -141,13 +409,34 @@ func findBeatThisModels() (string, error) {
 		)
 	}
 
+	if dir, err := userBeatThisModelsDir(); err == nil {
+		candidates = append(candidates, dir)
+	}
+
+	found := ""
 	for _, path := range candidates {
-		if _, err := os.Stat(path); err == nil {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if found == "" {
+			found = path
+		}
+		complete := true
+		for _, name := range files {
+			if _, err := os.Stat(filepath.Join(path, name)); err != nil {
+				complete = false
+				break
+			}
+		}
+		if complete {
 			return path, nil
 		}
 	}
+	if found != "" {
+		return found, nil
+	}
 
-	return "", fmt.Errorf("beat_this models not found - run: uv run export_beat_this.py")
+	return "", fmt.Errorf("beat_this models not found - run: uv run export_beat_this.py, or set %s and use --download-models", BeatThisModelsURLEnv)
 }
 
 // getONNXLibPath returns the path to the ONNX Runtime shared library.
@@ -194,8 +483,15 @@ type BeatThisResult struct {
 	BPM        float64
 	Beats      []float64 // Beat timestamps in seconds
 	Downbeats  []int     // Indices into Beats that are downbeats
-	Duration   float64
-	SampleRate int
+	Duration   Seconds
+	SampleRate int      // Rate the model ran at after resampling (22050 Hz)
+	HopSize    Seconds  // Time between activation frames (20 ms)
+	Warnings   []string // Sanity-check warnings about the input audio
+
+	// Frame-wise beat and downbeat probabilities (0-1), only with
+	// BeatThisOptions.Activations
+	BeatActivations     []float32
+	DownbeatActivations []float32
 }
 
 // AnalyzeFile analyzes an audio file using beat_this.
@@ -209,13 +505,60 @@ func (a *BeatThisAnalyzer) AnalyzeFile(audioPath string) (*BeatThisResult, error
 	return a.AnalyzeSamples(samples, sampleRate)
 }
 
+// AnalyzeFiles analyzes audio files one after another with the same sessions,
+// decoding the next file while the current one runs through the model.
+// Results are in the order of paths. A file that fails has a nil result and
+// its error, prefixed with its path, joined into the returned error; the rest
+// of the batch still runs.
+func (a *BeatThisAnalyzer) AnalyzeFiles(paths []string) ([]*BeatThisResult, error) {
+	type loaded struct {
+		samples    []float32
+		sampleRate int
+		err        error
+	}
+	next := make(chan loaded, 1)
+	go func() {
+		defer close(next)
+		for _, path := range paths {
+			samples, sampleRate, err := LoadAudioMono(path)
+			next <- loaded{samples, sampleRate, err}
+		}
+	}()
+
+	results := make([]*BeatThisResult, len(paths))
+	var errs []error
+	for i, path := range paths {
+		l := <-next
+		if l.err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to load audio: %w", path, l.err))
+			continue
+		}
+		result, err := a.AnalyzeSamples(l.samples, l.sampleRate)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		results[i] = result
+	}
+	return results, errors.Join(errs...)
+}
+
 // AnalyzeSamples analyzes audio samples using beat_this.
 func (a *BeatThisAnalyzer) AnalyzeSamples(samples []float32, sampleRate int) (*BeatThisResult, error) {
-	duration := float64(len(samples)) / float64(sampleRate)
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	duration := FramesToSeconds(len(samples), float64(sampleRate))
+
+	// Only the samples are known here; AnalyzeFileWithContext checks the duration
+	warnings := SampleRateWarnings(len(samples), sampleRate, 0)
+	if w := resampleRatioWarning(sampleRate, a.sampleRate); w != "" {
+		warnings = append(warnings, w)
+	}
 
 	// Resample to 22050 Hz if needed
 	if sampleRate != a.sampleRate {
-		samples = resampleAudioBeatThis(samples, sampleRate, a.sampleRate)
+		samples = resampleLinear(samples, sampleRate, a.sampleRate)
 		sampleRate = a.sampleRate
 	}
 
@@ -231,19 +574,26 @@ func (a *BeatThisAnalyzer) AnalyzeSamples(samples []float32, sampleRate int) (*B
 		return nil, fmt.Errorf("beat tracking failed: %w", err)
 	}
 
-	// Extract beats and downbeats using peak detection
+	// Extract beats and downbeats using peak detection or the DBN
 	beats, downbeatIndices := a.extractBeatsAndDownbeats(beatLogits, downbeatLogits)
 
 	// Calculate BPM from beat intervals
-	bpm := calculateBPMFromBeatsBeatThis(beats)
+	bpm := calculateBPMFromBeatsBeatThis(beats, a.bpmRange)
 
-	return &BeatThisResult{
+	result := &BeatThisResult{
 		BPM:        bpm,
 		Beats:      beats,
 		Downbeats:  downbeatIndices,
 		Duration:   duration,
 		SampleRate: sampleRate,
-	}, nil
+		HopSize:    Seconds(float64(a.hopLength) / float64(a.sampleRate)),
+		Warnings:   warnings,
+	}
+	if a.activations {
+		result.BeatActivations = activationProbs(beatLogits)
+		result.DownbeatActivations = activationProbs(downbeatLogits)
+	}
+	return result, nil
 }
 
 // computeMelSpectrogram runs the mel spectrogram ONNX model.
@@ -306,47 +656,54 @@ func (a *BeatThisAnalyzer) computeMelSpectrogram(audio []float32) ([][]float32,
 
 // runBeatTracker runs the beat tracker model with chunking for long audio.
 func (a *BeatThisAnalyzer) runBeatTracker(mel [][]float32) ([]float32, []float32, error) {
-	numFrames := len(mel)
+	return stitchChunkLogits(len(mel), a.chunkSize, a.chunkOverlap, func(start, end int) ([]float32, []float32, error) {
+		return a.runBeatTrackerChunk(mel[start:end])
+	})
+}
 
+// stitchChunkLogits runs a beat tracker over numFrames frames in chunks of
+// chunkSize that overlap by overlap frames, and joins the beat and downbeat
+// logits onto one timeline. run returns the logits for frames [start, end).
+//
+// The model is least reliable near the edges of its input, so across each
+// overlap the logits are crossfaded linearly from the earlier chunk to the
+// later one rather than cut, and beats near a seam use both predictions.
+func stitchChunkLogits(numFrames, chunkSize, overlap int, run func(start, end int) ([]float32, []float32, error)) ([]float32, []float32, error) {
 	// For short audio, process in one go
-	if numFrames <= beatThisChunkSize {
-		return a.runBeatTrackerChunk(mel)
+	if numFrames <= chunkSize {
+		return run(0, numFrames)
 	}
 
-	// For long audio, process in overlapping chunks and stitch
-	var allBeatLogits []float32
-	var allDownbeatLogits []float32
-
-	chunkStart := 0
-	for chunkStart < numFrames {
-		chunkEnd := chunkStart + beatThisChunkSize
-		if chunkEnd > numFrames {
-			chunkEnd = numFrames
-		}
-
-		chunk := mel[chunkStart:chunkEnd]
-		beatLogits, downbeatLogits, err := a.runBeatTrackerChunk(chunk)
+	beatLogits := make([]float32, numFrames)
+	downbeatLogits := make([]float32, numFrames)
+	written := 0 // Frames already filled by earlier chunks
+	for start := 0; ; start += chunkSize - overlap {
+		end := min(start+chunkSize, numFrames)
+		beat, downbeat, err := run(start, end)
 		if err != nil {
 			return nil, nil, err
 		}
+		if len(beat) != end-start || len(downbeat) != end-start {
+			return nil, nil, fmt.Errorf("beat tracker returned %d frames for a %d frame chunk", len(beat), end-start)
+		}
 
-		if chunkStart == 0 {
-			// First chunk - take all
-			allBeatLogits = append(allBeatLogits, beatLogits...)
-			allDownbeatLogits = append(allDownbeatLogits, downbeatLogits...)
-		} else {
-			// Subsequent chunks - skip overlap region
-			skipFrames := beatThisOverlap / 2
-			if skipFrames < len(beatLogits) {
-				allBeatLogits = append(allBeatLogits, beatLogits[skipFrames:]...)
-				allDownbeatLogits = append(allDownbeatLogits, downbeatLogits[skipFrames:]...)
+		fade := written - start // Overlap with the previous chunk
+		for i := range beat {
+			if i >= fade {
+				beatLogits[start+i] = beat[i]
+				downbeatLogits[start+i] = downbeat[i]
+				continue
 			}
+			w := float32(i+1) / float32(fade+1) // Weight of this chunk, rising across the overlap
+			beatLogits[start+i] = (1-w)*beatLogits[start+i] + w*beat[i]
+			downbeatLogits[start+i] = (1-w)*downbeatLogits[start+i] + w*downbeat[i]
 		}
+		written = end
 
-		chunkStart += beatThisChunkSize - beatThisOverlap
+		if end == numFrames {
+			return beatLogits, downbeatLogits, nil
+		}
 	}
-
-	return allBeatLogits, allDownbeatLogits, nil
 }
 
 // runBeatTrackerChunk runs the beat tracker on a single chunk.
@@ -430,16 +787,15 @@ func (a *BeatThisAnalyzer) runBeatTrackerChunk(mel [][]float32) ([]float32, []fl
 // extractBeatsAndDownbeats converts model logits to beat timestamps.
 func (a *BeatThisAnalyzer) extractBeatsAndDownbeats(beatLogits, downbeatLogits []float32) ([]float64, []int) {
 	// Apply sigmoid to convert logits to probabilities
-	beatProbs := make([]float32, len(beatLogits))
-	downbeatProbs := make([]float32, len(downbeatLogits))
+	beatProbs := activationProbs(beatLogits)
+	downbeatProbs := activationProbs(downbeatLogits)
 
-	for i := range beatLogits {
-		beatProbs[i] = sigmoid(beatLogits[i])
-		downbeatProbs[i] = sigmoid(downbeatLogits[i])
+	hopSizeSeconds := float64(a.hopLength) / float64(a.sampleRate)
+	if a.postProcess == PostProcessDBN {
+		return dbnBeatsAndDownbeats(beatProbs, downbeatProbs, 1/hopSizeSeconds)
 	}
 
 	// Find beat peaks
-	hopSizeSeconds := float64(a.hopLength) / float64(a.sampleRate)
 	beatThreshold := float32(0.5)
 	minDistanceFrames := 20 // ~400ms at 50fps, allows up to 150 BPM
 
@@ -457,13 +813,28 @@ func (a *BeatThisAnalyzer) extractBeatsAndDownbeats(beatLogits, downbeatLogits [
 	return beats, downbeatIndices
 }
 
+// activationProbs converts model logits to probabilities.
+func activationProbs(logits []float32) []float32 {
+	probs := make([]float32, len(logits))
+	for i, x := range logits {
+		probs[i] = sigmoid(x)
+	}
+	return probs
+}
+
 // sigmoid applies the sigmoid function.
 func sigmoid(x float32) float32 {
 	return float32(1.0 / (1.0 + math.Exp(-float64(x))))
 }
 
 // findPeaksBeatThis finds peaks in probability array above threshold.
+// Non-finite probabilities are treated as zero.
 func findPeaksBeatThis(probs []float32, threshold float32, minDistance int, hopSizeSeconds float64) []float64 {
+	if hopSizeSeconds <= 0 {
+		return nil
+	}
+	probs = finiteActivation(probs)
+
 	var peaks []float64
 
 	for i := 1; i < len(probs)-1; i++ {
@@ -479,7 +850,7 @@ func findPeaksBeatThis(probs []float32, threshold float32, minDistance int, hopS
 
 		// Check minimum distance from previous peak
 		if len(peaks) > 0 {
-			lastPeakFrame := int(peaks[len(peaks)-1] / hopSizeSeconds)
+			lastPeakFrame := Seconds(peaks[len(peaks)-1]).Frames(1 / hopSizeSeconds)
 			if i-lastPeakFrame < minDistance {
 				// Keep the higher peak
 				if probs[i] > probs[lastPeakFrame] {
@@ -535,35 +906,9 @@ func matchDownbeatsToBeats(beats []float64, downbeatTimes []float64) []int {
 	return indices
 }
 
-// resampleAudioBeatThis resamples audio from srcRate to dstRate using linear interpolation.
-// This is a copy to avoid build tag issues with the TF version.
-func resampleAudioBeatThis(samples []float32, srcRate, dstRate int) []float32 {
-	if srcRate == dstRate {
-		return samples
-	}
-
-	ratio := float64(srcRate) / float64(dstRate)
-	newLen := int(float64(len(samples)) / ratio)
-	result := make([]float32, newLen)
-
-	for i := 0; i < newLen; i++ {
-		srcIdx := float64(i) * ratio
-		srcIdxInt := int(srcIdx)
-		frac := float32(srcIdx - float64(srcIdxInt))
-
-		if srcIdxInt+1 < len(samples) {
-			result[i] = samples[srcIdxInt]*(1-frac) + samples[srcIdxInt+1]*frac
-		} else if srcIdxInt < len(samples) {
-			result[i] = samples[srcIdxInt]
-		}
-	}
-
-	return result
-}
-
 // calculateBPMFromBeatsBeatThis estimates BPM from beat timestamps.
 // This is a local copy to avoid build tag issues with the TF version.
-func calculateBPMFromBeatsBeatThis(beats []float64) float64 {
+func calculateBPMFromBeatsBeatThis(beats []float64, bpmRange BPMRange) float64 {
 	if len(beats) < 2 {
 		return 0
 	}
@@ -583,31 +928,32 @@ func calculateBPMFromBeatsBeatThis(beats []float64) float64 {
 
 	// Calculate median interval
 	median := medianFloat64BeatThis(intervals)
+	if median <= 0 {
+		return 0
+	}
 
 	// Convert to BPM
 	bpm := 60.0 / median
 
-	// Normalize to reasonable BPM range (60-180)
-	for bpm < 60 {
-		bpm *= 2
-	}
-	for bpm > 180 {
-		bpm /= 2
-	}
+	// Normalize to the BPM range (60-180 by default)
+	bpm = bpmRange.Normalize(bpm)
 
 	return math.Round(bpm*100) / 100
 }
 
-// medianFloat64BeatThis returns the median of a slice of float64 values.
+// medianFloat64BeatThis returns the median of the finite values in a slice of float64 values.
 func medianFloat64BeatThis(values []float64) float64 {
-	if len(values) == 0 {
+	// Make a copy to avoid modifying the original, skipping NaN and ±Inf
+	sorted := make([]float64, 0, len(values))
+	for _, v := range values {
+		if isFinite(v) {
+			sorted = append(sorted, v)
+		}
+	}
+	if len(sorted) == 0 {
 		return 0
 	}
 
-	// Make a copy to avoid modifying the original
-	sorted := make([]float64, len(values))
-	copy(sorted, values)
-
 	// Simple sort
 	sort.Float64s(sorted)
 
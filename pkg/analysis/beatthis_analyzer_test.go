@@ -0,0 +1,194 @@
+package analysis
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResampleLinear(t *testing.T) {
+	// Resampled length matches the source duration exactly, with no sample
+	// lost to float truncation, at the beat_this and rekordbox-go rates
+	for _, dstRate := range []int{beatThisSampleRate, 44100} {
+		for _, srcRate := range []int{8000, 11025, 32000, 44100, 48000, 96000} {
+			for _, secs := range []int{1, 2, 5, 60, 600} {
+				out := resampleLinear(make([]float32, srcRate*secs), srcRate, dstRate)
+				assert.Len(t, out, dstRate*secs, "%d Hz to %d Hz, %ds", srcRate, dstRate, secs)
+			}
+		}
+	}
+
+	// Clicks analyzed after resampling land within one frame of the same
+	// analysis at the original rate, even at the end of a long track
+	hopSecs := float64(beatThisHopLength) / beatThisSampleRate
+	clickTimes := func(samples []float32, rate int) []float64 {
+		hop := int(math.Round(hopSecs * float64(rate)))
+		env := make([]float32, len(samples)/hop)
+		for i := range env {
+			for _, v := range samples[i*hop : (i+1)*hop] {
+				env[i] += v * v
+			}
+		}
+		return findPeaksBeatThis(env, 1e-3, 20, hopSecs)
+	}
+
+	const srcRate, bpm, secs = 48000, 123.0, 600
+	src := make([]float32, srcRate*secs)
+	for beat := 0.25; beat < secs-1; beat += 60 / bpm {
+		start := int(beat * srcRate)
+		for j := range 240 { // 5 ms Hann burst
+			src[start+j] = float32(math.Sin(math.Pi * float64(j) / 240))
+		}
+	}
+
+	want := clickTimes(src, srcRate)
+	got := clickTimes(resampleLinear(src, srcRate, beatThisSampleRate), beatThisSampleRate)
+	require.Len(t, got, len(want))
+	require.NotEmpty(t, want)
+	for i := range want {
+		assert.InDelta(t, want[i], got[i], hopSecs+1e-9, "beat %d", i)
+	}
+	assert.InDelta(t, 60/bpm*float64(len(want)-1)+0.25, got[len(got)-1], hopSecs)
+}
+
+func TestStitchChunkLogits(t *testing.T) {
+	const numFrames = 4000 // Three chunks
+
+	// truth has a beat every 25 frames and a downbeat every 100
+	truth := func(f, period int) float32 {
+		d := f % period
+		d = min(d, period-d)
+		return 5 - 2*float32(d)
+	}
+
+	// The fake model misses beats within 10 frames of a chunk edge that cuts
+	// into the track, as the real model does with too little context
+	var chunks [][2]int
+	run := func(start, end int) ([]float32, []float32, error) {
+		chunks = append(chunks, [2]int{start, end})
+		beat := make([]float32, end-start)
+		downbeat := make([]float32, end-start)
+		for i := range beat {
+			beat[i], downbeat[i] = truth(start+i, 25), truth(start+i, 100)
+			if (start > 0 && i < 10) || (end < numFrames && end-start-i <= 10) {
+				beat[i], downbeat[i] = -5, -5
+			}
+		}
+		return beat, downbeat, nil
+	}
+
+	a := &BeatThisAnalyzer{hopLength: beatThisHopLength, sampleRate: beatThisSampleRate}
+	singleBeat, singleDownbeat, err := run(0, numFrames)
+	require.NoError(t, err)
+	wantBeats, wantDownbeats := a.extractBeatsAndDownbeats(singleBeat, singleDownbeat)
+
+	chunks = nil
+	beat, downbeat, err := stitchChunkLogits(numFrames, beatThisChunkSize, beatThisOverlap, run)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int{{0, 1500}, {1350, 2850}, {2700, 4000}}, chunks)
+	require.Len(t, beat, numFrames, "chunks are placed on one timeline")
+	require.Len(t, downbeat, numFrames)
+
+	// Beats in and around the overlaps match the single pass
+	gotBeats, gotDownbeats := a.extractBeatsAndDownbeats(beat, downbeat)
+	require.Len(t, gotBeats, len(wantBeats))
+	hopSecs := float64(beatThisHopLength) / beatThisSampleRate
+	for i := range wantBeats {
+		assert.InDelta(t, wantBeats[i], gotBeats[i], hopSecs, "beat %d", i)
+	}
+	assert.Equal(t, wantDownbeats, gotDownbeats)
+
+	// Short input is a single chunk
+	chunks = nil
+	beat, _, err = stitchChunkLogits(1000, beatThisChunkSize, beatThisOverlap, run)
+	require.NoError(t, err)
+	assert.Len(t, beat, 1000)
+	assert.Len(t, chunks, 1)
+}
+
+func TestBeatThisProvider(t *testing.T) {
+	p, err := ParseBeatThisProvider("")
+	require.NoError(t, err)
+	assert.Equal(t, BeatThisProviderAuto, p)
+	_, err = ParseBeatThisProvider("tpu")
+	assert.Error(t, err)
+
+	// Auto picks the platform's accelerator; explicit providers are kept
+	assert.Equal(t, BeatThisProviderCoreML, BeatThisProviderAuto.platformProvider("darwin"))
+	assert.Equal(t, BeatThisProviderCUDA, BeatThisProviderAuto.platformProvider("linux"))
+	assert.Equal(t, BeatThisProviderDirectML, BeatThisProviderAuto.platformProvider("windows"))
+	assert.Equal(t, BeatThisProviderCPU, BeatThisProviderAuto.platformProvider("freebsd"))
+	assert.Equal(t, BeatThisProviderCPU, BeatThisProviderCPU.platformProvider("darwin"))
+}
+
+func TestActivationProbs(t *testing.T) {
+	probs := activationProbs([]float32{0, -20, 20})
+	require.Len(t, probs, 3)
+	assert.InDelta(t, 0.5, probs[0], 1e-6)
+	assert.InDelta(t, 0, probs[1], 1e-6)
+	assert.InDelta(t, 1, probs[2], 1e-6)
+}
+
+func TestAnalyzeFilesErrors(t *testing.T) {
+	// Files that fail to load get their own error and a nil result
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.wav"), filepath.Join(dir, "b.mp3")}
+	results, err := (&BeatThisAnalyzer{}).AnalyzeFiles(paths)
+	require.Error(t, err)
+	assert.Equal(t, []*BeatThisResult{nil, nil}, results)
+	assert.ErrorContains(t, err, paths[0])
+	assert.ErrorContains(t, err, paths[1])
+}
+
+func TestStitchChunkLogitsDrift(t *testing.T) {
+	// Ten minutes at 128 BPM, a beat every 23.4375 frames, so beats fall
+	// between frames and chunk boundaries land at every phase of the beat
+	const numFrames = 30000
+	const period, phase = 50 * 60 / 128.0, 5.1
+	model := func(start, end int) ([]float32, []float32, error) {
+		beat := make([]float32, end-start)
+		downbeat := make([]float32, end-start)
+		for i := range beat {
+			f := float64(start+i) - phase
+			d := math.Abs(f - period*math.Round(f/period))
+			beat[i] = float32(5 - 4*d)
+			downbeat[i] = -5
+			if (start > 0 && i < 10) || (end < numFrames && end-start-i <= 10) {
+				beat[i] = -5
+			}
+		}
+		return beat, downbeat, nil
+	}
+
+	a := &BeatThisAnalyzer{hopLength: beatThisHopLength, sampleRate: beatThisSampleRate}
+	hopSecs := float64(beatThisHopLength) / beatThisSampleRate
+	for _, opts := range []BeatThisOptions{{}, {ChunkSize: 500}, {ChunkSize: 300, ChunkOverlap: 60}} {
+		size, overlap, err := opts.chunking()
+		require.NoError(t, err)
+		beat, downbeat, err := stitchChunkLogits(numFrames, size, overlap, model)
+		require.NoError(t, err)
+		beats, _ := a.extractBeatsAndDownbeats(beat, downbeat)
+
+		// Every beat is found within a frame of the truth, and the error
+		// doesn't grow from the first minute to the last
+		require.Len(t, beats, int(math.Floor((numFrames-phase)/period))+1, "chunk size %d", size)
+		var first, last float64
+		for i, b := range beats {
+			e := b - (phase+float64(i)*period)*hopSecs
+			assert.LessOrEqual(t, math.Abs(e), hopSecs, "chunk size %d beat %d", size, i)
+			if i < 128 {
+				first += e / 128
+			} else if i >= len(beats)-128 {
+				last += e / 128
+			}
+		}
+		assert.InDelta(t, first, last, hopSecs/4, "chunk size %d drifts", size)
+	}
+
+	// Overlaps must be shorter than chunks
+	_, _, err := BeatThisOptions{ChunkSize: 100, ChunkOverlap: 100}.chunking()
+	assert.Error(t, err)
+}
@@ -0,0 +1,192 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides dynamic Bayesian network decoding of beat_this activations.
+package analysis
+
+import (
+	"math"
+	"sort"
+)
+
+// DBN parameters, matching the madmom DBNDownBeatTrackingProcessor that the
+// beat_this reference post-processes with.
+const (
+	dbnMinBPM            = 55.0
+	dbnMaxBPM            = 215.0
+	dbnTransitionLambda  = 100.0 // Higher favors a constant tempo
+	dbnObservationLambda = 16.0  // Beats are expected in the first 1/λ of each beat period
+	dbnEpsilon           = 1e-5  // Keeps probabilities off 0 and 1
+)
+
+// dbnBeatsPerBar are the meters decoded; the most likely one wins.
+var dbnBeatsPerBar = []int{3, 4}
+
+// dbnBlock is the run of states for one beat of a bar at one tempo, one state
+// per frame of the beat period.
+type dbnBlock struct {
+	meter  int // Index into dbnBeatsPerBar
+	beat   int // Beat within the bar, 0 for the downbeat
+	tempo  int // Index into the beat periods
+	offset int // Index of the block's first state
+}
+
+// dbnBeatsAndDownbeats decodes beat and downbeat probabilities at fps frames
+// per second into a tempo-consistent grid with a bar-pointer hidden Markov
+// model (Krebs et al. 2015, as in madmom). Each state is a frame within a
+// beat period, a beat within a bar, and a meter. The position advances one
+// frame at a time, and the tempo may only change from one beat to the next,
+// so the Viterbi path can't jump to an off-beat peak or skip a soft beat.
+// Each decoded beat is then moved to the strongest activation within its beat
+// region. Returns the beat times in seconds and the indices of the downbeats.
+func dbnBeatsAndDownbeats(beatProbs, downbeatProbs []float32, fps float64) ([]float64, []int) {
+	n := min(len(beatProbs), len(downbeatProbs))
+	if n == 0 || fps <= 0 {
+		return nil, nil
+	}
+	beatProbs, downbeatProbs = finiteActivation(beatProbs[:n]), finiteActivation(downbeatProbs[:n])
+
+	// Beat periods in frames, and the log probability of moving between them
+	var periods []int
+	for p := max(1, int(math.Round(60*fps/dbnMaxBPM))); p <= int(math.Round(60*fps/dbnMinBPM)); p++ {
+		periods = append(periods, p)
+	}
+	if len(periods) == 0 {
+		return nil, nil
+	}
+	trans := make([][]float64, len(periods))
+	for i, from := range periods {
+		trans[i] = make([]float64, len(periods))
+		var sum float64
+		for j, to := range periods {
+			trans[i][j] = math.Exp(-dbnTransitionLambda * math.Abs(float64(to)/float64(from)-1))
+			sum += trans[i][j]
+		}
+		for j := range trans[i] {
+			trans[i][j] = math.Log(trans[i][j] / sum)
+		}
+	}
+	region := func(period int) int {
+		return int(math.Ceil(float64(period) / dbnObservationLambda))
+	}
+
+	var blocks []dbnBlock
+	index := make([][][]int, len(dbnBeatsPerBar)) // Block of [meter][beat][tempo]
+	numStates := 0
+	for m, bpb := range dbnBeatsPerBar {
+		index[m] = make([][]int, bpb)
+		for b := range bpb {
+			index[m][b] = make([]int, len(periods))
+			for k, period := range periods {
+				index[m][b][k] = len(blocks)
+				blocks = append(blocks, dbnBlock{meter: m, beat: b, tempo: k, offset: numStates})
+				numStates += period
+			}
+		}
+	}
+
+	// Log observation probabilities of downbeat, other beat, and no beat
+	// states, with the beat activation excluding downbeats as in beat_this
+	observe := func(t int) (down, beat, none float64) {
+		pb := float64(beatProbs[t])*(1-dbnEpsilon) + dbnEpsilon/2
+		pd := float64(downbeatProbs[t])*(1-dbnEpsilon) + dbnEpsilon/2
+		pb = max(pb-pd, dbnEpsilon/2)
+		return math.Log(pd), math.Log(pb), math.Log(max(1-pb-pd, dbnEpsilon) / (dbnObservationLambda - 1))
+	}
+
+	// Viterbi, keeping only the previous tempo at each beat start since
+	// every other state has one predecessor
+	prev := make([]float64, numStates)
+	cur := make([]float64, numStates)
+	back := make([]int16, n*len(blocks))
+	down, beat, none := observe(0)
+	for _, blk := range blocks {
+		o := beat
+		if blk.beat == 0 {
+			o = down
+		}
+		period := periods[blk.tempo]
+		for p := range period {
+			prev[blk.offset+p] = none
+			if p < region(period) {
+				prev[blk.offset+p] = o
+			}
+		}
+	}
+	for t := 1; t < n; t++ {
+		down, beat, none := observe(t)
+		for bi, blk := range blocks {
+			o := beat
+			if blk.beat == 0 {
+				o = down
+			}
+			period := periods[blk.tempo]
+			r := region(period)
+			for p := period - 1; p >= 1; p-- {
+				obs := none
+				if p < r {
+					obs = o
+				}
+				cur[blk.offset+p] = prev[blk.offset+p-1] + obs
+			}
+
+			bpb := dbnBeatsPerBar[blk.meter]
+			from := index[blk.meter][(blk.beat+bpb-1)%bpb]
+			best, arg := math.Inf(-1), 0
+			for k, period := range periods {
+				if v := prev[blocks[from[k]].offset+period-1] + trans[k][blk.tempo]; v > best {
+					best, arg = v, k
+				}
+			}
+			cur[blk.offset] = best + o
+			back[t*len(blocks)+bi] = int16(arg)
+		}
+		prev, cur = cur, prev
+	}
+
+	// Backtrack from the most likely final state
+	s := 0
+	for i, v := range prev {
+		if v > prev[s] {
+			s = i
+		}
+	}
+	bi := sort.Search(len(blocks), func(i int) bool { return blocks[i].offset > s }) - 1
+	p := s - blocks[bi].offset
+	pathBlock := make([]int, n)
+	inRegion := make([]bool, n)
+	for t := n - 1; t >= 0; t-- {
+		pathBlock[t] = bi
+		inRegion[t] = p < region(periods[blocks[bi].tempo])
+		if t == 0 {
+			break
+		}
+		if p > 0 {
+			p--
+			continue
+		}
+		blk := blocks[bi]
+		k := int(back[t*len(blocks)+bi])
+		bpb := dbnBeatsPerBar[blk.meter]
+		bi = index[blk.meter][(blk.beat+bpb-1)%bpb][k]
+		p = periods[k] - 1
+	}
+
+	// One beat per beat region, at its strongest activation
+	var beats []float64
+	var downbeats []int
+	for t := 0; t < n; t++ {
+		if !inRegion[t] {
+			continue
+		}
+		peak := t
+		for ; t+1 < n && inRegion[t+1] && pathBlock[t+1] == pathBlock[t]; t++ {
+			if beatProbs[t+1] > beatProbs[peak] {
+				peak = t + 1
+			}
+		}
+		if blocks[pathBlock[peak]].beat == 0 {
+			downbeats = append(downbeats, len(beats))
+		}
+		beats = append(beats, float64(peak)/fps)
+	}
+	return beats, downbeats
+}
@@ -0,0 +1,85 @@
+package analysis
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBNPostProcess(t *testing.T) {
+	// A minute of soft 120 BPM activations at 50 fps: a beat every 25 frames
+	// with jitter and weak peaks, spurious off-beat peaks, and a downbeat
+	// every 4 beats
+	const frames, period = 3000, 25
+	rng := rand.New(rand.NewPCG(1, 2))
+	beatProbs := make([]float32, frames)
+	downbeatProbs := make([]float32, frames)
+	bump := func(probs []float32, center int, height float64) {
+		for f := max(center-3, 0); f <= min(center+3, frames-1); f++ {
+			d := float64(f - center)
+			probs[f] = max(probs[f], float32(height*math.Exp(-d*d/2)))
+		}
+	}
+	for i := range frames / period {
+		center := 10 + i*period + rng.IntN(5) - 2
+		height := 0.3 + 0.6*rng.Float64()
+		bump(beatProbs, center, height)
+		if i%4 == 0 {
+			bump(downbeatProbs, center, 0.8*height)
+		}
+		if rng.Float64() < 0.2 {
+			bump(beatProbs, center+period/2, 0.5+0.2*rng.Float64())
+		}
+	}
+	logits := func(probs []float32) []float32 {
+		out := make([]float32, len(probs))
+		for i, p := range probs {
+			p = min(max(p, 0.01), 0.99)
+			out[i] = float32(math.Log(float64(p / (1 - p))))
+		}
+		return out
+	}
+
+	ibiVariance := func(beats []float64) float64 {
+		var mean, sq float64
+		for i := 1; i < len(beats); i++ {
+			mean += beats[i] - beats[i-1]
+		}
+		mean /= float64(len(beats) - 1)
+		for i := 1; i < len(beats); i++ {
+			d := beats[i] - beats[i-1] - mean
+			sq += d * d
+		}
+		return sq / float64(len(beats)-1)
+	}
+
+	analyze := func(pp BeatThisPostProcess) ([]float64, []int) {
+		a := &BeatThisAnalyzer{hopLength: beatThisHopLength, sampleRate: beatThisSampleRate, postProcess: pp}
+		return a.extractBeatsAndDownbeats(logits(beatProbs), logits(downbeatProbs))
+	}
+	peakBeats, _ := analyze(PostProcessPeak)
+	dbnBeats, dbnDownbeats := analyze(PostProcessDBN)
+	require.Greater(t, len(peakBeats), 1)
+	require.Greater(t, len(dbnBeats), 1)
+
+	peakVar, dbnVar := ibiVariance(peakBeats), ibiVariance(dbnBeats)
+	t.Logf("peak: %d beats, IBI variance %.5f; dbn: %d beats, IBI variance %.5f", len(peakBeats), peakVar, len(dbnBeats), dbnVar)
+	assert.Less(t, dbnVar, peakVar/4)
+	assert.InDelta(t, frames/period, len(dbnBeats), 2)
+	assert.InDelta(t, 120, calculateBPMFromBeatsBeatThis(dbnBeats, DefaultBPMRange), 1)
+
+	// Downbeats fall every 4 beats on the accented beats
+	require.Greater(t, len(dbnDownbeats), 10)
+	for i := 1; i < len(dbnDownbeats); i++ {
+		assert.Equal(t, 4, dbnDownbeats[i]-dbnDownbeats[i-1])
+	}
+	first := int(math.Round((dbnBeats[dbnDownbeats[0]]*50 - 10) / period))
+	assert.Zero(t, first%4, "first downbeat on beat %d", first)
+
+	beats, downbeats := dbnBeatsAndDownbeats(nil, nil, 50)
+	assert.Empty(t, beats)
+	assert.Empty(t, downbeats)
+}
@@ -0,0 +1,156 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides downloading of pre-exported beat_this ONNX models.
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Environment variables controlling beat_this model downloads.
+const (
+	// BeatThisModelsURLEnv is the base URL serving the exported models
+	// (mel.onnx, model_small.onnx, ...) and a SHA256SUMS file listing them.
+	BeatThisModelsURLEnv = "MIXXXLAB_BEATTHIS_MODELS_URL"
+
+	// OfflineEnv disables all model downloads when set to a non-empty value.
+	OfflineEnv = "MIXXXLAB_OFFLINE"
+)
+
+// beatThisModelsDir is where downloaded models are stored, matching the
+// first location findBeatThisModels checks.
+const beatThisModelsDir = "models/beat_this"
+
+// EnsureBeatThisModels downloads any beat_this ONNX models that are missing
+// locally or don't match their checksum, so beat_this runs without the Python
+// export toolchain. Files are listed by the SHA256SUMS file at
+// $MIXXXLAB_BEATTHIS_MODELS_URL and each download is verified against its
+// checksum. It returns the models directory. Nothing is downloaded if
+// $MIXXXLAB_OFFLINE is set. Progress is reported to logf if it is non-nil.
+//
+// If the models directory is read-only, as in packaged or containerized
+// installs, models are downloaded to the user cache directory instead
+// (e.g. ~/.cache/mixxxlab/models/beat_this), where findBeatThisModels also looks.
+func EnsureBeatThisModels(logf func(format string, args ...any)) (string, error) {
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+	baseURL := os.Getenv(BeatThisModelsURLEnv)
+	if baseURL == "" {
+		return "", fmt.Errorf("%s is not set", BeatThisModelsURLEnv)
+	}
+	if os.Getenv(OfflineEnv) != "" {
+		return "", fmt.Errorf("model download disabled by %s", OfflineEnv)
+	}
+
+	dir := beatThisModelsDir
+	if found, err := findBeatThisModels(); err == nil {
+		dir = found
+	}
+	if err := checkWritableDir(dir); err != nil {
+		cacheDir, cacheErr := userBeatThisModelsDir()
+		if cacheErr == nil {
+			cacheErr = checkWritableDir(cacheDir)
+		}
+		if cacheErr != nil {
+			return "", fmt.Errorf("models dir %s is not writable (%w) and no user cache dir is available: %w", dir, err, cacheErr)
+		}
+		logf("Models dir %s is not writable, downloading to %s", dir, cacheDir)
+		dir = cacheDir
+	}
+	return dir, downloadBeatThisModels(baseURL, dir, logf)
+}
+
+// userBeatThisModelsDir returns the per-user directory for downloaded models.
+func userBeatThisModelsDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mixxxlab", beatThisModelsDir), nil
+}
+
+// checkWritableDir creates dir if needed and checks that files can be created
+// in it, since permissions alone don't account for read-only mounts.
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// downloadBeatThisModels fetches every file listed in baseURL/SHA256SUMS
+// that is not already in dir with the listed checksum.
+func downloadBeatThisModels(baseURL, dir string, logf func(format string, args ...any)) error {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	sums, err := fetchSHA256Sums(baseURL + "/SHA256SUMS")
+	if err != nil {
+		return err
+	}
+	if _, ok := sums["mel.onnx"]; !ok {
+		return fmt.Errorf("%s/SHA256SUMS does not list mel.onnx", baseURL)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create models dir: %w", err)
+	}
+	for name, sum := range sums {
+		path := filepath.Join(dir, name)
+		if got, err := hashFile(path); err == nil {
+			if got == sum {
+				continue
+			}
+			logf("beat_this model %s does not match its checksum, downloading again", name)
+		}
+		logf("Downloading beat_this model %s...", name)
+		if _, err := fetch(baseURL+"/"+name, path, sum, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchSHA256Sums downloads and parses a sha256sum-style checksum file,
+// returning checksums keyed by file name. Only plain .onnx file names are
+// accepted so a checksum file cannot write outside the models directory.
+func fetchSHA256Sums(url string) (map[string]string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: unexpected status: %s", url, resp.Status)
+	}
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 1<<20))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || len(fields[0]) != 64 {
+			return nil, fmt.Errorf("%s line %d: expected \"<sha256>  <file>\"", url, line)
+		}
+		name := strings.TrimPrefix(fields[1], "*") // Binary-mode marker
+		if name != filepath.Base(name) || filepath.Ext(name) != ".onnx" {
+			return nil, fmt.Errorf("%s line %d: invalid model file %q", url, line, name)
+		}
+		sums[name] = strings.ToLower(fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", url, err)
+	}
+	return sums, nil
+}
@@ -0,0 +1,182 @@
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsureBeatThisModels(t *testing.T) {
+	defer func(b time.Duration) { fixtureBackoff = b }(fixtureBackoff)
+	fixtureBackoff = time.Millisecond
+
+	files := map[string][]byte{
+		"mel.onnx":         []byte("fake mel"),
+		"model_small.onnx": []byte("fake model"),
+	}
+	sums := ""
+	for name, data := range files {
+		sum := sha256.Sum256(data)
+		sums += fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Base(r.URL.Path)
+		requests[name]++
+		if name == "SHA256SUMS" {
+			fmt.Fprint(w, sums)
+			return
+		}
+		if name == "model_small.onnx" && requests[name] == 1 {
+			w.Write([]byte("corrupted")) // Fails verification, then serves the real file
+			return
+		}
+		w.Write(files[name])
+	}))
+	defer srv.Close()
+
+	t.Chdir(t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	// Downloads are opt-in via the models URL
+	t.Setenv(BeatThisModelsURLEnv, "")
+	_, err := EnsureBeatThisModels(nil)
+	assert.ErrorContains(t, err, BeatThisModelsURLEnv)
+
+	t.Setenv(BeatThisModelsURLEnv, srv.URL+"/")
+	t.Setenv(OfflineEnv, "1")
+	_, err = EnsureBeatThisModels(nil)
+	assert.ErrorContains(t, err, OfflineEnv)
+	assert.Empty(t, requests)
+
+	// A corrupted download is rejected and leaves nothing behind
+	t.Setenv(OfflineEnv, "")
+	dir, err := EnsureBeatThisModels(nil)
+	assert.ErrorContains(t, err, "checksum mismatch")
+	assert.NoFileExists(t, filepath.Join(dir, "model_small.onnx"))
+	assert.NoFileExists(t, filepath.Join(dir, "model_small.onnx.part"))
+
+	dir, err = EnsureBeatThisModels(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "models/beat_this", filepath.ToSlash(dir))
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	// Existing models are not downloaded again
+	_, err = EnsureBeatThisModels(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests["mel.onnx"])
+	assert.Equal(t, 2, requests["model_small.onnx"])
+
+	// A model that doesn't match its checksum is downloaded again
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mel.onnx"), []byte("truncated"), 0644))
+	var logs []string
+	_, err = EnsureBeatThisModels(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests["mel.onnx"])
+	got, err := os.ReadFile(filepath.Join(dir, "mel.onnx"))
+	require.NoError(t, err)
+	assert.Equal(t, files["mel.onnx"], got)
+	assert.Equal(t, []string{
+		"beat_this model mel.onnx does not match its checksum, downloading again",
+		"Downloading beat_this model mel.onnx...",
+	}, logs)
+}
+
+func TestEnsureBeatThisModelsReadOnly(t *testing.T) {
+	data := []byte("fake mel")
+	sum := sha256.Sum256(data)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if filepath.Base(r.URL.Path) == "SHA256SUMS" {
+			fmt.Fprintf(w, "%s  mel.onnx\n", hex.EncodeToString(sum[:]))
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+	t.Setenv(BeatThisModelsURLEnv, srv.URL)
+	t.Setenv(OfflineEnv, "")
+
+	// ensure checks that models land in the user cache dir
+	ensure := func(t *testing.T) {
+		cache := t.TempDir()
+		t.Setenv("XDG_CACHE_HOME", cache)
+		t.Setenv("HOME", cache)
+		want, err := userBeatThisModelsDir()
+		require.NoError(t, err)
+
+		dir, err := EnsureBeatThisModels(nil)
+		require.NoError(t, err)
+		assert.Equal(t, want, dir)
+		assert.FileExists(t, filepath.Join(dir, "mel.onnx"))
+
+		found, err := findBeatThisModels("mel.onnx")
+		require.NoError(t, err)
+		assert.Equal(t, want, found, "downloaded models are found")
+	}
+
+	t.Run("read-only dir", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("root can write to read-only directories")
+		}
+		t.Chdir(t.TempDir())
+		require.NoError(t, os.MkdirAll("models/beat_this", 0755))
+		require.NoError(t, os.Chmod("models/beat_this", 0555))
+		defer os.Chmod("models/beat_this", 0755)
+		ensure(t)
+	})
+
+	t.Run("uncreatable dir", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+		require.NoError(t, os.WriteFile("models", nil, 0644)) // A file where the directory should be
+		ensure(t)
+	})
+
+	t.Run("no fallback", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+		require.NoError(t, os.WriteFile("models", nil, 0644))
+		t.Setenv("XDG_CACHE_HOME", "")
+		t.Setenv("HOME", "")
+		_, err := EnsureBeatThisModels(nil)
+		assert.ErrorContains(t, err, "models dir models/beat_this is not writable")
+	})
+}
+
+func TestFetchSHA256Sums(t *testing.T) {
+	sum := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	body := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	body = sum + "  mel.onnx\n\n" + sum + " *model_full.onnx\n"
+	sums, err := fetchSHA256Sums(srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"mel.onnx": sum, "model_full.onnx": sum}, sums)
+
+	// Paths outside the models directory are rejected
+	body = sum + "  ../mel.onnx\n"
+	_, err = fetchSHA256Sums(srv.URL)
+	assert.ErrorContains(t, err, "invalid model file")
+
+	body = "abc mel.onnx\n"
+	_, err = fetchSHA256Sums(srv.URL)
+	assert.ErrorContains(t, err, "line 1")
+}
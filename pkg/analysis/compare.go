@@ -0,0 +1,368 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides side-by-side comparison of grid analyzer results.
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// GridSummary condenses one grid analyzer's result for comparison.
+type GridSummary struct {
+	Name      string  `json:"name"`
+	BPM       float64 `json:"bpm"`
+	Beats     int     `json:"beats"`
+	Downbeats int     `json:"downbeats"`
+	Seconds   float64 `json:"seconds,omitempty"` // Analysis time, if timed
+	Error     string  `json:"error,omitempty"`
+}
+
+// PairAgreement is the beat F-measure between two grids (1.0 = identical beats).
+// OctaveFMeasure scores B after normalizing it to A's tempo octave, so a grid at
+// double or half tempo isn't counted as a disagreement.
+type PairAgreement struct {
+	A              string  `json:"a"`
+	B              string  `json:"b"`
+	FMeasure       float64 `json:"f_measure"`
+	OctaveFMeasure float64 `json:"octave_f_measure"`
+}
+
+// Comparison summarizes how the grid analyzers agree on a single track.
+type Comparison struct {
+	File      string          `json:"file"`
+	Duration  Seconds         `json:"duration"`
+	Grids     []GridSummary   `json:"grids"`
+	Agreement []PairAgreement `json:"agreement"`
+	Warnings  []string        `json:"warnings,omitempty"`
+	Decode    float64         `json:"decode,omitempty"` // Shared audio decoding time in seconds, if timed
+	Elapsed   float64         `json:"elapsed"`          // Total analysis time in seconds
+}
+
+// GridAgreement returns the beat F-measure between two beat lists.
+// The score is symmetric since precision and recall swap roles.
+func GridAgreement(a, b []float64) float64 {
+	return Evaluate(a, b, DefaultEvalTolerance).FMeasure
+}
+
+// Compare builds a Comparison from a track analysis.
+// Grids are sorted by name and agreement is computed for every successful pair.
+// Times come from TrackAnalysis.Timings.
+func Compare(ta *TrackAnalysis) *Comparison {
+	c := &Comparison{
+		File:     ta.File,
+		Duration: ta.Duration,
+		Warnings: ta.Warnings,
+		Decode:   ta.Timings[TimingDecode],
+	}
+
+	names := make([]string, 0, len(ta.Grids))
+	for name := range ta.Grids {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		g := ta.Grids[name]
+		c.Grids = append(c.Grids, GridSummary{
+			Name:      name,
+			BPM:       g.BPM,
+			Beats:     len(g.Beats),
+			Downbeats: len(g.Downbeats),
+			Seconds:   ta.Timings[name],
+			Error:     g.Error,
+		})
+	}
+
+	for i, a := range names {
+		for _, b := range names[i+1:] {
+			ga, gb := ta.Grids[a], ta.Grids[b]
+			if ga.Error != "" || gb.Error != "" {
+				continue
+			}
+			c.Agreement = append(c.Agreement, PairAgreement{
+				A:              a,
+				B:              b,
+				FMeasure:       GridAgreement(ga.Beats, gb.Beats),
+				OctaveFMeasure: GridAgreement(ga.Beats, NormalizeOctave(gb.Beats, ga.BPM)),
+			})
+		}
+	}
+
+	return c
+}
+
+// WriteTable prints the comparison as aligned text tables.
+func (c *Comparison) WriteTable(w io.Writer) error {
+	fmt.Fprintf(w, "%s (%.1fs, analyzed in %.2fs", c.File, c.Duration, c.Elapsed)
+	if c.Decode > 0 {
+		fmt.Fprintf(w, ", decoded in %.2fs", c.Decode)
+	}
+	fmt.Fprint(w, ")\n\n")
+	for _, warning := range c.Warnings {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+	if len(c.Warnings) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ANALYZER\tBPM\tBEATS\tDOWNBEATS\tSECONDS")
+	for _, g := range c.Grids {
+		seconds := "-"
+		if g.Seconds > 0 {
+			seconds = fmt.Sprintf("%.2f", g.Seconds)
+		}
+		if g.Error != "" {
+			fmt.Fprintf(tw, "%s\terror: %s\t\t\t%s\n", g.Name, g.Error, seconds)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%.2f\t%d\t%d\t%s\n", g.Name, g.BPM, g.Beats, g.Downbeats, seconds)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(c.Agreement) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PAIR\tF-MEASURE\tOCTAVE-NORMALIZED")
+	for _, p := range c.Agreement {
+		fmt.Fprintf(tw, "%s vs %s\t%.3f\t%.3f\n", p.A, p.B, p.FMeasure, p.OctaveFMeasure)
+	}
+	return tw.Flush()
+}
+
+// Disagreement measures how strongly the grid analyzers disagree on one track.
+// Tracks with high scores are the ones most likely to need a manual grid.
+type Disagreement struct {
+	File        string             `json:"file"`
+	Sidecar     string             `json:"sidecar,omitempty"`
+	BPMs        map[string]float64 `json:"bpms"`          // BPM per successful grid
+	BPMSpread   float64            `json:"bpm_spread"`    // (max-min)/median of octave-folded BPMs
+	MinFMeasure float64            `json:"min_f_measure"` // Worst octave-normalized pairwise F-measure
+	Score       float64            `json:"score"`         // BPMSpread + (1 - MinFMeasure)
+}
+
+// Disagree scores analyzer disagreement for a track. BPMs are folded into the
+// median's octave and beats octave-normalized, so double/half tempo grids only
+// count if their beats are also misplaced. Returns nil if fewer than two grids
+// succeeded.
+func Disagree(ta *TrackAnalysis) *Disagreement {
+	c := Compare(ta)
+
+	d := &Disagreement{File: ta.File, BPMs: make(map[string]float64), MinFMeasure: 1}
+	var bpms []float64
+	for _, g := range c.Grids {
+		if g.Error == "" && g.BPM > 0 {
+			d.BPMs[g.Name] = g.BPM
+			bpms = append(bpms, g.BPM)
+		}
+	}
+	if len(bpms) < 2 {
+		return nil
+	}
+
+	median := medianFloat64BeatThis(bpms)
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, bpm := range bpms {
+		for bpm < median/math.Sqrt2 {
+			bpm *= 2
+		}
+		for bpm >= median*math.Sqrt2 {
+			bpm /= 2
+		}
+		lo, hi = math.Min(lo, bpm), math.Max(hi, bpm)
+	}
+	d.BPMSpread = (hi - lo) / median
+
+	for _, p := range c.Agreement {
+		if _, ok := d.BPMs[p.A]; !ok {
+			continue
+		}
+		if _, ok := d.BPMs[p.B]; !ok {
+			continue
+		}
+		d.MinFMeasure = math.Min(d.MinFMeasure, p.OctaveFMeasure)
+	}
+
+	d.Score = d.BPMSpread + (1 - d.MinFMeasure)
+	return d
+}
+
+// stableIntervalTolerance is how far a beat interval can be from the median
+// interval, relative to it, and still count as steady tempo.
+const stableIntervalTolerance = 0.05
+
+// TrackConfidence scores from 0 to 1 how far a track's default grid can be
+// trusted without review. It is the mean of the analyzer agreement, the worst
+// octave-normalized F-measure between any two successful grids (omitted with
+// fewer than two), and the tempo stability, the fraction of the default grid's
+// beat intervals within 5% of its median interval. A track without a usable
+// default grid scores 0.
+func TrackConfidence(ta *TrackAnalysis) float64 {
+	g := ta.DefaultGrid(nil)
+	if g == nil || len(g.Beats) < 2 {
+		return 0
+	}
+
+	intervals := make([]float64, 0, len(g.Beats)-1)
+	for i := 1; i < len(g.Beats); i++ {
+		intervals = append(intervals, g.Beats[i]-g.Beats[i-1])
+	}
+	median := medianFloat64BeatThis(intervals)
+	if median <= 0 {
+		return 0
+	}
+	var stable int
+	for _, iv := range intervals {
+		if math.Abs(iv-median) <= stableIntervalTolerance*median {
+			stable++
+		}
+	}
+	stability := float64(stable) / float64(len(intervals))
+
+	if d := Disagree(ta); d != nil {
+		return (d.MinFMeasure + stability) / 2
+	}
+	return stability
+}
+
+// DefaultTempoOctaveTolerance is the relative error allowed when matching two
+// tempos a power of two apart.
+const DefaultTempoOctaveTolerance = 0.03
+
+// TempoOctaveRelation reports whether tempos a and b are a power of two apart
+// (double, half, quadruple, ...) within DefaultTempoOctaveTolerance. ratio is
+// the faster tempo over the slower, e.g. 2 for 85 and 170 BPM. Equal tempos
+// are not related.
+func TempoOctaveRelation(a, b float64) (ratio int, related bool) {
+	return tempoOctaveRelation(a, b, DefaultTempoOctaveTolerance)
+}
+
+func tempoOctaveRelation(a, b, tolerance float64) (int, bool) {
+	if a <= 0 || b <= 0 || !isFinite(a) || !isFinite(b) {
+		return 0, false
+	}
+	r := math.Max(a, b) / math.Min(a, b)
+	octaves := math.Round(math.Log2(r))
+	if octaves < 1 {
+		return 0, false
+	}
+	ratio := math.Pow(2, octaves)
+	if math.Abs(r/ratio-1) > tolerance {
+		return 0, false
+	}
+	return int(ratio), true
+}
+
+// TempoWarnings describes every pair of successful grids whose BPMs are a
+// power of two apart within tolerance, e.g. one analyzer locking onto half
+// time. Forced and consensus grids are skipped. Pairs are ordered by name.
+func TempoWarnings(grids map[string]*GridAnalysis, tolerance float64) []string {
+	var names []string
+	for name, g := range grids {
+		switch AnalyzerType(name) {
+		case AnalyzerForced, AnalyzerConsensus:
+			continue
+		}
+		if g != nil && g.Error == "" && g.BPM > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var warnings []string
+	for i, a := range names {
+		for _, b := range names[i+1:] {
+			ratio, ok := tempoOctaveRelation(grids[a].BPM, grids[b].BPM, tolerance)
+			if !ok {
+				continue
+			}
+			slow, fast := a, b
+			if grids[a].BPM > grids[b].BPM {
+				slow, fast = b, a
+			}
+			warnings = append(warnings, fmt.Sprintf("%s (%.2f BPM) is %dx %s (%.2f BPM)",
+				fast, grids[fast].BPM, ratio, slow, grids[slow].BPM))
+		}
+	}
+	return warnings
+}
+
+// WorstDisagreements scores every analyzed track in dir and returns the top n
+// by descending disagreement (all of them if n <= 0). Ties are ordered by file.
+// A sidecar that can't be read is left out of the ranking and its error joined
+// into the returned error; the rest of the directory is still ranked.
+func WorstDisagreements(dir string, n int) ([]*Disagreement, error) {
+	var ds []*Disagreement
+	var errs []error
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if d.IsDir() || !isSupportedAudio(ext) {
+			return nil
+		}
+
+		jsonPath := strings.TrimSuffix(path, ext) + ".json"
+		if _, err := os.Stat(jsonPath); err != nil {
+			return nil // Not analyzed yet
+		}
+		ta, err := ReadTrackAnalysis(jsonPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", jsonPath, err))
+			return nil
+		}
+		if dis := Disagree(ta); dis != nil {
+			dis.Sidecar = jsonPath
+			ds = append(ds, dis)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ds, func(i, j int) bool {
+		if ds[i].Score != ds[j].Score {
+			return ds[i].Score > ds[j].Score
+		}
+		return ds[i].File < ds[j].File
+	})
+	if n > 0 && len(ds) > n {
+		ds = ds[:n]
+	}
+	return ds, errors.Join(errs...)
+}
+
+// WriteDisagreements prints ranked disagreements as an aligned text table.
+func WriteDisagreements(w io.Writer, ds []*Disagreement) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANK\tTRACK\tSCORE\tSPREAD\tMIN-F\tBPMS")
+	for i, d := range ds {
+		names := make([]string, 0, len(d.BPMs))
+		for name := range d.BPMs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		bpms := make([]string, len(names))
+		for j, name := range names {
+			bpms[j] = fmt.Sprintf("%s=%.2f", name, d.BPMs[name])
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%.3f\t%.3f\t%.3f\t%s\n",
+			i+1, d.File, d.Score, d.BPMSpread, d.MinFMeasure, strings.Join(bpms, " "))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,190 @@
+package analysis
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	ta := &TrackAnalysis{
+		File: "track.mp3",
+		Grids: map[string]*GridAnalysis{
+			"a":   {BPM: 120, Beats: []float64{0.5, 1.0, 1.5, 2.0}, Downbeats: []int{0}},
+			"b":   {BPM: 120, Beats: []float64{0.5, 1.0, 1.5, 2.0}},
+			"c":   {BPM: 60, Beats: []float64{0.5, 1.5}},
+			"bad": {Error: "boom"},
+		},
+		Timings: map[string]float64{TimingDecode: 0.25, "a": 1.5, "bad": 0.4},
+	}
+
+	c := Compare(ta)
+	require.Len(t, c.Grids, 4)
+	assert.Equal(t, "a", c.Grids[0].Name)
+	assert.Equal(t, 1, c.Grids[0].Downbeats)
+	assert.Equal(t, 1.5, c.Grids[0].Seconds)
+	assert.Equal(t, 0.25, c.Decode)
+
+	// Times are shown per analyzer, with a dash for untimed grids
+	var buf bytes.Buffer
+	require.NoError(t, c.WriteTable(&buf))
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "track.mp3 (0.0s, analyzed in 0.00s, decoded in 0.25s)", lines[0])
+	assert.Equal(t, []string{"a", "120.00", "4", "1", "1.50"}, strings.Fields(lines[3]))
+	assert.Equal(t, []string{"b", "120.00", "4", "0", "-"}, strings.Fields(lines[4]))
+	assert.Equal(t, []string{"bad", "error:", "boom", "0.40"}, strings.Fields(lines[5]))
+
+	// Errored grids are excluded from pairwise agreement
+	require.Len(t, c.Agreement, 3)
+	assert.Equal(t, PairAgreement{A: "a", B: "b", FMeasure: 1, OctaveFMeasure: 1}, c.Agreement[0])
+	assert.InDelta(t, 2.0/3.0, c.Agreement[1].FMeasure, 1e-9)
+
+	// Half-tempo grid c agrees better with a once normalized to a's octave
+	assert.Equal(t, "c", c.Agreement[1].B)
+	assert.Greater(t, c.Agreement[1].OctaveFMeasure, c.Agreement[1].FMeasure)
+}
+
+func TestWorstDisagreements(t *testing.T) {
+	beats := func(bpm, offset float64) []float64 {
+		var b []float64
+		for t := offset; t < 30; t += 60 / bpm {
+			b = append(b, t)
+		}
+		return b
+	}
+
+	dir := t.TempDir()
+	tracks := map[string]map[string]*GridAnalysis{
+		// All analyzers agree
+		"agree": {
+			"a": {BPM: 120, Beats: beats(120, 0.5)},
+			"b": {BPM: 120, Beats: beats(120, 0.51)},
+		},
+		// Half-tempo grid on the same beats only disagrees a little
+		"octave": {
+			"a": {BPM: 120, Beats: beats(120, 0.5)},
+			"b": {BPM: 60, Beats: beats(60, 0.5)},
+		},
+		// Grid shifted off the beat by half a period
+		"offbeat": {
+			"a": {BPM: 120, Beats: beats(120, 0.5)},
+			"b": {BPM: 120, Beats: beats(120, 0.75)},
+		},
+		// Different tempo entirely
+		"tempo": {
+			"a": {BPM: 120, Beats: beats(120, 0.5)},
+			"b": {BPM: 100, Beats: beats(100, 0.5)},
+			"c": {Error: "failed"},
+		},
+		// Only one successful grid is not ranked
+		"single": {
+			"a": {BPM: 120, Beats: beats(120, 0.5)},
+			"b": {Error: "failed"},
+		},
+	}
+	for name, grids := range tracks {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".mp3"), nil, 0644))
+		ta := &TrackAnalysis{File: name + ".mp3", Grids: grids}
+		require.NoError(t, ta.WriteJSON(filepath.Join(dir, name+".json")))
+	}
+	// Audio without a sidecar is skipped
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unanalyzed.mp3"), nil, 0644))
+
+	ds, err := WorstDisagreements(dir, 0)
+	require.NoError(t, err)
+
+	var files []string
+	for _, d := range ds {
+		files = append(files, d.File)
+	}
+	assert.Equal(t, []string{"offbeat.mp3", "tempo.mp3", "agree.mp3", "octave.mp3"}, files)
+	assert.InDelta(t, 1.0, ds[0].Score, 1e-9)
+	assert.Equal(t, map[string]float64{"a": 120, "b": 100}, ds[1].BPMs)
+	assert.InDelta(t, 20.0/110.0, ds[1].BPMSpread, 1e-9)
+	assert.Greater(t, ds[1].Score, ds[2].Score)
+	assert.InDelta(t, 0.0, ds[2].Score, 1e-9)
+	assert.InDelta(t, 0.0, ds[3].Score, 1e-9)
+
+	ds, err = WorstDisagreements(dir, 2)
+	require.NoError(t, err)
+	require.Len(t, ds, 2)
+	assert.Equal(t, "offbeat.mp3", ds[0].File)
+
+	// A corrupt sidecar is reported without stopping the ranking
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "corrupt.mp3"), nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "corrupt.json"), []byte("{not json"), 0644))
+	ds, err = WorstDisagreements(dir, 0)
+	assert.ErrorContains(t, err, "corrupt.json")
+	assert.Len(t, ds, 4)
+}
+
+func TestTrackConfidence(t *testing.T) {
+	beats := func(bpm, offset float64) []float64 {
+		var b []float64
+		for t := offset; t < 30; t += 60 / bpm {
+			b = append(b, t)
+		}
+		return b
+	}
+
+	clean := &TrackAnalysis{Grids: map[string]*GridAnalysis{
+		string(AnalyzerMixx):     {BPM: 120, Beats: beats(120, 0.5)},
+		string(AnalyzerBeatThis): {BPM: 120, Beats: beats(120, 0.51)},
+	}}
+	assert.InDelta(t, 1.0, TrackConfidence(clean), 1e-9)
+
+	// Analyzers at different tempos lower the score
+	disagree := &TrackAnalysis{Grids: map[string]*GridAnalysis{
+		string(AnalyzerMixx):     {BPM: 120, Beats: beats(120, 0.5)},
+		string(AnalyzerBeatThis): {BPM: 93, Beats: beats(93, 0.5)},
+	}}
+	assert.Less(t, TrackConfidence(disagree), 0.8)
+
+	// Drifting beat intervals lower the score of a single grid
+	var drift []float64
+	for i, t := 0, 0.5; t < 30; i++ {
+		drift = append(drift, t)
+		t += 0.5 + 0.05*float64(i%4)
+	}
+	unsteady := &TrackAnalysis{Grids: map[string]*GridAnalysis{string(AnalyzerMixx): {BPM: 110, Beats: drift}}}
+	assert.Less(t, TrackConfidence(unsteady), 0.8)
+
+	assert.Zero(t, TrackConfidence(&TrackAnalysis{}))
+}
+
+func TestTempoOctaveRelation(t *testing.T) {
+	ratio, ok := TempoOctaveRelation(85, 170)
+	assert.True(t, ok)
+	assert.Equal(t, 2, ratio)
+
+	ratio, ok = TempoOctaveRelation(172, 86.5)
+	assert.True(t, ok)
+	assert.Equal(t, 2, ratio)
+
+	ratio, ok = TempoOctaveRelation(60, 242)
+	assert.True(t, ok)
+	assert.Equal(t, 4, ratio)
+
+	for _, pair := range [][2]float64{{120, 120}, {120, 180}, {85, 180}, {0, 170}} {
+		_, ok := TempoOctaveRelation(pair[0], pair[1])
+		assert.False(t, ok, "%v", pair)
+	}
+
+	grids := map[string]*GridAnalysis{
+		string(AnalyzerMixx):         {BPM: 85},
+		string(AnalyzerBeatThis):     {BPM: 170.4},
+		string(AnalyzerRekordboxGo):  {BPM: 171},
+		string(AnalyzerConsensus):    {BPM: 170},
+		string(AnalyzerMixxExtended): {Error: "failed"},
+	}
+	assert.Equal(t, []string{
+		"beatthis (170.40 BPM) is 2x mixx (85.00 BPM)",
+		"rekordbox-go (171.00 BPM) is 2x mixx (85.00 BPM)",
+	}, TempoWarnings(grids, DefaultTempoOctaveTolerance))
+	assert.Empty(t, TempoWarnings(grids, 0.001))
+}
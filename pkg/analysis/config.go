@@ -0,0 +1,312 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides loading of persisted analyzer defaults from mixxxlab.yaml.
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the config file looked up by FindConfig.
+const ConfigFileName = "mixxxlab.yaml"
+
+// Config holds persisted defaults for QM-DSP tuning, analyzer selection, and output.
+//
+// Example mixxxlab.yaml:
+//
+//	preset: fast
+//	qm:
+//	  df_type: complexsd
+//	  input_tempo: 128
+//	  constrain_tempo: true
+//	analyzers: [mixx-extended, beatthis]
+//	output:
+//	  format: csv
+type Config struct {
+	// Preset is the analysis preset the other settings start from, if any.
+	// Settings in the same file override it.
+	Preset AnalysisPreset `yaml:"preset"`
+
+	QM QMConfig `yaml:"qm"`
+
+	// Analyzers selects the grid analyzers to run. Empty means all available
+	// except opt-in analyzers such as mixx-drums.
+	Analyzers []AnalyzerType `yaml:"analyzers"`
+
+	// MergeMarkers is the tolerance in seconds for combining cues from all
+	// marker analyzers into Markers["merged"]. Zero disables merging.
+	MergeMarkers float64 `yaml:"merge_markers"`
+
+	// TempoOctaveTolerance is the relative error allowed when warning that two
+	// analyzers' BPMs are double, half, or another power of two apart.
+	TempoOctaveTolerance float64 `yaml:"tempo_octave_tolerance"`
+
+	// WaveformLevels are the resolutions in pixels per second of the waveform
+	// pyramid stored in each sidecar. Empty stores only the 100 px/s waveform.
+	WaveformLevels []int `yaml:"waveform_levels"`
+
+	// VariableTempo adds a tempo curve from the QM-DSP beat periods to
+	// mixx-extended grids, for live recordings and DJ sets that drift.
+	VariableTempo bool `yaml:"variable_tempo"`
+
+	// BeatThisProvider is the ONNX Runtime execution provider beat_this runs
+	// on: auto (the default), cpu, cuda, coreml, or directml.
+	BeatThisProvider BeatThisProvider `yaml:"beatthis_provider"`
+
+	// BeatThisChunkSize and BeatThisChunkOverlap set how long audio is split
+	// into beat_this runs, in 50 fps frames (see BeatThisOptions). Zero uses
+	// the defaults.
+	BeatThisChunkSize    int `yaml:"beatthis_chunk_size"`
+	BeatThisChunkOverlap int `yaml:"beatthis_chunk_overlap"`
+
+	// TrimSilence trims silent intros and outros before grid analysis, so
+	// they don't confuse beat tracking near the edges. Beat times are mapped
+	// back to the original file's timeline. SilenceThresholdDB is the RMS
+	// level in dBFS below which audio is silent; zero uses
+	// DefaultSilenceThresholdDB.
+	TrimSilence        bool    `yaml:"trim_silence"`
+	SilenceThresholdDB float64 `yaml:"silence_threshold_db"`
+
+	// SnapCues moves detected cue points within a quarter beat of the
+	// default grid onto its beats, downbeats, or bars (see SnapCuesToGrid).
+	// Empty leaves them where they were detected.
+	SnapCues SnapMode `yaml:"snap_cues"`
+
+	// PhraseBars is the length in bars of the uniform phrase markers derived
+	// from the default grid's downbeats. Zero uses DefaultPhraseBars (16).
+	PhraseBars int `yaml:"phrase_bars"`
+
+	// BPMRange is the tempo range the rekordbox-go and beat_this BPMs are
+	// normalized into by doubling or halving, e.g. {min: 140, max: 220} for
+	// drum'n'bass. Default: 60-180
+	BPMRange BPMRange `yaml:"bpm_range"`
+
+	// DownloadModels fetches missing beat_this models from
+	// $MIXXXLAB_BEATTHIS_MODELS_URL (see EnsureBeatThisModels).
+	DownloadModels bool `yaml:"download_models"`
+
+	// Logf receives progress messages, such as model downloads and the
+	// beat_this execution provider, from NewWithConfig. Default: nil (silent)
+	Logf func(format string, args ...any) `yaml:"-"`
+
+	Output AnalyzeDirOptions `yaml:"output"`
+}
+
+// DefaultConfig returns the built-in defaults used when no config file is present.
+func DefaultConfig() *Config {
+	return &Config{
+		QM:                   DefaultQMConfig(),
+		TempoOctaveTolerance: DefaultTempoOctaveTolerance,
+		BPMRange:             DefaultBPMRange,
+		Output:               AnalyzeDirOptions{Format: FormatJSON},
+	}
+}
+
+// FindConfig returns the path of the first config file found in the working
+// directory or the user config directory (e.g. ~/.config/mixxxlab/mixxxlab.yaml),
+// or "" if there is none.
+func FindConfig() string {
+	candidates := []string{ConfigFileName}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "mixxxlab", ConfigFileName))
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// LoadConfig returns the defaults overlaid with the config file at path, if
+// path is non-empty, then with each override in order (e.g. command-line flags
+// the user set). A preset named in the file is applied before the file's other
+// settings. The result is validated after all overrides are applied.
+func LoadConfig(path string, overrides ...func(*Config)) (*Config, error) {
+	cfg := DefaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parse config %s: %w", path, err)
+		}
+
+		// Start over from the preset so the file's own settings override it
+		if preset := cfg.Preset; preset != "" {
+			cfg = DefaultConfig()
+			if err := preset.Apply(cfg); err != nil {
+				return nil, fmt.Errorf("parse config %s: %w", path, err)
+			}
+			if err := yaml.Unmarshal(data, cfg); err != nil {
+				return nil, fmt.Errorf("parse config %s: %w", path, err)
+			}
+		}
+	}
+
+	for _, override := range overrides {
+		override(cfg)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		if path != "" {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate checks that config values are within the ranges qm-dsp and the
+// analyzers accept.
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	qm := cfg.QM
+	if qm.DFType < DFTypeHFC || qm.DFType > DFTypeBroadband {
+		errs = append(errs, fmt.Errorf("qm.df_type: unknown detection function %d", qm.DFType))
+	}
+	if qm.StepSecs <= 0 || qm.StepSecs > 0.1 {
+		errs = append(errs, fmt.Errorf("qm.step_secs: %g out of range (0, 0.1]", qm.StepSecs))
+	}
+	if qm.MaxBinHz <= 0 {
+		errs = append(errs, fmt.Errorf("qm.max_bin_hz: %d must be positive", qm.MaxBinHz))
+	}
+	if qm.InputTempo != 0 && (qm.InputTempo < 40 || qm.InputTempo > 300) {
+		errs = append(errs, fmt.Errorf("qm.input_tempo: %g out of range [40, 300] (0 for automatic)", qm.InputTempo))
+	}
+	if qm.ConstrainTempo && qm.InputTempo == 0 {
+		errs = append(errs, errors.New("qm.constrain_tempo requires qm.input_tempo"))
+	}
+	if qm.Alpha < 0 || qm.Alpha > 1 {
+		errs = append(errs, fmt.Errorf("qm.alpha: %g out of range [0, 1]", qm.Alpha))
+	}
+	if qm.Tightness <= 0 {
+		errs = append(errs, fmt.Errorf("qm.tightness: %g must be positive", qm.Tightness))
+	}
+	if qm.BeatsPerBar < 1 || qm.BeatsPerBar > 16 {
+		errs = append(errs, fmt.Errorf("qm.beats_per_bar: %d out of range [1, 16]", qm.BeatsPerBar))
+	}
+
+	for _, at := range cfg.Analyzers {
+		if !isGridAnalyzer(at) {
+			errs = append(errs, fmt.Errorf("analyzers: unknown analyzer %q", at))
+		}
+	}
+
+	if cfg.MergeMarkers < 0 {
+		errs = append(errs, fmt.Errorf("merge_markers: %g must not be negative", cfg.MergeMarkers))
+	}
+
+	if cfg.TempoOctaveTolerance < 0 || cfg.TempoOctaveTolerance >= 0.5 {
+		errs = append(errs, fmt.Errorf("tempo_octave_tolerance: %g out of range [0, 0.5)", cfg.TempoOctaveTolerance))
+	}
+
+	for _, px := range cfg.WaveformLevels {
+		if px < 1 || px > maxWaveformLevel {
+			errs = append(errs, fmt.Errorf("waveform_levels: %d out of range [1, %d]", px, maxWaveformLevel))
+		}
+	}
+
+	if _, err := ParseBeatThisProvider(string(cfg.BeatThisProvider)); err != nil {
+		errs = append(errs, fmt.Errorf("beatthis_provider: %w", err))
+	}
+	if _, _, err := cfg.beatThisOptions().chunking(); err != nil {
+		errs = append(errs, fmt.Errorf("beatthis_chunk_size: %w", err))
+	}
+
+	if _, err := ParseSnapMode(string(cfg.SnapCues)); err != nil {
+		errs = append(errs, fmt.Errorf("snap_cues: %w", err))
+	}
+
+	if cfg.PhraseBars < 0 {
+		errs = append(errs, fmt.Errorf("phrase_bars: %d must not be negative", cfg.PhraseBars))
+	}
+
+	if err := cfg.BPMRange.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("bpm_range: %w", err))
+	}
+
+	if cfg.SilenceThresholdDB > 0 {
+		errs = append(errs, fmt.Errorf("silence_threshold_db: %g must not be positive", cfg.SilenceThresholdDB))
+	}
+
+	if cfg.Output.MinConfidence < 0 || cfg.Output.MinConfidence > 1 {
+		errs = append(errs, fmt.Errorf("output.min_confidence: %g out of range [0, 1]", cfg.Output.MinConfidence))
+	}
+
+	switch cfg.Output.Format {
+	case "", FormatJSON, FormatCSV:
+	default:
+		errs = append(errs, fmt.Errorf("output.format: unsupported format %q", cfg.Output.Format))
+	}
+
+	return errors.Join(errs...)
+}
+
+// beatThisOptions returns the options for the beat_this analyzers.
+func (cfg *Config) beatThisOptions() BeatThisOptions {
+	return BeatThisOptions{
+		Provider:     cfg.BeatThisProvider,
+		ChunkSize:    cfg.BeatThisChunkSize,
+		ChunkOverlap: cfg.BeatThisChunkOverlap,
+		BPMRange:     cfg.BPMRange,
+		Logf:         cfg.Logf,
+	}
+}
+
+// isGridAnalyzer reports whether at names a known grid analyzer.
+func isGridAnalyzer(at AnalyzerType) bool {
+	return slices.Contains(pathGridAnalyzers, at) || isRegisteredGridAnalyzer(at)
+}
+
+// dfTypeNames maps config names to detection function types.
+var dfTypeNames = map[string]DetectionFunctionType{
+	"hfc":       DFTypeHFC,
+	"specdiff":  DFTypeSpecDiff,
+	"phasedev":  DFTypePhaseDev,
+	"complexsd": DFTypeComplexSD,
+	"broadband": DFTypeBroadband,
+}
+
+// ParseDetectionFunctionType parses a detection function name (e.g. "complexsd")
+// or its numeric qm-dsp value.
+func ParseDetectionFunctionType(s string) (DetectionFunctionType, error) {
+	if t, ok := dfTypeNames[strings.ToLower(s)]; ok {
+		return t, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return DetectionFunctionType(n), nil
+	}
+	return 0, fmt.Errorf("unknown detection function: %s", s)
+}
+
+// MarshalText encodes a detection function type by name, or by number if it
+// has none.
+func (t DetectionFunctionType) MarshalText() ([]byte, error) {
+	for name, v := range dfTypeNames {
+		if v == t {
+			return []byte(name), nil
+		}
+	}
+	return []byte(strconv.Itoa(int(t))), nil
+}
+
+// UnmarshalText decodes a detection function type by name or number.
+func (t *DetectionFunctionType) UnmarshalText(b []byte) error {
+	v, err := ParseDetectionFunctionType(string(b))
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
@@ -0,0 +1,81 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	require.NoError(t, os.WriteFile(path, []byte(`# Preferred settings
+qm:
+  df_type: hfc
+  input_tempo: 128
+  constrain_tempo: true
+analyzers: [mixx-extended, beatthis]
+output:
+  format: csv
+  fail_fast: true
+`), 0644))
+
+	// Flag overrides file, file overrides default
+	cfg, err := LoadConfig(path, func(cfg *Config) {
+		cfg.QM.InputTempo = 174
+		cfg.Output.Format = FormatJSON
+	})
+	require.NoError(t, err)
+
+	def := DefaultQMConfig()
+	assert.Equal(t, 174.0, cfg.QM.InputTempo)
+	assert.Equal(t, FormatJSON, cfg.Output.Format)
+	assert.Equal(t, DFTypeHFC, cfg.QM.DFType)
+	assert.True(t, cfg.QM.ConstrainTempo)
+	assert.True(t, cfg.Output.FailFast)
+	assert.Equal(t, []AnalyzerType{AnalyzerMixxExtended, AnalyzerBeatThis}, cfg.Analyzers)
+	assert.Equal(t, def.Alpha, cfg.QM.Alpha)
+	assert.Equal(t, def.BeatsPerBar, cfg.QM.BeatsPerBar)
+	assert.False(t, cfg.Output.Force)
+
+	// No file is all defaults
+	cfg, err = LoadConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultConfig(), cfg)
+}
+
+func TestLoadConfigValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	require.NoError(t, os.WriteFile(path, []byte(`qm:
+  alpha: 1.5
+  beats_per_bar: 0
+analyzers: [madmom]
+`), 0644))
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "qm.alpha")
+	assert.ErrorContains(t, err, "qm.beats_per_bar")
+	assert.ErrorContains(t, err, `unknown analyzer "madmom"`)
+
+	// Overrides are validated too
+	_, err = LoadConfig("", func(cfg *Config) { cfg.QM.InputTempo = 1000 })
+	assert.ErrorContains(t, err, "qm.input_tempo")
+	_, err = LoadConfig("", func(cfg *Config) { cfg.WaveformLevels = []int{10, 0} })
+	assert.ErrorContains(t, err, "waveform_levels")
+	_, err = LoadConfig("", func(cfg *Config) { cfg.BeatThisProvider = "tpu" })
+	assert.ErrorContains(t, err, "beatthis_provider")
+	_, err = LoadConfig("", func(cfg *Config) { cfg.BeatThisChunkSize = -1 })
+	assert.ErrorContains(t, err, "beatthis_chunk_size")
+	_, err = LoadConfig("", func(cfg *Config) { cfg.BPMRange = BPMRange{Min: 140, Max: 70} })
+	assert.ErrorContains(t, err, "bpm_range")
+	_, err = LoadConfig("", func(cfg *Config) { cfg.SilenceThresholdDB = 6 })
+	assert.ErrorContains(t, err, "silence_threshold_db")
+
+	// Unknown detection function names fail to parse
+	require.NoError(t, os.WriteFile(path, []byte("qm:\n  df_type: wavelet\n"), 0644))
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, "unknown detection function")
+}
@@ -0,0 +1,180 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides a consensus beat grid voted from the grid analyzers.
+package analysis
+
+import (
+	"math"
+	"slices"
+	"sort"
+)
+
+// Consensus voting parameters.
+const (
+	consensusBPMStep   = 0.5 // BPM votes are snapped to this step
+	consensusPhaseBins = 64  // Candidate beat phases per period
+)
+
+// ConsensusGrid merges the successful grids into a single best-guess grid.
+//
+// Each grid's BPM is folded into the octave of the median BPM and snapped to
+// 0.5 BPM, and the value with the most grids within octave tolerance wins;
+// ties go to the grid earliest in DefaultGridPreference. Of the grids that
+// voted for the winner, the tempo octave most of them report (so double or
+// half tempo outliers are outvoted) sets the BPM. Beats are spaced at the
+// voters' mean beat period, octave-normalized, so they don't drift as a
+// snapped BPM would, and phased by cross-correlating a beat comb with every
+// voter's beats. Forced and existing consensus grids don't vote. Returns nil
+// if fewer than two grids succeeded.
+func ConsensusGrid(grids map[string]*GridAnalysis) *GridAnalysis {
+	rank := func(name string) int {
+		if i := slices.Index(DefaultGridPreference, AnalyzerType(name)); i >= 0 {
+			return i
+		}
+		return len(DefaultGridPreference)
+	}
+	var names []string
+	for name, g := range grids {
+		switch AnalyzerType(name) {
+		case AnalyzerForced, AnalyzerConsensus:
+			continue
+		}
+		if g != nil && g.Error == "" && g.BPM > 0 && isFinite(g.BPM) && len(g.Beats) >= 2 {
+			names = append(names, name)
+		}
+	}
+	if len(names) < 2 {
+		return nil
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if ri, rj := rank(names[i]), rank(names[j]); ri != rj {
+			return ri < rj
+		}
+		return names[i] < names[j]
+	})
+
+	// Fold every BPM into the median's octave
+	bpms := make([]float64, len(names))
+	folded := make([]float64, len(names))
+	for i, name := range names {
+		bpms[i] = grids[name].BPM
+	}
+	median := medianFloat64BeatThis(bpms)
+	for i, bpm := range bpms {
+		for bpm < median/math.Sqrt2 {
+			bpm *= 2
+		}
+		for bpm >= median*math.Sqrt2 {
+			bpm /= 2
+		}
+		folded[i] = bpm
+	}
+
+	// Vote on snapped tempos; a grid votes for every candidate it is near
+	near := func(bpm, target float64) bool {
+		return math.Abs(bpm-target) <= octaveTolerance*target
+	}
+	var winner float64
+	best := 0
+	for _, f := range folded {
+		candidate := math.Round(f/consensusBPMStep) * consensusBPMStep
+		n := 0
+		for _, other := range folded {
+			if near(other, candidate) {
+				n++
+			}
+		}
+		if n > best {
+			winner, best = candidate, n
+		}
+	}
+
+	// The voters' most common octave, as a power-of-two multiplier of the
+	// winner; ties go to the most preferred voter's octave
+	var voters []int
+	votes := make(map[int]int)
+	for i, f := range folded {
+		if near(f, winner) {
+			voters = append(voters, i)
+			votes[int(math.Round(math.Log2(bpms[i]/f)))]++
+		}
+	}
+	octave := 0
+	for _, i := range voters {
+		if o := int(math.Round(math.Log2(bpms[i] / folded[i]))); votes[o] > votes[octave] {
+			octave = o
+		}
+	}
+	bpm := winner * math.Pow(2, float64(octave))
+
+	// Mean octave-normalized beat period of the voters, and the span they cover
+	var period float64
+	var normalized [][]float64
+	end := 0.0
+	for _, i := range voters {
+		beats := NormalizeOctave(grids[names[i]].Beats, bpm)
+		intervals := make([]float64, 0, len(beats)-1)
+		for j := 1; j < len(beats); j++ {
+			intervals = append(intervals, beats[j]-beats[j-1])
+		}
+		period += medianFloat64BeatThis(intervals) / float64(len(voters))
+		normalized = append(normalized, beats)
+		end = max(end, beats[len(beats)-1])
+	}
+	if !isFinite(period) || period <= 0 {
+		return nil
+	}
+
+	phase := consensusPhase(normalized, period)
+	g := &GridAnalysis{BPM: bpm}
+	for t := phase; t <= end+period/2; t += period {
+		g.Beats = append(g.Beats, t)
+	}
+	return g
+}
+
+// consensusPhase returns the offset in [0, period) of the beat comb that best
+// matches every grid's beats. Each beat scores a triangular window of half
+// width min(DefaultEvalTolerance, period/4) around its phase, evaluated at
+// consensusPhaseBins candidates; the best candidate is refined to the circular
+// mean phase of the beats within its window.
+func consensusPhase(grids [][]float64, period float64) float64 {
+	tol := min(DefaultEvalTolerance, period/4)
+	var phases []float64
+	for _, beats := range grids {
+		for _, b := range beats {
+			phases = append(phases, math.Mod(math.Mod(b, period)+period, period))
+		}
+	}
+
+	// dist is the circular distance between two phases
+	dist := func(a, b float64) float64 {
+		d := math.Abs(a - b)
+		return min(d, period-d)
+	}
+
+	bestPhase, bestScore := 0.0, -1.0
+	for bin := range consensusPhaseBins {
+		candidate := (float64(bin) + 0.5) * period / consensusPhaseBins
+		var score float64
+		for _, p := range phases {
+			score += max(0, 1-dist(p, candidate)/tol)
+		}
+		if score > bestScore {
+			bestPhase, bestScore = candidate, score
+		}
+	}
+
+	var sin, cos float64
+	for _, p := range phases {
+		if dist(p, bestPhase) <= tol {
+			angle := 2 * math.Pi * p / period
+			sin += math.Sin(angle)
+			cos += math.Cos(angle)
+		}
+	}
+	if sin == 0 && cos == 0 {
+		return bestPhase
+	}
+	mean := math.Atan2(sin, cos) / (2 * math.Pi) * period
+	return math.Mod(mean+period, period)
+}
@@ -0,0 +1,71 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsensusGrid(t *testing.T) {
+	beats := func(bpm, offset float64) []float64 {
+		var b []float64
+		for t := offset; t < 60; t += 60 / bpm {
+			b = append(b, t)
+		}
+		return b
+	}
+
+	t.Run("majority with half tempo and outlier", func(t *testing.T) {
+		grids := map[string]*GridAnalysis{
+			string(AnalyzerMixx):        {BPM: 120, Beats: beats(120, 0.50)},
+			string(AnalyzerBeatThis):    {BPM: 120.2, Beats: beats(120, 0.52)},
+			string(AnalyzerRekordboxGo): {BPM: 60, Beats: beats(60, 0.51)},
+			string(AnalyzerRekordboxPy): {BPM: 93, Beats: beats(93, 0.2)},
+			string(AnalyzerMixxDrums):   {Error: "failed"},
+			string(AnalyzerForced):      {BPM: 100, Beats: beats(100, 0)},
+		}
+		g := ConsensusGrid(grids)
+		require.NotNil(t, g)
+		assert.Equal(t, 120.0, g.BPM)
+		assert.InDelta(t, 0.51, g.Beats[1], 0.01)
+		assert.Greater(t, GridAgreement(beats(120, 0.51), g.Beats), 0.99)
+	})
+
+	t.Run("double tempo outvoted", func(t *testing.T) {
+		grids := map[string]*GridAnalysis{
+			string(AnalyzerMixx):        {BPM: 85, Beats: beats(85, 0.3)},
+			string(AnalyzerBeatThis):    {BPM: 85.1, Beats: beats(85, 0.3)},
+			string(AnalyzerRekordboxGo): {BPM: 170, Beats: beats(170, 0.3)},
+		}
+		g := ConsensusGrid(grids)
+		require.NotNil(t, g)
+		assert.Equal(t, 85.0, g.BPM)
+		assert.Greater(t, GridAgreement(beats(85, 0.3), g.Beats), 0.99)
+	})
+
+	t.Run("too few grids", func(t *testing.T) {
+		assert.Nil(t, ConsensusGrid(map[string]*GridAnalysis{
+			string(AnalyzerMixx):      {BPM: 120, Beats: beats(120, 0.5)},
+			string(AnalyzerConsensus): {BPM: 120, Beats: beats(120, 0.5)},
+		}))
+	})
+}
+
+// renamedGridAnalyzer is a fakeGridAnalyzer under another name.
+type renamedGridAnalyzer struct {
+	fakeGridAnalyzer
+	name string
+}
+
+func (r *renamedGridAnalyzer) Name() string { return r.name }
+
+func TestAnalyzeLoadedConsensus(t *testing.T) {
+	a := &Analyzer{grids: []GridAnalyzer{&fakeGridAnalyzer{}, &renamedGridAnalyzer{name: "other"}}}
+	ta, err := a.AnalyzeLoaded(make([]float32, 4*44100), 44100, []AnalyzerType{"fake", "other"})
+	require.NoError(t, err)
+
+	// The single-decode path votes the same consensus grid as file analysis
+	require.Contains(t, ta.Grids, string(AnalyzerConsensus))
+	assert.Equal(t, 120.0, ta.Grids[string(AnalyzerConsensus)].BPM)
+}
@@ -11,10 +11,15 @@ import (
 
 // CuePoint represents a detected cue point in a track.
 type CuePoint struct {
-	Time       float64 `json:"time"`       // Time in seconds
+	Time       Seconds `json:"time"`       // Cue position
 	Type       string  `json:"type"`       // Type: intro, drop, breakdown, buildup, outro, section
 	Confidence float64 `json:"confidence"` // Confidence score 0-1
 	Name       string  `json:"name"`       // Display name
+	Color      string  `json:"color"`      // Hot-cue color ("#rrggbb"), see CueColor
+
+	// RawTime is the detected position of a cue snapped to the beat grid
+	// (see SnapCuesToGrid), zero if it wasn't moved
+	RawTime Seconds `json:"raw_time,omitempty"`
 }
 
 // CueAnalyzeOut contains the cue detection results.
@@ -90,6 +95,7 @@ func (a *CueAnalyzer) AnalyzeFile(audioPath string, maxCues int, minDistance flo
 	if err := json.Unmarshal(output, &result); err != nil {
 		return nil, fmt.Errorf("failed to parse cue detection output: %w", err)
 	}
+	colorCues(result.CuePoints)
 
 	return &result, nil
 }
@@ -0,0 +1,92 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides default cue colors by type and translation to DJ app palettes.
+package analysis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cueTypeColors is the default hot-cue color for each cue type. Colors are
+// taken from Serato's palette so they export unchanged.
+var cueTypeColors = map[string]string{
+	// Python ML cue types
+	"intro":     "#0044cc", // Blue
+	"drop":      "#cc0000", // Red
+	"breakdown": "#00cc00", // Green
+	"buildup":   "#cc8800", // Orange
+	"outro":     "#8800cc", // Purple
+	// QM-DSP cue types
+	"downbeat": "#00cccc", // Cyan
+	"phrase":   "#cc4400", // Orange-red
+	"section":  "#cccc00", // Yellow
+	"energy":   "#cc0088", // Pink
+}
+
+// defaultCueColor is used for cue types without a color of their own.
+const defaultCueColor = "#cccccc"
+
+// CueColor returns the default hex color ("#rrggbb") for a cue type.
+func CueColor(cueType string) string {
+	if c, ok := cueTypeColors[cueType]; ok {
+		return c
+	}
+	return defaultCueColor
+}
+
+// colorCues sets the default color on cues that have none.
+func colorCues(cues []CuePoint) []CuePoint {
+	for i := range cues {
+		if cues[i].Color == "" {
+			cues[i].Color = CueColor(cues[i].Type)
+		}
+	}
+	return cues
+}
+
+// seratoCuePalette is Serato DJ's 18-color hot-cue palette.
+var seratoCuePalette = []string{
+	"#cc0000", "#cc4400", "#cc8800", "#cccc00", "#88cc00", "#44cc00",
+	"#00cc00", "#00cc44", "#00cc88", "#00cccc", "#0088cc", "#0044cc",
+	"#0000cc", "#4400cc", "#8800cc", "#cc00cc", "#cc0088", "#cc0044",
+}
+
+// SeratoCueColor returns the Serato hot-cue palette color nearest to a hex
+// color, since Serato only displays palette colors.
+func SeratoCueColor(hex string) (string, error) {
+	r, g, b, err := parseHexColor(hex)
+	if err != nil {
+		return "", err
+	}
+
+	best, bestDist := "", -1
+	for _, c := range seratoCuePalette {
+		pr, pg, pb, _ := parseHexColor(c)
+		dr, dg, db := int(r)-int(pr), int(g)-int(pg), int(b)-int(pb)
+		if d := dr*dr + dg*dg + db*db; bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best, nil
+}
+
+// RekordboxCueColor returns the Red, Green, and Blue attributes of a Rekordbox
+// XML POSITION_MARK for a hex color. Rekordbox accepts any RGB value there and
+// shows it on the nearest color of its own hot-cue palette.
+func RekordboxCueColor(hex string) (red, green, blue uint8, err error) {
+	return parseHexColor(hex)
+}
+
+// parseHexColor parses a "#rrggbb" color.
+func parseHexColor(hex string) (r, g, b uint8, err error) {
+	s, ok := strings.CutPrefix(hex, "#")
+	if !ok || len(s) != 6 {
+		return 0, 0, 0, fmt.Errorf("invalid color %q: want #rrggbb", hex)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid color %q: want #rrggbb", hex)
+	}
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), nil
+}
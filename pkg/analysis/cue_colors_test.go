@@ -0,0 +1,49 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCueColor(t *testing.T) {
+	assert.Equal(t, "#0044cc", CueColor("intro"))
+	assert.Equal(t, "#cc0000", CueColor("drop"))
+	assert.Equal(t, "#00cc00", CueColor("breakdown"))
+	assert.Equal(t, defaultCueColor, CueColor("unknown"))
+
+	// Defaults fill in missing colors only
+	cues := colorCues([]CuePoint{{Type: "drop"}, {Type: "intro", Color: "#123456"}})
+	assert.Equal(t, "#cc0000", cues[0].Color)
+	assert.Equal(t, "#123456", cues[1].Color)
+
+	// Every default color is already in Serato's palette
+	for cueType, c := range cueTypeColors {
+		got, err := SeratoCueColor(c)
+		require.NoError(t, err)
+		assert.Equal(t, c, got, cueType)
+	}
+}
+
+func TestSeratoCueColor(t *testing.T) {
+	got, err := SeratoCueColor("#ff1010") // Bright red snaps to Serato red
+	require.NoError(t, err)
+	assert.Equal(t, "#cc0000", got)
+
+	got, err = SeratoCueColor("#2196F3") // Material blue snaps to Serato blue
+	require.NoError(t, err)
+	assert.Equal(t, "#0088cc", got)
+
+	_, err = SeratoCueColor("red")
+	assert.ErrorContains(t, err, "invalid color")
+}
+
+func TestRekordboxCueColor(t *testing.T) {
+	r, g, b, err := RekordboxCueColor(CueColor("intro"))
+	require.NoError(t, err)
+	assert.Equal(t, [3]uint8{0x00, 0x44, 0xcc}, [3]uint8{r, g, b})
+
+	_, _, _, err = RekordboxCueColor("#12345")
+	assert.ErrorContains(t, err, "invalid color")
+}
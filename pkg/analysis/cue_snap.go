@@ -0,0 +1,92 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides snapping of detected cue points to the beat grid.
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// SnapMode selects the grid lines SnapCuesToGrid moves cues onto.
+type SnapMode string
+
+const (
+	// SnapBeat snaps cues to the nearest beat.
+	SnapBeat SnapMode = "beat"
+	// SnapDownbeat snaps cues to the nearest detected downbeat.
+	SnapDownbeat SnapMode = "downbeat"
+	// SnapBar snaps cues to the nearest bar line: every bar-length beats
+	// from the first downbeat, over the whole grid, so bars the downbeat
+	// detection missed still count.
+	SnapBar SnapMode = "bar"
+)
+
+// ParseSnapMode returns the SnapMode named s, "" for none.
+func ParseSnapMode(s string) (SnapMode, error) {
+	switch m := SnapMode(s); m {
+	case "", SnapBeat, SnapDownbeat, SnapBar:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown cue snap mode %q (want %s, %s, or %s)", s, SnapBeat, SnapDownbeat, SnapBar)
+}
+
+// cueSnapTolerance is how close a cue must be to a grid line to snap, in
+// beats at the grid's median tempo.
+const cueSnapTolerance = 0.25
+
+// SnapCuesToGrid returns a copy of cues with each cue within a quarter beat
+// of a grid line of mode moved onto it, keeping its original time in RawTime.
+// Cues further from any grid line are left alone. downbeats are indices into
+// beats; without downbeats, only SnapBeat moves cues.
+func SnapCuesToGrid(cues []CuePoint, beats []float64, downbeats []int, mode SnapMode) []CuePoint {
+	cues = slices.Clone(cues)
+	if len(beats) < 2 {
+		return cues
+	}
+	lines := snapLines(beats, downbeats, mode)
+	if len(lines) == 0 {
+		return cues
+	}
+
+	intervals := make([]float64, 0, len(beats)-1)
+	for i := 1; i < len(beats); i++ {
+		intervals = append(intervals, beats[i]-beats[i-1])
+	}
+	tol := cueSnapTolerance * medianFloat64BeatThis(intervals)
+
+	for i, c := range cues {
+		line := lines[nearestBeatIndex(lines, float64(c.Time))]
+		if d := math.Abs(line - float64(c.Time)); d > 0 && d <= tol {
+			cues[i].RawTime = c.Time
+			cues[i].Time = Seconds(line)
+		}
+	}
+	return cues
+}
+
+// snapLines returns the times of the grid lines of mode.
+func snapLines(beats []float64, downbeats []int, mode SnapMode) []float64 {
+	valid := slices.DeleteFunc(slices.Clone(downbeats), func(i int) bool { return i < 0 || i >= len(beats) })
+	switch mode {
+	case SnapBeat:
+		return beats
+	case SnapDownbeat:
+		lines := make([]float64, 0, len(valid))
+		for _, i := range valid {
+			lines = append(lines, beats[i])
+		}
+		return lines
+	case SnapBar:
+		if len(valid) == 0 {
+			return nil
+		}
+		bar := estimateBarLength(valid)
+		var lines []float64
+		for i := valid[0] % bar; i < len(beats); i += bar {
+			lines = append(lines, beats[i])
+		}
+		return lines
+	}
+	return nil
+}
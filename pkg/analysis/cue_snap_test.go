@@ -0,0 +1,66 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapCuesToGrid(t *testing.T) {
+	// 120 BPM from 0.5s, bars of 4 starting on the second beat. Downbeat
+	// detection missed the bar at beat 9 (5s).
+	beats := make([]float64, 32)
+	for i := range beats {
+		beats[i] = 0.5 + float64(i)*0.5
+	}
+	downbeats := []int{1, 5, 13, 17, 21}
+
+	cues := []CuePoint{
+		{Time: 1.003, Type: "intro"},    // 3ms after the first downbeat
+		{Time: 2.496, Type: "buildup"},  // 4ms before beat 4, 0.5s from a downbeat
+		{Time: 5.008, Type: "drop"},     // 8ms after the missed bar
+		{Time: 7.25, Type: "breakdown"}, // Between beats, too far to snap
+		{Time: 9, Type: "outro"},        // Already on a downbeat
+	}
+
+	snapped := SnapCuesToGrid(cues, beats, downbeats, SnapBeat)
+	require.Len(t, snapped, len(cues))
+	assert.Equal(t, []Seconds{1, 2.5, 5, 7.25, 9}, cueTimes(snapped))
+	assert.Equal(t, []Seconds{1.003, 2.496, 5.008, 0, 0}, cueRawTimes(snapped))
+
+	snapped = SnapCuesToGrid(cues, beats, downbeats, SnapDownbeat)
+	assert.Equal(t, []Seconds{1, 2.496, 5.008, 7.25, 9}, cueTimes(snapped))
+
+	// Bar lines continue through bars without a detected downbeat
+	snapped = SnapCuesToGrid(cues, beats, downbeats, SnapBar)
+	assert.Equal(t, []Seconds{1, 2.496, 5, 7.25, 9}, cueTimes(snapped))
+	assert.Equal(t, Seconds(5.008), snapped[2].RawTime)
+
+	// The input is left untouched
+	assert.Equal(t, Seconds(1.003), cues[0].Time)
+	assert.Zero(t, cues[0].RawTime)
+
+	// Without downbeats only beat snapping moves cues
+	assert.Equal(t, cues, SnapCuesToGrid(cues, beats, nil, SnapBar))
+	assert.Equal(t, cues, SnapCuesToGrid(cues, nil, nil, SnapBeat))
+
+	_, err := ParseSnapMode("phrase")
+	assert.Error(t, err)
+}
+
+func cueTimes(cues []CuePoint) []Seconds {
+	times := make([]Seconds, len(cues))
+	for i, c := range cues {
+		times[i] = c.Time
+	}
+	return times
+}
+
+func cueRawTimes(cues []CuePoint) []Seconds {
+	times := make([]Seconds, len(cues))
+	for i, c := range cues {
+		times[i] = c.RawTime
+	}
+	return times
+}
@@ -0,0 +1,184 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides scoring of beat grids against ground-truth annotations.
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultEvalTolerance is the standard ±70ms window used by MIREX beat tracking evaluation.
+const DefaultEvalTolerance = 0.07
+
+// EvalResult contains beat tracking scores against a reference annotation.
+type EvalResult struct {
+	FMeasure  float64 `json:"f_measure"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	Matched   int     `json:"matched"`
+	Reference int     `json:"reference"`
+	Estimated int     `json:"estimated"`
+}
+
+// LoadBeatAnnotations reads a ground-truth beat annotation file.
+//
+// Supported formats are one beat per line with the time in seconds as the first
+// column, optionally followed by a beat position or label separated by whitespace
+// or a comma. This covers the Ballroom/GTZAN ".beats" files ("12.345 1") and
+// Sonic Visualiser exports. A position of 1 or a label of "downbeat" marks a
+// downbeat. Blank lines and lines starting with '#' are ignored.
+//
+// Returns beat times and the indices into beats that are downbeats.
+func LoadBeatAnnotations(path string) ([]float64, []int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open annotations: %w", err)
+	}
+	defer f.Close()
+
+	type beat struct {
+		time     float64
+		downbeat bool
+	}
+	var parsed []beat
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) == 0 {
+			continue // Only separators
+		}
+
+		t, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: invalid time %q", lineNum, fields[0])
+		}
+
+		b := beat{time: t}
+		if len(fields) > 1 {
+			label := strings.ToLower(fields[1])
+			if pos, err := strconv.ParseFloat(label, 64); err == nil {
+				b.downbeat = pos == 1
+			} else {
+				b.downbeat = label == "downbeat" || label == "db"
+			}
+		}
+		parsed = append(parsed, b)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("read annotations: %w", err)
+	}
+
+	sort.SliceStable(parsed, func(i, j int) bool { return parsed[i].time < parsed[j].time })
+
+	beats := make([]float64, len(parsed))
+	var downbeats []int
+	for i, b := range parsed {
+		beats[i] = b.time
+		if b.downbeat {
+			downbeats = append(downbeats, i)
+		}
+	}
+
+	return beats, downbeats, nil
+}
+
+// Evaluate scores estimated beat times against reference beat times.
+// A reference beat is matched by at most one estimated beat within tolerance seconds.
+func Evaluate(reference, estimated []float64, tolerance float64) EvalResult {
+	result := EvalResult{
+		Reference: len(reference),
+		Estimated: len(estimated),
+	}
+	if len(reference) == 0 || len(estimated) == 0 {
+		return result
+	}
+
+	used := make([]bool, len(estimated))
+	for _, ref := range reference {
+		bestIdx := -1
+		bestDist := tolerance
+		for i, est := range estimated {
+			if used[i] {
+				continue
+			}
+			if dist := math.Abs(est - ref); dist <= bestDist {
+				bestDist = dist
+				bestIdx = i
+			}
+		}
+		if bestIdx >= 0 {
+			used[bestIdx] = true
+			result.Matched++
+		}
+	}
+
+	result.Precision = float64(result.Matched) / float64(len(estimated))
+	result.Recall = float64(result.Matched) / float64(len(reference))
+	if result.Precision+result.Recall > 0 {
+		result.FMeasure = 2 * result.Precision * result.Recall / (result.Precision + result.Recall)
+	}
+	return result
+}
+
+// EvaluateDir scores every analyzed track in dir that has a ".beats" annotation
+// next to its JSON sidecar, printing the F-measure per analyzer per track to w.
+func EvaluateDir(dir string, w io.Writer) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".beats" {
+			return nil
+		}
+
+		jsonPath := strings.TrimSuffix(path, ".beats") + ".json"
+		if _, err := os.Stat(jsonPath); err != nil {
+			return nil // Not analyzed yet
+		}
+		analysis, err := ReadTrackAnalysis(jsonPath)
+		if err != nil {
+			return err
+		}
+
+		reference, _, err := LoadBeatAnnotations(path)
+		if err != nil {
+			return fmt.Errorf("load %s: %w", path, err)
+		}
+
+		names := make([]string, 0, len(analysis.Grids))
+		for name := range analysis.Grids {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(w, "%s\n", analysis.File)
+		for _, name := range names {
+			g := analysis.Grids[name]
+			if g.Error != "" {
+				fmt.Fprintf(w, "  %-14s error - %s\n", name, g.Error)
+				continue
+			}
+			r := Evaluate(reference, g.Beats, DefaultEvalTolerance)
+			fmt.Fprintf(w, "  %-14s F=%.3f P=%.3f R=%.3f\n", name, r.FMeasure, r.Precision, r.Recall)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,62 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadBeatAnnotations(t *testing.T) {
+	// Ballroom-style annotation: time and beat position within the bar
+	path := filepath.Join(t.TempDir(), "track.beats")
+	data := "# ballroom\n0.500 1\n1.000 2\n1.500 3\n\n2.000 4\n2.500 1\n3.000\t2\n"
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	beats, downbeats, err := LoadBeatAnnotations(path)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.5, 1.0, 1.5, 2.0, 2.5, 3.0}, beats)
+	assert.Equal(t, []int{0, 4}, downbeats)
+
+	// Plain one-time-per-line format has no downbeats
+	path = filepath.Join(t.TempDir(), "plain.txt")
+	require.NoError(t, os.WriteFile(path, []byte("1.0\n0.5\n1.5\n"), 0644))
+
+	beats, downbeats, err = LoadBeatAnnotations(path)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.5, 1.0, 1.5}, beats)
+	assert.Empty(t, downbeats)
+
+	// Lines of only separators are skipped like blank lines
+	path = filepath.Join(t.TempDir(), "separators.csv")
+	require.NoError(t, os.WriteFile(path, []byte("0.5,1\n,\n, \t,\n1.0,2\n"), 0644))
+
+	beats, downbeats, err = LoadBeatAnnotations(path)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.5, 1.0}, beats)
+	assert.Equal(t, []int{0}, downbeats)
+
+	// Garbage is rejected with the line number
+	path = filepath.Join(t.TempDir(), "bad.txt")
+	require.NoError(t, os.WriteFile(path, []byte("0.5\nabc\n"), 0644))
+
+	_, _, err = LoadBeatAnnotations(path)
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestEvaluate(t *testing.T) {
+	reference := []float64{0.5, 1.0, 1.5, 2.0}
+
+	r := Evaluate(reference, []float64{0.51, 1.02, 1.49, 2.03}, DefaultEvalTolerance)
+	assert.InDelta(t, 1.0, r.FMeasure, 1e-9)
+
+	// Half the beats found, one false positive
+	r = Evaluate(reference, []float64{0.5, 1.5, 1.75}, DefaultEvalTolerance)
+	assert.Equal(t, 2, r.Matched)
+	assert.InDelta(t, 2.0/3.0, r.Precision, 1e-9)
+	assert.InDelta(t, 0.5, r.Recall, 1e-9)
+
+	assert.Equal(t, 0.0, Evaluate(reference, nil, DefaultEvalTolerance).FMeasure)
+}
@@ -0,0 +1,205 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides spreadsheet-friendly exports of analysis results.
+package analysis
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Plausible tempo range for exported grids, matching the qm.input_tempo range.
+const (
+	validMinBPM = 40.0
+	validMaxBPM = 300.0
+)
+
+// ValidateGrid returns the problems that would make grid corrupt in DJ
+// software: beats past the end of a track of duration seconds, beats that
+// don't strictly increase, beats closer together than validMaxBPM allows, and a
+// BPM outside [validMinBPM, validMaxBPM]. A duration of 0 skips the end check.
+// A valid grid returns nil.
+func ValidateGrid(grid *GridAnalysis, duration float64) []string {
+	if grid == nil {
+		return []string{"no grid"}
+	}
+	if grid.Error != "" {
+		return []string{"analyzer error: " + grid.Error}
+	}
+
+	var problems []string
+	if !isFinite(grid.BPM) || grid.BPM < validMinBPM || grid.BPM > validMaxBPM {
+		problems = append(problems, fmt.Sprintf("implausible BPM %.2f (want %g to %g)", grid.BPM, validMinBPM, validMaxBPM))
+	}
+	if len(grid.Beats) == 0 {
+		return append(problems, "no beats")
+	}
+
+	// Count each kind of problem rather than listing every beat
+	var pastEnd, nonIncreasing, tooClose int
+	firstPastEnd := -1
+	minInterval := 60 / validMaxBPM
+	for i, t := range grid.Beats {
+		if duration > 0 && t > duration {
+			if pastEnd == 0 {
+				firstPastEnd = i
+			}
+			pastEnd++
+		}
+		if i == 0 {
+			continue
+		}
+		switch interval := t - grid.Beats[i-1]; {
+		case interval <= 0:
+			nonIncreasing++
+		case interval < minInterval:
+			tooClose++
+		}
+	}
+	if pastEnd > 0 {
+		problems = append(problems, fmt.Sprintf("%d beats past the end of the track (%.2fs), first at %.2fs",
+			pastEnd, duration, grid.Beats[firstPastEnd]))
+	}
+	if nonIncreasing > 0 {
+		problems = append(problems, fmt.Sprintf("%d zero or negative beat intervals", nonIncreasing))
+	}
+	if tooClose > 0 {
+		problems = append(problems, fmt.Sprintf("%d beat intervals shorter than %.2fs", tooClose, minInterval))
+	}
+	return problems
+}
+
+// validateExportGrid returns an error listing the ValidateGrid problems of
+// grid in a track of duration seconds, or nil if it has none or force is set.
+// Every exporter calls it before writing anything.
+func validateExportGrid(grid *GridAnalysis, duration float64, force bool) error {
+	if force {
+		return nil
+	}
+	if problems := ValidateGrid(grid, duration); len(problems) > 0 {
+		return fmt.Errorf("invalid grid: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateExport checks the default grid of each track with ValidateGrid.
+func validateExport(analyses []*TrackAnalysis) error {
+	var errs []error
+	for _, ta := range analyses {
+		g := ta.DefaultGrid(nil)
+		if g == nil {
+			continue // Exported with blank cells
+		}
+		if err := validateExportGrid(g, float64(ta.Duration), false); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ta.File, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// csvAnalyzers is the fixed column order for per-analyzer CSV columns.
+var csvAnalyzers = []AnalyzerType{
+	AnalyzerMixx,
+	AnalyzerMixxExtended,
+	AnalyzerRekordboxPy,
+	AnalyzerRekordboxGo,
+	AnalyzerBeatThis,
+	AnalyzerBeatThisFull,
+}
+
+// csvHeader returns the CSV header row: file, duration, default grid BPM, then
+// BPM and beat count per analyzer.
+func csvHeader() []string {
+	header := []string{"file", "duration", "bpm"}
+	for _, name := range csvAnalyzers {
+		header = append(header, string(name)+"_bpm", string(name)+"_beats")
+	}
+	return header
+}
+
+// csvRow returns one CSV row for a track. Missing or errored grids leave blank cells.
+func csvRow(ta *TrackAnalysis) []string {
+	row := []string{ta.File, strconv.FormatFloat(float64(ta.Duration), 'f', 2, 64), ""}
+	if g := ta.DefaultGrid(nil); g != nil {
+		row[2] = strconv.FormatFloat(g.BPM, 'f', 2, 64)
+	}
+	for _, name := range csvAnalyzers {
+		g, ok := ta.Grids[string(name)]
+		if !ok || g.Error != "" {
+			row = append(row, "", "")
+			continue
+		}
+		row = append(row,
+			strconv.FormatFloat(g.BPM, 'f', 2, 64),
+			strconv.Itoa(len(g.Beats)),
+		)
+	}
+	return row
+}
+
+// ExportCSV writes one row per track with file, duration, and each analyzer's BPM and beat count.
+// Nothing is written if any track's default grid fails ValidateGrid, unless force is set.
+func ExportCSV(analyses []*TrackAnalysis, w io.Writer, force bool) error {
+	if !force {
+		if err := validateExport(analyses); err != nil {
+			return err
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader()); err != nil {
+		return err
+	}
+	for _, ta := range analyses {
+		if err := cw.Write(csvRow(ta)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportBeatsCSV writes one row per beat of grid with its index, time in
+// seconds, whether it is a downbeat (1 or 0), and its BeatConfidence, for
+// spreadsheets and Sonic Visualiser. Confidence cells are blank if the grid
+// has no per-beat confidence. Nothing is written if grid fails ValidateGrid
+// for a track of duration seconds, unless force is set.
+func ExportBeatsCSV(grid *GridAnalysis, duration float64, w io.Writer, force bool) error {
+	if grid == nil {
+		return errors.New("no grid")
+	}
+	if grid.Error != "" {
+		return fmt.Errorf("analyzer error: %s", grid.Error)
+	}
+	if err := validateExportGrid(grid, duration, force); err != nil {
+		return err
+	}
+
+	downbeats := make(map[int]bool, len(grid.Downbeats))
+	for _, i := range grid.Downbeats {
+		downbeats[i] = true
+	}
+	hasConfidence := len(grid.BeatConfidence) == len(grid.Beats)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"index", "time_seconds", "is_downbeat", "confidence"}); err != nil {
+		return err
+	}
+	for i, t := range grid.Beats {
+		row := []string{strconv.Itoa(i), strconv.FormatFloat(t, 'f', 6, 64), "0", ""}
+		if downbeats[i] {
+			row[2] = "1"
+		}
+		if hasConfidence {
+			row[3] = strconv.FormatFloat(grid.BeatConfidence[i], 'f', 3, 64)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
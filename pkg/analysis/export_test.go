@@ -0,0 +1,177 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCSV(t *testing.T) {
+	analyses := []*TrackAnalysis{
+		{
+			File:     "a.mp3",
+			Duration: 180.5,
+			Grids: map[string]*GridAnalysis{
+				string(AnalyzerMixx):     {BPM: 128, Beats: []float64{0.5, 1.0, 1.5}},
+				string(AnalyzerBeatThis): {Error: "model not found"},
+			},
+		},
+		{File: "b.mp3", Duration: 90},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, ExportCSV(analyses, &buf, false))
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3) // header + one row per track
+
+	header := records[0]
+	assert.Equal(t, []string{"file", "duration", "bpm", "mixx_bpm", "mixx_beats"}, header[:5])
+
+	row := records[1]
+	assert.Equal(t, "a.mp3", row[0])
+	assert.Equal(t, "180.50", row[1])
+	assert.Equal(t, "128.00", row[2], "errored beatthis falls through to mixx")
+	assert.Equal(t, "128.00", row[3])
+	assert.Equal(t, "3", row[4])
+	assert.Empty(t, records[2][2], "no grids means no default BPM")
+
+	col := map[string]int{}
+	for i, name := range header {
+		col[name] = i
+	}
+	assert.Empty(t, row[col["beatthis_bpm"]], "errored grid should leave blank cells")
+}
+
+func TestValidateGrid(t *testing.T) {
+	beats := func(n int, period float64) []float64 {
+		out := make([]float64, n)
+		for i := range out {
+			out[i] = 0.5 + float64(i)*period
+		}
+		return out
+	}
+
+	assert.Nil(t, ValidateGrid(&GridAnalysis{BPM: 120, Beats: beats(100, 0.5)}, 60))
+	assert.Nil(t, ValidateGrid(&GridAnalysis{BPM: 120, Beats: beats(100, 0.5)}, 0), "unknown duration")
+	assert.Equal(t, []string{"no grid"}, ValidateGrid(nil, 60))
+	assert.Equal(t, []string{"analyzer error: model not found"}, ValidateGrid(&GridAnalysis{Error: "model not found"}, 60))
+
+	// Runs 10s past the end, with a repeated beat, a doubled beat, and a nonsense BPM
+	broken := beats(120, 0.5)
+	broken[10] = broken[9]
+	broken[20] = broken[19] + 0.01
+	problems := ValidateGrid(&GridAnalysis{BPM: 900, Beats: broken}, 50)
+	assert.Equal(t, []string{
+		"implausible BPM 900.00 (want 40 to 300)",
+		"20 beats past the end of the track (50.00s), first at 50.50s",
+		"1 zero or negative beat intervals",
+		"1 beat intervals shorter than 0.20s",
+	}, problems)
+
+	analyses := []*TrackAnalysis{{
+		File:     "broken.mp3",
+		Duration: 50,
+		Grids:    map[string]*GridAnalysis{string(AnalyzerMixx): {BPM: 900, Beats: broken}},
+	}}
+	var buf bytes.Buffer
+	err := ExportCSV(analyses, &buf, false)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "broken.mp3: invalid grid")
+	assert.Empty(t, buf.String(), "nothing is written for an invalid grid")
+
+	require.NoError(t, ExportCSV(analyses, &buf, true))
+	assert.Contains(t, buf.String(), "broken.mp3")
+}
+
+func TestAnalyzeDirCSV(t *testing.T) {
+	// Pre-existing sidecars are skipped but still appear in the CSV
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".mp3"), nil, 0644))
+		ta := &TrackAnalysis{
+			File:  name + ".mp3",
+			Grids: map[string]*GridAnalysis{string(AnalyzerMixx): {BPM: 120}},
+		}
+		require.NoError(t, ta.WriteJSON(filepath.Join(dir, name+".json")))
+	}
+
+	a := &Analyzer{}
+	require.NoError(t, a.AnalyzeDirWithOptions(dir, AnalyzeDirOptions{Format: FormatCSV}))
+
+	f, err := os.Open(filepath.Join(dir, "analysis.csv"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "a.mp3", records[1][0])
+	assert.Equal(t, "b.mp3", records[2][0])
+
+	assert.Error(t, a.AnalyzeDirWithOptions(dir, AnalyzeDirOptions{Format: "xml"}))
+}
+
+func TestDefaultGrid(t *testing.T) {
+	ta := &TrackAnalysis{
+		Grids: map[string]*GridAnalysis{
+			string(AnalyzerBeatThisFull): {Error: "model not found"},
+			string(AnalyzerMixxExtended): {BPM: 125},
+			string(AnalyzerMixx):         {BPM: 124},
+		},
+	}
+
+	// beatthis-full errored and beatthis is missing, so mixx-extended wins
+	g := ta.DefaultGrid(nil)
+	require.NotNil(t, g)
+	assert.Equal(t, 125.0, g.BPM)
+
+	g = ta.DefaultGrid([]AnalyzerType{AnalyzerMixx, AnalyzerMixxExtended})
+	require.NotNil(t, g)
+	assert.Equal(t, 124.0, g.BPM)
+
+	assert.Nil(t, ta.DefaultGrid([]AnalyzerType{AnalyzerBeatThisFull}))
+}
+
+func TestExportBeatsCSV(t *testing.T) {
+	grid := &GridAnalysis{
+		BPM:            120,
+		Beats:          []float64{0.5, 1, 1.5, 2, 2.5},
+		Downbeats:      []int{0, 4},
+		BeatConfidence: []float64{0.9, 0.25, 0.5, 1.0 / 3, 1},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, ExportBeatsCSV(grid, 3, &buf, false))
+	assert.Equal(t, `index,time_seconds,is_downbeat,confidence
+0,0.500000,1,0.900
+1,1.000000,0,0.250
+2,1.500000,0,0.500
+3,2.000000,0,0.333
+4,2.500000,1,1.000
+`, buf.String())
+
+	// Without per-beat confidence the column is blank
+	grid.BeatConfidence = nil
+	buf.Reset()
+	require.NoError(t, ExportBeatsCSV(grid, 3, &buf, false))
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "0,0.500000,1,", lines[1])
+	assert.Equal(t, "1,1.000000,0,", lines[2])
+
+	assert.Error(t, ExportBeatsCSV(nil, 3, &buf, false))
+	assert.Error(t, ExportBeatsCSV(&GridAnalysis{Error: "model not found"}, 3, &buf, true))
+
+	// Beats past the end of the track are refused unless forced
+	buf.Reset()
+	assert.ErrorContains(t, ExportBeatsCSV(grid, 2, &buf, false), "invalid grid")
+	assert.Empty(t, buf.String())
+	require.NoError(t, ExportBeatsCSV(grid, 2, &buf, true))
+	assert.Contains(t, buf.String(), "4,2.500000,1,")
+}
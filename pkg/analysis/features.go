@@ -0,0 +1,48 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides beat-synchronous aggregation of per-frame features.
+package analysis
+
+import (
+	"sort"
+)
+
+// BeatSyncFeatures averages a per-frame feature matrix (e.g. chroma or mel
+// bands, one row per frame at frameTimes seconds) within each beat interval
+// [beats[i], beats[i+1]), returning one vector per interval: len(beats)-1 rows.
+//
+// frameTimes and beats must be sorted. An interval too short to contain a
+// frame takes the frame nearest its start, so every beat has features. Returns
+// nil if features and frameTimes differ in length or there are fewer than two
+// beats.
+func BeatSyncFeatures(features [][]float64, frameTimes []float64, beats []float64) [][]float64 {
+	if len(features) == 0 || len(features) != len(frameTimes) || len(beats) < 2 {
+		return nil
+	}
+
+	dims := len(features[0])
+	synced := make([][]float64, len(beats)-1)
+	for i := range synced {
+		synced[i] = make([]float64, dims)
+		lo := sort.SearchFloat64s(frameTimes, beats[i])
+		hi := sort.SearchFloat64s(frameTimes, beats[i+1])
+		if lo >= hi {
+			// No frame inside, so use the nearest to the beat
+			hi = min(lo, len(frameTimes)-1)
+			if lo > 0 && (lo == len(frameTimes) || beats[i]-frameTimes[lo-1] < frameTimes[lo]-beats[i]) {
+				hi = lo - 1
+			}
+			copy(synced[i], features[hi])
+			continue
+		}
+
+		for _, frame := range features[lo:hi] {
+			for d := range min(dims, len(frame)) {
+				synced[i][d] += frame[d]
+			}
+		}
+		for d := range synced[i] {
+			synced[i][d] /= float64(hi - lo)
+		}
+	}
+	return synced
+}
@@ -0,0 +1,34 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBeatSyncFeatures(t *testing.T) {
+	// 10 frames per second for 3 seconds; feature 0 is the frame index and
+	// feature 1 is constant
+	var features [][]float64
+	var frameTimes []float64
+	for i := range 30 {
+		features = append(features, []float64{float64(i), 1})
+		frameTimes = append(frameTimes, float64(i)/10)
+	}
+
+	// 4 beats make 3 intervals: frames 0-4, 5-14, and 15-29
+	synced := BeatSyncFeatures(features, frameTimes, []float64{0, 0.5, 1.5, 3})
+	require.Len(t, synced, 3)
+	assert.InDeltaSlice(t, []float64{2, 1}, synced[0], 1e-9)
+	assert.InDeltaSlice(t, []float64{9.5, 1}, synced[1], 1e-9)
+	assert.InDeltaSlice(t, []float64{22, 1}, synced[2], 1e-9)
+
+	// An interval between frames takes the nearest frame
+	synced = BeatSyncFeatures(features, frameTimes, []float64{1.02, 1.05, 2})
+	require.Len(t, synced, 2)
+	assert.Equal(t, []float64{10, 1}, synced[0])
+
+	assert.Nil(t, BeatSyncFeatures(features, frameTimes, []float64{1}))
+	assert.Nil(t, BeatSyncFeatures(features, frameTimes[:10], []float64{0, 1}))
+}
@@ -0,0 +1,123 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides cached downloads of audio fixtures for tests and benchmarks.
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Fixture download retry policy. Backoff doubles after each failed attempt.
+var (
+	fixtureAttempts = 5
+	fixtureBackoff  = 500 * time.Millisecond
+)
+
+// FetchFixture downloads url into dir, returning the cached path if it already exists.
+// Failed requests and 5xx responses are retried with exponential backoff. Downloads
+// are written to a ".part" file and renamed on success so an interrupted download
+// never leaves a truncated fixture. If sha256sum is non-empty, the download is
+// verified against it and discarded on mismatch.
+func FetchFixture(url, dir, sha256sum string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create fixture dir: %w", err)
+	}
+
+	path := filepath.Join(dir, filepath.Base(url))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	if _, err := fetch(url, path, sha256sum, 0); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// fetch downloads url to path with the fixture retry policy, returning the
+// response Content-Type. If maxBytes is positive, larger downloads fail
+// without retrying.
+func fetch(url, path, sha256sum string, maxBytes int64) (string, error) {
+	backoff := fixtureBackoff
+	var lastErr error
+	for attempt := range fixtureAttempts {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		contentType, retry, err := downloadFixture(url, path, sha256sum, maxBytes)
+		if err == nil {
+			return contentType, nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+
+	return "", fmt.Errorf("fetch %s: %w", url, lastErr)
+}
+
+// downloadFixture makes one download attempt, reporting the response Content-Type
+// and whether a failure is worth retrying.
+func downloadFixture(url, path, sha256sum string, maxBytes int64) (string, bool, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return "", retry, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	body := io.Reader(resp.Body)
+	if maxBytes > 0 {
+		if resp.ContentLength > maxBytes {
+			return "", false, fmt.Errorf("download too large: %d bytes exceeds limit of %d", resp.ContentLength, maxBytes)
+		}
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+
+	part := path + ".part"
+	f, err := os.Create(part)
+	if err != nil {
+		return "", false, err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(part)
+		return "", true, err
+	}
+
+	if maxBytes > 0 && n > maxBytes {
+		os.Remove(part)
+		return "", false, fmt.Errorf("download too large: exceeds limit of %d bytes", maxBytes)
+	}
+
+	if sha256sum != "" {
+		if got := hex.EncodeToString(h.Sum(nil)); got != sha256sum {
+			os.Remove(part)
+			return "", false, fmt.Errorf("checksum mismatch: got %s, want %s", got, sha256sum)
+		}
+	}
+
+	if err := os.Rename(part, path); err != nil {
+		os.Remove(part)
+		return "", false, err
+	}
+	return resp.Header.Get("Content-Type"), false, nil
+}
@@ -0,0 +1,55 @@
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchFixture(t *testing.T) {
+	defer func(b time.Duration) { fixtureBackoff = b }(fixtureBackoff)
+	fixtureBackoff = time.Millisecond
+
+	body := []byte("fake audio")
+	sum := sha256.Sum256(body)
+
+	// Server is unavailable once, then serves the file
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	path, err := FetchFixture(srv.URL+"/track.mp3", dir, hex.EncodeToString(sum[:]))
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, body, data)
+
+	// Cached fixture is not downloaded again
+	_, err = FetchFixture(srv.URL+"/track.mp3", dir, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	// Checksum mismatch fails without leaving a partial file behind
+	_, err = FetchFixture(srv.URL+"/other.mp3", dir, "deadbeef")
+	assert.ErrorContains(t, err, "checksum mismatch")
+	assert.NoFileExists(t, filepath.Join(dir, "other.mp3"))
+	assert.NoFileExists(t, filepath.Join(dir, "other.mp3.part"))
+}
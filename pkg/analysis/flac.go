@@ -0,0 +1,444 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides native FLAC decoding.
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// FLAC format codes from the spec.
+const (
+	flacBlockStreamInfo  = 0      // Metadata block type
+	flacSyncCode         = 0x3FFE // 14-bit frame sync
+	flacSubframeConstant = 0      // Subframe types; 8-12 are fixed, 32-63 LPC
+	flacSubframeVerbatim = 1      //
+	flacLeftSide         = 8      // Channel assignments; 0-7 are independent channels
+	flacSideRight        = 9      //
+	flacMidSide          = 10     //
+)
+
+// flacMaxPreallocSamples caps the per-channel buffer preallocated from
+// STREAMINFO, about 24 seconds at 44.1 kHz.
+const flacMaxPreallocSamples = 1 << 20
+
+// flacStreamInfo holds the STREAMINFO fields needed to decode frames.
+type flacStreamInfo struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	TotalSamples  int64 // 0 if unknown
+}
+
+// loadFLAC decodes a FLAC file to float32 channel buffers in [-1, 1].
+// Unlike MP3, FLAC is lossless and has no encoder delay, so no samples are
+// skipped.
+func loadFLAC(path string, opts LoadAudioMonoOptions) ([][]float32, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	channels, info, err := decodeFLAC(data[min(id3v2Size(data), len(data)):], opts.MaxDuration)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode FLAC: %w", err)
+	}
+	return channels, info.SampleRate, nil
+}
+
+// decodeFLAC decodes a FLAC stream, returning channel buffers and the stream
+// info. Decoding stops after maxDuration of audio if it is positive. Frame
+// CRCs are checked so corrupt files fail loudly.
+//
+// Decoding whole files in memory needs only this much of the format, so it
+// is done here rather than with github.com/mewkiz/flac, whose frame-by-frame
+// API and extra dependencies buy nothing for it.
+func decodeFLAC(data []byte, maxDuration Seconds) ([][]float32, *flacStreamInfo, error) {
+	if !bytes.HasPrefix(data, []byte("fLaC")) {
+		return nil, nil, fmt.Errorf("missing fLaC marker")
+	}
+
+	// Metadata blocks: last flag (1 bit), type (7 bits), length (24 bits)
+	var info *flacStreamInfo
+	pos := 4
+	for last := false; !last; {
+		if pos+4 > len(data) {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		last = data[pos]&0x80 != 0
+		typ := data[pos] & 0x7F
+		length := int(data[pos+1])<<16 | int(data[pos+2])<<8 | int(data[pos+3])
+		pos += 4
+		if pos+length > len(data) {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		if typ == flacBlockStreamInfo {
+			if length < 34 {
+				return nil, nil, fmt.Errorf("STREAMINFO too short: %d bytes", length)
+			}
+			r := &flacBitReader{data: data[pos+10 : pos+18]}
+			info = &flacStreamInfo{
+				SampleRate:    int(r.bits(20)),
+				Channels:      int(r.bits(3)) + 1,
+				BitsPerSample: int(r.bits(5)) + 1,
+				TotalSamples:  int64(r.bits(36)),
+			}
+		}
+		pos += length
+	}
+	if info == nil {
+		return nil, nil, fmt.Errorf("missing STREAMINFO")
+	}
+
+	limit := info.TotalSamples
+	if maxDuration > 0 {
+		maxFrames := int64(max(maxDuration.Frames(float64(info.SampleRate)), 1))
+		if limit == 0 || maxFrames < limit {
+			limit = maxFrames
+		}
+	}
+
+	// TotalSamples comes from the file, so a corrupt header mustn't size the
+	// buffers; longer streams grow by append
+	channels := make([][]float32, info.Channels)
+	for ch := range channels {
+		channels[ch] = make([]float32, 0, min(limit, flacMaxPreallocSamples))
+	}
+	r := &flacBitReader{data: data, pos: pos * 8}
+	for r.pos/8 < len(data) {
+		decoded := int64(len(channels[0]))
+		if maxDuration > 0 && decoded >= limit {
+			break
+		}
+		// Trailing data such as an ID3v1 tag follows the last frame
+		if r.peek(14) != flacSyncCode && info.TotalSamples > 0 && decoded >= info.TotalSamples {
+			break
+		}
+		if err := decodeFLACFrame(r, info, channels); err != nil {
+			return nil, nil, fmt.Errorf("frame at byte %d: %w", r.pos/8, err)
+		}
+	}
+	for ch, c := range channels {
+		if limit > 0 && int64(len(c)) > limit {
+			channels[ch] = c[:limit]
+		}
+	}
+	return channels, info, nil
+}
+
+// flacBlockSizes maps block size codes 1-5 and 8-15 to samples per block.
+// Codes 6 and 7 read the size from the end of the header.
+var flacBlockSizes = [16]int{0, 192, 576, 1152, 2304, 4608, 0, 0, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768}
+
+// flacSampleSizes maps sample size codes to bits per sample; 0 uses STREAMINFO.
+var flacSampleSizes = [8]int{0, 8, 12, 0, 16, 20, 24, 32}
+
+// decodeFLACFrame decodes one frame at r, appending each channel's samples
+// to the matching buffer of out.
+func decodeFLACFrame(r *flacBitReader, info *flacStreamInfo, out [][]float32) error {
+	start := r.pos / 8
+	if sync := r.bits(14); sync != flacSyncCode {
+		return fmt.Errorf("bad frame sync %#x", sync)
+	}
+	r.bits(2) // Reserved, blocking strategy
+	blockCode := r.bits(4)
+	rateCode := r.bits(4)
+	channelCode := int(r.bits(4))
+	sizeCode := r.bits(3)
+	r.bits(1) // Reserved
+
+	// Frame or sample number, UTF-8 coded: continuation bytes follow a lead
+	// byte with its top bits set, one per set bit after the first
+	if lead := r.bits(8); lead&0x80 != 0 {
+		for n := lead << 1; n&0x80 != 0; n <<= 1 {
+			r.bits(8)
+		}
+	}
+
+	blockSize := flacBlockSizes[blockCode]
+	switch blockCode {
+	case 6:
+		blockSize = int(r.bits(8)) + 1
+	case 7:
+		blockSize = int(r.bits(16)) + 1
+	}
+	// Explicit rates are skipped; the STREAMINFO rate applies to every frame
+	switch rateCode {
+	case 12:
+		r.bits(8)
+	case 13, 14:
+		r.bits(16)
+	case 15:
+		return fmt.Errorf("invalid sample rate code")
+	}
+	r.bits(8) // CRC-8, covered by the frame CRC-16 below
+	if blockSize == 0 {
+		return fmt.Errorf("reserved block size code")
+	}
+
+	bps := info.BitsPerSample
+	if sizeCode != 0 {
+		bps = flacSampleSizes[sizeCode]
+	}
+	if bps == 0 {
+		return fmt.Errorf("reserved sample size code")
+	}
+	channels := channelCode + 1
+	if channelCode >= flacLeftSide {
+		if channelCode > flacMidSide {
+			return fmt.Errorf("reserved channel assignment %d", channelCode)
+		}
+		channels = 2
+	}
+	if channels != len(out) {
+		return fmt.Errorf("frame has %d channels, stream has %d", channels, len(out))
+	}
+
+	// The side channel carries one extra bit
+	chans := make([][]int64, channels)
+	for ch := range chans {
+		chBPS := bps
+		if (channelCode == flacLeftSide || channelCode == flacMidSide) && ch == 1 ||
+			channelCode == flacSideRight && ch == 0 {
+			chBPS++
+		}
+		chans[ch] = make([]int64, blockSize)
+		if err := decodeFLACSubframe(r, chans[ch], chBPS); err != nil {
+			return fmt.Errorf("channel %d: %w", ch, err)
+		}
+	}
+
+	r.align()
+	end := r.pos / 8
+	crc := r.bits(16)
+	if r.err != nil {
+		return r.err
+	}
+	if got := flacCRC16(r.data[start:end]); uint64(got) != crc {
+		return fmt.Errorf("CRC mismatch: %#04x != %#04x", got, crc)
+	}
+
+	// Undo inter-channel decorrelation, then scale to [-1, 1]
+	switch channelCode {
+	case flacLeftSide:
+		for i, side := range chans[1] {
+			chans[1][i] = chans[0][i] - side
+		}
+	case flacSideRight:
+		for i, side := range chans[0] {
+			chans[0][i] = side + chans[1][i]
+		}
+	case flacMidSide:
+		for i, side := range chans[1] {
+			mid := chans[0][i]<<1 | side&1
+			chans[0][i], chans[1][i] = (mid+side)>>1, (mid-side)>>1
+		}
+	}
+	scale := float64(int64(1) << (bps - 1))
+	for ch, c := range chans {
+		for _, v := range c {
+			out[ch] = append(out[ch], float32(float64(v)/scale))
+		}
+	}
+	return nil
+}
+
+// flacFixedCoeffs are the predictor coefficients of the fixed subframe orders.
+var flacFixedCoeffs = [5][]int64{{}, {1}, {2, -1}, {3, -3, 1}, {4, -6, 4, -1}}
+
+// decodeFLACSubframe decodes one channel of a frame into samples.
+func decodeFLACSubframe(r *flacBitReader, samples []int64, bps int) error {
+	r.bits(1) // Zero padding
+	typ := int(r.bits(6))
+	var wasted int
+	if r.bits(1) == 1 {
+		wasted = r.unary() + 1
+		bps -= wasted
+	}
+
+	switch {
+	case typ == flacSubframeConstant:
+		v := r.signed(bps)
+		for i := range samples {
+			samples[i] = v
+		}
+	case typ == flacSubframeVerbatim:
+		for i := range samples {
+			samples[i] = r.signed(bps)
+		}
+	case typ >= 8 && typ <= 12:
+		order := typ - 8
+		if order > len(samples) {
+			return fmt.Errorf("predictor order %d exceeds block size %d", order, len(samples))
+		}
+		for i := range order {
+			samples[i] = r.signed(bps)
+		}
+		if err := decodeFLACResidual(r, samples, order); err != nil {
+			return err
+		}
+		flacPredict(samples, flacFixedCoeffs[order], 0)
+	case typ >= 32:
+		order := typ - 31
+		if order > len(samples) {
+			return fmt.Errorf("predictor order %d exceeds block size %d", order, len(samples))
+		}
+		for i := range order {
+			samples[i] = r.signed(bps)
+		}
+		precision := int(r.bits(4)) + 1
+		if precision == 16 {
+			return fmt.Errorf("invalid LPC precision")
+		}
+		shift := int(r.signed(5))
+		if shift < 0 {
+			return fmt.Errorf("negative LPC shift %d", shift)
+		}
+		coeffs := make([]int64, order)
+		for i := range coeffs {
+			coeffs[i] = r.signed(precision)
+		}
+		if err := decodeFLACResidual(r, samples, order); err != nil {
+			return err
+		}
+		flacPredict(samples, coeffs, shift)
+	default:
+		return fmt.Errorf("reserved subframe type %d", typ)
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+	return r.err
+}
+
+// flacPredict adds the linear prediction from the preceding samples to each
+// residual in samples after the warm-up samples.
+func flacPredict(samples, coeffs []int64, shift int) {
+	for i := len(coeffs); i < len(samples); i++ {
+		var sum int64
+		for j, c := range coeffs {
+			sum += c * samples[i-1-j]
+		}
+		samples[i] += sum >> shift
+	}
+}
+
+// decodeFLACResidual decodes the Rice-coded residual into samples[order:].
+func decodeFLACResidual(r *flacBitReader, samples []int64, order int) error {
+	method := r.bits(2)
+	if method > 1 {
+		return fmt.Errorf("reserved residual coding method %d", method)
+	}
+	paramBits, escape := 4, uint64(15)
+	if method == 1 {
+		paramBits, escape = 5, 31
+	}
+
+	partitions := 1 << r.bits(4)
+	partSize := len(samples) / partitions
+	if partSize*partitions != len(samples) || partSize < order {
+		return fmt.Errorf("invalid residual partitioning: %d partitions of %d samples", partitions, len(samples))
+	}
+	i := order
+	for p := range partitions {
+		end := (p + 1) * partSize
+		param := r.bits(paramBits)
+		if param == escape {
+			bits := int(r.bits(5))
+			for ; i < end; i++ {
+				samples[i] = r.signed(bits)
+			}
+			continue
+		}
+		for ; i < end; i++ {
+			v := uint64(r.unary())<<param | r.bits(int(param))
+			samples[i] = int64(v>>1) ^ -int64(v&1) // Zigzag decode
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+	return nil
+}
+
+// flacBitReader reads big-endian bit fields. The first read past the end of
+// data sets err, and later reads return zeros.
+type flacBitReader struct {
+	data []byte
+	pos  int // In bits
+	err  error
+}
+
+// bits reads an n-bit unsigned value, n <= 64.
+func (r *flacBitReader) bits(n int) uint64 {
+	var v uint64
+	for n > 0 {
+		if r.pos/8 >= len(r.data) {
+			r.err = io.ErrUnexpectedEOF
+			return 0
+		}
+		avail := 8 - r.pos%8
+		take := min(avail, n)
+		v = v<<take | uint64(r.data[r.pos/8]>>(avail-take))&(1<<take-1)
+		r.pos += take
+		n -= take
+	}
+	return v
+}
+
+// signed reads an n-bit two's complement value.
+func (r *flacBitReader) signed(n int) int64 {
+	if n == 0 {
+		return 0
+	}
+	return int64(r.bits(n)<<(64-n)) >> (64 - n)
+}
+
+// unary counts zero bits up to and including the next one bit.
+func (r *flacBitReader) unary() int {
+	var n int
+	for {
+		// Skip whole zero bytes at once
+		for r.pos%8 == 0 && r.pos/8 < len(r.data) && r.data[r.pos/8] == 0 {
+			r.pos += 8
+			n += 8
+		}
+		if r.bits(1) == 1 || r.err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+// peek returns the next n bits without consuming them.
+func (r *flacBitReader) peek(n int) uint64 {
+	pos, err := r.pos, r.err
+	v := r.bits(n)
+	r.pos, r.err = pos, err
+	return v
+}
+
+// align skips to the next byte boundary.
+func (r *flacBitReader) align() {
+	r.pos = (r.pos + 7) / 8 * 8
+}
+
+// flacCRC16 computes the frame footer CRC (polynomial 0x8005, initial 0).
+func flacCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
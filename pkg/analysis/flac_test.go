@@ -0,0 +1,231 @@
+package analysis
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flacTestWriter packs big-endian bit fields for building FLAC streams.
+type flacTestWriter struct {
+	buf   []byte
+	nbits int
+}
+
+func (w *flacTestWriter) bits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.nbits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[len(w.buf)-1] |= byte(v>>i&1) << (7 - w.nbits%8)
+		w.nbits++
+	}
+}
+
+func (w *flacTestWriter) signed(v int64, n int) { w.bits(uint64(v)&(1<<n-1), n) }
+
+// residual writes Rice-coded residuals for a block whose first order samples
+// are warm-up, in 1<<partOrder partitions with their own parameters. With
+// rice2, parameters are 5 bits and the first partition is escaped to raw
+// values, as encoders do for noisy partitions.
+func (w *flacTestWriter) residual(res []int64, order, partOrder int, rice2 bool) {
+	paramBits := 4
+	if rice2 {
+		paramBits = 5
+	}
+	w.bits(uint64(paramBits-4), 2)
+	w.bits(uint64(partOrder), 4)
+	partSize := (len(res) + order) >> partOrder
+	for p := range 1 << partOrder {
+		part := res[max(p*partSize-order, 0) : (p+1)*partSize-order]
+		if rice2 && p == 0 {
+			const bits = 20
+			w.bits(1<<paramBits-1, paramBits) // Escape
+			w.bits(bits, 5)
+			for _, r := range part {
+				w.signed(r, bits)
+			}
+			continue
+		}
+		param := 4 + p%4
+		w.bits(uint64(param), paramBits)
+		for _, r := range part {
+			u := uint64(r<<1 ^ r>>63) // Zigzag encode
+			for range u >> param {
+				w.bits(0, 1)
+			}
+			w.bits(1, 1)
+			w.bits(u, param)
+		}
+	}
+}
+
+// subframe writes samples as an order-2 predictor, fixed or the equivalent
+// LPC with shifted coefficients. Fixed subframes use a single Rice partition
+// and LPC subframes use eight with Rice2 parameters when the block divides.
+func (w *flacTestWriter) subframe(samples []int64, bps int, lpc bool) {
+	res := make([]int64, len(samples)-2)
+	for i := range res {
+		res[i] = samples[i+2] - (2*samples[i+1] - samples[i])
+	}
+	if lpc {
+		w.bits(2*(32+1), 8) // Type 33 (LPC order 2), no wasted bits
+	} else {
+		w.bits(2*(8+2), 8) // Type 10 (fixed order 2)
+	}
+	w.signed(samples[0], bps)
+	w.signed(samples[1], bps)
+	if !lpc {
+		w.residual(res, 2, 0, false)
+		return
+	}
+	w.bits(14, 4) // 15-bit coefficients
+	w.bits(1, 5)  // Shift right by 1
+	w.signed(4, 15)
+	w.signed(-2, 15)
+	partOrder := 0
+	if len(samples)%8 == 0 {
+		partOrder = 3
+	}
+	w.residual(res, 2, partOrder, true)
+}
+
+// encodeTestFLAC encodes 16-bit stereo at 44.1 kHz in 4096-sample blocks,
+// cycling through the independent and decorrelated channel assignments.
+func encodeTestFLAC(left, right []int64) []byte {
+	const blockSize = 4096
+	w := &flacTestWriter{}
+	w.buf = append(w.buf, "fLaC"...)
+	w.bits(1<<7|flacBlockStreamInfo, 8)
+	w.bits(34, 24)
+	w.bits(blockSize, 16)
+	w.bits(blockSize, 16)
+	w.bits(0, 48) // Frame sizes unknown
+	w.bits(44100, 20)
+	w.bits(2-1, 3)
+	w.bits(16-1, 5)
+	w.bits(uint64(len(left)), 36)
+	w.bits(0, 128) // MD5 unset
+
+	channelCodes := []int{1, flacLeftSide, flacSideRight, flacMidSide}
+	for frame := 0; frame*blockSize < len(left); frame++ {
+		l := left[frame*blockSize : min((frame+1)*blockSize, len(left))]
+		r := right[frame*blockSize : min((frame+1)*blockSize, len(right))]
+		code := channelCodes[frame%len(channelCodes)]
+
+		start := len(w.buf)
+		w.bits(flacSyncCode, 14)
+		w.bits(0, 2)
+		if len(l) == blockSize {
+			w.bits(12, 4)
+		} else {
+			w.bits(7, 4) // 16-bit size at the end of the header
+		}
+		w.bits(9, 4) // 44.1 kHz
+		w.bits(uint64(code), 4)
+		w.bits(4, 3) // 16 bits per sample
+		w.bits(0, 1)
+		w.bits(uint64(frame), 8)
+		if len(l) != blockSize {
+			w.bits(uint64(len(l)-1), 16)
+		}
+		var crc8 byte
+		for _, b := range w.buf[start:] {
+			crc8 ^= b
+			for range 8 {
+				if crc8&0x80 != 0 {
+					crc8 = crc8<<1 ^ 0x07
+				} else {
+					crc8 <<= 1
+				}
+			}
+		}
+		w.bits(uint64(crc8), 8)
+
+		side, mid := make([]int64, len(l)), make([]int64, len(l))
+		for i := range l {
+			side[i], mid[i] = l[i]-r[i], (l[i]+r[i])>>1
+		}
+		lpc := frame%2 == 1
+		switch code {
+		case flacLeftSide:
+			w.subframe(l, 16, lpc)
+			w.subframe(side, 17, lpc)
+		case flacSideRight:
+			w.subframe(side, 17, lpc)
+			w.subframe(r, 16, lpc)
+		case flacMidSide:
+			w.subframe(mid, 16, lpc)
+			w.subframe(side, 17, lpc)
+		default:
+			w.subframe(l, 16, lpc)
+			w.subframe(r, 16, lpc)
+		}
+
+		w.nbits = (w.nbits + 7) / 8 * 8
+		w.bits(uint64(flacCRC16(w.buf[start:])), 16)
+	}
+	return w.buf
+}
+
+func TestLoadFLACMono(t *testing.T) {
+	const sampleRate, duration = 44100, 2.0
+	n := int(duration * sampleRate)
+	left, right := make([]int64, n), make([]int64, n)
+	want := make([]float32, n)
+	for i := range n {
+		s := math.Sin(2 * math.Pi * 440 * float64(i) / sampleRate)
+		left[i] = int64(math.Round(0.8 * s * 32767))
+		right[i] = int64(math.Round(-0.3 * s * 32767))
+		want[i] = float32(left[i]+right[i]) / 2 / 32768
+	}
+
+	dir := t.TempDir()
+	data := encodeTestFLAC(left, right)
+	// Some taggers prepend an ID3v2 tag (here 20 bytes of padding) to FLAC
+	tagged := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x14"), make([]byte, 20)...)
+	tagged = append(tagged, data...)
+	for name, content := range map[string][]byte{"tone.flac": data, "tagged.flac": tagged} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, content, 0644))
+
+		samples, rate, err := LoadAudioMono(path)
+		require.NoError(t, err, name)
+		assert.Equal(t, sampleRate, rate)
+		require.Len(t, samples, int(duration*float64(rate)))
+		for i := range want {
+			if math.Abs(float64(samples[i]-want[i])) > 1e-6 {
+				t.Fatalf("%s sample %d: got %v, want %v", name, i, samples[i], want[i])
+			}
+		}
+	}
+
+	// A corrupted frame fails its CRC instead of decoding garbage
+	data[len(data)/2] ^= 0xFF
+	_, _, err := decodeFLAC(data, 0)
+	assert.Error(t, err)
+
+	// A header claiming the 36-bit maximum of samples doesn't size the buffers
+	w := &flacTestWriter{}
+	w.buf = append(w.buf, "fLaC"...)
+	w.bits(1<<7|flacBlockStreamInfo, 8)
+	w.bits(34, 24)
+	w.bits(4096, 16)
+	w.bits(4096, 16)
+	w.bits(0, 48)
+	w.bits(44100, 20)
+	w.bits(8-1, 3)
+	w.bits(16-1, 5)
+	w.bits(1<<36-1, 36)
+	w.bits(0, 128)
+	channels, info, err := decodeFLAC(w.buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1<<36-1), info.TotalSamples)
+	require.Len(t, channels, 8)
+	assert.Empty(t, channels[0])
+	assert.LessOrEqual(t, cap(channels[0]), flacMaxPreallocSamples)
+}
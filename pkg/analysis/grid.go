@@ -0,0 +1,622 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides beat grid post-processing utilities shared by all analyzers.
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// FindDownbeatOne picks the most likely true bar-one among candidate downbeats.
+// beats and downbeats are timestamps in seconds, energy holds one value per beat.
+//
+// The first detected downbeat is often a pickup (anacrusis), so each candidate is
+// scored by the average energy of all beats sharing its bar phase plus how many
+// other detected downbeats fall on that phase. The earliest downbeat on the
+// winning phase is returned. Returns 0 if there are no candidates.
+func FindDownbeatOne(beats, downbeats []float64, energy []float64) float64 {
+	if len(downbeats) == 0 {
+		return 0
+	}
+	if len(beats) == 0 {
+		return downbeats[0]
+	}
+
+	// Map each downbeat to its nearest beat index
+	indices := make([]int, len(downbeats))
+	for i, db := range downbeats {
+		indices[i] = nearestBeatIndex(beats, db)
+	}
+
+	barLen := estimateBarLength(indices)
+	if barLen < 2 {
+		return downbeats[0]
+	}
+
+	// Average energy of all beats at each bar phase
+	phaseEnergy := make([]float64, barLen)
+	if len(energy) == len(beats) {
+		counts := make([]int, barLen)
+		for i, e := range energy {
+			if math.IsNaN(e) || math.IsInf(e, 0) {
+				continue
+			}
+			phaseEnergy[i%barLen] += e
+			counts[i%barLen]++
+		}
+		maxEnergy := 0.0
+		for p := range phaseEnergy {
+			if counts[p] > 0 {
+				phaseEnergy[p] /= float64(counts[p])
+			}
+			maxEnergy = math.Max(maxEnergy, phaseEnergy[p])
+		}
+		if maxEnergy > 0 {
+			for p := range phaseEnergy {
+				phaseEnergy[p] /= maxEnergy
+			}
+		}
+	}
+
+	// Periodicity: fraction of detected downbeats agreeing on each phase
+	phaseVotes := make([]float64, barLen)
+	for _, idx := range indices {
+		phaseVotes[idx%barLen]++
+	}
+	for p := range phaseVotes {
+		phaseVotes[p] /= float64(len(indices))
+	}
+
+	bestIdx := -1
+	bestScore := math.Inf(-1)
+	for i, idx := range indices {
+		score := phaseEnergy[idx%barLen] + phaseVotes[idx%barLen]
+		if score > bestScore {
+			bestScore = score
+			bestIdx = i
+		}
+	}
+
+	// Earliest beat on the winning phase that is itself a detected downbeat
+	phase := indices[bestIdx] % barLen
+	for i, idx := range indices {
+		if idx%barLen == phase {
+			return downbeats[i]
+		}
+	}
+	return downbeats[bestIdx]
+}
+
+// DeriveDownbeats estimates downbeats for analyzers that only report beats.
+// beats are timestamps in seconds and energy holds one value per beat. Every
+// beatsPerBar-th beat is a downbeat; the bar phase is the one whose beats have
+// the highest average energy, since bar-one is usually the accented beat.
+// Returns indices into beats, or nil if there are fewer beats than one bar.
+func DeriveDownbeats(beats []float64, beatsPerBar int, energy []float64) []int {
+	if beatsPerBar < 1 || len(beats) < beatsPerBar {
+		return nil
+	}
+
+	phase := 0
+	if len(energy) == len(beats) {
+		phaseEnergy := make([]float64, beatsPerBar)
+		counts := make([]int, beatsPerBar)
+		for i, e := range energy {
+			if !isFinite(e) {
+				continue
+			}
+			phaseEnergy[i%beatsPerBar] += e
+			counts[i%beatsPerBar]++
+		}
+		best := math.Inf(-1)
+		for p := range phaseEnergy {
+			if counts[p] == 0 {
+				continue
+			}
+			if mean := phaseEnergy[p] / float64(counts[p]); mean > best {
+				best = mean
+				phase = p
+			}
+		}
+	}
+
+	downbeats := make([]int, 0, len(beats)/beatsPerBar+1)
+	for i := phase; i < len(beats); i += beatsPerBar {
+		downbeats = append(downbeats, i)
+	}
+	return downbeats
+}
+
+// DefaultPhraseBars is the phrase length in bars of the phrase markers
+// AnalyzeFileWithContext derives from the grid.
+const DefaultPhraseBars = 16
+
+// DerivePhraseMarkers returns a "phrase" cue at every barsPerPhrase-th
+// downbeat from the first, for mixing on uniform 8, 16, or 32 bar phrases.
+// downbeats are indices into beats; invalid indices are skipped. It needs no
+// model, so it works on any grid with downbeats.
+func DerivePhraseMarkers(downbeats []int, beats []float64, barsPerPhrase int) []CuePoint {
+	if barsPerPhrase < 1 {
+		return nil
+	}
+	var cues []CuePoint
+	bar := 0
+	for _, i := range downbeats {
+		if i < 0 || i >= len(beats) {
+			continue
+		}
+		if bar%barsPerPhrase == 0 {
+			cues = append(cues, CuePoint{
+				Time:  Seconds(beats[i]),
+				Type:  "phrase",
+				Name:  fmt.Sprintf("phrase-%d", bar/barsPerPhrase),
+				Color: CueColor("phrase"),
+			})
+		}
+		bar++
+	}
+	return cues
+}
+
+// WaveformBeatEnergy returns the peak waveform amplitude within ±50ms of each beat.
+func WaveformBeatEnergy(w *Waveform, beats []float64) []float64 {
+	energy := make([]float64, len(beats))
+	if w == nil || w.PixelsPerSec <= 0 || len(w.Peaks) == 0 {
+		return energy
+	}
+
+	radius := int(math.Ceil(0.05 * float64(w.PixelsPerSec)))
+	for i, bt := range beats {
+		center := int(bt * float64(w.PixelsPerSec))
+		for p := center - radius; p <= center+radius; p++ {
+			if p < 0 || p >= len(w.Peaks) {
+				continue
+			}
+			amp := math.Max(math.Abs(w.Peaks[p]), math.Abs(w.Troughs[p]))
+			energy[i] = math.Max(energy[i], amp)
+		}
+	}
+	return energy
+}
+
+// Velocity window around each beat and dynamic range mapped onto MIDI velocities.
+const (
+	velocityWindowBefore = 0.02 // seconds before the beat, for early onsets
+	velocityWindowAfter  = 0.08 // seconds after the beat, covering the attack
+	velocityRangeDB      = 40.0 // beats this far below the loudest map to velocity 1
+)
+
+// BeatVelocities returns a MIDI velocity (1-127) per beat from the peak amplitude
+// around each beat, scaled in decibels relative to the loudest beat so accents
+// survive export to MIDI and DAW click tracks.
+func BeatVelocities(beats []float64, samples []float32, sampleRate int) []int {
+	velocities := make([]int, len(beats))
+	if len(beats) == 0 || sampleRate <= 0 {
+		return velocities
+	}
+
+	peaks := make([]float64, len(beats))
+	maxPeak := 0.0
+	for i, bt := range beats {
+		start := max(int((bt-velocityWindowBefore)*float64(sampleRate)), 0)
+		end := min(int((bt+velocityWindowAfter)*float64(sampleRate)), len(samples))
+		for j := start; j < end; j++ {
+			peaks[i] = math.Max(peaks[i], math.Abs(float64(samples[j])))
+		}
+		maxPeak = math.Max(maxPeak, peaks[i])
+	}
+
+	for i, peak := range peaks {
+		velocities[i] = 1
+		if maxPeak == 0 || peak == 0 {
+			continue
+		}
+		db := 20 * math.Log10(peak/maxPeak)
+		v := int(math.Round(1 + 126*(1+db/velocityRangeDB)))
+		velocities[i] = min(max(v, 1), 127)
+	}
+	return velocities
+}
+
+// Transient detection for RefineBeatsToTransients.
+const (
+	transientBlockSecs   = 0.001 // Energy block size, the refinement resolution
+	transientContextSecs = 0.01  // Preceding span an energy rise is measured against
+	transientRiseRatio   = 4     // Energy over the preceding average that counts as an onset
+	transientMinStrength = 0.1   // Onsets weaker than this fraction of the strongest are ignored
+	transientAttackStart = 0.1   // Fraction of an onset's peak rise where its attack begins
+)
+
+// RefineBeatsToTransients nudges each beat to the strongest onset within
+// windowMs either side of it, so beats from ML models that sit a few
+// milliseconds off the kick land on the transient itself. Onsets are 1ms
+// blocks whose energy at least quadruples over the preceding 10ms, which
+// ignores ripple within sustained notes, and a beat moves to the start of the
+// attack leading up to its strongest onset. Beats with no onset at least a
+// tenth as strong as the track's strongest are left unchanged, as are beats
+// that would move past a neighbour. Returns a new slice.
+func RefineBeatsToTransients(beats []float64, samples []float32, sampleRate int, windowMs float64) []float64 {
+	refined := slices.Clone(beats)
+	if len(beats) == 0 || sampleRate <= 0 || windowMs <= 0 {
+		return refined
+	}
+
+	block := max(int(transientBlockSecs*float64(sampleRate)), 1)
+	energy := make([]float64, len(samples)/block)
+	for k := range energy {
+		for _, v := range samples[k*block : (k+1)*block] {
+			if x := float64(v); isFinite(x) {
+				energy[k] += x * x
+			}
+		}
+	}
+
+	// Onset strength is the energy rise over the preceding context average
+	context := max(int(transientContextSecs/transientBlockSecs), 1)
+	onset := make([]float64, len(energy))
+	var sum, strongest float64
+	for k, e := range energy {
+		if mean := sum / float64(max(min(k, context), 1)); k > 0 && e >= transientRiseRatio*mean {
+			onset[k] = e - mean
+			strongest = max(strongest, onset[k])
+		}
+		sum += e
+		if k >= context {
+			sum -= energy[k-context]
+		}
+	}
+
+	blockSecs := float64(block) / float64(sampleRate)
+	radius := int(math.Ceil(windowMs / 1000 / blockSecs))
+	for i, bt := range beats {
+		if !isFinite(bt) {
+			continue
+		}
+
+		// Strongest onset in the window
+		center := int(math.Round(bt / blockSecs))
+		lo, hi := max(center-radius, 0), min(center+radius, len(onset)-1)
+		k := -1
+		for j := lo; j <= hi; j++ {
+			if onset[j] > 0 && (k < 0 || onset[j] > onset[k]) {
+				k = j
+			}
+		}
+		if k < 0 || onset[k] < transientMinStrength*strongest {
+			continue
+		}
+
+		// Walk back through the rising attack to where it starts
+		floor := transientAttackStart * onset[k]
+		for k > lo && onset[k-1] >= floor && onset[k-1] <= onset[k] {
+			k--
+		}
+		t := float64(k) * blockSecs
+		if (i > 0 && t <= refined[i-1]) || (i+1 < len(beats) && t >= beats[i+1]) {
+			continue
+		}
+		refined[i] = t
+	}
+	return refined
+}
+
+// BeatActivation renders beats as a soft per-frame activation target at frameRateHz,
+// the inverse of peak-picking. Each beat puts a Gaussian bump (peak 1.0 on the nearest
+// frame, sigma widthFrames/2) over widthFrames frames either side; overlapping bumps
+// take the maximum. widthFrames of 0 produces single-frame impulses.
+func BeatActivation(beats []float64, duration float64, frameRateHz float64, widthFrames int) []float64 {
+	if duration <= 0 || frameRateHz <= 0 {
+		return nil
+	}
+	numFrames := int(math.Ceil(duration * frameRateHz))
+	activation := make([]float64, numFrames)
+	sigma := float64(widthFrames) / 2
+
+	for _, bt := range beats {
+		center := int(math.Round(bt * frameRateHz))
+		for f := center - widthFrames; f <= center+widthFrames; f++ {
+			if f < 0 || f >= numFrames {
+				continue
+			}
+			v := 1.0
+			if f != center {
+				d := float64(f-center) / sigma
+				v = math.Exp(-0.5 * d * d)
+			}
+			activation[f] = math.Max(activation[f], v)
+		}
+	}
+	return activation
+}
+
+// ForceGrid returns a constant-tempo grid at exactly bpm with a downbeat at
+// firstBeat, for tracks known to be at a fixed tempo where detection wobble is
+// unwanted. Beats extend back to the start of the track and forward to
+// duration, and every fourth beat from firstBeat is a downbeat. The grid has
+// an Error if bpm or duration is not positive or firstBeat is outside the track.
+func ForceGrid(bpm, firstBeat, duration float64) *GridAnalysis {
+	switch {
+	case !isFinite(bpm) || bpm <= 0:
+		return &GridAnalysis{Error: fmt.Sprintf("invalid BPM %g", bpm)}
+	case !isFinite(duration) || duration <= 0:
+		return &GridAnalysis{Error: fmt.Sprintf("invalid duration %g", duration)}
+	case !isFinite(firstBeat) || firstBeat < 0 || firstBeat >= duration:
+		return &GridAnalysis{Error: fmt.Sprintf("first beat %g outside track (0 to %g)", firstBeat, duration)}
+	}
+
+	// Each beat is computed from the anchor rather than accumulated, so the
+	// spacing doesn't drift over a long track
+	period := 60 / bpm
+	before := int(firstBeat / period)
+	beatsPerBar := DefaultQMConfig().BeatsPerBar
+	g := &GridAnalysis{BPM: bpm, DownbeatOne: Seconds(firstBeat), BeatsPerBar: beatsPerBar}
+	for i := -before; ; i++ {
+		t := firstBeat + float64(i)*period
+		if t >= duration {
+			break
+		}
+		if i%beatsPerBar == 0 {
+			g.Downbeats = append(g.Downbeats, len(g.Beats))
+		}
+		g.Beats = append(g.Beats, t)
+	}
+	return g
+}
+
+// BPMRange bounds the tempo ML analyzers report: the BPM of the median beat
+// interval is doubled or halved into it. Widen it for styles outside the
+// default, e.g. 140-220 so half-time drum'n'bass grids report the full tempo.
+// The zero value is DefaultBPMRange.
+type BPMRange struct {
+	Min float64 `yaml:"min" json:"min"`
+	Max float64 `yaml:"max" json:"max"`
+}
+
+// DefaultBPMRange is the 60-180 BPM range tempos are normalized into by default.
+var DefaultBPMRange = BPMRange{Min: 60, Max: 180}
+
+// Normalize doubles bpm until it reaches Min, then halves it while it is
+// above Max and half of it isn't below Min. A tempo with no octave inside a
+// range narrower than an octave ends up above Max.
+func (r BPMRange) Normalize(bpm float64) float64 {
+	if r == (BPMRange{}) {
+		r = DefaultBPMRange
+	}
+	if !isFinite(bpm) || bpm <= 0 {
+		return bpm
+	}
+	for bpm < r.Min {
+		bpm *= 2
+	}
+	for bpm > r.Max && bpm/2 >= r.Min {
+		bpm /= 2
+	}
+	return bpm
+}
+
+// validate reports whether r is the zero value or a positive range.
+func (r BPMRange) validate() error {
+	if r != (BPMRange{}) && (r.Min <= 0 || r.Max <= r.Min) {
+		return fmt.Errorf("invalid BPM range %g-%g", r.Min, r.Max)
+	}
+	return nil
+}
+
+// computeGridAnchor returns the anchor of a constant grid through grid's
+// beats: the time of its first downbeat, or of its first beat if it has no
+// downbeats, and the tempo of its median beat interval (grid.BPM with fewer
+// than two beats). Both are 0 for a grid without beats.
+func computeGridAnchor(grid *GridAnalysis) (firstBeatSec, bpm float64) {
+	if grid == nil || len(grid.Beats) == 0 {
+		return 0, 0
+	}
+
+	firstBeatSec = grid.Beats[0]
+	for _, i := range grid.Downbeats {
+		if i >= 0 && i < len(grid.Beats) {
+			firstBeatSec = grid.Beats[i]
+			break
+		}
+	}
+
+	bpm = grid.BPM
+	if len(grid.Beats) >= 2 {
+		intervals := make([]float64, 0, len(grid.Beats)-1)
+		for i := 1; i < len(grid.Beats); i++ {
+			intervals = append(intervals, grid.Beats[i]-grid.Beats[i-1])
+		}
+		if median := medianFloat64BeatThis(intervals); median > 0 {
+			bpm = 60 / median
+		}
+	}
+	return firstBeatSec, bpm
+}
+
+// octaveTolerance is the relative tempo error allowed when matching a harmonic multiple.
+const octaveTolerance = 0.04
+
+// NormalizeOctave re-derives a beat grid at the reference tempo's octave when it
+// runs at 2x, 3x, or 4x (thinned to every k-th beat) or 1/2, 1/3, or 1/4 (beats
+// interpolated between each pair) of referenceBPM. Grids at the reference tempo
+// or at an unrelated tempo are returned unchanged.
+func NormalizeOctave(beats []float64, referenceBPM float64) []float64 {
+	if len(beats) < 2 || referenceBPM <= 0 {
+		return beats
+	}
+
+	intervals := make([]float64, 0, len(beats)-1)
+	for i := 1; i < len(beats); i++ {
+		intervals = append(intervals, beats[i]-beats[i-1])
+	}
+	median := medianFloat64BeatThis(intervals)
+	if median <= 0 {
+		return beats
+	}
+	bpm := 60 / median
+
+	near := func(target float64) bool {
+		return math.Abs(bpm-target) <= octaveTolerance*target
+	}
+
+	for k := 2; k <= 4; k++ {
+		if near(referenceBPM * float64(k)) {
+			thinned := make([]float64, 0, len(beats)/k+1)
+			for i := 0; i < len(beats); i += k {
+				thinned = append(thinned, beats[i])
+			}
+			return thinned
+		}
+		if near(referenceBPM / float64(k)) {
+			filled := make([]float64, 0, len(beats)*k)
+			for i := 0; i < len(beats)-1; i++ {
+				step := (beats[i+1] - beats[i]) / float64(k)
+				for j := range k {
+					filled = append(filled, beats[i]+float64(j)*step)
+				}
+			}
+			return append(filled, beats[len(beats)-1])
+		}
+	}
+
+	return beats
+}
+
+// AlignBeatsToDownbeats regenerates beats so that every downbeat coincides with
+// a beat, for grids where beats and downbeats come from different analyzers.
+// Between consecutive downbeats, the number of beats is rounded from the median
+// beat period and spread evenly; before the first and after the last downbeat,
+// beats continue at the median period over the span of the original grid.
+func AlignBeatsToDownbeats(beats, downbeats []float64) []float64 {
+	if len(beats) < 2 || len(downbeats) == 0 {
+		return beats
+	}
+
+	intervals := make([]float64, 0, len(beats)-1)
+	for i := 1; i < len(beats); i++ {
+		intervals = append(intervals, beats[i]-beats[i-1])
+	}
+	period := medianFloat64BeatThis(intervals)
+	if period <= 0 {
+		return beats
+	}
+
+	// Lead-in before the first downbeat
+	first := downbeats[0]
+	lead := min(int(math.Floor((first-beats[0]+period/2)/period)), int(first/period))
+	aligned := make([]float64, 0, len(beats)+len(downbeats))
+	for k := lead; k > 0; k-- {
+		aligned = append(aligned, first-float64(k)*period)
+	}
+
+	// Evenly spaced beats between each pair of downbeats
+	last := first
+	for _, d := range downbeats[1:] {
+		n := int(math.Round((d - last) / period))
+		if n < 1 {
+			continue // Downbeat within half a beat of the previous one
+		}
+		step := (d - last) / float64(n)
+		for j := range n {
+			aligned = append(aligned, last+float64(j)*step)
+		}
+		last = d
+	}
+
+	// Tail after the last downbeat
+	for t := last; t <= beats[len(beats)-1]+period/2; t += period {
+		aligned = append(aligned, t)
+	}
+	return aligned
+}
+
+// isFinite reports whether x is neither NaN nor ±Inf.
+func isFinite(x float64) bool {
+	return !math.IsNaN(x) && !math.IsInf(x, 0)
+}
+
+// finiteActivation returns probs with NaN and ±Inf replaced by zero, so a model
+// that emits non-finite activations yields no peaks instead of a peak per frame.
+// probs is returned unchanged if it is already finite.
+func finiteActivation(probs []float32) []float32 {
+	for i, p := range probs {
+		if isFinite(float64(p)) {
+			continue
+		}
+		clean := make([]float32, len(probs))
+		copy(clean, probs[:i])
+		for j := i; j < len(probs); j++ {
+			if isFinite(float64(probs[j])) {
+				clean[j] = probs[j]
+			}
+		}
+		return clean
+	}
+	return probs
+}
+
+// sanitizeGrid makes a grid safe to encode as JSON, which rejects NaN and ±Inf.
+// A non-finite BPM, bar-one, or detection function value is replaced by zero;
+// non-finite beat times mark the grid as errored since its beats can't be trusted.
+func sanitizeGrid(g *GridAnalysis) {
+	if !isFinite(g.BPM) {
+		g.BPM = 0
+		g.Warnings = append(g.Warnings, "non-finite BPM replaced with 0")
+	}
+	if !isFinite(float64(g.DownbeatOne)) {
+		g.DownbeatOne = 0
+	}
+	for i, v := range g.DetectionFunction {
+		if !isFinite(v) {
+			g.DetectionFunction[i] = 0
+		}
+	}
+	for _, bt := range g.Beats {
+		if !isFinite(bt) {
+			if g.Error == "" {
+				g.Error = "analyzer produced non-finite beat times"
+			}
+			g.BPM = 0
+			g.Beats = nil
+			g.Downbeats = nil
+			g.BeatConfidence = nil
+			g.DownbeatOne = 0
+			return
+		}
+	}
+}
+
+// nearestBeatIndex returns the index of the beat closest to t.
+func nearestBeatIndex(beats []float64, t float64) int {
+	best := 0
+	bestDist := math.MaxFloat64
+	for i, bt := range beats {
+		if dist := math.Abs(bt - t); dist < bestDist {
+			bestDist = dist
+			best = i
+		}
+	}
+	return best
+}
+
+// estimateBarLength returns the most common spacing in beats between consecutive downbeats.
+func estimateBarLength(indices []int) int {
+	if len(indices) < 2 {
+		return 4
+	}
+
+	counts := make(map[int]int)
+	for i := 1; i < len(indices); i++ {
+		if gap := indices[i] - indices[i-1]; gap > 0 {
+			counts[gap]++
+		}
+	}
+
+	best, bestCount := 4, 0
+	for gap, n := range counts {
+		if n > bestCount || (n == bestCount && gap < best) {
+			best, bestCount = gap, n
+		}
+	}
+	return best
+}
@@ -0,0 +1,158 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides the GridAnalyzer interface and the registry of grid analyzers.
+package analysis
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// GridAnalyzer is a beat detector that runs on decoded mono samples. Analyzers
+// registered with RegisterGridAnalyzer run alongside the built-ins in
+// AnalyzeFileWithContext and AnalyzeLoaded, and their grids are compared,
+// voted on, and exported like any other.
+//
+// If a GridAnalyzer also has a Version() string method, the version is added
+// to TrackAnalysis.Versions, and if it is an io.Closer, Analyzer.Close closes it.
+type GridAnalyzer interface {
+	// Name is the key of the analyzer's grid in TrackAnalysis.Grids.
+	Name() string
+	// Analyze detects the beat grid of samples at sampleRate Hz.
+	Analyze(samples []float32, sampleRate int) (*GridAnalysis, error)
+}
+
+// GridAnalyzerFactory creates a GridAnalyzer for an Analyzer. cfg holds the
+// Analyzer's settings, or the defaults. An error means the analyzer isn't
+// available, e.g. its model isn't installed, and it is skipped.
+type GridAnalyzerFactory func(cfg *Config) (GridAnalyzer, error)
+
+// gridRegistration is a registered grid analyzer.
+type gridRegistration struct {
+	name    AnalyzerType
+	factory GridAnalyzerFactory
+}
+
+// pathGridAnalyzers are the built-in grid analyzers that aren't GridAnalyzers:
+// mixx-extended adds markers, and rekordbox-py and mixx-drums need the file.
+var pathGridAnalyzers = []AnalyzerType{AnalyzerMixxExtended, AnalyzerRekordboxPy, AnalyzerMixxDrums}
+
+var (
+	gridRegistryMu sync.RWMutex
+	gridRegistry   []gridRegistration // In registration order
+)
+
+// RegisterGridAnalyzer makes a grid analyzer available to New and NewWithConfig
+// under name, which must match the Name of the analyzers factory creates. It
+// runs whenever Config.Analyzers is empty or lists name. It panics if name is
+// already registered.
+func RegisterGridAnalyzer(name AnalyzerType, factory GridAnalyzerFactory) {
+	gridRegistryMu.Lock()
+	defer gridRegistryMu.Unlock()
+	if name == "" || factory == nil {
+		panic("analysis: RegisterGridAnalyzer needs a name and a factory")
+	}
+	reserved := append(slices.Clone(pathGridAnalyzers), AnalyzerForced, AnalyzerConsensus)
+	if slices.Contains(reserved, name) || slices.ContainsFunc(gridRegistry, func(r gridRegistration) bool { return r.name == name }) {
+		panic(fmt.Sprintf("analysis: grid analyzer %q registered twice", name))
+	}
+	gridRegistry = append(gridRegistry, gridRegistration{name, factory})
+}
+
+// registeredGridAnalyzers returns the registered grid analyzers in order.
+func registeredGridAnalyzers() []gridRegistration {
+	gridRegistryMu.RLock()
+	defer gridRegistryMu.RUnlock()
+	return slices.Clone(gridRegistry)
+}
+
+// isRegisteredGridAnalyzer reports whether at was registered with RegisterGridAnalyzer.
+func isRegisteredGridAnalyzer(at AnalyzerType) bool {
+	return slices.ContainsFunc(registeredGridAnalyzers(), func(r gridRegistration) bool { return r.name == at })
+}
+
+func init() {
+	RegisterGridAnalyzer(AnalyzerMixx, func(*Config) (GridAnalyzer, error) {
+		return mixxGridAnalyzer{}, nil
+	})
+	RegisterGridAnalyzer(AnalyzerRekordboxGo, func(cfg *Config) (GridAnalyzer, error) {
+		tf, err := NewTFAnalyzer()
+		if err != nil {
+			return nil, err
+		}
+		tf.BPMRange = cfg.BPMRange
+		return tf, nil
+	})
+	RegisterGridAnalyzer(AnalyzerBeatThis, beatThisFactory("small"))
+	RegisterGridAnalyzer(AnalyzerBeatThisFull, beatThisFactory("full"))
+}
+
+// beatThisFactory creates beat_this analyzers with the model of modelSize.
+func beatThisFactory(modelSize string) GridAnalyzerFactory {
+	return func(cfg *Config) (GridAnalyzer, error) {
+		bt, err := NewBeatThisAnalyzerWithOptions(modelSize, cfg.beatThisOptions())
+		if err != nil {
+			return nil, err
+		}
+		return bt, nil
+	}
+}
+
+// mixxGridAnalyzer is the basic QM-DSP beat tracker with default settings.
+type mixxGridAnalyzer struct{}
+
+// Name returns "mixx".
+func (mixxGridAnalyzer) Name() string { return string(AnalyzerMixx) }
+
+// Analyze runs the basic QM-DSP beat tracker.
+func (mixxGridAnalyzer) Analyze(samples []float32, sampleRate int) (*GridAnalysis, error) {
+	r, err := AnalyzeSamplesQM(samples, sampleRate, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &GridAnalysis{
+		BPM:                r.BPM,
+		Beats:              r.Beats,
+		AnalysisSampleRate: r.SampleRate,
+	}, nil
+}
+
+// Name returns "rekordbox-go".
+func (a *TFAnalyzer) Name() string { return string(AnalyzerRekordboxGo) }
+
+// Analyze runs the Rekordbox model as a GridAnalyzer.
+func (a *TFAnalyzer) Analyze(samples []float32, sampleRate int) (*GridAnalysis, error) {
+	r, err := a.AnalyzeSamples(samples, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return &GridAnalysis{
+		BPM:                r.BPM,
+		Beats:              r.Beats,
+		Warnings:           withDurationCheck(r.Warnings, r.Duration, FramesToSeconds(len(samples), float64(sampleRate))),
+		AnalysisSampleRate: r.SampleRate,
+	}, nil
+}
+
+// Name returns "beatthis" for the small model and "beatthis-full" for the full one.
+func (a *BeatThisAnalyzer) Name() string {
+	if a.modelSize == "full" {
+		return string(AnalyzerBeatThisFull)
+	}
+	return string(AnalyzerBeatThis)
+}
+
+// Analyze runs beat_this as a GridAnalyzer.
+func (a *BeatThisAnalyzer) Analyze(samples []float32, sampleRate int) (*GridAnalysis, error) {
+	r, err := a.AnalyzeSamples(samples, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return &GridAnalysis{
+		BPM:                r.BPM,
+		Beats:              r.Beats,
+		Downbeats:          r.Downbeats,
+		Warnings:           withDurationCheck(r.Warnings, r.Duration, FramesToSeconds(len(samples), float64(sampleRate))),
+		AnalysisSampleRate: r.SampleRate,
+	}, nil
+}
@@ -0,0 +1,55 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGridAnalyzer reports a 120 BPM grid for any audio.
+type fakeGridAnalyzer struct {
+	closed bool
+}
+
+func (f *fakeGridAnalyzer) Name() string    { return "fake" }
+func (f *fakeGridAnalyzer) Version() string { return "fake-1" }
+func (f *fakeGridAnalyzer) Close() error    { f.closed = true; return nil }
+
+func (f *fakeGridAnalyzer) Analyze(samples []float32, sampleRate int) (*GridAnalysis, error) {
+	var beats []float64
+	for t := 0.0; t < float64(len(samples))/float64(sampleRate); t += 0.5 {
+		beats = append(beats, t)
+	}
+	return &GridAnalysis{BPM: 120, Beats: beats, AnalysisSampleRate: sampleRate}, nil
+}
+
+func TestRegisterGridAnalyzer(t *testing.T) {
+	fake := &fakeGridAnalyzer{}
+	RegisterGridAnalyzer("fake", func(*Config) (GridAnalyzer, error) { return fake, nil })
+	assert.Panics(t, func() {
+		RegisterGridAnalyzer("fake", func(*Config) (GridAnalyzer, error) { return fake, nil })
+	})
+	assert.Panics(t, func() {
+		RegisterGridAnalyzer(AnalyzerMixxExtended, func(*Config) (GridAnalyzer, error) { return fake, nil })
+	})
+
+	// Registered analyzers can be selected in the config
+	cfg := DefaultConfig()
+	cfg.Analyzers = []AnalyzerType{"fake"}
+	require.NoError(t, cfg.Validate())
+
+	a, err := NewWithConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "fake-1", a.Versions()["fake"])
+
+	ta, err := a.AnalyzeLoaded(make([]float32, 4*44100), 44100, nil)
+	require.NoError(t, err)
+	require.Contains(t, ta.Grids, "fake")
+	assert.Equal(t, 120.0, ta.Grids["fake"].BPM)
+	assert.Len(t, ta.Grids["fake"].Beats, 8)
+	assert.NotContains(t, ta.Grids, string(AnalyzerMixxExtended), "only selected analyzers run")
+
+	require.NoError(t, a.Close())
+	assert.True(t, fake.closed)
+}
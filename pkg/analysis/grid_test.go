@@ -0,0 +1,380 @@
+package analysis
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindDownbeatOne(t *testing.T) {
+	// 120 BPM grid where beat 0 is an anacrusis (pickup) and bars start on beat 1
+	beats := make([]float64, 33)
+	energy := make([]float64, len(beats))
+	for i := range beats {
+		beats[i] = float64(i) * 0.5
+		energy[i] = 0.3
+		if i%4 == 1 {
+			energy[i] = 1.0 // accented bar-one
+		}
+	}
+
+	// Detector flagged the pickup as a downbeat, followed by the true downbeats
+	downbeats := []float64{beats[0]}
+	for i := 1; i < len(beats); i += 4 {
+		downbeats = append(downbeats, beats[i])
+	}
+
+	one := FindDownbeatOne(beats, downbeats, energy)
+	assert.Equal(t, beats[1], one, "should skip the pickup and pick the first accented downbeat")
+
+	// Without energy, downbeat periodicity alone should still reject the pickup
+	one = FindDownbeatOne(beats, downbeats, nil)
+	assert.Equal(t, beats[1], one)
+
+	// No candidates
+	assert.Equal(t, 0.0, FindDownbeatOne(beats, nil, energy))
+}
+
+func TestDeriveDownbeats(t *testing.T) {
+	// 120 BPM grid accented every 4 beats starting on beat 2 (two-beat pickup)
+	beats := make([]float64, 34)
+	energy := make([]float64, len(beats))
+	for i := range beats {
+		beats[i] = float64(i) * 0.5
+		energy[i] = 0.4
+		if i%4 == 2 {
+			energy[i] = 0.9
+		}
+	}
+	energy[5] = math.NaN()
+
+	downbeats := DeriveDownbeats(beats, 4, energy)
+	assert.Equal(t, []int{2, 6, 10, 14, 18, 22, 26, 30}, downbeats)
+
+	// Without energy, bars start on the first beat
+	assert.Equal(t, []int{0, 3, 6, 9}, DeriveDownbeats(beats[:12], 3, nil))
+
+	// Fewer beats than a bar
+	assert.Nil(t, DeriveDownbeats(beats[:3], 4, energy[:3]))
+}
+
+func TestDerivePhraseMarkers(t *testing.T) {
+	// Four minutes at a steady 128 BPM in 4/4, bars starting on the third beat
+	const beatsPerBar, barsPerPhrase = 4, 8
+	beats := make([]float64, 4*128)
+	for i := range beats {
+		beats[i] = 0.2 + float64(i)*60/128
+	}
+	var downbeats []int
+	for i := 2; i < len(beats); i += beatsPerBar {
+		downbeats = append(downbeats, i)
+	}
+
+	cues := DerivePhraseMarkers(downbeats, beats, barsPerPhrase)
+	require.Len(t, cues, (len(downbeats)+barsPerPhrase-1)/barsPerPhrase)
+	assert.Equal(t, Seconds(beats[2]), cues[0].Time)
+	for i := 1; i < len(cues); i++ {
+		gap := float64(cues[i].Time-cues[i-1].Time) * 128 / 60
+		assert.InDelta(t, barsPerPhrase*beatsPerBar, gap, 1e-9)
+	}
+	assert.Equal(t, CuePoint{Time: cues[1].Time, Type: "phrase", Name: "phrase-1", Color: CueColor("phrase")}, cues[1])
+
+	// Invalid downbeats are skipped without counting as bars
+	cues = DerivePhraseMarkers([]int{-1, 2, 6, 1000, 10}, beats, 2)
+	assert.Equal(t, []Seconds{Seconds(beats[2]), Seconds(beats[10])}, cueTimes(cues))
+
+	assert.Empty(t, DerivePhraseMarkers(nil, beats, 8))
+	assert.Empty(t, DerivePhraseMarkers(downbeats, beats, 0))
+}
+
+func TestWaveformBeatEnergy(t *testing.T) {
+	w := &Waveform{
+		PixelsPerSec: 100,
+		Peaks:        make([]float64, 300),
+		Troughs:      make([]float64, 300),
+	}
+	w.Peaks[100] = 0.8
+	w.Troughs[200] = -0.5
+
+	energy := WaveformBeatEnergy(w, []float64{1.0, 2.02, 2.5})
+	assert.InDelta(t, 0.8, energy[0], 1e-9)
+	assert.InDelta(t, 0.5, energy[1], 1e-9)
+	assert.InDelta(t, 0.0, energy[2], 1e-9)
+}
+
+func TestBeatVelocities(t *testing.T) {
+	const sampleRate = 1000
+	samples := make([]float32, 4*sampleRate)
+	beats := []float64{0.5, 1.5, 2.5, 3.5}
+	amps := []float32{1.0, 0.25, 0.5, 0}
+	for i, bt := range beats {
+		start := int(bt * sampleRate)
+		for j := start; j < start+50; j++ {
+			samples[j] = amps[i]
+		}
+	}
+
+	v := BeatVelocities(beats, samples, sampleRate)
+	assert.Equal(t, 127, v[0], "loudest beat gets full velocity")
+	assert.Greater(t, v[2], v[1], "louder beat gets higher velocity")
+	assert.Greater(t, v[1], v[3])
+	assert.Equal(t, 1, v[3], "silent beat gets minimum velocity")
+
+	assert.Empty(t, BeatVelocities(nil, samples, sampleRate))
+}
+
+func TestRefineBeatsToTransients(t *testing.T) {
+	// Decaying 60 Hz kicks at 0.5, 1.0, and 1.5s over quiet noise
+	const sampleRate = 44100
+	samples := make([]float32, 2*sampleRate)
+	for i := range samples {
+		samples[i] = 0.001 * float32(math.Sin(float64(i)*12.9898))
+	}
+	kicks := []float64{0.5, 1.0, 1.5}
+	for _, kt := range kicks {
+		start := int(kt * sampleRate)
+		for j := range sampleRate / 10 {
+			tt := float64(j) / sampleRate
+			samples[start+j] += float32(0.8 * math.Exp(-tt*30) * math.Sin(2*math.Pi*60*tt))
+		}
+	}
+
+	// Beats a few ms early or late snap onto the kicks; the beat in silence stays
+	beats := []float64{0.492, 0.995, 1.506, 1.8}
+	refined := RefineBeatsToTransients(beats, samples, sampleRate, 20)
+	require.Len(t, refined, len(beats))
+	for i, kt := range kicks {
+		assert.InDelta(t, kt, refined[i], 0.001, "beat %d", i)
+	}
+	assert.Equal(t, 1.8, refined[3])
+	assert.Equal(t, 0.492, beats[0], "input is not modified")
+
+	// Transients outside the window are ignored
+	far := []float64{0.49, 1.01, 1.8}
+	assert.Equal(t, far, RefineBeatsToTransients(far, samples, sampleRate, 3))
+
+	assert.Empty(t, RefineBeatsToTransients(nil, samples, sampleRate, 20))
+}
+
+func TestBeatActivation(t *testing.T) {
+	// 100 Hz frames, beats at frames 50 and 150
+	act := BeatActivation([]float64{0.5, 1.5}, 2.0, 100, 2)
+	assert.Len(t, act, 200)
+
+	assert.Equal(t, 1.0, act[50])
+	assert.Equal(t, 1.0, act[150])
+
+	// Symmetric bump falling off with sigma = 1 frame
+	assert.InDelta(t, math.Exp(-0.5), act[49], 1e-9)
+	assert.InDelta(t, math.Exp(-0.5), act[51], 1e-9)
+	assert.InDelta(t, math.Exp(-2), act[52], 1e-9)
+
+	// Nothing outside the width
+	assert.Equal(t, 0.0, act[47])
+	assert.Equal(t, 0.0, act[53])
+	assert.Equal(t, 0.0, act[100])
+
+	// Zero width gives impulses; beats past the end are dropped
+	act = BeatActivation([]float64{0.5, 5.0}, 1.0, 100, 0)
+	assert.Equal(t, 1.0, act[50])
+	assert.Equal(t, 0.0, act[51])
+
+	assert.Nil(t, BeatActivation(nil, 0, 100, 2))
+}
+
+func TestForceGrid(t *testing.T) {
+	// A 10-minute track at 128 BPM anchored on a downbeat 1.2s in
+	g := ForceGrid(128, 1.2, 600)
+	require.Empty(t, g.Error)
+	assert.Equal(t, 128.0, g.BPM)
+	assert.Equal(t, Seconds(1.2), g.DownbeatOne)
+
+	period := 60.0 / 128
+	for i := 1; i < len(g.Beats); i++ {
+		assert.InDelta(t, period, g.Beats[i]-g.Beats[i-1], 1e-9, "beat %d", i)
+	}
+	assert.InDelta(t, 1.2-2*period, g.Beats[0], 1e-9, "beats extend back to the start")
+	assert.Less(t, g.Beats[len(g.Beats)-1], 600.0)
+	assert.Greater(t, g.Beats[len(g.Beats)-1]+period, 600.0)
+	assert.Empty(t, ValidateGrid(g, 600))
+
+	// Downbeats are every fourth beat, in phase with the anchor
+	require.NotEmpty(t, g.Downbeats)
+	assert.Equal(t, 2, g.Downbeats[0])
+	assert.Equal(t, 1.2, g.Beats[g.Downbeats[0]])
+	for i := 1; i < len(g.Downbeats); i++ {
+		assert.Equal(t, 4, g.Downbeats[i]-g.Downbeats[i-1])
+	}
+
+	assert.NotEmpty(t, ForceGrid(0, 1, 60).Error)
+	assert.NotEmpty(t, ForceGrid(128, 1, 0).Error)
+	assert.NotEmpty(t, ForceGrid(128, 61, 60).Error)
+}
+
+func TestNormalizeOctave(t *testing.T) {
+	// Reference grid at 120 BPM
+	reference := make([]float64, 16)
+	for i := range reference {
+		reference[i] = 1.0 + float64(i)*0.5
+	}
+
+	// Doubled grid (240 BPM) thins back to the reference
+	doubled := make([]float64, 0, 2*len(reference))
+	for _, bt := range reference {
+		doubled = append(doubled, bt, bt+0.25)
+	}
+	doubled = doubled[:len(doubled)-1]
+	assert.InDeltaSlice(t, reference, NormalizeOctave(doubled, 120), 1e-9)
+
+	// Half-tempo grid (60 BPM) is filled back in
+	var halved []float64
+	for i := 0; i < len(reference); i += 2 {
+		halved = append(halved, reference[i])
+	}
+	assert.InDeltaSlice(t, reference[:len(reference)-1], NormalizeOctave(halved, 120), 1e-9)
+
+	// Same octave and unrelated tempos are untouched
+	assert.Equal(t, reference, NormalizeOctave(reference, 120))
+	assert.Equal(t, reference, NormalizeOctave(reference, 97))
+}
+
+func TestComputeGridAnchor(t *testing.T) {
+	// 124 BPM with a little jitter, bars starting on the third beat
+	grid := &GridAnalysis{BPM: 124, Downbeats: []int{2, 6, 10}}
+	for i := range 12 {
+		jitter := 0.0
+		if i%3 == 0 {
+			jitter = 0.004
+		}
+		grid.Beats = append(grid.Beats, 0.3+float64(i)*60/124+jitter)
+	}
+	first, bpm := computeGridAnchor(grid)
+	assert.Equal(t, grid.Beats[2], first)
+	assert.Contains(t, grid.Beats, first)
+	assert.InDelta(t, 124, bpm, 0.01)
+
+	// Invalid downbeat indices are skipped
+	grid.Downbeats = []int{-1, 40, 3}
+	first, _ = computeGridAnchor(grid)
+	assert.Equal(t, grid.Beats[3], first)
+
+	// Without downbeats the first beat anchors the grid
+	grid.Downbeats = nil
+	first, _ = computeGridAnchor(grid)
+	assert.Equal(t, grid.Beats[0], first)
+
+	// A single beat keeps the grid's BPM, and no beats have no anchor
+	first, bpm = computeGridAnchor(&GridAnalysis{BPM: 128, Beats: []float64{1.5}})
+	assert.Equal(t, 1.5, first)
+	assert.Equal(t, 128.0, bpm)
+	first, bpm = computeGridAnchor(&GridAnalysis{Error: "model not found"})
+	assert.Zero(t, first)
+	assert.Zero(t, bpm)
+
+	// anchorGrids stores the anchor on each grid
+	ta := &TrackAnalysis{Grids: map[string]*GridAnalysis{"a": {Beats: []float64{0.5, 1, 1.5, 2}, Downbeats: []int{1}}}}
+	anchorGrids(ta)
+	assert.Equal(t, 1.0, ta.Grids["a"].FirstDownbeat)
+}
+
+func TestBPMRange(t *testing.T) {
+	// A 174 BPM drum'n'bass track tracked in half time: a beat every other hit
+	var beats []float64
+	for i := range 64 {
+		beats = append(beats, float64(i)*2*60/174)
+	}
+	assert.InDelta(t, 87, calculateBPMFromBeatsBeatThis(beats, DefaultBPMRange), 0.01)
+	assert.InDelta(t, 87, calculateBPMFromBeatsBeatThis(beats, BPMRange{}), 0.01)
+	assert.InDelta(t, 174, calculateBPMFromBeatsBeatThis(beats, BPMRange{Min: 140, Max: 220}), 0.01)
+
+	// The default range matches the old 60-180 normalization
+	assert.Equal(t, 90.0, DefaultBPMRange.Normalize(45))
+	assert.Equal(t, 95.0, DefaultBPMRange.Normalize(190))
+	assert.Equal(t, 180.0, DefaultBPMRange.Normalize(180))
+
+	// In a range narrower than an octave, tempos without an octave in it
+	// stay above the range rather than dropping below it
+	dnb := BPMRange{Min: 140, Max: 220}
+	assert.Equal(t, 170.0, dnb.Normalize(85))
+	assert.Equal(t, 230.0, dnb.Normalize(230))
+	assert.Equal(t, 0.0, dnb.Normalize(0))
+
+	assert.NoError(t, BPMRange{}.validate())
+	assert.Error(t, BPMRange{Min: 180, Max: 60}.validate())
+	assert.Error(t, BPMRange{Max: 180}.validate())
+}
+
+func TestAlignBeatsToDownbeats(t *testing.T) {
+	// 120 BPM beats from 0.6s, downbeats from another analyzer 60ms later
+	beats := make([]float64, 32)
+	for i := range beats {
+		beats[i] = 0.6 + float64(i)*0.5
+	}
+	downbeats := []float64{1.66, 3.66, 5.66, 7.66, 9.66, 11.66, 13.66, 15.66}
+
+	aligned := AlignBeatsToDownbeats(beats, downbeats)
+
+	// Every downbeat lands on a beat
+	for _, d := range downbeats {
+		assert.InDelta(t, d, aligned[nearestBeatIndex(aligned, d)], 1e-9)
+	}
+
+	// Tempo and span are preserved
+	assert.Len(t, aligned, len(beats))
+	assert.InDelta(t, 0.66, aligned[0], 1e-9)
+	for i := 1; i < len(aligned); i++ {
+		assert.InDelta(t, 0.5, aligned[i]-aligned[i-1], 1e-9)
+	}
+
+	// Without downbeats the grid is unchanged
+	assert.Equal(t, beats, AlignBeatsToDownbeats(beats, nil))
+}
+
+func TestNonFiniteGuards(t *testing.T) {
+	nan := float32(math.NaN())
+	zeros := make([]float32, 500)
+	nans := make([]float32, 500)
+	for i := range nans {
+		nans[i] = nan
+	}
+
+	// All-zero and NaN activations yield no beats and a zero BPM
+	for _, probs := range [][]float32{zeros, nans} {
+		beats := findPeaksBeatThis(probs, 0.5, 20, 0.02)
+		assert.Empty(t, beats)
+		assert.Equal(t, 0.0, calculateBPMFromBeatsBeatThis(beats, DefaultBPMRange))
+	}
+	assert.Empty(t, findPeaksBeatThis([]float32{0, 1, 0}, 0.5, 20, 0))
+
+	// NaN frames between real peaks are ignored
+	probs := make([]float32, 100)
+	probs[25], probs[50], probs[51], probs[75] = 0.9, 0.9, nan, 0.9
+	assert.InDeltaSlice(t, []float64{0.5, 1.0, 1.5}, findPeaksBeatThis(probs, 0.5, 20, 0.02), 1e-9)
+
+	// Medians skip non-finite values
+	assert.Equal(t, 0.5, medianFloat64BeatThis([]float64{0.5, math.NaN(), math.Inf(1)}))
+	assert.Equal(t, 0.0, medianFloat64BeatThis([]float64{math.NaN()}))
+
+	// Grids with non-finite values encode as valid JSON
+	g := &GridAnalysis{
+		BPM:               math.NaN(),
+		Beats:             []float64{0.5, math.NaN(), 1.5},
+		Downbeats:         []int{0},
+		DetectionFunction: []float64{1, math.Inf(1)},
+	}
+	sanitizeGrid(g)
+	_, err := json.Marshal(g)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, g.Error)
+	assert.Empty(t, g.Beats)
+	assert.Equal(t, []float64{1, 0}, g.DetectionFunction)
+
+	g = &GridAnalysis{BPM: math.Inf(1), Beats: []float64{0.5, 1.0}}
+	sanitizeGrid(g)
+	assert.Equal(t, 0.0, g.BPM)
+	assert.Empty(t, g.Error)
+	assert.Len(t, g.Beats, 2)
+}
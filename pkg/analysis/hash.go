@@ -0,0 +1,80 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides content hashes that tie sidecars to the audio analyzed.
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// AnalyzerVersion identifies the analysis a sidecar went through. Bump it when
+// a change to the analyzers or the TrackAnalysis format should invalidate
+// existing sidecars, so AnalyzeDir re-analyzes them.
+const AnalyzerVersion = "1"
+
+// Content hash schemes, written as the prefix of TrackAnalysis.ContentHash.
+const (
+	contentHashSampled = "sampled-sha256:" // File size plus its first and last 64 KiB
+	contentHashFull    = "sha256:"         // Whole file
+)
+
+// contentHashSampleSize is how much of each end of a file a sampled hash reads.
+const contentHashSampleSize = 64 << 10
+
+// ContentHash returns a hash identifying the contents of the file at path. By
+// default it hashes the size and the first and last 64 KiB, which changes
+// when a file is re-encoded or retagged without reading all of it; full
+// hashes the whole file with SHA-256. The scheme is part of the hash.
+func ContentHash(path string, full bool) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if full {
+		if _, err := io.Copy(h, f); err != nil {
+			return "", fmt.Errorf("hash %s: %w", path, err)
+		}
+		return contentHashFull + hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := info.Size()
+	h.Write(binary.LittleEndian.AppendUint64(nil, uint64(size)))
+	if _, err := io.CopyN(h, f, min(size, contentHashSampleSize)); err != nil {
+		return "", fmt.Errorf("hash %s: %w", path, err)
+	}
+	if tail := min(size-contentHashSampleSize, contentHashSampleSize); tail > 0 {
+		if _, err := io.Copy(h, io.NewSectionReader(f, size-tail, tail)); err != nil {
+			return "", fmt.Errorf("hash %s: %w", path, err)
+		}
+	}
+	return contentHashSampled + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sidecarUpToDate reads the sidecar at jsonPath and reports whether it can be
+// kept for the audio at audioPath: it was written by this AnalyzerVersion and
+// its content hash still matches. The audio is hashed with the sidecar's own
+// scheme, or the full scheme with rehash, so sampled hashes are replaced. The
+// sidecar is returned if it could be read, even if it is stale.
+func sidecarUpToDate(audioPath, jsonPath string, rehash bool) (*TrackAnalysis, bool) {
+	existing, err := ReadTrackAnalysis(jsonPath)
+	if err != nil {
+		return nil, false
+	}
+	if existing.AnalyzerVersion != AnalyzerVersion || existing.ContentHash == "" {
+		return existing, false
+	}
+	hash, err := ContentHash(audioPath, rehash || strings.HasPrefix(existing.ContentHash, contentHashFull))
+	return existing, err == nil && hash == existing.ContentHash
+}
@@ -0,0 +1,42 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	data := make([]byte, 3*contentHashSampleSize)
+	write := func() {
+		require.NoError(t, os.WriteFile(path, data, 0644))
+	}
+	hash := func(full bool) string {
+		h, err := ContentHash(path, full)
+		require.NoError(t, err)
+		return h
+	}
+
+	write()
+	sampled, full := hash(false), hash(true)
+	assert.True(t, strings.HasPrefix(sampled, contentHashSampled))
+	assert.True(t, strings.HasPrefix(full, contentHashFull))
+
+	// A sampled hash only sees the ends of the file
+	data[len(data)/2] = 1
+	write()
+	assert.Equal(t, sampled, hash(false))
+	assert.NotEqual(t, full, hash(true))
+
+	data[len(data)-1] = 1
+	write()
+	assert.NotEqual(t, sampled, hash(false))
+
+	_, err := ContentHash(filepath.Join(t.TempDir(), "missing.mp3"), false)
+	assert.Error(t, err)
+}
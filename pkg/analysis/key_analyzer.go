@@ -0,0 +1,105 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides musical key detection with qm-dsp's GetKeyMode.
+package analysis
+
+import (
+	"fmt"
+)
+
+// KeyResult is the detected musical key of a track.
+type KeyResult struct {
+	Key        string      `json:"key"`        // Camelot notation, e.g. "8A"
+	Name       string      `json:"name"`       // Musical notation, e.g. "A minor"
+	Confidence float64     `json:"confidence"` // Fraction of windows in Key
+	Windows    []KeyWindow `json:"windows,omitempty"`
+}
+
+// KeyWindow is the key detected in one analysis window.
+type KeyWindow struct {
+	Time       Seconds `json:"time"`       // Window start
+	Key        string  `json:"key"`        // Camelot notation, "" if no key was detected
+	Confidence float64 `json:"confidence"` // Key profile correlation, 0-1
+}
+
+// KeyAnalyzer detects musical key with the qm-dsp key detector Mixxx uses.
+type KeyAnalyzer struct{}
+
+// NewKeyAnalyzer creates a key analyzer. It needs no resources beyond the
+// qm-dsp library the grid analyzers already link.
+func NewKeyAnalyzer() *KeyAnalyzer {
+	return &KeyAnalyzer{}
+}
+
+// AnalyzeFile decodes an audio file and detects its key.
+func (k *KeyAnalyzer) AnalyzeFile(path string) (*KeyResult, error) {
+	samples, sampleRate, err := LoadAudioMono(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load audio: %w", err)
+	}
+	return k.AnalyzeSamples(samples, sampleRate)
+}
+
+// AnalyzeSamples detects the key of decoded mono samples. The track's key is
+// the one detected in the most windows, ties going to the lower key index.
+func (k *KeyAnalyzer) AnalyzeSamples(samples []float32, sampleRate int) (*KeyResult, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	keys, strengths, step, err := qmKeyWindows(samples, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return keyResult(keys, strengths, step)
+}
+
+// keyResult votes the track key from per-window GetKeyMode keys.
+func keyResult(keys []int, strengths []float64, step float64) (*KeyResult, error) {
+	result := &KeyResult{Windows: make([]KeyWindow, len(keys))}
+	var counts [25]int
+	detected := 0
+	for i, key := range keys {
+		w := KeyWindow{Time: Seconds(float64(i) * step), Confidence: strengths[i]}
+		if camelot, _, ok := keyNotation(key); ok {
+			w.Key = camelot
+			counts[key]++
+			detected++
+		}
+		result.Windows[i] = w
+	}
+	if detected == 0 {
+		return nil, fmt.Errorf("no key detected in %d windows", len(keys))
+	}
+
+	best := 1
+	for key := 2; key <= 24; key++ {
+		if counts[key] > counts[best] {
+			best = key
+		}
+	}
+	result.Key, result.Name, _ = keyNotation(best)
+	result.Confidence = float64(counts[best]) / float64(detected)
+	return result, nil
+}
+
+// Pitch class names (C = 0) for major and minor keys, spelled as DJ software
+// usually shows them.
+var (
+	majorKeyNames = [12]string{"C", "Db", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+	minorKeyNames = [12]string{"C", "C#", "D", "Eb", "E", "F", "F#", "G", "G#", "A", "Bb", "B"}
+)
+
+// keyNotation converts a GetKeyMode key (1-12 C..B major, 13-24 C..B minor)
+// to Camelot ("8B" for C major, "8A" for A minor) and musical notation.
+// Reports false for 0 (no key) and out-of-range values.
+func keyNotation(key int) (camelot, name string, ok bool) {
+	if key < 1 || key > 24 {
+		return "", "", false
+	}
+	pc := (key - 1) % 12
+	if key <= 12 {
+		// Camelot numbers step by fifths, with C major at 8B
+		return fmt.Sprintf("%dB", (7*pc+7)%12+1), majorKeyNames[pc] + " major", true
+	}
+	// A minor key shares its number with its relative major, 3 semitones up
+	return fmt.Sprintf("%dA", (7*(pc+3)+7)%12+1), minorKeyNames[pc] + " minor", true
+}
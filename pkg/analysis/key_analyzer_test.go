@@ -0,0 +1,82 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyNotation(t *testing.T) {
+	tests := []struct {
+		key     int
+		camelot string
+		name    string
+	}{
+		{1, "8B", "C major"},
+		{8, "9B", "G major"},
+		{7, "2B", "F# major"},
+		{12, "1B", "B major"},
+		{22, "8A", "A minor"},
+		{17, "9A", "E minor"},
+		{16, "2A", "Eb minor"},
+		{21, "1A", "G# minor"},
+		{13, "5A", "C minor"},
+	}
+	for _, tt := range tests {
+		camelot, name, ok := keyNotation(tt.key)
+		assert.True(t, ok, tt.name)
+		assert.Equal(t, tt.camelot, camelot, tt.name)
+		assert.Equal(t, tt.name, name)
+	}
+
+	for _, key := range []int{0, -1, 25} {
+		_, _, ok := keyNotation(key)
+		assert.False(t, ok, key)
+	}
+}
+
+func TestKeyResult(t *testing.T) {
+	r, err := keyResult([]int{0, 22, 22, 1, 22}, []float64{0, 0.8, 0.7, 0.6, 0.9}, 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, "8A", r.Key)
+	assert.Equal(t, "A minor", r.Name)
+	assert.InDelta(t, 0.75, r.Confidence, 1e-9)
+	require.Len(t, r.Windows, 5)
+	assert.Equal(t, KeyWindow{Time: 0, Key: "", Confidence: 0}, r.Windows[0])
+	assert.Equal(t, KeyWindow{Time: 1.5, Key: "8B", Confidence: 0.6}, r.Windows[3])
+
+	_, err = keyResult([]int{0, 0}, []float64{0, 0}, 0.5)
+	assert.Error(t, err)
+}
+
+func TestKeyAnalyzer(t *testing.T) {
+	// An A minor progression (Am, Dm, Em, Am) of harmonic tones, 5s per chord
+	const sampleRate, chordSecs = 44100, 5.0
+	chords := [][]float64{
+		{220.00, 261.63, 329.63},
+		{293.66, 349.23, 440.00},
+		{329.63, 392.00, 493.88},
+		{220.00, 261.63, 329.63},
+	}
+	n := int(chordSecs * sampleRate)
+	samples := make([]float32, 0, n*len(chords))
+	for _, chord := range chords {
+		for i := range n {
+			var v float64
+			for _, f := range chord {
+				for h := 1; h <= 3; h++ {
+					v += math.Sin(2*math.Pi*f*float64(h)*float64(i)/sampleRate) / float64(h)
+				}
+			}
+			samples = append(samples, float32(0.1*v))
+		}
+	}
+
+	r, err := NewKeyAnalyzer().AnalyzeSamples(samples, sampleRate)
+	require.NoError(t, err)
+	assert.Equal(t, "8A", r.Key)
+	assert.Equal(t, "A minor", r.Name)
+	assert.NotEmpty(t, r.Windows)
+}
@@ -0,0 +1,67 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides Audacity and Sonic Visualiser label track export.
+package analysis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ExportLabelTrack writes the beats of grid as a tab-separated label track
+// of start, end, and label lines, which Audacity and Sonic Visualiser import
+// as labels over the waveform. Beats are instant labels named "beat", and
+// downbeats are named "1". Nothing is written if grid fails ValidateGrid for
+// a track of duration seconds, unless force is set.
+func ExportLabelTrack(grid *GridAnalysis, duration float64, w io.Writer, force bool) error {
+	if grid == nil {
+		return errors.New("no grid")
+	}
+	if grid.Error != "" {
+		return fmt.Errorf("analyzer error: %s", grid.Error)
+	}
+	if err := validateExportGrid(grid, duration, force); err != nil {
+		return err
+	}
+
+	downbeats := make(map[int]bool, len(grid.Downbeats))
+	for _, i := range grid.Downbeats {
+		downbeats[i] = true
+	}
+	bw := bufio.NewWriter(w)
+	for i, t := range grid.Beats {
+		label := "beat"
+		if downbeats[i] {
+			label = "1"
+		}
+		writeLabel(bw, t, t, label)
+	}
+	return bw.Flush()
+}
+
+// ExportPhraseLabels writes the phrases of the first marker source that has
+// any (see ExportSeratoMarkers) as a label track of regions, each labeled
+// with its Phrase.Label.
+func ExportPhraseLabels(analysis *TrackAnalysis, w io.Writer) error {
+	phrases := exportPhrases(analysis)
+	if len(phrases) == 0 {
+		return errors.New("no phrases")
+	}
+	bw := bufio.NewWriter(w)
+	for _, p := range phrases {
+		writeLabel(bw, float64(p.Time), float64(p.Time+p.Duration), p.Label)
+	}
+	return bw.Flush()
+}
+
+// writeLabel writes one label track line.
+func writeLabel(w *bufio.Writer, start, end float64, label string) {
+	w.WriteString(strconv.FormatFloat(start, 'f', 6, 64))
+	w.WriteByte('\t')
+	w.WriteString(strconv.FormatFloat(end, 'f', 6, 64))
+	w.WriteByte('\t')
+	w.WriteString(label)
+	w.WriteByte('\n')
+}
@@ -0,0 +1,52 @@
+package analysis
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportLabelTrack(t *testing.T) {
+	grid := &GridAnalysis{
+		BPM:       120,
+		Beats:     []float64{0.5, 1, 1.5, 2, 2.5},
+		Downbeats: []int{0, 4},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, ExportLabelTrack(grid, 3, &buf, false))
+	assert.Equal(t, "0.500000\t0.500000\t1\n"+
+		"1.000000\t1.000000\tbeat\n"+
+		"1.500000\t1.500000\tbeat\n"+
+		"2.000000\t2.000000\tbeat\n"+
+		"2.500000\t2.500000\t1\n", buf.String())
+
+	assert.Error(t, ExportLabelTrack(nil, 3, &buf, false))
+	assert.Error(t, ExportLabelTrack(&GridAnalysis{Error: "model not found"}, 3, &buf, true))
+
+	// A nonsense BPM is refused unless forced
+	grid.BPM = 900
+	buf.Reset()
+	assert.ErrorContains(t, ExportLabelTrack(grid, 3, &buf, false), "implausible BPM")
+	assert.Empty(t, buf.String())
+	require.NoError(t, ExportLabelTrack(grid, 3, &buf, true))
+}
+
+func TestExportPhraseLabels(t *testing.T) {
+	ta := &TrackAnalysis{
+		Markers: map[string]*MarkerAnalysis{
+			"songformer": {Phrases: []Phrase{
+				{Time: 16, Label: "chorus", Duration: 16},
+				{Time: 0.5, Label: "intro", Duration: 15.5},
+				{Time: 32, Label: "empty"},
+			}},
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, ExportPhraseLabels(ta, &buf))
+	assert.Equal(t, "0.500000\t16.000000\tintro\n"+
+		"16.000000\t32.000000\tchorus\n", buf.String())
+
+	assert.Error(t, ExportPhraseLabels(&TrackAnalysis{}, &buf))
+}
@@ -10,14 +10,17 @@
 #include <vector>
 #include <memory>
 #include <algorithm>
+#include <iterator>
 
 #include <sndfile.h>
 
 // qm-dsp includes
 #include "dsp/onsets/DetectionFunction.h"
+#include "dsp/onsets/PeakPicking.h"
 #include "dsp/tempotracking/TempoTrackV2.h"
 #include "dsp/tempotracking/DownBeat.h"
 #include "dsp/segmentation/ClusterMeltSegmenter.h"
+#include "dsp/keydetection/GetKeyMode.h"
 #include "maths/MathUtilities.h"
 
 namespace {
@@ -41,6 +44,17 @@ constexpr int kDefaultSegNumHMMStates = 40;
 // Decimation factor for downbeat analysis (matches qm-dsp recommendation)
 constexpr size_t kDownbeatDecimationFactor = 16;
 
+// Onset peak picking parameters matching the qm-vamp-plugins onset detector
+constexpr double kOnsetLPACoeffs[] = {1.0000, -0.5949, 0.2348};
+constexpr double kOnsetLPBCoeffs[] = {0.1600, 0.3200, 0.1600};
+constexpr unsigned int kOnsetWindowPre = 7;
+constexpr unsigned int kOnsetWindowPost = 8;
+constexpr double kDefaultOnsetSensitivity = 50.0;
+
+// Key detection parameters matching Mixxx
+constexpr float kKeyTuningFrequencyHz = 440.0f;
+constexpr int kNumKeys = 24;
+
 // Helper to downmix stereo to mono
 void downmixToMono(const float* stereo, double* mono, size_t frames) {
     for (size_t i = 0; i < frames; ++i) {
@@ -144,6 +158,47 @@ struct QMAnalyzer {
     }
 };
 
+// Feed mono audio through the overlap buffer into the detection function,
+// keeping a copy for downbeat/segmentation analysis
+static void processMono(QMAnalyzer* analyzer, const double* monoBuffer, size_t num_frames) {
+    // Store mono audio for downbeat/segmentation analysis
+    for (size_t i = 0; i < num_frames; ++i) {
+        analyzer->audioBuffer.push_back(static_cast<float>(monoBuffer[i]));
+    }
+
+    // Process through overlap buffer
+    std::vector<double> windowBuffer(analyzer->windowSize);
+
+    for (size_t i = 0; i < num_frames; ++i) {
+        analyzer->overlapBuffer[analyzer->overlapPos] = monoBuffer[i];
+        analyzer->overlapPos++;
+        analyzer->totalFramesProcessed++;
+
+        // When we have a full window, process it
+        if (analyzer->overlapPos >= static_cast<size_t>(analyzer->windowSize)) {
+            // Copy window data
+            std::copy(analyzer->overlapBuffer.begin(),
+                      analyzer->overlapBuffer.end(),
+                      windowBuffer.begin());
+
+            // Process and get detection value
+            double df = analyzer->detectionFunction->processTimeDomain(windowBuffer.data());
+            analyzer->detectionResults.push_back(df);
+
+            // Shift overlap buffer by step size
+            size_t shift = analyzer->stepSizeFrames;
+            if (shift < static_cast<size_t>(analyzer->windowSize)) {
+                std::copy(analyzer->overlapBuffer.begin() + shift,
+                          analyzer->overlapBuffer.end(),
+                          analyzer->overlapBuffer.begin());
+                analyzer->overlapPos = analyzer->windowSize - shift;
+            } else {
+                analyzer->overlapPos = 0;
+            }
+        }
+    }
+}
+
 extern "C" {
 
 AnalyzerConfig analyzer_default_config(void) {
@@ -209,6 +264,14 @@ AnalyzerResult* analyzer_analyze_file_config(const char* filepath, const Analyze
 AnalyzerResultEx* analyzer_analyze_file_ex(const char* filepath,
                                            const AnalyzerConfig* config,
                                            const AnalyzerSegmenterConfig* seg_config) {
+    return analyzer_analyze_file_ex_progress(filepath, config, seg_config, nullptr, nullptr);
+}
+
+AnalyzerResultEx* analyzer_analyze_file_ex_progress(const char* filepath,
+                                                    const AnalyzerConfig* config,
+                                                    const AnalyzerSegmenterConfig* seg_config,
+                                                    AnalyzerProgressFunc progress,
+                                                    void* user_data) {
     auto* result = static_cast<AnalyzerResultEx*>(calloc(1, sizeof(AnalyzerResultEx)));
     if (!result) {
         return nullptr;
@@ -242,6 +305,7 @@ AnalyzerResultEx* analyzer_analyze_file_ex(const char* filepath,
     // Read and process audio in chunks
     const size_t chunkSize = 4096;
     std::vector<float> readBuffer(chunkSize * sfinfo.channels);
+    int64_t processedFrames = 0;
 
     while (true) {
         sf_count_t framesRead = sf_readf_float(sndfile, readBuffer.data(), chunkSize);
@@ -256,6 +320,11 @@ AnalyzerResultEx* analyzer_analyze_file_ex(const char* filepath,
             result->error = strdup_safe("Error processing audio");
             return result;
         }
+
+        processedFrames += framesRead;
+        if (progress) {
+            progress(processedFrames, sfinfo.frames, user_data);
+        }
     }
 
     sf_close(sndfile);
@@ -327,46 +396,28 @@ int analyzer_process(QMAnalyzer* analyzer, const float* samples, size_t num_fram
         downmixToMono(samples, monoBuffer.data(), num_frames);
     }
 
-    // Store mono audio for downbeat/segmentation analysis
-    for (size_t i = 0; i < num_frames; ++i) {
-        analyzer->audioBuffer.push_back(static_cast<float>(monoBuffer[i]));
-    }
-
-    // Process through overlap buffer
-    std::vector<double> windowBuffer(analyzer->windowSize);
-
-    for (size_t i = 0; i < num_frames; ++i) {
-        analyzer->overlapBuffer[analyzer->overlapPos] = monoBuffer[i];
-        analyzer->overlapPos++;
-        analyzer->totalFramesProcessed++;
-
-        // When we have a full window, process it
-        if (analyzer->overlapPos >= static_cast<size_t>(analyzer->windowSize)) {
-            // Copy window data
-            std::copy(analyzer->overlapBuffer.begin(),
-                      analyzer->overlapBuffer.end(),
-                      windowBuffer.begin());
-
-            // Process and get detection value
-            double df = analyzer->detectionFunction->processTimeDomain(windowBuffer.data());
-            analyzer->detectionResults.push_back(df);
+    processMono(analyzer, monoBuffer.data(), num_frames);
+    return 0;
+}
 
-            // Shift overlap buffer by step size
-            size_t shift = analyzer->stepSizeFrames;
-            if (shift < static_cast<size_t>(analyzer->windowSize)) {
-                std::copy(analyzer->overlapBuffer.begin() + shift,
-                          analyzer->overlapBuffer.end(),
-                          analyzer->overlapBuffer.begin());
-                analyzer->overlapPos = analyzer->windowSize - shift;
-            } else {
-                analyzer->overlapPos = 0;
-            }
-        }
+int analyzer_process_mono(QMAnalyzer* analyzer, const float* samples, size_t num_frames) {
+    if (!analyzer || !samples || num_frames == 0) {
+        return -1;
     }
 
+    std::vector<double> monoBuffer(num_frames);
+    convertToDouble(samples, monoBuffer.data(), num_frames);
+
+    processMono(analyzer, monoBuffer.data(), num_frames);
     return 0;
 }
 
+size_t analyzer_get_audio(QMAnalyzer* analyzer, const float** samples) {
+    if (!analyzer || !samples) return 0;
+    *samples = analyzer->audioBuffer.data();
+    return analyzer->audioBuffer.size();
+}
+
 AnalyzerResultEx* analyzer_finalize(QMAnalyzer* analyzer, const AnalyzerSegmenterConfig* seg_config) {
     if (!analyzer) {
         return nullptr;
@@ -626,6 +677,132 @@ size_t analyzer_get_df_count(QMAnalyzer* analyzer) {
     return analyzer->detectionResults.size();
 }
 
+// === Onset Detection ===
+
+AnalyzerOnsetResult* analyzer_detect_onsets(QMAnalyzer* analyzer, double sensitivity) {
+    if (!analyzer) {
+        return nullptr;
+    }
+
+    auto* result = static_cast<AnalyzerOnsetResult*>(calloc(1, sizeof(AnalyzerOnsetResult)));
+    if (!result) {
+        return nullptr;
+    }
+
+    // Skip the first 2 results and trailing silence as analyzer_finalize does
+    size_t nonZeroCount = analyzer->detectionResults.size();
+    while (nonZeroCount > 0 && analyzer->detectionResults[nonZeroCount - 1] <= 0.0) {
+        --nonZeroCount;
+    }
+    if (nonZeroCount <= 2) {
+        result->error = strdup_safe("Not enough audio data for onset detection");
+        return result;
+    }
+    std::vector<double> df(analyzer->detectionResults.begin() + 2,
+                           analyzer->detectionResults.begin() + nonZeroCount);
+
+    sensitivity = sensitivity > 0 ? std::min(sensitivity, 100.0) : kDefaultOnsetSensitivity;
+
+    PPickParams params;
+    params.length = static_cast<unsigned int>(df.size());
+    params.tau = static_cast<double>(analyzer->stepSizeFrames) / analyzer->sampleRate;
+    params.alpha = 9;
+    params.cutoff = analyzer->sampleRate / 4.0;
+    params.LPOrd = 2;
+    params.LPACoeffs.assign(std::begin(kOnsetLPACoeffs), std::end(kOnsetLPACoeffs));
+    params.LPBCoeffs.assign(std::begin(kOnsetLPBCoeffs), std::end(kOnsetLPBCoeffs));
+    params.WinT.pre = kOnsetWindowPre;
+    params.WinT.post = kOnsetWindowPost;
+    params.QuadThresh.a = (100 - sensitivity) / 1000.0;
+    params.QuadThresh.b = 0;
+    params.QuadThresh.c = (100 - sensitivity) / 1500.0;
+
+    PeakPicking peakPicker(params);
+    std::vector<int> onsets;
+    peakPicker.process(df.data(), static_cast<int>(df.size()), onsets);
+
+    result->num_onsets = onsets.size();
+    if (onsets.empty()) {
+        return result;
+    }
+    result->onsets = static_cast<double*>(malloc(sizeof(double) * onsets.size()));
+    if (!result->onsets) {
+        result->error = strdup_safe("Memory allocation failed");
+        result->num_onsets = 0;
+        return result;
+    }
+
+    // Convert DF frames to seconds as for beats
+    for (size_t i = 0; i < onsets.size(); ++i) {
+        double framePos = (onsets[i] + 2) * analyzer->stepSizeFrames +
+                          analyzer->stepSizeFrames / 2.0;
+        result->onsets[i] = framePos / analyzer->sampleRate;
+    }
+    return result;
+}
+
+void analyzer_free_onset_result(AnalyzerOnsetResult* result) {
+    if (!result) return;
+    free(result->onsets);
+    free(result->error);
+    free(result);
+}
+
+// === Key Detection ===
+
+AnalyzerKeyResult* analyzer_analyze_key(const float* samples, size_t num_frames, int sample_rate) {
+    auto* result = static_cast<AnalyzerKeyResult*>(calloc(1, sizeof(AnalyzerKeyResult)));
+    if (!result) {
+        return nullptr;
+    }
+    result->sample_rate = sample_rate;
+    if (!samples || sample_rate <= 0) {
+        result->error = strdup_safe("Invalid key detection input");
+        return result;
+    }
+
+    GetKeyMode::Config config(sample_rate, kKeyTuningFrequencyHz);
+    GetKeyMode keyMode(config);
+    const size_t blockSize = keyMode.getBlockSize();
+    const size_t hopSize = keyMode.getHopSize();
+    result->window_step = static_cast<double>(hopSize) / sample_rate;
+    if (num_frames < blockSize) {
+        result->error = strdup_safe("Audio too short for key detection");
+        return result;
+    }
+
+    std::vector<int> keys;
+    std::vector<double> strengths;
+    std::vector<double> window(blockSize);
+    for (size_t start = 0; start + blockSize <= num_frames; start += hopSize) {
+        convertFloatToDouble(samples + start, window.data(), blockSize);
+        keys.push_back(keyMode.process(window.data()));
+        const double* keyStrengths = keyMode.getKeyStrengths();
+        double best = *std::max_element(keyStrengths, keyStrengths + kNumKeys);
+        strengths.push_back(std::min(std::max(best, 0.0), 1.0));
+    }
+
+    result->num_windows = keys.size();
+    result->keys = static_cast<int*>(malloc(keys.size() * sizeof(int)));
+    result->strengths = static_cast<double*>(malloc(strengths.size() * sizeof(double)));
+    if (!result->keys || !result->strengths) {
+        result->num_windows = 0;
+        result->error = strdup_safe("Failed to allocate key results");
+        return result;
+    }
+    std::copy(keys.begin(), keys.end(), result->keys);
+    std::copy(strengths.begin(), strengths.end(), result->strengths);
+    return result;
+}
+
+void analyzer_free_key_result(AnalyzerKeyResult* result) {
+    if (!result) return;
+    free(result->keys);
+    free(result->strengths);
+    free(result->error);
+    free(result);
+}
+
 const char* analyzer_version(void) {
     return "3.0.0-mixxx-qmdsp-full";
 }
@@ -1,5 +1,5 @@
 // analyzer.h - C API for Mixxx beat detection
-// Wraps qm-dsp library for BPM, beat grid, downbeat, and segmentation analysis
+// Wraps qm-dsp library for BPM, beat grid, downbeat, segmentation, and key analysis
 
 #ifndef MIXXX_ANALYZER_H
 #define MIXXX_ANALYZER_H
@@ -121,6 +121,27 @@ typedef struct {
     size_t num_cue_points;
 } AnalyzerResultEx;
 
+// Key detection result
+typedef struct {
+    int* keys;              // Key per window: 1-12 C..B major, 13-24 C..B minor, 0 if none
+    double* strengths;      // Best key profile correlation per window (0-1)
+    size_t num_windows;
+    double window_step;     // Seconds between window starts
+    int sample_rate;
+    char* error;            // Error message if analysis failed (NULL if success)
+} AnalyzerKeyResult;
+
+// Onset detection result
+typedef struct {
+    double* onsets;         // Onset times in seconds
+    size_t num_onsets;
+    char* error;            // Error message if detection failed (NULL if success)
+} AnalyzerOnsetResult;
+
+// Progress callback for file analysis, called after each chunk is processed
+// with the frames processed so far and the file's total frames
+typedef void (*AnalyzerProgressFunc)(int64_t processed_frames, int64_t total_frames, void* user_data);
+
 // Opaque handle for streaming analyzer
 typedef struct QMAnalyzer QMAnalyzer;
 
@@ -141,6 +162,15 @@ AnalyzerResultEx* analyzer_analyze_file_ex(const char* filepath,
                                            const AnalyzerConfig* config,
                                            const AnalyzerSegmenterConfig* seg_config);
 
+// Analyze with extended results, reporting progress to an optional callback
+// progress: called from the analysis thread (NULL for none)
+// user_data: passed through to progress
+AnalyzerResultEx* analyzer_analyze_file_ex_progress(const char* filepath,
+                                                    const AnalyzerConfig* config,
+                                                    const AnalyzerSegmenterConfig* seg_config,
+                                                    AnalyzerProgressFunc progress,
+                                                    void* user_data);
+
 // Free the analysis result
 void analyzer_free_result(AnalyzerResult* result);
 void analyzer_free_result_ex(AnalyzerResultEx* result);
@@ -159,6 +189,16 @@ QMAnalyzer* analyzer_create(int sample_rate, int channels, const AnalyzerConfig*
 // Returns 0 on success, non-zero on error
 int analyzer_process(QMAnalyzer* analyzer, const float* samples, size_t num_frames);
 
+// Process a chunk of mono samples regardless of the analyzer's channel count
+// Used to re-feed the buffered audio of a snapshot when restoring
+// Returns 0 on success, non-zero on error
+int analyzer_process_mono(QMAnalyzer* analyzer, const float* samples, size_t num_frames);
+
+// Get the mono audio processed so far
+// Sets *samples to the analyzer's buffer, valid until the next process call
+// Returns the number of frames
+size_t analyzer_get_audio(QMAnalyzer* analyzer, const float** samples);
+
 // Finalize analysis and get results
 // seg_config: optional segmenter config (NULL to skip segmentation)
 // Returns extended results, caller must free with analyzer_free_result_ex
@@ -170,6 +210,27 @@ void analyzer_destroy(QMAnalyzer* analyzer);
 // Get the current number of detection function values computed
 size_t analyzer_get_df_count(QMAnalyzer* analyzer);
 
+// === Onset Detection ===
+
+// Pick onsets from the detection function of the audio processed so far with
+// qm-dsp's PeakPicking, without running the tempo tracker
+// sensitivity: 1-100, higher picks more onsets (0 = default 50, as in qm-vamp-plugins)
+// Returns NULL on failure, caller must free result with analyzer_free_onset_result
+AnalyzerOnsetResult* analyzer_detect_onsets(QMAnalyzer* analyzer, double sensitivity);
+
+// Free the onset detection result
+void analyzer_free_onset_result(AnalyzerOnsetResult* result);
+
+// === Key Detection ===
+
+// Detect the musical key of mono samples with qm-dsp's GetKeyMode, one key
+// per non-overlapping window as Mixxx does
+// Returns NULL on failure, caller must free result with analyzer_free_key_result
+AnalyzerKeyResult* analyzer_analyze_key(const float* samples, size_t num_frames, int sample_rate);
+
+// Free the key detection result
+void analyzer_free_key_result(AnalyzerKeyResult* result);
+
 // Get the version of the analyzer library
 const char* analyzer_version(void);
 
@@ -0,0 +1,196 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides EBU R128 loudness and ReplayGain 2.0 measurement.
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// EBU R128 / ITU-R BS.1770-4 measurement parameters.
+const (
+	loudnessStepSecs     = 0.1   // Gating block step
+	loudnessBlockSteps   = 4     // Steps per 400 ms gating block (75% overlap)
+	loudnessAbsoluteGate = -70.0 // LUFS
+	loudnessRelativeGate = -10.0 // LU below the absolute-gated loudness
+	loudnessOffset       = -0.691
+
+	// replayGainReference is the ReplayGain 2.0 target loudness in LUFS.
+	replayGainReference = -18.0
+
+	// truePeakOversample is the oversampling factor for true-peak detection
+	// below 96 kHz, and truePeakTaps the interpolation filter taps per phase.
+	truePeakOversample = 4
+	truePeakTaps       = 12
+)
+
+// LoudnessResult is the measured loudness of a track.
+type LoudnessResult struct {
+	Integrated float64 `json:"integrated_lufs"` // EBU R128 integrated loudness
+	TruePeak   float64 `json:"true_peak_dbtp"`  // Maximum inter-sample peak
+	ReplayGain float64 `json:"replay_gain_db"`  // ReplayGain 2.0 track gain to -18 LUFS
+}
+
+// MeasureLoudness measures the EBU R128 integrated loudness, true peak, and
+// ReplayGain 2.0 track gain of mono samples. The samples are treated as the
+// mixdown of a stereo track played on both channels (BS.1770 dual mono), so a
+// centered stereo mix measures the same as it would before mixdown. Returns
+// an error if no 400 ms block is above the -70 LUFS absolute gate.
+func MeasureLoudness(samples []float32, sampleRate int) (*LoudnessResult, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	step := max(1, int(math.Round(loudnessStepSecs*float64(sampleRate))))
+	if len(samples) < loudnessBlockSteps*step {
+		return nil, fmt.Errorf("audio shorter than one %.1fs gating block", loudnessBlockSteps*loudnessStepSecs)
+	}
+
+	// Squared K-weighted samples, summed per step so blocks overlap by whole steps
+	weighted := kWeight(samples, sampleRate)
+	steps := make([]float64, len(samples)/step)
+	for i := range steps {
+		for _, v := range weighted[i*step : (i+1)*step] {
+			steps[i] += v * v
+		}
+	}
+	var powers []float64 // Mean square of each gating block
+	for i := 0; i+loudnessBlockSteps <= len(steps); i++ {
+		var sum float64
+		for _, s := range steps[i : i+loudnessBlockSteps] {
+			sum += s
+		}
+		powers = append(powers, sum/float64(loudnessBlockSteps*step))
+	}
+
+	// Dual mono: both channels carry the signal, so channel power doubles
+	loudness := func(power float64) float64 { return loudnessOffset + 10*math.Log10(2*power) }
+	gatedMean := func(threshold float64) (float64, int) {
+		var sum float64
+		var n int
+		for _, p := range powers {
+			if p > 0 && loudness(p) > threshold {
+				sum += p
+				n++
+			}
+		}
+		if n == 0 {
+			return 0, 0
+		}
+		return sum / float64(n), n
+	}
+
+	mean, n := gatedMean(loudnessAbsoluteGate)
+	if n == 0 {
+		return nil, errors.New("audio too quiet to measure loudness")
+	}
+	mean, _ = gatedMean(loudness(mean) + loudnessRelativeGate)
+	integrated := loudness(mean)
+
+	return &LoudnessResult{
+		Integrated: integrated,
+		TruePeak:   20 * math.Log10(max(truePeak(samples, sampleRate), 1e-10)),
+		ReplayGain: replayGainReference - integrated,
+	}, nil
+}
+
+// biquad is a second order IIR filter in direct form I.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+func (f biquad) apply(x []float64) {
+	bf := biquadFilter{biquad: f}
+	for i, v := range x {
+		x[i] = bf.next(v)
+	}
+}
+
+// biquadFilter is a biquad with its delay line, filtering a sample at a time.
+type biquadFilter struct {
+	biquad
+	x1, x2, y1, y2 float64
+}
+
+func (f *biquadFilter) next(v float64) float64 {
+	y := f.b0*v + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, v
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeight applies the BS.1770 K-weighting filter: a high shelf modeling the
+// head, then the RLB high pass. Coefficients are derived for sampleRate from
+// the analog prototypes, which reproduces the spec's 48 kHz values.
+func kWeight(samples []float32, sampleRate int) []float64 {
+	x := make([]float64, len(samples))
+	for i, s := range samples {
+		x[i] = float64(s)
+	}
+
+	// Stage 1: high shelf, +4 dB above ~1.7 kHz
+	const f0, gainDB, q = 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / float64(sampleRate))
+	vh := math.Pow(10, gainDB/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}.apply(x)
+
+	// Stage 2: RLB high pass at ~38 Hz
+	const hpF0, hpQ = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * hpF0 / float64(sampleRate))
+	a0 = 1 + k/hpQ + k*k
+	biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/hpQ + k*k) / a0,
+	}.apply(x)
+	return x
+}
+
+// truePeak returns the maximum absolute sample value after oversampling by
+// truePeakOversample with a Hann-windowed sinc interpolator (BS.1770 Annex 2).
+// At 96 kHz and above the sample peak is used.
+func truePeak(samples []float32, sampleRate int) float64 {
+	peak := 0.0
+	for _, s := range samples {
+		peak = max(peak, math.Abs(float64(s)))
+	}
+	if sampleRate >= 96000 {
+		return peak
+	}
+
+	// Polyphase coefficients: phase p interpolates at offset p/oversample
+	const half = truePeakTaps / 2
+	var coeffs [truePeakOversample][truePeakTaps]float64
+	for p := 1; p < truePeakOversample; p++ {
+		for j := range truePeakTaps {
+			t := float64(j-half+1) - float64(p)/truePeakOversample // Distance in samples
+			window := 0.5 * (1 + math.Cos(math.Pi*t/(half+1)))
+			sinc := 1.0
+			if t != 0 {
+				sinc = math.Sin(math.Pi*t) / (math.Pi * t)
+			}
+			coeffs[p][j] = sinc * window
+		}
+	}
+
+	for i := half - 1; i+half < len(samples); i++ {
+		for p := 1; p < truePeakOversample; p++ {
+			var v float64
+			for j, c := range coeffs[p] {
+				v += c * float64(samples[i-half+1+j])
+			}
+			peak = max(peak, math.Abs(v))
+		}
+	}
+	return peak
+}
@@ -0,0 +1,52 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasureLoudness(t *testing.T) {
+	// sine returns secs of a tone with peak amplitude dbfs, the EBU Tech 3341
+	// calibration signal when played on both channels
+	sine := func(freq, dbfs, secs float64, sampleRate int) []float32 {
+		amp := math.Pow(10, dbfs/20)
+		samples := make([]float32, int(secs*float64(sampleRate)))
+		for i := range samples {
+			samples[i] = float32(amp * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate)))
+		}
+		return samples
+	}
+
+	// 1 kHz at -23 dBFS measures -23 LUFS at any sample rate
+	for _, rate := range []int{48000, 44100} {
+		r, err := MeasureLoudness(sine(1000, -23, 20, rate), rate)
+		require.NoError(t, err)
+		assert.InDelta(t, -23, r.Integrated, 0.5, "%d Hz integrated", rate)
+		assert.InDelta(t, -23, r.TruePeak, 0.5, "%d Hz true peak", rate)
+		assert.InDelta(t, 5, r.ReplayGain, 0.5, "%d Hz ReplayGain", rate)
+	}
+
+	// Quiet passages below the relative gate don't drag the loudness down
+	loudThenQuiet := append(sine(1000, -23, 20, 48000), sine(1000, -50, 20, 48000)...)
+	r, err := MeasureLoudness(loudThenQuiet, 48000)
+	require.NoError(t, err)
+	assert.InDelta(t, -23, r.Integrated, 0.5)
+
+	// A tone at fs/4 phased to peak between samples, whose sample peak is 3 dB
+	// below its true peak
+	between := make([]float32, 5*44100)
+	for i := range between {
+		between[i] = float32(math.Pow(10, -3.0/20) * math.Sin(math.Pi/2*float64(i)+math.Pi/4))
+	}
+	r, err = MeasureLoudness(between, 44100)
+	require.NoError(t, err)
+	assert.InDelta(t, -3, r.TruePeak, 0.5)
+
+	_, err = MeasureLoudness(make([]float32, 48000), 48000)
+	assert.Error(t, err, "silence")
+	_, err = MeasureLoudness(sine(1000, -23, 0.2, 48000), 48000)
+	assert.Error(t, err, "shorter than a block")
+}
@@ -0,0 +1,143 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides a single-file library index of analyzed tracks.
+package analysis
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ManifestFileName is the library manifest written at the root of an analyzed directory.
+const ManifestFileName = "library.json"
+
+// ManifestTrack is one track's entry in the library manifest. Paths are
+// relative to the manifest's directory, with forward slashes.
+type ManifestTrack struct {
+	File     string  `json:"file"`          // Audio file
+	Sidecar  string  `json:"sidecar"`       // JSON sidecar
+	BPM      float64 `json:"bpm,omitempty"` // Default grid BPM
+	Key      string  `json:"key,omitempty"` // Camelot key, e.g. "8A"
+	Duration Seconds `json:"duration"`
+	// NeedsReview marks tracks flagged for manual review
+	NeedsReview bool `json:"needs_review,omitempty"`
+}
+
+// Manifest indexes every analyzed track in a directory so other tools can
+// read one file instead of walking every sidecar. Tracks are sorted by file.
+type Manifest struct {
+	Tracks []ManifestTrack `json:"tracks"`
+}
+
+// ReadManifest reads the manifest in dir. A missing manifest is empty.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Manifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Write atomically writes the manifest to dir.
+func (m *Manifest) Write(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, ManifestFileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, ManifestFileName))
+}
+
+// Retain drops tracks whose audio file is not in files, e.g. deleted since
+// the last run.
+func (m *Manifest) Retain(files map[string]bool) {
+	tracks := m.Tracks[:0]
+	for _, t := range m.Tracks {
+		if files[t.File] {
+			tracks = append(tracks, t)
+		}
+	}
+	m.Tracks = tracks
+}
+
+// Update adds or replaces the entry for a track analyzed from audioPath with
+// its sidecar at jsonPath, both under dir.
+func (m *Manifest) Update(dir, audioPath, jsonPath string, ta *TrackAnalysis) {
+	file, sidecar := manifestPath(dir, audioPath), manifestPath(dir, jsonPath)
+
+	track := ManifestTrack{File: file, Sidecar: sidecar, Duration: ta.Duration, NeedsReview: ta.NeedsReview}
+	if g := ta.DefaultGrid(nil); g != nil {
+		track.BPM = g.BPM
+	}
+	if ta.Key != nil {
+		track.Key = ta.Key.Key
+	}
+
+	i := sort.Search(len(m.Tracks), func(i int) bool { return m.Tracks[i].File >= file })
+	if i < len(m.Tracks) && m.Tracks[i].File == file {
+		m.Tracks[i] = track
+		return
+	}
+	m.Tracks = slices.Insert(m.Tracks, i, track)
+}
+
+// BuildManifest indexes every audio file in dir that has a JSON sidecar.
+func BuildManifest(dir string) (*Manifest, error) {
+	m := &Manifest{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if d.IsDir() || !isSupportedAudio(ext) {
+			return nil
+		}
+
+		jsonPath := strings.TrimSuffix(path, ext) + ".json"
+		if _, err := os.Stat(jsonPath); err != nil {
+			return nil // Not analyzed yet
+		}
+		ta, err := ReadTrackAnalysis(jsonPath)
+		if err != nil {
+			return err
+		}
+		m.Update(dir, path, jsonPath, ta)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteManifest rebuilds the manifest for dir from its sidecars and writes it.
+func WriteManifest(dir string) (*Manifest, error) {
+	m, err := BuildManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	return m, m.Write(dir)
+}
+
+// manifestPath returns path relative to dir in slash form.
+func manifestPath(dir, path string) string {
+	if rel, err := filepath.Rel(dir, path); err == nil {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
@@ -0,0 +1,67 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "album"), 0755))
+
+	writeTrack := func(name string, bpm float64, key string) {
+		audio := filepath.Join(dir, name+".mp3")
+		require.NoError(t, os.WriteFile(audio, nil, 0644))
+		ta := &TrackAnalysis{
+			File:     filepath.Base(audio),
+			Duration: 180,
+			Grids:    map[string]*GridAnalysis{string(AnalyzerBeatThis): {BPM: bpm, Beats: []float64{0.5}}},
+		}
+		if key != "" {
+			ta.Key = &KeyResult{Key: key, Name: "A minor", Confidence: 1}
+		}
+		require.NoError(t, ta.WriteJSON(filepath.Join(dir, name+".json")))
+	}
+	writeTrack("b", 128, "8A")
+	writeTrack("a", 120, "")
+	writeTrack("album/c", 90, "8A")
+	// Audio without a sidecar is not listed
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unanalyzed.mp3"), nil, 0644))
+
+	m, err := WriteManifest(dir)
+	require.NoError(t, err)
+
+	read, err := ReadManifest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, m, read)
+	assert.Equal(t, []ManifestTrack{
+		{File: "a.mp3", Sidecar: "a.json", BPM: 120, Duration: 180},
+		{File: "album/c.mp3", Sidecar: "album/c.json", BPM: 90, Key: "8A", Duration: 180},
+		{File: "b.mp3", Sidecar: "b.json", BPM: 128, Key: "8A", Duration: 180},
+	}, read.Tracks)
+
+	// Re-analyzing a track replaces its entry instead of duplicating it
+	ta, err := ReadTrackAnalysis(filepath.Join(dir, "b.json"))
+	require.NoError(t, err)
+	ta.Grids[string(AnalyzerBeatThis)].BPM = 64
+	ta.Key.Key = "9A"
+	read.Update(dir, filepath.Join(dir, "b.mp3"), filepath.Join(dir, "b.json"), ta)
+	read.Update(dir, filepath.Join(dir, "b.mp3"), filepath.Join(dir, "b.json"), ta)
+	require.Len(t, read.Tracks, 3)
+	assert.Equal(t, 64.0, read.Tracks[2].BPM)
+	assert.Equal(t, "9A", read.Tracks[2].Key)
+
+	// Deleted tracks are dropped
+	read.Retain(map[string]bool{"a.mp3": true, "b.mp3": true})
+	require.Len(t, read.Tracks, 2)
+	assert.Equal(t, []string{"a.mp3", "b.mp3"}, []string{read.Tracks[0].File, read.Tracks[1].File})
+
+	// A directory without a manifest reads as empty
+	empty, err := ReadManifest(t.TempDir())
+	require.NoError(t, err)
+	assert.Empty(t, empty.Tracks)
+}
@@ -0,0 +1,113 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides merging of cue points and phrases from multiple marker analyzers.
+package analysis
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+)
+
+// MarkerMerged is the Markers key of the combined marker track.
+const MarkerMerged = "merged"
+
+// MarkerPhrases is the Markers key of the bar-phrase cues derived from the
+// default grid's downbeats (see DerivePhraseMarkers).
+const MarkerPhrases = "phrases"
+
+// MergeMarkers combines the cue points and phrases of several marker analyzers
+// into one decluttered marker track. Cues within toleranceSec of the first cue
+// in a cluster collapse into the highest-confidence cue of that cluster.
+// Phrase boundaries from all sources are unioned, with boundaries within
+// toleranceSec of each other collapsed into the earliest, and durations
+// recomputed so phrases tile the combined span. An existing merged entry is
+// ignored.
+func MergeMarkers(markers map[string]*MarkerAnalysis, toleranceSec float64) *MarkerAnalysis {
+	var cues []CuePoint
+	var phrases []Phrase
+	var end Seconds
+	for _, name := range slices.Sorted(maps.Keys(markers)) {
+		m := markers[name]
+		if name == MarkerMerged || m == nil {
+			continue
+		}
+		cues = append(cues, m.CuePoints...)
+		for _, p := range m.Phrases {
+			phrases = append(phrases, p)
+			end = max(end, p.Time+p.Duration)
+		}
+	}
+
+	merged := &MarkerAnalysis{}
+	tol := Seconds(toleranceSec)
+
+	// Cluster cues by time, keeping the most confident cue of each cluster
+	slices.SortStableFunc(cues, func(a, b CuePoint) int { return cmp.Compare(a.Time, b.Time) })
+	for i := 0; i < len(cues); {
+		best, j := cues[i], i+1
+		for ; j < len(cues) && cues[j].Time-cues[i].Time <= tol; j++ {
+			if cues[j].Confidence > best.Confidence {
+				best = cues[j]
+			}
+		}
+		merged.CuePoints = append(merged.CuePoints, best)
+		i = j
+	}
+
+	// Union phrase boundaries, then recompute durations
+	slices.SortStableFunc(phrases, func(a, b Phrase) int { return cmp.Compare(a.Time, b.Time) })
+	for _, p := range phrases {
+		if n := len(merged.Phrases); n > 0 && p.Time-merged.Phrases[n-1].Time <= tol {
+			continue
+		}
+		merged.Phrases = append(merged.Phrases, Phrase{Time: p.Time, Label: p.Label})
+	}
+	for i := range merged.Phrases {
+		next := end
+		if i+1 < len(merged.Phrases) {
+			next = merged.Phrases[i+1].Time
+		}
+		merged.Phrases[i].Duration = max(next-merged.Phrases[i].Time, 0)
+	}
+
+	return merged
+}
+
+// exportMarkerSources are the Markers keys exporters search, in order, for cue
+// points and phrases.
+var exportMarkerSources = []string{MarkerMerged, "mixx", "songformer", "beats", MarkerPhrases}
+
+// exportCuePoints returns a copy of the cue points of the first marker source
+// that has any, by time.
+func exportCuePoints(ta *TrackAnalysis) []CuePoint {
+	for _, name := range exportMarkerSources {
+		if m := ta.Markers[name]; m != nil && m.Error == "" && len(m.CuePoints) > 0 {
+			cues := slices.Clone(m.CuePoints)
+			slices.SortStableFunc(cues, func(a, b CuePoint) int { return cmp.Compare(a.Time, b.Time) })
+			return cues
+		}
+	}
+	return nil
+}
+
+// exportPhrases returns the phrases with a positive duration of the first
+// marker source that has any, by time.
+func exportPhrases(ta *TrackAnalysis) []Phrase {
+	for _, name := range exportMarkerSources {
+		m := ta.Markers[name]
+		if m == nil || m.Error != "" {
+			continue
+		}
+		var phrases []Phrase
+		for _, p := range m.Phrases {
+			if p.Duration > 0 {
+				phrases = append(phrases, p)
+			}
+		}
+		if len(phrases) > 0 {
+			slices.SortStableFunc(phrases, func(a, b Phrase) int { return cmp.Compare(a.Time, b.Time) })
+			return phrases
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeMarkers(t *testing.T) {
+	markers := map[string]*MarkerAnalysis{
+		"beats": {CuePoints: []CuePoint{
+			{Time: 0, Type: "downbeat", Confidence: 0.5, Name: "downbeat-0"},
+			{Time: 32.1, Type: "section", Confidence: 0.4, Name: "section-1"},
+			{Time: 64, Type: "section", Confidence: 0.9, Name: "section-2"},
+		}},
+		"mixx": {CuePoints: []CuePoint{
+			{Time: 0.2, Type: "intro", Confidence: 0.8, Name: "Intro"},
+			{Time: 32, Type: "drop", Confidence: 0.7, Name: "Drop"},
+			{Time: 96, Type: "outro", Confidence: 0.6, Name: "Outro"},
+		}},
+		"songformer": {Phrases: []Phrase{
+			{Time: 0, Label: "intro", Duration: 32.2},
+			{Time: 32.2, Label: "chorus", Duration: 63.8},
+		}},
+		"other": {Phrases: []Phrase{
+			{Time: 32, Label: "verse", Duration: 32},
+			{Time: 64, Label: "verse", Duration: 40},
+		}},
+		MarkerMerged: {CuePoints: []CuePoint{{Time: 50, Confidence: 1}}},
+	}
+
+	merged := MergeMarkers(markers, 0.5)
+
+	// Near-duplicate cues collapse to the most confident, distinct ones survive
+	require.Len(t, merged.CuePoints, 4)
+	assert.Equal(t, "Intro", merged.CuePoints[0].Name)
+	assert.Equal(t, "Drop", merged.CuePoints[1].Name)
+	assert.Equal(t, "section-2", merged.CuePoints[2].Name)
+	assert.Equal(t, "Outro", merged.CuePoints[3].Name)
+
+	// Phrase boundaries are unioned and tile the combined span
+	require.Len(t, merged.Phrases, 3)
+	assert.Equal(t, []Seconds{0, 32, 64}, []Seconds{merged.Phrases[0].Time, merged.Phrases[1].Time, merged.Phrases[2].Time})
+	assert.Equal(t, "verse", merged.Phrases[1].Label)
+	assert.InDelta(t, 32.0, float64(merged.Phrases[0].Duration), 1e-9)
+	assert.InDelta(t, 40.0, float64(merged.Phrases[2].Duration), 1e-9)
+
+	// Zero tolerance only merges exact duplicates
+	assert.Len(t, MergeMarkers(markers, 0).CuePoints, 6)
+	assert.Empty(t, MergeMarkers(nil, 1).CuePoints)
+}
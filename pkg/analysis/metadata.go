@@ -0,0 +1,370 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides tag metadata extraction from ID3, Vorbis comment, and MP4 tags.
+package analysis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// TrackMetadata contains tag metadata read from the audio file.
+type TrackMetadata struct {
+	Title  string  `json:"title,omitempty"`
+	Artist string  `json:"artist,omitempty"`
+	Album  string  `json:"album,omitempty"`
+	Genre  string  `json:"genre,omitempty"`
+	BPM    float64 `json:"bpm,omitempty"` // BPM tag written by another tool, if any
+
+	// BPMMismatch is set when the BPM tag disagrees with the detected BPM
+	BPMMismatch bool `json:"bpm_mismatch,omitempty"`
+}
+
+// tagBPMTolerance is the relative difference above which a BPM tag is flagged.
+const tagBPMTolerance = 0.03
+
+// CheckBPM flags the metadata if its BPM tag differs from the detected BPM
+// by more than tagBPMTolerance. Tracks without a BPM tag are never flagged.
+func (m *TrackMetadata) CheckBPM(detected float64) {
+	if m.BPM <= 0 || detected <= 0 {
+		return
+	}
+	m.BPMMismatch = math.Abs(m.BPM-detected)/detected > tagBPMTolerance
+}
+
+// ReadMetadata reads title, artist, album, genre, and BPM tags from an audio file.
+// Supports ID3v2 (MP3, or prepended to FLAC and WAV), ID3v1 (MP3), Vorbis
+// comments (FLAC, Ogg), and iTunes MP4 atoms (M4A).
+// Returns an empty TrackMetadata if the file has no recognized tags.
+func ReadMetadata(path string) (*TrackMetadata, error) {
+	format, err := sniffAudioFormat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+
+	// ID3v2 tags are also prepended to some FLAC and WAV files
+	m := &TrackMetadata{}
+	readID3v2(data, m)
+	data = data[min(id3v2Size(data), len(data)):]
+	switch format {
+	case ".mp3":
+		if m.Title == "" && m.Artist == "" {
+			readID3v1(data, m)
+		}
+	case ".flac":
+		readFLACComments(data, m)
+	case ".ogg":
+		readOggComments(data, m)
+	case ".m4a":
+		readMP4Tags(data, m)
+	}
+	return m, nil
+}
+
+// setTag assigns a tag value by its common field name (case-insensitive).
+func (m *TrackMetadata) setTag(key, value string) {
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	if value == "" {
+		return
+	}
+	switch strings.ToUpper(key) {
+	case "TITLE":
+		m.Title = value
+	case "ARTIST":
+		m.Artist = value
+	case "ALBUM":
+		m.Album = value
+	case "GENRE":
+		m.Genre = value
+	case "BPM":
+		if bpm, err := strconv.ParseFloat(value, 64); err == nil {
+			m.BPM = bpm
+		}
+	}
+}
+
+// id3Frames maps ID3v2.3/2.4 and ID3v2.2 frame IDs to tag names.
+var id3Frames = map[string]string{
+	"TIT2": "TITLE", "TT2": "TITLE",
+	"TPE1": "ARTIST", "TP1": "ARTIST",
+	"TALB": "ALBUM", "TAL": "ALBUM",
+	"TCON": "GENRE", "TCO": "GENRE",
+	"TBPM": "BPM", "TBP": "BPM",
+}
+
+// readID3v2 parses text frames from an ID3v2.2, 2.3, or 2.4 tag at the start of data.
+func readID3v2(data []byte, m *TrackMetadata) {
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return
+	}
+	version := data[3]
+	flags := data[5]
+	size := syncsafe(data[6:10])
+	end := min(10+size, len(data))
+	pos := 10
+
+	// Skip extended header (v2.3 size excludes itself, v2.4 is syncsafe and includes itself)
+	if flags&0x40 != 0 && pos+4 <= end {
+		switch version {
+		case 3:
+			pos += 4 + int(binary.BigEndian.Uint32(data[pos:]))
+		case 4:
+			pos += syncsafe(data[pos : pos+4])
+		}
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+
+	for pos+headerLen <= end {
+		id := string(data[pos : pos+idLen])
+		if id[0] == 0 {
+			break // Padding
+		}
+
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(data[pos+3])<<16 | int(data[pos+4])<<8 | int(data[pos+5])
+		case 4:
+			frameSize = syncsafe(data[pos+4 : pos+8])
+		default:
+			frameSize = int(binary.BigEndian.Uint32(data[pos+4:]))
+		}
+		body := pos + headerLen
+		if frameSize <= 0 || body+frameSize > end {
+			break
+		}
+
+		if key, ok := id3Frames[id]; ok {
+			m.setTag(key, decodeID3Text(data[body:body+frameSize]))
+		}
+		pos = body + frameSize
+	}
+}
+
+// syncsafe decodes a 4-byte ID3v2 syncsafe integer (7 bits per byte).
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// decodeID3Text decodes an ID3v2 text frame body: an encoding byte followed by text.
+// Multiple values (v2.4 null-separated) are reduced to the first.
+func decodeID3Text(b []byte) string {
+	if len(b) < 1 {
+		return ""
+	}
+	enc, text := b[0], b[1:]
+
+	switch enc {
+	case 1, 2: // UTF-16 with BOM, UTF-16BE
+		order := binary.ByteOrder(binary.BigEndian)
+		if enc == 1 && len(text) >= 2 {
+			if text[0] == 0xFF && text[1] == 0xFE {
+				order = binary.LittleEndian
+			}
+			text = text[2:]
+		}
+		units := make([]uint16, 0, len(text)/2)
+		for i := 0; i+1 < len(text); i += 2 {
+			u := order.Uint16(text[i:])
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		return string(utf16.Decode(units))
+	case 3: // UTF-8
+		s, _, _ := strings.Cut(string(text), "\x00")
+		return s
+	default: // ISO-8859-1
+		s, _, _ := bytes.Cut(text, []byte{0})
+		runes := make([]rune, len(s))
+		for i, c := range s {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	}
+}
+
+// readID3v1 parses the fixed 128-byte ID3v1 tag at the end of data.
+func readID3v1(data []byte, m *TrackMetadata) {
+	if len(data) < 128 {
+		return
+	}
+	tag := data[len(data)-128:]
+	if string(tag[:3]) != "TAG" {
+		return
+	}
+	m.setTag("TITLE", string(tag[3:33]))
+	m.setTag("ARTIST", string(tag[33:63]))
+	m.setTag("ALBUM", string(tag[63:93]))
+}
+
+// readFLACComments parses the VORBIS_COMMENT metadata block of a FLAC stream.
+func readFLACComments(data []byte, m *TrackMetadata) {
+	pos := 4 // "fLaC"
+	for pos+4 <= len(data) {
+		header := data[pos]
+		length := int(data[pos+1])<<16 | int(data[pos+2])<<8 | int(data[pos+3])
+		pos += 4
+		if pos+length > len(data) {
+			return
+		}
+		if header&0x7f == 4 { // VORBIS_COMMENT
+			parseVorbisComments(data[pos:pos+length], m)
+			return
+		}
+		if header&0x80 != 0 { // Last metadata block
+			return
+		}
+		pos += length
+	}
+}
+
+// readOggComments parses the Vorbis or Opus comment header packet of an Ogg stream.
+func readOggComments(data []byte, m *TrackMetadata) {
+	var packet []byte
+	for pos := 0; pos+27 <= len(data) && string(data[pos:pos+4]) == "OggS"; {
+		numSegments := int(data[pos+26])
+		if pos+27+numSegments > len(data) {
+			return
+		}
+		segments := data[pos+27 : pos+27+numSegments]
+		body := pos + 27 + numSegments
+
+		for _, seg := range segments {
+			if body+int(seg) > len(data) {
+				return
+			}
+			packet = append(packet, data[body:body+int(seg)]...)
+			body += int(seg)
+
+			// A segment shorter than 255 bytes ends the packet
+			if seg < 255 {
+				switch {
+				case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+					parseVorbisComments(packet[7:], m)
+					return
+				case bytes.HasPrefix(packet, []byte("OpusTags")):
+					parseVorbisComments(packet[8:], m)
+					return
+				}
+				packet = packet[:0]
+			}
+		}
+		pos = body
+	}
+}
+
+// parseVorbisComments parses a Vorbis comment block: vendor string then KEY=value pairs.
+func parseVorbisComments(b []byte, m *TrackMetadata) {
+	r := bytes.NewReader(b)
+	readString := func() (string, bool) {
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil || int(n) > r.Len() {
+			return "", false
+		}
+		s := make([]byte, n)
+		io.ReadFull(r, s)
+		return string(s), true
+	}
+
+	if _, ok := readString(); !ok { // Vendor
+		return
+	}
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return
+	}
+	for range count {
+		comment, ok := readString()
+		if !ok {
+			return
+		}
+		if key, value, found := strings.Cut(comment, "="); found {
+			m.setTag(key, value)
+		}
+	}
+}
+
+// mp4Tags maps iTunes ilst atom names to tag names.
+var mp4Tags = map[string]string{
+	"\xa9nam": "TITLE",
+	"\xa9ART": "ARTIST",
+	"\xa9alb": "ALBUM",
+	"\xa9gen": "GENRE",
+	"tmpo":    "BPM",
+}
+
+// readMP4Tags walks moov/udta/meta/ilst atoms and reads iTunes-style tags.
+func readMP4Tags(data []byte, m *TrackMetadata) {
+	ilst := findMP4Atom(data, "moov", "udta", "meta", "ilst")
+	for pos := 0; pos+8 <= len(ilst); {
+		size := int(binary.BigEndian.Uint32(ilst[pos:]))
+		if size < 8 || pos+size > len(ilst) {
+			return
+		}
+		name := string(ilst[pos+4 : pos+8])
+		item := ilst[pos+8 : pos+size]
+		pos += size
+
+		key, ok := mp4Tags[name]
+		if !ok {
+			continue
+		}
+		// data atom: size, "data", type (4), locale (4), value
+		value := findMP4Atom(item, "data")
+		if len(value) < 8 {
+			continue
+		}
+		value = value[8:]
+		if name == "tmpo" {
+			if len(value) >= 2 {
+				m.setTag(key, strconv.Itoa(int(binary.BigEndian.Uint16(value))))
+			}
+			continue
+		}
+		m.setTag(key, string(value))
+	}
+}
+
+// findMP4Atom returns the payload of the atom at the given path, or nil if not found.
+// The "meta" atom is a full box, so its 4-byte version/flags prefix is skipped.
+func findMP4Atom(data []byte, path ...string) []byte {
+	for _, name := range path {
+		var found []byte
+		for pos := 0; pos+8 <= len(data); {
+			size := int(binary.BigEndian.Uint32(data[pos:]))
+			if size < 8 || pos+size > len(data) {
+				return nil
+			}
+			if string(data[pos+4:pos+8]) == name {
+				found = data[pos+8 : pos+size]
+				break
+			}
+			pos += size
+		}
+		if found == nil {
+			return nil
+		}
+		if name == "meta" && len(found) >= 4 {
+			found = found[4:]
+		}
+		data = found
+	}
+	return data
+}
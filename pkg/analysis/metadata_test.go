@@ -0,0 +1,138 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// id3Frame builds an ID3v2.3 text frame with ISO-8859-1 encoding.
+func id3Frame(id, text string) []byte {
+	var b bytes.Buffer
+	b.WriteString(id)
+	binary.Write(&b, binary.BigEndian, uint32(len(text)+1))
+	b.Write([]byte{0, 0, 0}) // Flags, encoding
+	b.WriteString(text)
+	return b.Bytes()
+}
+
+// vorbisComments builds a Vorbis comment block.
+func vorbisComments(comments ...string) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(4))
+	b.WriteString("test")
+	binary.Write(&b, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		binary.Write(&b, binary.LittleEndian, uint32(len(c)))
+		b.WriteString(c)
+	}
+	return b.Bytes()
+}
+
+// mp4Atom builds an MP4 atom with the given children or payload.
+func mp4Atom(name string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], name)
+	return append(b, body...)
+}
+
+func TestReadMetadataID3(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tagged.mp3")
+	writeSilentMonoMP3(t, path, 10)
+	audio, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	frames := bytes.Join([][]byte{
+		id3Frame("TIT2", "Now Get Busy"),
+		id3Frame("TPE1", "Beastie Boys"),
+		id3Frame("TALB", "The WIRED CD"),
+		id3Frame("TCON", "Hip-Hop"),
+		id3Frame("TBPM", "104"),
+	}, nil)
+	frames = append(frames, make([]byte, 32)...) // Padding
+	size := len(frames)
+	header := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	require.NoError(t, os.WriteFile(path, append(append(header, frames...), audio...), 0644))
+
+	m, err := ReadMetadata(path)
+	require.NoError(t, err)
+	assert.Equal(t, &TrackMetadata{
+		Title:  "Now Get Busy",
+		Artist: "Beastie Boys",
+		Album:  "The WIRED CD",
+		Genre:  "Hip-Hop",
+		BPM:    104,
+	}, m)
+
+	// Tagged file still decodes
+	_, _, err = LoadAudioMono(path)
+	assert.NoError(t, err)
+
+	m.CheckBPM(104.5)
+	assert.False(t, m.BPMMismatch)
+	m.CheckBPM(140)
+	assert.True(t, m.BPMMismatch)
+}
+
+func TestReadMetadataFLAC(t *testing.T) {
+	comments := vorbisComments("TITLE=Track", "artist=Someone", "BPM=128.5")
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	b.Write([]byte{0x00, 0, 0, 34}) // STREAMINFO
+	b.Write(make([]byte, 34))
+	b.Write([]byte{0x84, byte(len(comments) >> 16), byte(len(comments) >> 8), byte(len(comments))})
+	b.Write(comments)
+
+	path := filepath.Join(t.TempDir(), "tagged.flac")
+	require.NoError(t, os.WriteFile(path, b.Bytes(), 0644))
+
+	m, err := ReadMetadata(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Track", m.Title)
+	assert.Equal(t, "Someone", m.Artist)
+	assert.Equal(t, 128.5, m.BPM)
+
+	// An ID3v2 tag prepended to FLAC is read along with the Vorbis comments
+	frame := id3Frame("TALB", "Album")
+	id3 := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frame))}, frame...)
+	require.NoError(t, os.WriteFile(path, append(id3, b.Bytes()...), 0644))
+	m, err = ReadMetadata(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Album", m.Album)
+	assert.Equal(t, "Track", m.Title)
+}
+
+func TestReadMetadataMP4(t *testing.T) {
+	dataAtom := func(typ uint32, value []byte) []byte {
+		payload := make([]byte, 8)
+		binary.BigEndian.PutUint32(payload, typ)
+		return mp4Atom("data", payload, value)
+	}
+	tempo := make([]byte, 2)
+	binary.BigEndian.PutUint16(tempo, 122)
+
+	ilst := mp4Atom("ilst",
+		mp4Atom("\xa9nam", dataAtom(1, []byte("Song"))),
+		mp4Atom("\xa9ART", dataAtom(1, []byte("Band"))),
+		mp4Atom("tmpo", dataAtom(21, tempo)),
+	)
+	meta := mp4Atom("meta", []byte{0, 0, 0, 0}, mp4Atom("hdlr", make([]byte, 25)), ilst)
+	file := append(mp4Atom("ftyp", []byte("M4A \x00\x00\x00\x00")), mp4Atom("moov", mp4Atom("udta", meta))...)
+
+	path := filepath.Join(t.TempDir(), "tagged.m4a")
+	require.NoError(t, os.WriteFile(path, file, 0644))
+
+	m, err := ReadMetadata(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Song", m.Title)
+	assert.Equal(t, "Band", m.Artist)
+	assert.Equal(t, 122.0, m.BPM)
+}
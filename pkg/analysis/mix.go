@@ -0,0 +1,220 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides track boundary detection in continuous DJ mixes.
+package analysis
+
+import (
+	"math"
+)
+
+// DJ mix transition detection parameters.
+const (
+	mixFrameSecs       = 1.0   // Feature frame size, the resolution of reported transitions
+	mixKernelFrames    = 16    // Half-width of the novelty kernel; shorter changes are ignored
+	mixMinTrackFrames  = 30    // Minimum spacing between transitions
+	mixFFTSize         = 2048  // FFT size for spectral features
+	mixBands           = 24    // Log-spaced spectral bands per feature frame
+	mixMinHz           = 30.0  // Lowest band edge
+	mixOnsetRate       = 100   // Onset envelope frames per second, for tempo
+	mixTempoWindowSecs = 8.0   // Span each local tempo estimate covers
+	mixMinBPM          = 60.0  // Local tempo search range
+	mixMaxBPM          = 180.0 //
+	mixTempoScale      = 0.1   // Relative tempo change that counts as much as a full timbre change
+	mixMinNovelty      = 0.1   // Floor under the peak threshold, so a steady track has no transitions
+)
+
+// DetectMixTransitions finds where one song hands over to the next in a
+// continuous DJ mix, returning candidate boundary times in seconds.
+//
+// Each second of audio is summarized by a log-band spectrum and a local tempo.
+// A checkerboard kernel over the spectral self-similarity matrix scores how
+// different the 16 seconds before each point are from the 16 seconds after,
+// and the relative change in median tempo across the point is added to that
+// score, so sustained changes in sound or tempo stand out while fills and
+// breakdowns within a track don't. Peaks more than a standard deviation above
+// the mean score (and above mixMinNovelty), at least 30 seconds apart, are
+// returned.
+func DetectMixTransitions(samples []float32, sampleRate int) []float64 {
+	frameLen := int(mixFrameSecs * float64(sampleRate))
+	if sampleRate <= 0 || frameLen < mixFFTSize {
+		return nil
+	}
+	numFrames := len(samples) / frameLen
+	if numFrames < 2*mixKernelFrames+1 {
+		return nil
+	}
+
+	features := mixFeatures(samples, sampleRate, numFrames)
+	tempos := mixTempos(samples, sampleRate, numFrames)
+
+	// Similarity is cosine similarity of band spectra, 1 for two silent frames
+	sim := func(i, j int) float64 {
+		var dot, ni, nj float64
+		for b := range features[i] {
+			dot += features[i][b] * features[j][b]
+			ni += features[i][b] * features[i][b]
+			nj += features[j][b] * features[j][b]
+		}
+		if ni == 0 || nj == 0 {
+			if ni == nj {
+				return 1
+			}
+			return 0
+		}
+		return dot / math.Sqrt(ni*nj)
+	}
+
+	novelty := make([]float64, numFrames)
+	const k = mixKernelFrames
+	for c := k; c <= numFrames-k; c++ {
+		// Foote novelty: similarity within each side minus similarity across
+		var within, across float64
+		for i := c - k; i < c+k; i++ {
+			for j := i + 1; j < c+k; j++ {
+				if (i < c) == (j < c) {
+					within += sim(i, j)
+				} else {
+					across += sim(i, j)
+				}
+			}
+		}
+		spectral := max(within/float64(k*(k-1))-across/float64(k*k), 0)
+
+		var tempo float64
+		left, right := medianFloat64BeatThis(tempos[c-k:c]), medianFloat64BeatThis(tempos[c:c+k])
+		if left > 0 && right > 0 {
+			tempo = min(math.Abs(right-left)/min(left, right)/mixTempoScale, 1)
+		}
+		novelty[c] = spectral + tempo
+	}
+
+	// Peaks above mean + one standard deviation, strongest first within the spacing
+	var mean, sq float64
+	n := float64(numFrames - 2*k + 1)
+	for _, v := range novelty[k : numFrames-k+1] {
+		mean += v / n
+	}
+	for _, v := range novelty[k : numFrames-k+1] {
+		sq += (v - mean) * (v - mean) / n
+	}
+	threshold := max(mean+math.Sqrt(sq), mixMinNovelty)
+
+	var transitions []float64
+	last := -mixMinTrackFrames
+	for c := k; c <= numFrames-k; c++ {
+		if novelty[c] <= threshold {
+			continue
+		}
+		peak := true
+		for j := max(c-mixMinTrackFrames, k); j <= min(c+mixMinTrackFrames, numFrames-k); j++ {
+			if novelty[j] > novelty[c] || (novelty[j] == novelty[c] && j < c) {
+				peak = false
+				break
+			}
+		}
+		if peak && c-last >= mixMinTrackFrames {
+			transitions = append(transitions, float64(c)*mixFrameSecs)
+			last = c
+		}
+	}
+	return transitions
+}
+
+// mixFeatures returns a log-compressed, log-frequency band spectrum for each
+// mixFrameSecs frame, averaged over the FFT frames within it.
+func mixFeatures(samples []float32, sampleRate, numFrames int) [][]float64 {
+	frameLen := int(mixFrameSecs * float64(sampleRate))
+
+	// Band index of each FFT bin, -1 below mixMinHz
+	numBins := mixFFTSize/2 + 1
+	nyquist := float64(sampleRate) / 2
+	band := make([]int, numBins)
+	for j := range band {
+		hz := float64(j) * float64(sampleRate) / mixFFTSize
+		band[j] = -1
+		if hz >= mixMinHz {
+			band[j] = min(int(mixBands*math.Log(hz/mixMinHz)/math.Log(nyquist/mixMinHz)), mixBands-1)
+		}
+	}
+
+	cfg := GoSTFTConfig{FFTSize: mixFFTSize, HopSize: mixFFTSize / 2, WindowSize: mixFFTSize}
+	chunk := make([]float64, frameLen+mixFFTSize)
+	features := make([][]float64, numFrames)
+	for f := range features {
+		start := f * frameLen
+		chunk = chunk[:min(frameLen+mixFFTSize, len(samples)-start)]
+		for i := range chunk {
+			if v := float64(samples[start+i]); isFinite(v) {
+				chunk[i] = v
+			} else {
+				chunk[i] = 0
+			}
+		}
+
+		features[f] = make([]float64, mixBands)
+		n := defaultSTFT.frames(chunk, cfg, func(_ int, coeffs []complex128) {
+			for j, b := range band {
+				if b >= 0 {
+					re, im := real(coeffs[j]), imag(coeffs[j])
+					features[f][b] += math.Sqrt(re*re + im*im)
+				}
+			}
+		})
+		for b := range features[f] {
+			features[f][b] = math.Log1p(features[f][b] / float64(max(n, 1)))
+		}
+	}
+	return features
+}
+
+// mixTempos estimates the local tempo in BPM around each mixFrameSecs frame
+// from the autocorrelation of an onset envelope, or 0 where there is no pulse.
+func mixTempos(samples []float32, sampleRate, numFrames int) []float64 {
+	// Onset envelope: rise in log energy between mixOnsetRate blocks
+	block := max(sampleRate/mixOnsetRate, 1)
+	env := make([]float64, len(samples)/block)
+	prev := 0.0
+	for i := range env {
+		var e float64
+		for _, v := range samples[i*block : (i+1)*block] {
+			if x := float64(v); isFinite(x) {
+				e += x * x
+			}
+		}
+		logE := math.Log1p(1000 * e / float64(block))
+		if i > 0 {
+			env[i] = max(logE-prev, 0)
+		}
+		prev = logE
+	}
+
+	minLag := int(math.Floor(60 / mixMaxBPM * mixOnsetRate))
+	maxLag := int(math.Ceil(60 / mixMinBPM * mixOnsetRate))
+	half := int(mixTempoWindowSecs / 2 * mixOnsetRate)
+	tempos := make([]float64, numFrames)
+	for f := range tempos {
+		center := int((float64(f) + 0.5) * mixFrameSecs * mixOnsetRate)
+		lo, hi := max(center-half, 0), min(center+half, len(env))
+		if hi-lo <= maxLag {
+			continue
+		}
+
+		var energy float64
+		for _, v := range env[lo:hi] {
+			energy += v * v
+		}
+		bestLag, best := 0, 0.0
+		for lag := minLag; lag <= maxLag; lag++ {
+			var ac float64
+			for i := lo; i+lag < hi; i++ {
+				ac += env[i] * env[i+lag]
+			}
+			if ac > best {
+				bestLag, best = lag, ac
+			}
+		}
+		if bestLag > 0 && best > 0.1*energy {
+			tempos[f] = 60 * mixOnsetRate / float64(bestLag)
+		}
+	}
+	return tempos
+}
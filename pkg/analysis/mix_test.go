@@ -0,0 +1,51 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectMixTransitions(t *testing.T) {
+	const sampleRate = 22050
+	rng := rand.New(rand.NewSource(1))
+
+	// segment synthesizes secs of a pad tone at toneHz with a decaying hit
+	// every beat at bpm: a low kick when kick is set, a noise hat otherwise
+	segment := func(secs, bpm, toneHz float64, kick bool) []float32 {
+		n := int(secs * sampleRate)
+		period := int(60 / bpm * sampleRate)
+		out := make([]float32, n)
+		for i := range out {
+			tm := float64(i) / sampleRate
+			v := 0.2 * math.Sin(2*math.Pi*toneHz*tm)
+			since := float64(i%period) / sampleRate
+			env := math.Exp(-since * 30)
+			if kick {
+				v += 0.7 * env * math.Sin(2*math.Pi*60*since)
+			} else {
+				v += 0.5 * env * (2*rng.Float64() - 1)
+			}
+			out[i] = float32(v)
+		}
+		return out
+	}
+
+	t.Run("two tracks", func(t *testing.T) {
+		mix := append(segment(45, 120, 220, true), segment(45, 90, 1760, false)...)
+		got := DetectMixTransitions(mix, sampleRate)
+		require.Len(t, got, 1, "transitions: %v", got)
+		assert.InDelta(t, 45, got[0], 2)
+	})
+
+	t.Run("one track", func(t *testing.T) {
+		assert.Empty(t, DetectMixTransitions(segment(90, 120, 220, true), sampleRate))
+	})
+
+	t.Run("too short", func(t *testing.T) {
+		assert.Nil(t, DetectMixTransitions(segment(20, 120, 220, true), sampleRate))
+	})
+}
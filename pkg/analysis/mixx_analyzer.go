@@ -10,11 +10,21 @@ package analysis
 
 #include "analyzer.h"
 #include <stdlib.h>
+
+extern void qmProgressCallback(int64_t processed_frames, int64_t total_frames, void* user_data);
 */
 import "C"
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/gob"
 	"errors"
 	"fmt"
+	"math"
+	"runtime/cgo"
+	"slices"
+	"sort"
 	"unsafe"
 )
 
@@ -64,43 +74,73 @@ const (
 type QMConfig struct {
 	// DFType specifies the detection function type.
 	// Default: DFTypeComplexSD
-	DFType DetectionFunctionType
+	DFType DetectionFunctionType `yaml:"df_type" json:"df_type"`
 
 	// StepSecs is the analysis step size in seconds.
 	// Default: 0.01161 (~12ms, ~86Hz resolution)
-	StepSecs float32
+	StepSecs float32 `yaml:"step_secs" json:"step_secs"`
 
 	// MaxBinHz is the maximum frequency bin size in Hz.
 	// Determines FFT window size. Default: 50 Hz
-	MaxBinHz int
+	MaxBinHz int `yaml:"max_bin_hz" json:"max_bin_hz"`
 
 	// DBRise is the dB rise threshold for broadband detection.
 	// Only used when DFType is DFTypeBroadband. Default: 3.0
-	DBRise float64
+	DBRise float64 `yaml:"db_rise" json:"db_rise"`
 
 	// AdaptiveWhitening enables spectral whitening.
 	// Default: false
-	AdaptiveWhitening bool
+	AdaptiveWhitening bool `yaml:"adaptive_whitening" json:"adaptive_whitening"`
 
 	// InputTempo is a tempo hint in BPM for the tracker.
 	// Default: 120.0, set to 0 for fully automatic detection.
-	InputTempo float64
+	InputTempo float64 `yaml:"input_tempo" json:"input_tempo"`
 
 	// ConstrainTempo forces the tracker to stay near InputTempo.
 	// Default: false
-	ConstrainTempo bool
+	ConstrainTempo bool `yaml:"constrain_tempo" json:"constrain_tempo"`
 
 	// Alpha is the beat tracking weight (0-1).
 	// Higher values favor consistent tempo. Default: 0.9
-	Alpha float64
+	Alpha float64 `yaml:"alpha" json:"alpha"`
 
 	// Tightness controls how strictly beats follow the tempo.
 	// Higher values = stricter. Default: 4.0
-	Tightness float64
+	Tightness float64 `yaml:"tightness" json:"tightness"`
 
 	// BeatsPerBar for downbeat detection.
 	// Default: 4
-	BeatsPerBar int
+	BeatsPerBar int `yaml:"beats_per_bar" json:"beats_per_bar"`
+
+	// DetectMeter picks the bar length among 3, 4, and 6 beats from the
+	// downbeat periodicity, using BeatsPerBar when it's unclear.
+	// Default: false
+	DetectMeter bool `yaml:"detect_meter" json:"detect_meter"`
+
+	// DownbeatPrior biases the downbeat phase toward a known bar structure.
+	// Applied in Go after qm-dsp downbeat detection. Default: nil (no prior)
+	DownbeatPrior *DownbeatPrior `yaml:"downbeat_prior" json:"downbeat_prior,omitempty"`
+
+	// OnsetSensitivity (1-100) controls how many peaks DetectOnsets picks
+	// from the detection function. Higher picks more onsets.
+	// Default: 0 (50, matching the qm-vamp-plugins onset detector)
+	OnsetSensitivity float64 `yaml:"onset_sensitivity" json:"onset_sensitivity"`
+
+	// ProgressFunc is called as audio is processed with the frames processed
+	// so far and the total, or 0 for a total that isn't known up front as
+	// when streaming. It runs on the analyzing goroutine. Default: nil
+	ProgressFunc func(processedFrames, totalFrames int64) `yaml:"-" json:"-"`
+}
+
+// DownbeatPrior describes an expected bar structure for downbeat selection.
+type DownbeatPrior struct {
+	// BeatsPerBar is the expected bar length in beats.
+	// Default: 0 (use QMConfig.BeatsPerBar)
+	BeatsPerBar int `yaml:"beats_per_bar" json:"beats_per_bar"`
+
+	// Anchor is the time in seconds of a known downbeat, e.g. the first kick
+	// of an EDM intro. Default: nil (phase from the spectral difference)
+	Anchor *float64 `yaml:"anchor" json:"anchor,omitempty"`
 }
 
 // SegmenterConfig holds configuration for structural segmentation.
@@ -157,7 +197,7 @@ type QMSegment struct {
 
 // QMCue represents a detected cue point.
 type QMCue struct {
-	Time       float64   // Time in seconds
+	Time       Seconds   // Cue position
 	Type       QMCueType // Cue type
 	TypeIndex  int       // Index within type (e.g., section type 0-9)
 	Confidence float64   // Confidence score (0-1)
@@ -206,7 +246,7 @@ type QMResult struct {
 	Beats       []float64 // Beat timestamps in seconds
 	SampleRate  int       // Audio sample rate in Hz
 	TotalFrames int64     // Total number of audio frames
-	Duration    float64   // Audio duration in seconds
+	Duration    Seconds   // Audio duration
 
 	// Stage 1: Detection function values (onset strength over time)
 	DetectionFunction []float64 // Raw detection function values
@@ -218,9 +258,11 @@ type QMResult struct {
 	BeatPeriods []int
 
 	// Downbeat detection
-	Downbeats          []int     // Indices into Beats array that are downbeats (first beat of bar)
-	BeatSpectralDiff   []float64 // Spectral difference at each beat (for downbeat analysis)
-	NumDownbeats       int       // Number of downbeats detected
+	Downbeats        []int     // Indices into Beats array that are downbeats (first beat of bar)
+	BeatsPerBar      int       // Meter of the downbeats, e.g. 3 for 3/4
+	BeatSpectralDiff []float64 // Spectral difference at each beat (for downbeat analysis)
+	BeatConfidence   []float64 // Normalized spectral strength of each beat (0-1), aligned to Beats
+	NumDownbeats     int       // Number of downbeats detected
 
 	// Segmentation
 	Segments        []QMSegment // Structural segments
@@ -230,17 +272,156 @@ type QMResult struct {
 	Cues []QMCue
 }
 
-// Bars returns the number of bars (assuming 4 beats per bar).
+// Bars returns the number of bars of BeatsPerBar beats (4 if unset).
 func (r *QMResult) Bars() float64 {
 	if len(r.Beats) == 0 {
 		return 0
 	}
-	return float64(len(r.Beats)) / 4.0
+	return float64(len(r.Beats)) / float64(cmp.Or(r.BeatsPerBar, 4))
+}
+
+// meterCandidates are the bar lengths DetectMeter tries, in beats: 3/4, 4/4,
+// and 6/8 counted in eighth notes.
+var meterCandidates = []int{3, 4, 6}
+
+// DetectMeter picks the bar length among meterCandidates with the strongest
+// downbeat periodicity in BeatSpectralDiff and rederives the downbeats at it,
+// returning the meter. A meter's strength is how far its strongest phase's
+// mean spectral difference stands above its other phases', relative to the
+// overall mean, so a multiple of the true meter (6 for a waltz) scores lower
+// as its other phases include true downbeats. fallback wins ties and is kept
+// without two bars of spectral differences for every candidate.
+func (r *QMResult) DetectMeter(fallback int) int {
+	sd := r.BeatSpectralDiff
+	if len(sd) < 2*slices.Max(meterCandidates) {
+		return fallback
+	}
+	var mean float64
+	for _, v := range sd {
+		mean += v
+	}
+	mean /= float64(len(sd))
+	if !(mean > 0) {
+		return fallback
+	}
+
+	strength := func(n int) float64 {
+		phases := make([]float64, n)
+		counts := make([]int, n)
+		for j, v := range sd {
+			phases[(j+1)%n] += v // The difference going into beat j+1
+			counts[(j+1)%n]++
+		}
+		var sum float64
+		for p := range n {
+			phases[p] /= float64(counts[p])
+			sum += phases[p]
+		}
+		best := slices.Max(phases)
+		return (best - (sum-best)/float64(n-1)) / mean
+	}
+
+	meter := fallback
+	best := math.Inf(-1)
+	if fallback > 1 {
+		best = strength(fallback)
+	}
+	for _, n := range meterCandidates {
+		if s := strength(n); s > best+1e-9 {
+			meter, best = n, s
+		}
+	}
+	r.ApplyDownbeatPrior(&DownbeatPrior{BeatsPerBar: meter}, meter)
+	return meter
+}
+
+// ApplyDownbeatPrior replaces the detected downbeats with a rigid bar grid of
+// prior.BeatsPerBar beats (falling back to beatsPerBar, then 4). With an anchor,
+// the bar phase is the beat nearest the anchor; without one, the phase with the
+// highest mean spectral difference going into its beats wins, with qm-dsp's
+// downbeats breaking ties.
+func (r *QMResult) ApplyDownbeatPrior(prior *DownbeatPrior, beatsPerBar int) {
+	if prior == nil || len(r.Beats) == 0 {
+		return
+	}
+	n := prior.BeatsPerBar
+	if n <= 0 {
+		n = beatsPerBar
+	}
+	if n <= 0 {
+		n = 4
+	}
+
+	phase := 0
+	if prior.Anchor != nil {
+		phase = nearestBeatIndex(r.Beats, *prior.Anchor) % n
+	} else {
+		// BeatSpectralDiff[j] is the difference between beats j and j+1, so
+		// it scores beat j+1 as qm-dsp's DownBeat does
+		scores := make([]float64, n)
+		counts := make([]int, n)
+		for j, sd := range r.BeatSpectralDiff {
+			scores[(j+1)%n] += sd
+			counts[(j+1)%n]++
+		}
+		for _, idx := range r.Downbeats {
+			if idx >= 0 {
+				scores[idx%n] += 1e-9 // Tie-break toward qm-dsp's choice
+			}
+		}
+		best := math.Inf(-1)
+		for p := range n {
+			score := scores[p]
+			if counts[p] > 0 {
+				score = scores[p] / float64(counts[p])
+			}
+			if score > best {
+				best, phase = score, p
+			}
+		}
+	}
+
+	r.Downbeats = r.Downbeats[:0]
+	for i := phase; i < len(r.Beats); i += n {
+		r.Downbeats = append(r.Downbeats, i)
+	}
+	r.NumDownbeats = len(r.Downbeats)
+	r.BeatsPerBar = n
 }
 
 // DFTimeToSeconds converts a detection function frame index to seconds.
-func (r *QMResult) DFTimeToSeconds(dfIndex int) float64 {
-	return float64(dfIndex*r.StepSizeFrames) / float64(r.SampleRate)
+func (r *QMResult) DFTimeToSeconds(dfIndex int) Seconds {
+	return FramesToSeconds(dfIndex*r.StepSizeFrames, float64(r.SampleRate))
+}
+
+// qmBeatPeriodStep is the hop in DF frames between qm-dsp's beat period windows.
+const qmBeatPeriodStep = 128
+
+// TempoCurve returns the tempo over time from BeatPeriods: a point at the
+// start and wherever the tempo changes. BeatPeriods spans the detection
+// function, or is qmBeatPeriodStep DF frames apart without one. Invalid
+// periods are skipped. Returns nil if there are no valid periods.
+func (r *QMResult) TempoCurve() []TempoPoint {
+	if len(r.BeatPeriods) == 0 {
+		return nil
+	}
+	step := float64(qmBeatPeriodStep)
+	if len(r.DetectionFunction) > 0 {
+		step = float64(len(r.DetectionFunction)) / float64(len(r.BeatPeriods))
+	}
+
+	var curve []TempoPoint
+	for i, p := range r.BeatPeriods {
+		bpm := r.BeatPeriodToBPM(p)
+		if bpm <= 0 || (len(curve) > 0 && bpm == curve[len(curve)-1].BPM) {
+			continue
+		}
+		curve = append(curve, TempoPoint{Time: r.DFTimeToSeconds(int(float64(i) * step)), BPM: bpm})
+	}
+	if len(curve) > 0 {
+		curve[0].Time = 0
+	}
+	return curve
 }
 
 // BeatPeriodToBPM converts a beat period (in DF frames) to BPM.
@@ -250,14 +431,184 @@ func (r *QMResult) BeatPeriodToBPM(period int) float64 {
 	}
 	// period is in DF frame units
 	// seconds per beat = period * step_size / sample_rate
-	secondsPerBeat := float64(period*r.StepSizeFrames) / float64(r.SampleRate)
-	return 60.0 / secondsPerBeat
+	secondsPerBeat := FramesToSeconds(period*r.StepSizeFrames, float64(r.SampleRate))
+	if secondsPerBeat <= 0 {
+		return 0
+	}
+	return 60.0 / float64(secondsPerBeat)
+}
+
+// ModalBPM returns the most common tempo among per-window beat periods (in DF
+// frames, as in r.BeatPeriods), using r's step size and sample rate. Unlike
+// the tracker's single BPM, a sparse intro or breakdown with unstable periods
+// can't pull the mode away from the tempo of the rest of the track.
+//
+// Periods are histogrammed by frame with neighboring frames counting half, so
+// a tempo that falls between two integer periods isn't split in two, and the
+// result is the count-weighted mean of the winning period and its neighbors.
+// Returns 0 if there are no valid periods.
+func ModalBPM(periods []int, r *QMResult) float64 {
+	counts := make(map[int]int)
+	for _, p := range periods {
+		if p > 0 {
+			counts[p]++
+		}
+	}
+
+	best, bestScore := 0, 0.0
+	for p, n := range counts {
+		score := float64(n) + float64(counts[p-1]+counts[p+1])/2
+		if score > bestScore || (score == bestScore && p < best) {
+			best, bestScore = p, score
+		}
+	}
+	if best == 0 {
+		return 0
+	}
+
+	var sum, n float64
+	for p := best - 1; p <= best+1; p++ {
+		sum += float64(p * counts[p])
+		n += float64(counts[p])
+	}
+	secondsPerBeat := float64(FramesToSeconds(r.StepSizeFrames, float64(r.SampleRate))) * sum / n
+	if secondsPerBeat <= 0 {
+		return 0
+	}
+	return 60 / secondsPerBeat
+}
+
+// NormMode selects how NormalizedDetectionFunction rescales detection function values.
+type NormMode int
+
+const (
+	// NormPeak divides by the maximum value, mapping the DF into [0, 1].
+	NormPeak NormMode = iota
+	// NormZScore subtracts the mean and divides by the standard deviation.
+	NormZScore
+	// NormPercentile maps the 5th..95th percentile range onto [0, 1], clipping outliers.
+	NormPercentile
+)
+
+// NormalizedDetectionFunction returns a rescaled copy of the detection function
+// so DFs from different tracks can be overlaid on a comparable scale.
+// Returns nil if there is no detection function.
+func (r *QMResult) NormalizedDetectionFunction(mode NormMode) []float64 {
+	df := r.DetectionFunction
+	if len(df) == 0 {
+		return nil
+	}
+	out := make([]float64, len(df))
+
+	switch mode {
+	case NormZScore:
+		mean := 0.0
+		for _, v := range df {
+			mean += v
+		}
+		mean /= float64(len(df))
+
+		variance := 0.0
+		for _, v := range df {
+			variance += (v - mean) * (v - mean)
+		}
+		std := math.Sqrt(variance / float64(len(df)))
+		if std == 0 {
+			return out
+		}
+		for i, v := range df {
+			out[i] = (v - mean) / std
+		}
+
+	case NormPercentile:
+		sorted := append([]float64(nil), df...)
+		sort.Float64s(sorted)
+		lo := percentileSorted(sorted, 0.05)
+		hi := percentileSorted(sorted, 0.95)
+		if hi <= lo {
+			return out
+		}
+		for i, v := range df {
+			out[i] = math.Min(math.Max((v-lo)/(hi-lo), 0), 1)
+		}
+
+	default: // NormPeak
+		peak := 0.0
+		for _, v := range df {
+			peak = math.Max(peak, math.Abs(v))
+		}
+		if peak == 0 {
+			return out
+		}
+		for i, v := range df {
+			out[i] = v / peak
+		}
+	}
+
+	return out
+}
+
+// beatConfidence returns a 0-1 confidence for each beat. A beat's strength is
+// its spectral difference from the previous beat, which qm-dsp computes for
+// all but the first and last beats; those take their neighbor's value. Without
+// spectral differences (e.g. too few beats for downbeat detection), strength is
+// the detection function at the beat. Strengths are divided by the 95th
+// percentile and clipped, so a few loud hits don't make every other beat weak.
+func (r *QMResult) beatConfidence() []float64 {
+	n := len(r.Beats)
+	if n == 0 {
+		return nil
+	}
+	strength := make([]float64, n)
+	switch {
+	case len(r.BeatSpectralDiff) > 0:
+		// BeatSpectralDiff[j] is the difference between beats j and j+1
+		sd := r.BeatSpectralDiff
+		for i := range strength {
+			strength[i] = sd[min(max(i-1, 0), len(sd)-1)]
+		}
+	case len(r.DetectionFunction) > 0 && r.StepSizeFrames > 0:
+		for i, bt := range r.Beats {
+			frame := int(math.Round(bt * float64(r.SampleRate) / float64(r.StepSizeFrames)))
+			strength[i] = r.DetectionFunction[min(max(frame, 0), len(r.DetectionFunction)-1)]
+		}
+	}
+
+	conf := make([]float64, n)
+	sorted := append([]float64(nil), strength...)
+	sort.Float64s(sorted)
+	hi := percentileSorted(sorted, 0.95)
+	if !(hi > 0) {
+		return conf
+	}
+	for i, v := range strength {
+		if isFinite(v) {
+			conf[i] = math.Min(math.Max(v/hi, 0), 1)
+		}
+	}
+	return conf
+}
+
+// percentileSorted returns the p-th quantile (0..1) of sorted values using linear interpolation.
+func percentileSorted(sorted []float64, p float64) float64 {
+	pos := p * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(i)
+	return sorted[i]*(1-frac) + sorted[i+1]*frac
 }
 
 // QMAnalyzer provides streaming beat detection using the QM-DSP algorithm.
 type QMAnalyzer struct {
-	handle *C.QMAnalyzer
-	config QMConfig
+	handle     *C.QMAnalyzer
+	config     QMConfig
+	sampleRate int
+	channels   int
+
+	processedFrames int64
+	totalFrames     int64 // 0 if unknown
 }
 
 // NewQMAnalyzer creates a new streaming beat analyzer.
@@ -282,8 +633,10 @@ func NewQMAnalyzer(sampleRate, channels int, config *QMConfig) (*QMAnalyzer, err
 	}
 
 	return &QMAnalyzer{
-		handle: handle,
-		config: cfg,
+		handle:     handle,
+		config:     cfg,
+		sampleRate: sampleRate,
+		channels:   channels,
 	}, nil
 }
 
@@ -304,6 +657,7 @@ func (a *QMAnalyzer) Process(samples []float32) error {
 	if ret != 0 {
 		return fmt.Errorf("error processing samples: %d", ret)
 	}
+	a.reportProgress(len(samples))
 	return nil
 }
 
@@ -322,9 +676,18 @@ func (a *QMAnalyzer) ProcessFrames(samples []float32, numFrames int) error {
 	if ret != 0 {
 		return fmt.Errorf("error processing samples: %d", ret)
 	}
+	a.reportProgress(numFrames)
 	return nil
 }
 
+// reportProgress counts processed frames and calls the configured ProgressFunc.
+func (a *QMAnalyzer) reportProgress(frames int) {
+	a.processedFrames += int64(frames)
+	if a.config.ProgressFunc != nil {
+		a.config.ProgressFunc(a.processedFrames, a.totalFrames)
+	}
+}
+
 // DetectionFunctionCount returns the current number of detection function values.
 func (a *QMAnalyzer) DetectionFunctionCount() int {
 	if a.handle == nil {
@@ -333,6 +696,74 @@ func (a *QMAnalyzer) DetectionFunctionCount() int {
 	return int(C.analyzer_get_df_count(a.handle))
 }
 
+// qmSnapshot is the serialized state of a streaming QM analyzer. The detection
+// function's internal state isn't exposed by qm-dsp, so a snapshot holds the
+// mono audio fed so far, which restoring re-feeds to rebuild it.
+type qmSnapshot struct {
+	Version    int
+	SampleRate int
+	Channels   int
+	Config     QMConfig
+	Audio      []float32
+}
+
+// qmSnapshotVersion is bumped when the snapshot format changes.
+const qmSnapshotVersion = 1
+
+// Snapshot serializes the analyzer state so analysis of a long input can resume
+// in another process with RestoreQMAnalyzer. The snapshot grows with the audio
+// fed so far (4 bytes per frame).
+func (a *QMAnalyzer) Snapshot() ([]byte, error) {
+	if a.handle == nil {
+		return nil, errors.New("analyzer not initialized")
+	}
+
+	var samples *C.float
+	n := int(C.analyzer_get_audio(a.handle, &samples))
+	snap := qmSnapshot{
+		Version:    qmSnapshotVersion,
+		SampleRate: a.sampleRate,
+		Channels:   a.channels,
+		Config:     a.config,
+	}
+	if n > 0 {
+		snap.Audio = make([]float32, n)
+		copy(snap.Audio, unsafe.Slice((*float32)(unsafe.Pointer(samples)), n))
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&snap); err != nil {
+		return nil, fmt.Errorf("encode snapshot: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RestoreQMAnalyzer creates a streaming analyzer from a Snapshot, ready to
+// process further audio with the original sample rate and channel count.
+func RestoreQMAnalyzer(state []byte) (*QMAnalyzer, error) {
+	var snap qmSnapshot
+	if err := gob.NewDecoder(bytes.NewReader(state)).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	if snap.Version != qmSnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version: %d", snap.Version)
+	}
+
+	a, err := NewQMAnalyzer(snap.SampleRate, snap.Channels, &snap.Config)
+	if err != nil {
+		return nil, err
+	}
+	if len(snap.Audio) > 0 {
+		ret := C.analyzer_process_mono(a.handle, (*C.float)(&snap.Audio[0]), C.size_t(len(snap.Audio)))
+		if ret != 0 {
+			a.Close()
+			return nil, fmt.Errorf("error restoring samples: %d", ret)
+		}
+		a.processedFrames = int64(len(snap.Audio))
+	}
+	return a, nil
+}
+
 // Finalize completes analysis and returns results.
 // segConfig is optional - pass nil to skip segmentation.
 // After calling Finalize, the analyzer should be closed.
@@ -361,7 +792,7 @@ func (a *QMAnalyzer) Finalize(segConfig *SegmenterConfig) (*QMResult, error) {
 		BPM:            float64(cResult.bpm),
 		SampleRate:     int(cResult.sample_rate),
 		TotalFrames:    int64(cResult.total_frames),
-		Duration:       float64(cResult.duration),
+		Duration:       Seconds(cResult.duration),
 		StepSizeFrames: int(cResult.step_size_frames),
 		WindowSize:     int(cResult.window_size),
 	}
@@ -439,7 +870,7 @@ func (a *QMAnalyzer) Finalize(segConfig *SegmenterConfig) (*QMResult, error) {
 		cueSlice := unsafe.Slice(cResult.cue_points, numCues)
 		for i := 0; i < numCues; i++ {
 			result.Cues[i] = QMCue{
-				Time:       float64(cueSlice[i].time),
+				Time:       Seconds(cueSlice[i].time),
 				Type:       QMCueType(cueSlice[i]._type),
 				TypeIndex:  int(cueSlice[i].type_index),
 				Confidence: float64(cueSlice[i].confidence),
@@ -447,6 +878,13 @@ func (a *QMAnalyzer) Finalize(segConfig *SegmenterConfig) (*QMResult, error) {
 		}
 	}
 
+	result.BeatConfidence = result.beatConfidence()
+	result.BeatsPerBar = a.config.BeatsPerBar
+	if a.config.DetectMeter {
+		result.DetectMeter(a.config.BeatsPerBar)
+	}
+	result.ApplyDownbeatPrior(a.config.DownbeatPrior, a.config.BeatsPerBar)
+
 	return result, nil
 }
 
@@ -468,7 +906,17 @@ func AnalyzeFileQMConfig(filepath string, config *QMConfig) (*QMResult, error) {
 	return AnalyzeFileQMFull(filepath, config, nil)
 }
 
+// qmProgressCallback forwards file analysis progress from C to the
+// QMConfig.ProgressFunc whose handle userData points to.
+//
+//export qmProgressCallback
+func qmProgressCallback(processedFrames, totalFrames C.int64_t, userData unsafe.Pointer) {
+	fn := (*cgo.Handle)(userData).Value().(func(int64, int64))
+	fn(int64(processedFrames), int64(totalFrames))
+}
+
 // AnalyzeFileQMFull analyzes an audio file with full config including segmentation.
+// Progress is reported to config.ProgressFunc if set.
 func AnalyzeFileQMFull(filepath string, config *QMConfig, segConfig *SegmenterConfig) (*QMResult, error) {
 	cpath := C.CString(filepath)
 	defer C.free(unsafe.Pointer(cpath))
@@ -485,7 +933,15 @@ func AnalyzeFileQMFull(filepath string, config *QMConfig, segConfig *SegmenterCo
 		cSegCfg = &c
 	}
 
-	cResult := C.analyzer_analyze_file_ex(cpath, cCfg, cSegCfg)
+	var cResult *C.AnalyzerResultEx
+	if config != nil && config.ProgressFunc != nil {
+		h := cgo.NewHandle(config.ProgressFunc)
+		defer h.Delete()
+		cResult = C.analyzer_analyze_file_ex_progress(cpath, cCfg, cSegCfg,
+			C.AnalyzerProgressFunc(C.qmProgressCallback), unsafe.Pointer(&h))
+	} else {
+		cResult = C.analyzer_analyze_file_ex(cpath, cCfg, cSegCfg)
+	}
 	if cResult == nil {
 		return nil, errors.New("analyzer returned nil result")
 	}
@@ -499,7 +955,7 @@ func AnalyzeFileQMFull(filepath string, config *QMConfig, segConfig *SegmenterCo
 		BPM:            float64(cResult.bpm),
 		SampleRate:     int(cResult.sample_rate),
 		TotalFrames:    int64(cResult.total_frames),
-		Duration:       float64(cResult.duration),
+		Duration:       Seconds(cResult.duration),
 		StepSizeFrames: int(cResult.step_size_frames),
 		WindowSize:     int(cResult.window_size),
 	}
@@ -577,7 +1033,7 @@ func AnalyzeFileQMFull(filepath string, config *QMConfig, segConfig *SegmenterCo
 		cueSlice := unsafe.Slice(cResult.cue_points, numCues)
 		for i := 0; i < numCues; i++ {
 			result.Cues[i] = QMCue{
-				Time:       float64(cueSlice[i].time),
+				Time:       Seconds(cueSlice[i].time),
 				Type:       QMCueType(cueSlice[i]._type),
 				TypeIndex:  int(cueSlice[i].type_index),
 				Confidence: float64(cueSlice[i].confidence),
@@ -585,9 +1041,138 @@ func AnalyzeFileQMFull(filepath string, config *QMConfig, segConfig *SegmenterCo
 		}
 	}
 
+	result.BeatConfidence = result.beatConfidence()
+	result.BeatsPerBar = DefaultQMConfig().BeatsPerBar
+	if config != nil {
+		result.BeatsPerBar = config.BeatsPerBar
+		if config.DetectMeter {
+			result.DetectMeter(config.BeatsPerBar)
+		}
+		result.ApplyDownbeatPrior(config.DownbeatPrior, config.BeatsPerBar)
+	}
+
 	return result, nil
 }
 
+// AnalyzeSamplesQM analyzes already-decoded mono samples with the streaming
+// QM-DSP analyzer, avoiding a second decode of the file by libsndfile.
+func AnalyzeSamplesQM(samples []float32, sampleRate int, config *QMConfig, segConfig *SegmenterConfig) (*QMResult, error) {
+	return AnalyzeSamplesQMContext(context.Background(), samples, sampleRate, config, segConfig)
+}
+
+// qmProcessChunkFrames is how many frames AnalyzeSamplesQMContext feeds the
+// streaming analyzer between cancellation checks (about 1.5s at 44.1 kHz).
+const qmProcessChunkFrames = 1 << 16
+
+// AnalyzeSamplesQMContext is AnalyzeSamplesQM with cancellation: samples are
+// processed in chunks and ctx.Err() is returned if ctx is cancelled between them.
+// Within AnalyzeFileWithContext, each chunk also reports stage progress.
+func AnalyzeSamplesQMContext(ctx context.Context, samples []float32, sampleRate int, config *QMConfig, segConfig *SegmenterConfig) (*QMResult, error) {
+	a, err := NewQMAnalyzer(sampleRate, 1, config)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+	a.totalFrames = int64(len(samples))
+
+	// Progress is the share of the expected detection function values computed
+	progress := progressFrom(ctx)
+	expected := len(samples) / max(1, int(float32(sampleRate)*a.config.StepSecs))
+	for start := 0; start < len(samples); start += qmProcessChunkFrames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := a.Process(samples[start:min(start+qmProcessChunkFrames, len(samples))]); err != nil {
+			return nil, err
+		}
+		if expected > 0 {
+			progress.update(float64(a.DetectionFunctionCount()) / float64(expected))
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.Finalize(segConfig)
+}
+
+// Onsets picks onsets from the detection function of the audio processed so
+// far, without running the tempo tracker. Unlike beats, onsets aren't locked
+// to a tempo: every transient peak is an onset, which suits slicing and
+// transient detection. Times are in seconds, ascending.
+func (a *QMAnalyzer) Onsets() ([]float64, error) {
+	if a.handle == nil {
+		return nil, errors.New("analyzer not initialized")
+	}
+
+	cResult := C.analyzer_detect_onsets(a.handle, C.double(a.config.OnsetSensitivity))
+	if cResult == nil {
+		return nil, errors.New("onset detection returned nil")
+	}
+	defer C.analyzer_free_onset_result(cResult)
+
+	if cResult.error != nil {
+		return nil, errors.New(C.GoString(cResult.error))
+	}
+
+	n := int(cResult.num_onsets)
+	onsets := make([]float64, n)
+	if n > 0 {
+		onsetSlice := unsafe.Slice(cResult.onsets, n)
+		for i := 0; i < n; i++ {
+			onsets[i] = float64(onsetSlice[i])
+		}
+	}
+	return onsets, nil
+}
+
+// DetectOnsets detects the onsets of mono samples: stage-1 detection function
+// peak picking without the stage-2 tempo tracker. cfg selects the detection
+// function and OnsetSensitivity (nil for defaults). See QMAnalyzer.Onsets.
+func DetectOnsets(samples []float32, sampleRate int, cfg *QMConfig) ([]float64, error) {
+	a, err := NewQMAnalyzer(sampleRate, 1, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+
+	if err := a.Process(samples); err != nil {
+		return nil, err
+	}
+	return a.Onsets()
+}
+
+// qmKeyWindows detects the key of each window of mono samples with qm-dsp's
+// GetKeyMode. Keys are 1-12 for C..B major, 13-24 for C..B minor, and 0 where
+// no key was detected; strengths are each window's best key profile
+// correlation. step is the window spacing in seconds.
+func qmKeyWindows(samples []float32, sampleRate int) (keys []int, strengths []float64, step float64, err error) {
+	if len(samples) == 0 {
+		return nil, nil, 0, errors.New("no samples")
+	}
+	cResult := C.analyzer_analyze_key((*C.float)(&samples[0]), C.size_t(len(samples)), C.int(sampleRate))
+	if cResult == nil {
+		return nil, nil, 0, errors.New("key detection returned nil")
+	}
+	defer C.analyzer_free_key_result(cResult)
+
+	if cResult.error != nil {
+		return nil, nil, 0, errors.New(C.GoString(cResult.error))
+	}
+
+	n := int(cResult.num_windows)
+	keys = make([]int, n)
+	strengths = make([]float64, n)
+	if n > 0 {
+		keySlice := unsafe.Slice(cResult.keys, n)
+		strengthSlice := unsafe.Slice(cResult.strengths, n)
+		for i := 0; i < n; i++ {
+			keys[i] = int(keySlice[i])
+			strengths[i] = float64(strengthSlice[i])
+		}
+	}
+	return keys, strengths, float64(cResult.window_step), nil
+}
+
 // QMVersion returns the version of the QM-DSP analyzer library.
 func QMVersion() string {
 	return C.GoString(C.analyzer_version())
@@ -1,8 +1,13 @@
 package analysis
 
 import (
+	"cmp"
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -110,6 +115,151 @@ func TestQMAnalyzerStreaming(t *testing.T) {
 		result.BPM, len(result.Beats), len(result.DetectionFunction))
 }
 
+func TestQMAnalyzerSnapshot(t *testing.T) {
+	// 20 seconds of 120 BPM clicks at 44.1kHz
+	const sampleRate = 44100
+	samples := make([]float32, 20*sampleRate)
+	for start := 0; start < len(samples); start += sampleRate / 2 {
+		for j := start; j < start+200; j++ {
+			samples[j] = 0.9
+		}
+	}
+	cfg := DefaultQMConfig()
+	cfg.InputTempo = 126
+
+	analyze := func(split int) *QMResult {
+		a, err := NewQMAnalyzer(sampleRate, 1, &cfg)
+		if err != nil {
+			t.Fatalf("Failed to create analyzer: %v", err)
+		}
+		if err := a.Process(samples[:split]); err != nil {
+			t.Fatalf("Failed to process: %v", err)
+		}
+
+		// Simulate a restart: snapshot, discard the analyzer, restore
+		if split < len(samples) {
+			state, err := a.Snapshot()
+			if err != nil {
+				t.Fatalf("Snapshot failed: %v", err)
+			}
+			a.Close()
+			if a, err = RestoreQMAnalyzer(state); err != nil {
+				t.Fatalf("Restore failed: %v", err)
+			}
+			if a.config.InputTempo != cfg.InputTempo {
+				t.Errorf("Restored InputTempo = %v, want %v", a.config.InputTempo, cfg.InputTempo)
+			}
+			if err := a.Process(samples[split:]); err != nil {
+				t.Fatalf("Failed to process after restore: %v", err)
+			}
+		}
+		defer a.Close()
+
+		result, err := a.Finalize(nil)
+		if err != nil {
+			t.Fatalf("Finalize failed: %v", err)
+		}
+		return result
+	}
+
+	want := analyze(len(samples))
+	got := analyze(7*sampleRate + 123)
+
+	if got.BPM != want.BPM || got.Duration != want.Duration {
+		t.Errorf("Restored BPM %.3f duration %.3f, want %.3f %.3f", got.BPM, got.Duration, want.BPM, want.Duration)
+	}
+	if len(got.Beats) != len(want.Beats) {
+		t.Fatalf("Restored %d beats, want %d", len(got.Beats), len(want.Beats))
+	}
+	for i := range want.Beats {
+		if got.Beats[i] != want.Beats[i] {
+			t.Fatalf("Beat %d: got %v, want %v", i, got.Beats[i], want.Beats[i])
+		}
+	}
+	if len(got.DetectionFunction) != len(want.DetectionFunction) {
+		t.Errorf("Restored %d DF values, want %d", len(got.DetectionFunction), len(want.DetectionFunction))
+	}
+
+	if _, err := RestoreQMAnalyzer([]byte("not a snapshot")); err == nil {
+		t.Error("Expected error restoring an invalid snapshot")
+	}
+}
+
+func TestQMAnalyzerProgress(t *testing.T) {
+	// 5 seconds of 120 BPM clicks at 44.1kHz
+	const sampleRate = 44100
+	samples := make([]float32, 5*sampleRate)
+	for start := 0; start < len(samples); start += sampleRate / 2 {
+		for j := start; j < start+200; j++ {
+			samples[j] = 0.9
+		}
+	}
+
+	var calls [][2]int64
+	cfg := DefaultQMConfig()
+	cfg.ProgressFunc = func(processed, total int64) {
+		calls = append(calls, [2]int64{processed, total})
+	}
+	check := func(name string, wantTotal int64) {
+		t.Helper()
+		if len(calls) == 0 {
+			t.Fatalf("%s: no progress reported", name)
+		}
+		for i, c := range calls {
+			if i > 0 && c[0] <= calls[i-1][0] {
+				t.Errorf("%s: processed frames went from %d to %d", name, calls[i-1][0], c[0])
+			}
+			if c[1] != wantTotal {
+				t.Errorf("%s: total frames = %d, want %d", name, c[1], wantTotal)
+			}
+		}
+		if last := calls[len(calls)-1]; wantTotal > 0 && last[0] != wantTotal {
+			t.Errorf("%s: last progress %d of %d frames", name, last[0], wantTotal)
+		}
+		calls = nil
+	}
+
+	// Chunked sample analysis knows the total
+	if _, err := AnalyzeSamplesQM(samples, sampleRate, &cfg, nil); err != nil {
+		t.Fatalf("AnalyzeSamplesQM failed: %v", err)
+	}
+	check("samples", int64(len(samples)))
+
+	// Streaming doesn't
+	a, err := NewQMAnalyzer(sampleRate, 1, &cfg)
+	if err != nil {
+		t.Fatalf("Failed to create analyzer: %v", err)
+	}
+	defer a.Close()
+	for i := 0; i < len(samples); i += 4096 {
+		if err := a.Process(samples[i:min(i+4096, len(samples))]); err != nil {
+			t.Fatalf("Failed to process chunk: %v", err)
+		}
+	}
+	check("streaming", 0)
+
+	// File analysis reports from the C read loop, here a 16-bit mono WAV
+	data := make([]byte, 2*len(samples))
+	for i, v := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(int16(v*math.MaxInt16)))
+	}
+	header := []byte("RIFF\x00\x00\x00\x00WAVEfmt \x10\x00\x00\x00\x01\x00\x01\x00")
+	header = binary.LittleEndian.AppendUint32(header, sampleRate)
+	header = binary.LittleEndian.AppendUint32(header, 2*sampleRate)
+	header = append(header, "\x02\x00\x10\x00data"...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(data)))
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(header)-8+len(data)))
+	path := filepath.Join(t.TempDir(), "clicks.wav")
+	if err := os.WriteFile(path, append(header, data...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := AnalyzeFileQMConfig(path, &cfg)
+	if err != nil {
+		t.Fatalf("AnalyzeFileQMConfig failed: %v", err)
+	}
+	check("file", result.TotalFrames)
+}
+
 func TestQMAnalyzerConfig(t *testing.T) {
 	// Find a test audio file
 	musicDir := filepath.Join("..", "..", "music")
@@ -146,6 +296,39 @@ func TestQMAnalyzerConfig(t *testing.T) {
 	}
 }
 
+func TestDetectOnsets(t *testing.T) {
+	// Decaying noise bursts, like drum hits, at irregular times that no
+	// tempo fits
+	const sampleRate = 44100
+	hits := []float64{0.5, 0.8, 1.6, 1.9, 2.2, 3.4, 3.7, 4.5, 5.3, 5.5, 6.4, 7.1, 7.4, 8.3, 8.8, 9.5}
+	rng := rand.New(rand.NewPCG(1, 2))
+	samples := make([]float32, 10*sampleRate)
+	for _, hit := range hits {
+		start := int(hit * sampleRate)
+		for j := 0; j < sampleRate/10 && start+j < len(samples); j++ {
+			decay := math.Exp(-float64(j) / (0.02 * sampleRate))
+			samples[start+j] = float32(0.9 * decay * (2*rng.Float64() - 1))
+		}
+	}
+
+	onsets, err := DetectOnsets(samples, sampleRate, nil)
+	if err != nil {
+		t.Fatalf("DetectOnsets failed: %v", err)
+	}
+	if len(onsets) != len(hits) {
+		t.Fatalf("got %d onsets, want %d: %v", len(onsets), len(hits), onsets)
+	}
+	for i, hit := range hits {
+		if math.Abs(onsets[i]-hit) > 0.05 {
+			t.Errorf("onset %d at %.3fs, want %.3fs", i, onsets[i], hit)
+		}
+	}
+
+	if _, err := DetectOnsets(make([]float32, 100), sampleRate, nil); err == nil {
+		t.Error("expected an error for too little audio")
+	}
+}
+
 func TestQMVersion(t *testing.T) {
 	version := QMVersion()
 	if version == "" {
@@ -154,6 +337,327 @@ func TestQMVersion(t *testing.T) {
 	t.Logf("QM-DSP Analyzer version: %s", version)
 }
 
+func TestNormalizedDetectionFunction(t *testing.T) {
+	r := &QMResult{DetectionFunction: []float64{0, 2, 4, 6, 8, 10, 12, 14, 16, 18, 20}}
+
+	peak := r.NormalizedDetectionFunction(NormPeak)
+	if peak[10] != 1 || peak[5] != 0.5 || peak[0] != 0 {
+		t.Errorf("Peak normalization: got %v", peak)
+	}
+
+	z := r.NormalizedDetectionFunction(NormZScore)
+	if math.Abs(z[5]) > 1e-9 {
+		t.Errorf("Z-score of the mean should be 0, got %f", z[5])
+	}
+	// Population std of 0,2,...,20 is sqrt(40)
+	if want := 10 / math.Sqrt(40); math.Abs(z[10]-want) > 1e-9 {
+		t.Errorf("Z-score of max: expected %f, got %f", want, z[10])
+	}
+
+	// 5th percentile is 1, 95th is 19; values outside clip to [0, 1]
+	pct := r.NormalizedDetectionFunction(NormPercentile)
+	if pct[0] != 0 || pct[10] != 1 {
+		t.Errorf("Percentile normalization should clip ends: got %v", pct)
+	}
+	if math.Abs(pct[5]-0.5) > 1e-9 {
+		t.Errorf("Percentile normalization of median: expected 0.5, got %f", pct[5])
+	}
+
+	// Source slice is untouched
+	if r.DetectionFunction[10] != 20 {
+		t.Error("NormalizedDetectionFunction modified the raw DF")
+	}
+
+	flat := &QMResult{DetectionFunction: []float64{3, 3, 3}}
+	for _, mode := range []NormMode{NormPeak, NormZScore, NormPercentile} {
+		for _, v := range flat.NormalizedDetectionFunction(mode) {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				t.Errorf("Mode %d produced %f on a flat DF", mode, v)
+			}
+		}
+	}
+
+	if (&QMResult{}).NormalizedDetectionFunction(NormPeak) != nil {
+		t.Error("Expected nil for empty DF")
+	}
+}
+
+func TestBeatConfidence(t *testing.T) {
+	beats := []float64{0.5, 1, 1.5, 2, 2.5, 3}
+	tests := []struct {
+		name string
+		r    QMResult
+		want []float64
+	}{
+		{
+			name: "spectral difference",
+			// Differences between beats 0-1 .. 4-5; the first and last beats
+			// take their neighbors', and the weak beat 3 stands out
+			r:    QMResult{Beats: beats, BeatSpectralDiff: []float64{4, 4, 1, 4, 4}},
+			want: []float64{1, 1, 1, 0.25, 1, 1},
+		},
+		{
+			name: "detection function",
+			// 10 DF frames per second, strong at beats 0.5 and 2, NaN at beat 3
+			r: QMResult{
+				Beats:             beats,
+				SampleRate:        1000,
+				StepSizeFrames:    100,
+				DetectionFunction: []float64{0, 0, 0, 0, 0, 8, 0, 0, 0, 0, 2, 0, 0, 0, 0, 2, 0, 0, 0, 0, 8, 0, 0, 0, 0, 4, 0, 0, 0, 0, math.NaN()},
+			},
+			want: []float64{1, 0.25, 0.25, 1, 0.5, 0},
+		},
+		{
+			name: "no strength",
+			r:    QMResult{Beats: beats},
+			want: []float64{0, 0, 0, 0, 0, 0},
+		},
+		{
+			name: "no beats",
+			r:    QMResult{BeatSpectralDiff: []float64{1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.r.beatConfidence()
+			if len(got) != len(tt.r.Beats) {
+				t.Fatalf("got %d confidences for %d beats", len(got), len(tt.r.Beats))
+			}
+			for i := range tt.want {
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Errorf("beat %d: got %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestApplyDownbeatPrior(t *testing.T) {
+	// 32 beats where qm-dsp locked onto phase 2, two beats after the true
+	// bar-one on beats 1, 5, ...
+	newResult := func() *QMResult {
+		r := &QMResult{}
+		for i := range 32 {
+			r.Beats = append(r.Beats, 1.0+float64(i)*0.5)
+			if i%4 == 2 {
+				r.Downbeats = append(r.Downbeats, i)
+			}
+			if i == 0 {
+				continue
+			}
+			// As in qm-dsp, the difference going into beat i is at i-1
+			sd := 0.2
+			if i%4 == 1 {
+				sd = 0.9 // Spectral change at the true bar boundaries
+			}
+			r.BeatSpectralDiff = append(r.BeatSpectralDiff, sd)
+		}
+		return r
+	}
+
+	// Anchor on a known downbeat (beat 4 at 3.0s)
+	anchor := 3.02
+	r := newResult()
+	r.ApplyDownbeatPrior(&DownbeatPrior{BeatsPerBar: 4, Anchor: &anchor}, 0)
+	if len(r.Downbeats) != 8 || r.Downbeats[0] != 0 || r.Downbeats[1] != 4 {
+		t.Errorf("Anchored prior: expected downbeats 0, 4, ..., got %v", r.Downbeats)
+	}
+	if r.NumDownbeats != len(r.Downbeats) {
+		t.Errorf("NumDownbeats %d != %d", r.NumDownbeats, len(r.Downbeats))
+	}
+
+	// Without an anchor, the rigid bar follows the spectral difference
+	r = newResult()
+	r.ApplyDownbeatPrior(&DownbeatPrior{}, 4)
+	if r.Downbeats[0] != 1 || r.Downbeats[1] != 5 {
+		t.Errorf("Unanchored prior: expected downbeats 1, 5, ..., got %v", r.Downbeats)
+	}
+
+	// An anchor at 0s is still an anchor
+	anchor = 0
+	r = newResult()
+	r.ApplyDownbeatPrior(&DownbeatPrior{Anchor: &anchor}, 4)
+	if r.Downbeats[0] != 0 {
+		t.Errorf("Zero anchor: expected first downbeat 0, got %v", r.Downbeats)
+	}
+
+	// No prior leaves qm-dsp downbeats alone
+	r = newResult()
+	r.ApplyDownbeatPrior(nil, 4)
+	if r.Downbeats[0] != 2 {
+		t.Errorf("Nil prior changed downbeats: %v", r.Downbeats)
+	}
+}
+
+func TestDetectMeter(t *testing.T) {
+	// Spectral differences going into each beat repeating a bar accent
+	// pattern from beat 0, stored as qm-dsp does with the difference into
+	// beat j+1 at j (so beat 0's is dropped)
+	bars := func(pattern []float64, n int) *QMResult {
+		r := &QMResult{Downbeats: []int{0}}
+		for range n {
+			for _, v := range pattern {
+				r.Beats = append(r.Beats, float64(len(r.Beats))*0.5)
+				r.BeatSpectralDiff = append(r.BeatSpectralDiff, v)
+			}
+		}
+		r.BeatSpectralDiff = r.BeatSpectralDiff[1:]
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		r        *QMResult
+		fallback int
+		want     int
+	}{
+		{"waltz", bars([]float64{3, 1, 1}, 16), 4, 3},
+		{"4/4", bars([]float64{3, 1, 1, 1}, 16), 4, 4},
+		{"6/8 with a weaker mid-bar accent", bars([]float64{3, 1, 1, 2, 1, 1}, 8), 4, 6},
+		{"flat prefers fallback", bars([]float64{1}, 48), 4, 4},
+		{"too short keeps fallback", bars([]float64{3, 1, 1}, 3), 4, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.DetectMeter(tt.fallback); got != tt.want {
+				t.Fatalf("DetectMeter = %d, want %d", got, tt.want)
+			}
+			if tt.r.BeatsPerBar != 0 && tt.r.BeatsPerBar != tt.want {
+				t.Errorf("BeatsPerBar = %d, want %d", tt.r.BeatsPerBar, tt.want)
+			}
+		})
+	}
+
+	// Waltz downbeats fall every 3 beats on the accents and bars count in 3s
+	r := bars([]float64{3, 1, 1}, 16)
+	r.DetectMeter(4)
+	if len(r.Downbeats) != 16 {
+		t.Fatalf("got %d downbeats, want 16", len(r.Downbeats))
+	}
+	for i, idx := range r.Downbeats {
+		if idx != 3*i {
+			t.Fatalf("downbeat %d at beat %d, want %d", i, idx, 3*i)
+		}
+	}
+	if bars := r.Bars(); bars != 16 {
+		t.Errorf("Bars() = %v, want 16", bars)
+	}
+
+	// A 4/4 pickup: the accent is on beat 2, not one beat early on beat 1
+	r = bars([]float64{1, 1, 3, 1}, 16)
+	if got := r.DetectMeter(4); got != 4 {
+		t.Fatalf("DetectMeter = %d, want 4", got)
+	}
+	if r.Downbeats[0] != 2 || r.Downbeats[1] != 6 {
+		t.Errorf("expected downbeats 2, 6, ..., got %v", r.Downbeats)
+	}
+}
+
+func TestTempoCurve(t *testing.T) {
+	// Without a detection function, periods are 128 DF frames apart
+	r := &QMResult{SampleRate: 44100, StepSizeFrames: 512, BeatPeriods: []int{43, 43, 42, 42, 0, 41}}
+	curve := r.TempoCurve()
+	want := []TempoPoint{
+		{Time: 0, BPM: r.BeatPeriodToBPM(43)},
+		{Time: r.DFTimeToSeconds(2 * 128), BPM: r.BeatPeriodToBPM(42)},
+		{Time: r.DFTimeToSeconds(5 * 128), BPM: r.BeatPeriodToBPM(41)},
+	}
+	if len(curve) != len(want) {
+		t.Fatalf("got %d points, want %d: %v", len(curve), len(want), curve)
+	}
+	for i := range want {
+		if curve[i] != want[i] {
+			t.Errorf("point %d: got %+v, want %+v", i, curve[i], want[i])
+		}
+	}
+	if curve := (&QMResult{}).TempoCurve(); curve != nil {
+		t.Errorf("got %v without beat periods, want nil", curve)
+	}
+
+	// A click track ramping from 110 to 130 BPM over a minute
+	const sampleRate = 44100
+	ramp := func(sec float64) float64 { return 110 + 20*sec/60 }
+	samples := make([]float32, 60*sampleRate)
+	phase := 1.0
+	for i := range samples {
+		if phase >= 1 {
+			phase--
+			for j := i; j < min(i+200, len(samples)); j++ {
+				samples[j] = 0.9
+			}
+		}
+		phase += ramp(float64(i)/sampleRate) / 60 / sampleRate
+	}
+	r, err := AnalyzeSamplesQM(samples, sampleRate, nil, nil)
+	if err != nil {
+		t.Fatalf("AnalyzeSamplesQM failed: %v", err)
+	}
+	curve = r.TempoCurve()
+	if len(curve) < 2 {
+		t.Fatalf("got %d tempo points for a ramp", len(curve))
+	}
+	for sec := 10.0; sec <= 50; sec += 5 {
+		// The last point at or before sec
+		i, found := slices.BinarySearchFunc(curve, sec, func(p TempoPoint, sec float64) int {
+			return cmp.Compare(float64(p.Time), sec)
+		})
+		if !found {
+			i--
+		}
+		got := curve[max(i, 0)].BPM
+		if math.Abs(got-ramp(sec)) > 4 {
+			t.Errorf("at %gs: tempo %.1f BPM, want %.1f", sec, got, ramp(sec))
+		}
+	}
+}
+
+func TestModalBPM(t *testing.T) {
+	// 512-sample steps at 44100 Hz: a period of 43 frames is 120.19 BPM
+	r := &QMResult{SampleRate: 44100, StepSizeFrames: 512}
+	bpm := func(period float64) float64 { return 60 / (period * 512 / 44100) }
+
+	// A sparse breakdown at double period doesn't move the mode
+	var periods []int
+	for range 40 {
+		periods = append(periods, 43)
+	}
+	for range 15 {
+		periods = append(periods, 86)
+	}
+	if got := ModalBPM(periods, r); math.Abs(got-bpm(43)) > 1e-9 {
+		t.Errorf("ModalBPM = %f, want %f", got, bpm(43))
+	}
+
+	// A tempo between two periods is the weighted mean, not the larger bin
+	periods = []int{43, 43, 43, 44, 44, 44, 44, 100, 0, -1}
+	if got, want := ModalBPM(periods, r), bpm((3*43+4*44)/7.0); math.Abs(got-want) > 1e-9 {
+		t.Errorf("ModalBPM = %f, want %f", got, want)
+	}
+
+	if got := ModalBPM(nil, r); got != 0 {
+		t.Errorf("ModalBPM(nil) = %f, want 0", got)
+	}
+	if got := ModalBPM([]int{43}, &QMResult{}); got != 0 {
+		t.Errorf("ModalBPM without a sample rate = %f, want 0", got)
+	}
+
+	// On a constant-tempo click track the mode agrees with the tracker's BPM
+	const sampleRate = 44100
+	samples := make([]float32, 60*sampleRate)
+	for start := 0; start < len(samples); start += sampleRate / 2 {
+		for j := start; j < start+200; j++ {
+			samples[j] = 0.9
+		}
+	}
+	result, err := AnalyzeSamplesQM(samples, sampleRate, nil, nil)
+	if err != nil {
+		t.Fatalf("AnalyzeSamplesQM failed: %v", err)
+	}
+	if got := ModalBPM(result.BeatPeriods, result); math.Abs(got-result.BPM) > 1 {
+		t.Errorf("ModalBPM = %f, tracker BPM %f", got, result.BPM)
+	}
+}
+
 func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
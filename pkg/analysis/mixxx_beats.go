@@ -0,0 +1,115 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides export of grids in Mixxx's serialized beats format.
+package analysis
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Mixxx stores a track's beats in the library's beats column as a protobuf
+// message, tagged with a version string in the beats_version column. The
+// messages are from Mixxx's src/proto/beats.proto (package mixxx.track.io):
+//
+//	message Beat     { optional int32 frame_position = 1;
+//	                   optional bool enabled = 2 [default = true];
+//	                   optional Source source = 3 [default = ANALYZER]; }
+//	message Bpm      { optional double bpm = 1;
+//	                   optional Source source = 2 [default = ANALYZER]; }
+//	message BeatGrid { optional Bpm bpm = 1; optional Beat first_beat = 2; }
+//	message BeatMap  { repeated Beat beat = 1; }
+//
+// Frame positions count sample frames (one per channel set) at the track's
+// native sample rate. Fields left at their defaults are omitted, as Mixxx's
+// own serializer does.
+const (
+	MixxxBeatGridVersion = "BeatGrid-2.0" // beats_version of a constant-tempo BeatGrid
+	MixxxBeatMapVersion  = "BeatMap-1.0"  // beats_version of an explicit BeatMap
+)
+
+// Protobuf wire types used by the beats messages.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+)
+
+// MixxxBeatsOptions controls ExportMixxxBeatGridWithOptions.
+type MixxxBeatsOptions struct {
+	// BeatMap writes every beat as an explicit BeatMap instead of a
+	// constant-tempo BeatGrid anchored on the first beat.
+	BeatMap bool
+
+	// Duration is the track length in seconds the grid is validated against
+	// (see ValidateGrid). Default: 0 (beats past the end aren't checked)
+	Duration float64
+
+	// Force exports a grid that fails ValidateGrid.
+	Force bool
+}
+
+// ExportMixxxBeatGrid serializes grid as a constant-tempo Mixxx BeatGrid
+// (see MixxxBeatGridVersion) with frame positions at sampleRate.
+func ExportMixxxBeatGrid(grid *GridAnalysis, sampleRate int) ([]byte, error) {
+	return ExportMixxxBeatGridWithOptions(grid, sampleRate, MixxxBeatsOptions{})
+}
+
+// ExportMixxxBeatGridWithOptions serializes grid as a Mixxx BeatGrid, its BPM
+// and first beat, or with opts.BeatMap as a BeatMap of every beat. sampleRate
+// must be the track's native rate (TrackAnalysis.SampleRate), not the rate an
+// analyzer resampled to, since Mixxx positions beats in decoded file frames.
+// A grid that fails ValidateGrid is an error unless opts.Force is set.
+func ExportMixxxBeatGridWithOptions(grid *GridAnalysis, sampleRate int, opts MixxxBeatsOptions) ([]byte, error) {
+	if grid == nil || grid.Error != "" || len(grid.Beats) == 0 {
+		return nil, fmt.Errorf("no beats to export")
+	}
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	if err := validateExportGrid(grid, opts.Duration, opts.Force); err != nil {
+		return nil, err
+	}
+
+	if opts.BeatMap {
+		var out []byte
+		for i, t := range grid.Beats {
+			beat, err := mixxxBeat(t, sampleRate)
+			if err != nil {
+				return nil, fmt.Errorf("beat %d: %w", i, err)
+			}
+			out = appendProtoBytes(out, 1, beat)
+		}
+		return out, nil
+	}
+
+	if !isFinite(grid.BPM) || grid.BPM <= 0 {
+		return nil, fmt.Errorf("invalid BPM: %g", grid.BPM)
+	}
+	first, err := mixxxBeat(grid.Beats[0], sampleRate)
+	if err != nil {
+		return nil, fmt.Errorf("first beat: %w", err)
+	}
+	bpm := binary.AppendUvarint(nil, 1<<3|protoFixed64)
+	bpm = binary.LittleEndian.AppendUint64(bpm, math.Float64bits(grid.BPM))
+
+	out := appendProtoBytes(nil, 1, bpm)
+	return appendProtoBytes(out, 2, first), nil
+}
+
+// mixxxBeat encodes a Beat message at t seconds.
+func mixxxBeat(t float64, sampleRate int) ([]byte, error) {
+	frame := math.Round(t * float64(sampleRate))
+	if !isFinite(frame) || frame < 0 || frame > math.MaxInt32 {
+		return nil, fmt.Errorf("position %gs out of range", t)
+	}
+	beat := binary.AppendUvarint(nil, 1<<3|protoVarint)
+	return binary.AppendUvarint(beat, uint64(frame)), nil
+}
+
+// appendProtoBytes appends a length-delimited protobuf field.
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|protoBytes)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,79 @@
+package analysis
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// protoFields parses a protobuf message into its fields by number. Varint
+// fields hold the value, fixed64 fields the raw bits, and bytes fields the
+// payload as a string.
+func protoFields(t *testing.T, b []byte) map[int][]any {
+	t.Helper()
+	fields := make(map[int][]any)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		require.Positive(t, n)
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case protoVarint:
+			v, n := binary.Uvarint(b)
+			require.Positive(t, n)
+			fields[field] = append(fields[field], v)
+			b = b[n:]
+		case protoFixed64:
+			fields[field] = append(fields[field], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case protoBytes:
+			l, n := binary.Uvarint(b)
+			require.Positive(t, n)
+			fields[field] = append(fields[field], string(b[n:n+int(l)]))
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func TestExportMixxxBeatGrid(t *testing.T) {
+	grid := &GridAnalysis{BPM: 128, Beats: []float64{0.5, 0.96875, 1.4375}, AnalysisSampleRate: 22050}
+
+	data, err := ExportMixxxBeatGrid(grid, 48000)
+	require.NoError(t, err)
+	msg := protoFields(t, data)
+	require.Len(t, msg[1], 1)
+	require.Len(t, msg[2], 1)
+	bpm := protoFields(t, []byte(msg[1][0].(string)))
+	assert.Equal(t, 128.0, math.Float64frombits(bpm[1][0].(uint64)))
+	first := protoFields(t, []byte(msg[2][0].(string)))
+	assert.Equal(t, []any{uint64(24000)}, first[1], "native-rate frames")
+
+	// A beat map lists every beat
+	data, err = ExportMixxxBeatGridWithOptions(grid, 44100, MixxxBeatsOptions{BeatMap: true})
+	require.NoError(t, err)
+	msg = protoFields(t, data)
+	var frames []uint64
+	for _, b := range msg[1] {
+		frames = append(frames, protoFields(t, []byte(b.(string)))[1][0].(uint64))
+	}
+	assert.Equal(t, []uint64{22050, 42722, 63394}, frames)
+
+	_, err = ExportMixxxBeatGrid(grid, 0)
+	assert.Error(t, err)
+	_, err = ExportMixxxBeatGrid(&GridAnalysis{BPM: 120}, 44100)
+	assert.Error(t, err)
+	_, err = ExportMixxxBeatGrid(&GridAnalysis{Beats: []float64{1}}, 44100)
+	assert.Error(t, err)
+
+	// A grid running past the end of the track is refused unless forced
+	_, err = ExportMixxxBeatGridWithOptions(grid, 44100, MixxxBeatsOptions{Duration: 1})
+	assert.ErrorContains(t, err, "past the end")
+	_, err = ExportMixxxBeatGridWithOptions(grid, 44100, MixxxBeatsOptions{Duration: 1, Force: true})
+	assert.NoError(t, err)
+}
@@ -3,8 +3,14 @@ package analysis
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	ort "github.com/yalue/onnxruntime_go"
 )
 
 // ModelStructure contains information about the beat detection model.
@@ -12,6 +18,81 @@ type ModelStructure struct {
 	STFTConfigs []STFTConfig `json:"stft_configs"`
 	InputShape  []int        `json:"input_shape"`
 	OutputShape []int        `json:"output_shape"`
+	Inputs      []TensorInfo `json:"inputs"`  // serving_default signature inputs
+	Outputs     []TensorInfo `json:"outputs"` // serving_default signature outputs
+}
+
+// TensorInfo describes a model input or output tensor.
+type TensorInfo struct {
+	Name     string  `json:"name"`
+	Shape    []int64 `json:"shape"` // -1 for dynamic dimensions
+	DataType string  `json:"dtype"`
+}
+
+// ModelIO lists the inputs and outputs of an ONNX model or TensorFlow SavedModel.
+type ModelIO struct {
+	Format  string       `json:"format"` // "onnx" or "savedmodel"
+	Inputs  []TensorInfo `json:"inputs"`
+	Outputs []TensorInfo `json:"outputs"`
+}
+
+// ModelInfo returns input/output names, shapes, and dtypes for a model.
+// Paths ending in .onnx are read with ONNX Runtime; anything else is treated
+// as a TensorFlow SavedModel directory and inspected with AnalyzeModel.
+func ModelInfo(path string) (*ModelIO, error) {
+	if strings.ToLower(filepath.Ext(path)) != ".onnx" {
+		ms, err := AnalyzeModel(path)
+		if err != nil {
+			return nil, err
+		}
+		return &ModelIO{Format: "savedmodel", Inputs: ms.Inputs, Outputs: ms.Outputs}, nil
+	}
+
+	if err := initONNXRuntime(); err != nil {
+		return nil, err
+	}
+	inputs, outputs, err := ort.GetInputOutputInfo(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model info: %w", err)
+	}
+
+	toTensorInfo := func(infos []ort.InputOutputInfo) []TensorInfo {
+		out := make([]TensorInfo, len(infos))
+		for i, info := range infos {
+			out[i] = TensorInfo{
+				Name:     info.Name,
+				Shape:    []int64(info.Dimensions),
+				DataType: info.DataType.String(),
+			}
+		}
+		return out
+	}
+
+	return &ModelIO{
+		Format:  "onnx",
+		Inputs:  toTensorInfo(inputs),
+		Outputs: toTensorInfo(outputs),
+	}, nil
+}
+
+// WriteTable prints the model inputs and outputs as aligned text tables.
+func (m *ModelIO) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Format: %s\n\n", m.Format)
+	for _, section := range []struct {
+		title   string
+		tensors []TensorInfo
+	}{
+		{"INPUT", m.Inputs},
+		{"OUTPUT", m.Outputs},
+	} {
+		fmt.Fprintf(tw, "%s\tSHAPE\tDTYPE\n", section.title)
+		for _, t := range section.tensors {
+			fmt.Fprintf(tw, "%s\t%v\t%s\n", t.Name, t.Shape, t.DataType)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
 }
 
 // STFTConfig describes one STFT layer's parameters.
@@ -54,10 +135,16 @@ infer = model.signatures['serving_default']
 test_audio = tf.random.normal([1, 441000])  # 10 seconds
 output = infer(fltp=test_audio)
 
+def tensor_info(name, spec):
+    shape = spec.shape.as_list() if spec.shape.rank is not None else []
+    return {'name': name, 'shape': [-1 if d is None else d for d in shape], 'dtype': spec.dtype.name}
+
 result = {
     'stft_configs': stft_configs,
     'input_shape': [1, 441000],
     'output_shapes': {k: list(v.shape) for k, v in output.items()},
+    'inputs': [tensor_info(k, v) for k, v in infer.structured_input_signature[1].items()],
+    'outputs': [tensor_info(k, v) for k, v in infer.structured_outputs.items()],
 }
 
 # Try to trace through and find intermediate shapes
@@ -80,26 +167,12 @@ print(json.dumps(result, indent=2))
 		return nil, fmt.Errorf("analysis failed: %w", err)
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(output, &result); err != nil {
+	var ms ModelStructure
+	if err := json.Unmarshal(output, &ms); err != nil {
 		return nil, fmt.Errorf("failed to parse output: %w", err)
 	}
 
-	// Extract STFT configs
-	ms := &ModelStructure{}
-	if configs, ok := result["stft_configs"].([]interface{}); ok {
-		for _, c := range configs {
-			cfg := c.(map[string]interface{})
-			ms.STFTConfigs = append(ms.STFTConfigs, STFTConfig{
-				FrameLength: int(cfg["frame_length"].(float64)),
-				FrameStep:   int(cfg["frame_step"].(float64)),
-				FFTLength:   int(cfg["fft_length"].(float64)),
-				NumBins:     int(cfg["num_bins"].(float64)),
-			})
-		}
-	}
-
-	return ms, nil
+	return &ms, nil
 }
 
 // ExportPostSTFTModel exports the model with STFT ops removed.
@@ -1,8 +1,10 @@
 package analysis
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -38,3 +40,32 @@ func TestExportPostSTFTModel(t *testing.T) {
 		t.Fatalf("ExportPostSTFTModel failed: %v", err)
 	}
 }
+
+func TestModelInfo(t *testing.T) {
+	modelsDir, err := findBeatThisModels()
+	if err != nil {
+		t.Skip("beat_this models not found")
+	}
+
+	info, err := ModelInfo(filepath.Join(modelsDir, "model_small.onnx"))
+	if err != nil {
+		t.Fatalf("ModelInfo failed: %v", err)
+	}
+
+	if info.Format != "onnx" {
+		t.Errorf("Expected onnx format, got %s", info.Format)
+	}
+	if len(info.Outputs) != 2 {
+		t.Fatalf("Expected 2 outputs (beat and downbeat logits), got %d", len(info.Outputs))
+	}
+
+	var buf bytes.Buffer
+	if err := info.WriteTable(&buf); err != nil {
+		t.Fatalf("WriteTable failed: %v", err)
+	}
+	for _, out := range info.Outputs {
+		if !strings.Contains(buf.String(), out.Name) {
+			t.Errorf("Expected output %q in table:\n%s", out.Name, buf.String())
+		}
+	}
+}
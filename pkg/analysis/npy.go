@@ -0,0 +1,74 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides NumPy .npy exports of beats and per-frame curves.
+package analysis
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// npyMagic starts every .npy file, followed by the format version (1.0).
+const npyMagic = "\x93NUMPY\x01\x00"
+
+// npyAlign is the alignment NumPy pads the header to, so data starts aligned.
+const npyAlign = 64
+
+// ExportNPY writes values as a 1-D float64 NumPy array, loadable with np.load.
+func ExportNPY(values []float64, path string) error {
+	header := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': (%d,), }", len(values))
+
+	// Pad with spaces and end with a newline so the data is aligned
+	prefix := len(npyMagic) + 2 // Magic, version, and header length
+	pad := npyAlign - (prefix+len(header)+1)%npyAlign
+	header += strings.Repeat(" ", pad%npyAlign) + "\n"
+
+	data := make([]byte, 0, prefix+len(header)+8*len(values))
+	data = append(data, npyMagic...)
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(header)))
+	data = append(data, header...)
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ExportGridNPY writes a grid's beat times to <base>.beats.npy and, when the
+// grid has them, its downbeat times to <base>.downbeats.npy and its QM-DSP
+// detection function to <base>.detection_function.npy. It returns the paths
+// written. Nothing is written if g fails ValidateGrid for a track of duration
+// seconds, unless force is set.
+func ExportGridNPY(g *GridAnalysis, duration float64, base string, force bool) ([]string, error) {
+	if err := validateExportGrid(g, duration, force); err != nil {
+		return nil, err
+	}
+
+	arrays := []struct {
+		name   string
+		values []float64
+	}{
+		{"beats", g.Beats},
+		{"downbeats", nil},
+		{"detection_function", g.DetectionFunction},
+	}
+	for _, i := range g.Downbeats {
+		if i >= 0 && i < len(g.Beats) {
+			arrays[1].values = append(arrays[1].values, g.Beats[i])
+		}
+	}
+
+	var paths []string
+	for _, a := range arrays {
+		if a.values == nil && a.name != "beats" {
+			continue
+		}
+		path := base + "." + a.name + ".npy"
+		if err := ExportNPY(a.values, path); err != nil {
+			return paths, fmt.Errorf("write %s: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
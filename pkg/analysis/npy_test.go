@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportNPY(t *testing.T) {
+	// readNPY parses a 1-D float64 .npy file as np.load would
+	readNPY := func(path string) (string, []float64) {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, npyMagic, string(data[:8]))
+		headerLen := int(binary.LittleEndian.Uint16(data[8:10]))
+		assert.Zero(t, (10+headerLen)%npyAlign, "data is aligned")
+		header := string(data[10 : 10+headerLen])
+
+		body := data[10+headerLen:]
+		require.Zero(t, len(body)%8)
+		values := make([]float64, len(body)/8)
+		for i := range values {
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(body[i*8:]))
+		}
+		return header, values
+	}
+
+	dir := t.TempDir()
+	beats := []float64{0.5, 1.0, 1.5, 2.0, 2.5, 3.0, 3.5, 4.0, 4.5}
+	path := filepath.Join(dir, "beats.npy")
+	require.NoError(t, ExportNPY(beats, path))
+	header, values := readNPY(path)
+	assert.Equal(t, "{'descr': '<f8', 'fortran_order': False, 'shape': (9,), }", strings.TrimRight(header, " \n"))
+	assert.Equal(t, byte('\n'), header[len(header)-1])
+	assert.Equal(t, beats, values)
+
+	path = filepath.Join(dir, "empty.npy")
+	require.NoError(t, ExportNPY(nil, path))
+	header, values = readNPY(path)
+	assert.Contains(t, header, "'shape': (0,)")
+	assert.Empty(t, values)
+
+	g := &GridAnalysis{BPM: 120, Beats: beats, Downbeats: []int{1, 5}, DetectionFunction: []float64{0, 0.25, 1}}
+	paths, err := ExportGridNPY(g, 5, filepath.Join(dir, "track"), false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "track.beats.npy"),
+		filepath.Join(dir, "track.downbeats.npy"),
+		filepath.Join(dir, "track.detection_function.npy"),
+	}, paths)
+	_, values = readNPY(paths[1])
+	assert.Equal(t, []float64{1.0, 3.0}, values)
+	_, values = readNPY(paths[2])
+	assert.Equal(t, g.DetectionFunction, values)
+
+	// Beats only, with nothing else to write
+	paths, err = ExportGridNPY(&GridAnalysis{BPM: 120, Beats: beats}, 5, filepath.Join(dir, "beats-only"), false)
+	require.NoError(t, err)
+	assert.Len(t, paths, 1)
+
+	// Beats past the end of the track are refused unless forced
+	paths, err = ExportGridNPY(g, 4, filepath.Join(dir, "short"), false)
+	assert.ErrorContains(t, err, "past the end")
+	assert.Empty(t, paths)
+	assert.NoFileExists(t, filepath.Join(dir, "short.beats.npy"))
+	paths, err = ExportGridNPY(g, 4, filepath.Join(dir, "short"), true)
+	require.NoError(t, err)
+	assert.Len(t, paths, 3)
+}
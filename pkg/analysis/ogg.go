@@ -0,0 +1,114 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides Ogg Vorbis decoding.
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// oggCodec identifies the codec of an Ogg stream from the first packet of its
+// first page, e.g. "vorbis" or "opus". Returns "" if unrecognized.
+func oggCodec(r io.Reader) (string, error) {
+	// Page header: "OggS", version, type, granule (8), serial (4), sequence
+	// (4), CRC (4), segment count, then the segment table and payload
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", fmt.Errorf("failed to read Ogg page: %w", err)
+	}
+	if string(header[:4]) != "OggS" {
+		return "", fmt.Errorf("missing OggS capture pattern")
+	}
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(r, segments); err != nil {
+		return "", fmt.Errorf("failed to read Ogg page: %w", err)
+	}
+	payload := make([]byte, 8)
+	n, _ := io.ReadFull(r, payload)
+	payload = payload[:n]
+
+	switch {
+	case bytes.HasPrefix(payload, []byte("\x01vorbis")):
+		return "vorbis", nil
+	case bytes.HasPrefix(payload, []byte("OpusHead")):
+		return "opus", nil
+	case bytes.HasPrefix(payload, []byte("\x7fFLAC")):
+		return "flac", nil
+	default:
+		return "", nil
+	}
+}
+
+// loadOGG loads an Ogg Vorbis file and returns float32 channel buffers at
+// the stream's native sample rate. Other codecs in an Ogg container, such as
+// Opus, are reported as errors rather than misdecoded.
+func loadOGG(path string, opts LoadAudioMonoOptions) ([][]float32, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	codec, err := oggCodec(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch codec {
+	case "vorbis":
+	case "":
+		return nil, 0, fmt.Errorf("unsupported Ogg codec: not a Vorbis stream")
+	default:
+		return nil, 0, fmt.Errorf("unsupported Ogg codec: stream is %s, not Vorbis", codec)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, fmt.Errorf("failed to rewind file: %w", err)
+	}
+
+	// Samples are interleaved float32 in [-1, 1]
+	var pcm []float32
+	var format *oggvorbis.Format
+	if opts.MaxDuration > 0 {
+		pcm, format, err = readOGGPrefix(f, opts.MaxDuration)
+	} else {
+		pcm, format, err = oggvorbis.ReadAll(f)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode Ogg Vorbis: %w", err)
+	}
+	if format.Channels <= 0 {
+		return nil, 0, fmt.Errorf("invalid Ogg Vorbis channel count: %d", format.Channels)
+	}
+
+	return deinterleave(pcm, format.Channels), format.SampleRate, nil
+}
+
+// readOGGPrefix decodes up to maxDuration of interleaved samples from an Ogg
+// Vorbis stream, leaving the rest undecoded.
+func readOGGPrefix(in io.Reader, maxDuration Seconds) ([]float32, *oggvorbis.Format, error) {
+	r, err := oggvorbis.NewReader(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	format := &oggvorbis.Format{SampleRate: r.SampleRate(), Channels: r.Channels(), Bitrate: r.Bitrate()}
+	limit := max(maxDuration.Frames(float64(r.SampleRate())), 1) * r.Channels()
+	buf := make([]float32, 4096*r.Channels())
+	var pcm []float32
+	for len(pcm) < limit {
+		n, err := r.Read(buf)
+		pcm = append(pcm, buf[:min(n, limit-len(pcm))]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if n == 0 {
+			return nil, nil, io.ErrNoProgress
+		}
+	}
+	return pcm, format, nil
+}
@@ -0,0 +1,38 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadOGGMono(t *testing.T) {
+	// One second of 44.1 kHz stereo Vorbis from the decoder's own test data
+	path := get(t, "https://raw.githubusercontent.com/jfreymuth/oggvorbis/v1.0.5/testdata/test.ogg")
+
+	samples, rate, err := LoadAudioMono(path)
+	require.NoError(t, err)
+	assert.Equal(t, 44100, rate)
+	assert.Len(t, samples, 44100)
+	for _, v := range samples {
+		require.LessOrEqual(t, v, float32(1))
+		require.GreaterOrEqual(t, v, float32(-1))
+	}
+}
+
+func TestLoadOGGMonoOpus(t *testing.T) {
+	// First page of an Ogg Opus stream: page header, one segment, OpusHead
+	head := []byte("OpusHead\x01\x02\x38\x01\x80\xbb\x00\x00\x00\x00\x00")
+	page := append([]byte("OggS\x00\x02"), make([]byte, 20)...)
+	page = append(page, 1, byte(len(head)))
+	page = append(page, head...)
+
+	path := filepath.Join(t.TempDir(), "voice.ogg")
+	require.NoError(t, os.WriteFile(path, page, 0644))
+
+	_, _, err := LoadAudioMono(path)
+	assert.ErrorContains(t, err, "stream is opus, not Vorbis")
+}
@@ -0,0 +1,118 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides OSC beat messages for driving visuals and lighting.
+package analysis
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"time"
+)
+
+// OSCConfig is where and how beat messages are sent.
+type OSCConfig struct {
+	Host            string `yaml:"host"`
+	Port            int    `yaml:"port"`
+	BeatAddress     string `yaml:"beat_address"`
+	DownbeatAddress string `yaml:"downbeat_address"`
+}
+
+// DefaultOSCConfig sends /beat and /downbeat to localhost:9000.
+func DefaultOSCConfig() OSCConfig {
+	return OSCConfig{
+		Host:            "127.0.0.1",
+		Port:            9000,
+		BeatAddress:     "/beat",
+		DownbeatAddress: "/downbeat",
+	}
+}
+
+// OSCSender sends a UDP OSC message with the current BPM as a float32
+// argument on each beat, and another on each downbeat.
+type OSCSender struct {
+	conn net.Conn
+	cfg  OSCConfig
+}
+
+// NewOSCSender creates a sender for cfg.
+func NewOSCSender(cfg OSCConfig) (*OSCSender, error) {
+	if cfg.BeatAddress == "" || cfg.BeatAddress[0] != '/' || cfg.DownbeatAddress == "" || cfg.DownbeatAddress[0] != '/' {
+		return nil, fmt.Errorf("OSC addresses must start with /: %q, %q", cfg.BeatAddress, cfg.DownbeatAddress)
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
+	if err != nil {
+		return nil, fmt.Errorf("dial OSC: %w", err)
+	}
+	return &OSCSender{conn: conn, cfg: cfg}, nil
+}
+
+// SendBeat sends a beat message, and a downbeat message too if downbeat is set.
+func (s *OSCSender) SendBeat(bpm float64, downbeat bool) error {
+	if _, err := s.conn.Write(encodeOSCMessage(s.cfg.BeatAddress, float32(bpm))); err != nil {
+		return fmt.Errorf("send OSC: %w", err)
+	}
+	if downbeat {
+		if _, err := s.conn.Write(encodeOSCMessage(s.cfg.DownbeatAddress, float32(bpm))); err != nil {
+			return fmt.Errorf("send OSC: %w", err)
+		}
+	}
+	return nil
+}
+
+// PlayGrid sends each of g's beats in real time, as if playback of the track
+// started at start, until the grid ends or ctx is done. Beats already past
+// when PlayGrid is called are skipped.
+func (s *OSCSender) PlayGrid(ctx context.Context, g *GridAnalysis, start time.Time) error {
+	downbeats := make(map[int]bool, len(g.Downbeats))
+	for _, i := range g.Downbeats {
+		downbeats[i] = true
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	for i, t := range g.Beats {
+		wait := time.Until(start.Add(time.Duration(t * float64(time.Second))))
+		if wait < 0 {
+			continue
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if err := s.SendBeat(g.BPM, downbeats[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the sender's socket.
+func (s *OSCSender) Close() error {
+	return s.conn.Close()
+}
+
+// encodeOSCMessage encodes an OSC 1.0 message with float32 arguments: the
+// address and ",f..." type tag as NUL-terminated strings padded to 4 bytes,
+// then each argument big-endian.
+func encodeOSCMessage(address string, args ...float32) []byte {
+	tags := ","
+	for range args {
+		tags += "f"
+	}
+
+	var b []byte
+	for _, s := range []string{address, tags} {
+		b = append(b, s...)
+		b = append(b, make([]byte, 4-len(s)%4)...) // At least one NUL
+	}
+	for _, v := range args {
+		b = binary.BigEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	return b
+}
@@ -0,0 +1,87 @@
+package analysis
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOSCSender(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	cfg := DefaultOSCConfig()
+	cfg.Port = listener.LocalAddr().(*net.UDPAddr).Port
+	cfg.BeatAddress = "/mixxxlab/beat"
+	s, err := NewOSCSender(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// receive parses the next OSC message as its address and float arguments
+	receive := func() (string, []float32) {
+		buf := make([]byte, 512)
+		require.NoError(t, listener.SetReadDeadline(time.Now().Add(2*time.Second)))
+		n, _, err := listener.ReadFrom(buf)
+		require.NoError(t, err)
+		require.Zero(t, n%4, "packets are 4-byte aligned")
+
+		// readString reads a NUL-terminated, 4-byte padded string
+		pos := 0
+		readString := func() string {
+			end := pos + strings.IndexByte(string(buf[pos:n]), 0)
+			s := string(buf[pos:end])
+			pos = end + 4 - (end-pos)%4
+			return s
+		}
+		address, tags := readString(), readString()
+		require.True(t, strings.HasPrefix(tags, ","))
+		var args []float32
+		for _, tag := range tags[1:] {
+			require.Equal(t, 'f', tag)
+			args = append(args, math.Float32frombits(binary.BigEndian.Uint32(buf[pos:])))
+			pos += 4
+		}
+		assert.Equal(t, n, pos)
+		return address, args
+	}
+
+	require.NoError(t, s.SendBeat(128, false))
+	address, args := receive()
+	assert.Equal(t, "/mixxxlab/beat", address)
+	assert.Equal(t, []float32{128}, args)
+
+	require.NoError(t, s.SendBeat(127.5, true))
+	address, _ = receive()
+	assert.Equal(t, "/mixxxlab/beat", address)
+	address, args = receive()
+	assert.Equal(t, "/downbeat", address)
+	assert.Equal(t, []float32{127.5}, args)
+
+	// A grid plays back in real time, skipping beats already past
+	g := &GridAnalysis{BPM: 120, Beats: []float64{-1, 0.02, 0.04, 0.06}, Downbeats: []int{0, 2}}
+	start := time.Now()
+	require.NoError(t, s.PlayGrid(context.Background(), g, start))
+	assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+	var got []string
+	for range 4 {
+		address, _ := receive()
+		got = append(got, address)
+	}
+	assert.Equal(t, []string{"/mixxxlab/beat", "/mixxxlab/beat", "/downbeat", "/mixxxlab/beat"}, got)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, s.PlayGrid(ctx, &GridAnalysis{Beats: []float64{10}}, time.Now()), context.Canceled)
+
+	cfg.DownbeatAddress = "downbeat"
+	_, err = NewOSCSender(cfg)
+	assert.Error(t, err)
+}
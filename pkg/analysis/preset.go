@@ -0,0 +1,72 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides analysis presets trading accuracy for speed.
+package analysis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AnalysisPreset names a bundle of analyzer settings, so users can pick a
+// speed/accuracy trade-off without tuning individual options.
+type AnalysisPreset string
+
+const (
+	// PresetFast runs basic qm-dsp at a coarser step and the small beat_this model.
+	PresetFast AnalysisPreset = "fast"
+	// PresetBalanced runs every default analyzer with default settings.
+	PresetBalanced AnalysisPreset = "balanced"
+	// PresetAccurate runs the full beat_this model, both Rekordbox models, and
+	// qm-dsp on the Demucs drum stem as well as the full mix.
+	PresetAccurate AnalysisPreset = "accurate"
+)
+
+// Presets lists the analysis presets from fastest to most accurate.
+var Presets = []AnalysisPreset{PresetFast, PresetBalanced, PresetAccurate}
+
+// fastStepSecs doubles the default qm-dsp step, halving the detection
+// function frames, as analyzing decimated audio would.
+const fastStepSecs = 0.02322
+
+// ParseAnalysisPreset parses a preset name (e.g. "fast").
+func ParseAnalysisPreset(s string) (AnalysisPreset, error) {
+	p := AnalysisPreset(strings.ToLower(s))
+	for _, known := range Presets {
+		if p == known {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown preset %q: want fast, balanced, or accurate", s)
+}
+
+// Apply sets the analyzer selection and QM-DSP settings of cfg to the preset's.
+// Other settings, such as output options, are left unchanged.
+func (p AnalysisPreset) Apply(cfg *Config) error {
+	cfg.QM = DefaultQMConfig()
+	switch p {
+	case PresetFast:
+		cfg.Analyzers = []AnalyzerType{AnalyzerMixx, AnalyzerBeatThis}
+		cfg.QM.StepSecs = fastStepSecs
+	case PresetBalanced:
+		cfg.Analyzers = nil
+	case PresetAccurate:
+		cfg.Analyzers = []AnalyzerType{
+			AnalyzerMixxExtended, AnalyzerRekordboxPy, AnalyzerRekordboxGo,
+			AnalyzerBeatThisFull, AnalyzerMixxDrums,
+		}
+	default:
+		return fmt.Errorf("unknown preset %q: want fast, balanced, or accurate", p)
+	}
+	cfg.Preset = p
+	return nil
+}
+
+// UnmarshalText decodes a preset by name.
+func (p *AnalysisPreset) UnmarshalText(b []byte) error {
+	v, err := ParseAnalysisPreset(string(b))
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
@@ -0,0 +1,64 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalysisPresetConfig(t *testing.T) {
+	for _, p := range Presets {
+		cfg := DefaultConfig()
+		require.NoError(t, p.Apply(cfg))
+		assert.NoError(t, cfg.Validate(), p)
+		assert.Equal(t, p, cfg.Preset)
+	}
+
+	_, err := ParseAnalysisPreset("ludicrous")
+	assert.Error(t, err)
+	p, err := ParseAnalysisPreset("Accurate")
+	require.NoError(t, err)
+	assert.Equal(t, PresetAccurate, p)
+
+	// Settings in the file override the preset it names
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	require.NoError(t, os.WriteFile(path, []byte(`preset: fast
+analyzers: [mixx-extended]
+`), 0644))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, PresetFast, cfg.Preset)
+	assert.Equal(t, []AnalyzerType{AnalyzerMixxExtended}, cfg.Analyzers)
+	assert.Equal(t, float32(fastStepSecs), cfg.QM.StepSecs)
+}
+
+func TestAnalysisPresets(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "music", "*", "*.mp3"))
+	if err != nil || len(files) == 0 {
+		t.Skip("No test audio files found")
+	}
+
+	elapsed := map[AnalysisPreset]time.Duration{}
+	for _, p := range Presets {
+		cfg := DefaultConfig()
+		require.NoError(t, p.Apply(cfg))
+		a, err := NewWithConfig(cfg)
+		require.NoError(t, err)
+
+		start := time.Now()
+		ta, err := a.AnalyzeFileWithPath(files[0])
+		elapsed[p] = time.Since(start)
+		require.NoError(t, a.Close())
+		require.NoError(t, err, p)
+
+		g := ta.DefaultGrid(nil)
+		require.NotNil(t, g, p)
+		assert.Positive(t, g.BPM, p)
+		t.Logf("%s: %.1f BPM in %s", p, g.BPM, elapsed[p])
+	}
+	assert.GreaterOrEqual(t, elapsed[PresetAccurate], elapsed[PresetFast])
+}
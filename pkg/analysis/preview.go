@@ -0,0 +1,63 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides a fast, approximate BPM preview for instant UI feedback.
+package analysis
+
+import (
+	"fmt"
+)
+
+// Preview analysis window and decimation, trading accuracy for speed.
+const (
+	previewSeconds    = 30 // Analyze only the start of the track
+	previewDecimation = 2  // 44.1kHz -> 22.05kHz
+)
+
+// PreviewBPM returns an approximate BPM from qm-dsp on the first 30 seconds of
+// the track at half the sample rate. Only those seconds are decoded, so it
+// returns in well under a second even for a long mix, and a UI can show it
+// while the full analysis runs; expect it to differ by a few BPM.
+func PreviewBPM(path string) (float64, error) {
+	samples, sampleRate, err := LoadAudioMonoWithOptions(path, LoadAudioMonoOptions{CompensateDelay: true, MaxDuration: previewSeconds})
+	if err != nil {
+		return 0, fmt.Errorf("load audio: %w", err)
+	}
+	return previewBPM(samples, sampleRate)
+}
+
+// previewBPM runs the preview analysis on decoded mono samples.
+func previewBPM(samples []float32, sampleRate int) (float64, error) {
+	if sampleRate <= 0 {
+		return 0, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	if n := previewSeconds * sampleRate; len(samples) > n {
+		samples = samples[:n]
+	}
+	samples, sampleRate = decimate(samples, sampleRate, previewDecimation)
+
+	r, err := AnalyzeSamplesQM(samples, sampleRate, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	if !isFinite(r.BPM) {
+		return 0, fmt.Errorf("preview produced non-finite BPM")
+	}
+	return r.BPM, nil
+}
+
+// decimate reduces the sample rate by an integer factor, averaging each group
+// of factor samples as a simple anti-aliasing filter. Rates that would drop
+// below 11025 Hz are returned unchanged.
+func decimate(samples []float32, sampleRate, factor int) ([]float32, int) {
+	if factor <= 1 || sampleRate/factor < 11025 {
+		return samples, sampleRate
+	}
+	out := make([]float32, len(samples)/factor)
+	for i := range out {
+		var sum float32
+		for _, s := range samples[i*factor : (i+1)*factor] {
+			sum += s
+		}
+		out[i] = sum / float32(factor)
+	}
+	return out, sampleRate / factor
+}
@@ -0,0 +1,52 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewBPM(t *testing.T) {
+	// 60 seconds of 120 BPM clicks; the preview only analyzes the first 30
+	const sampleRate = 44100
+	samples := make([]float32, 60*sampleRate)
+	for start := 0; start < len(samples); start += sampleRate / 2 {
+		for j := start; j < start+200; j++ {
+			samples[j] = 0.9
+		}
+	}
+
+	full, err := AnalyzeSamplesQM(samples, sampleRate, nil, nil)
+	require.NoError(t, err)
+
+	preview, err := previewBPM(samples, sampleRate)
+	require.NoError(t, err)
+	assert.InDelta(t, full.BPM, preview, 3)
+
+	_, err = previewBPM(samples, 0)
+	assert.Error(t, err)
+}
+
+func TestPreviewBPMFixture(t *testing.T) {
+	path := get(t, "https://archive.org/download/The_WIRED_CD_Rip_Sample_Mash_Share-2769/Beastie_Boys_-_01_-_Now_Get_Busy.mp3")
+
+	full, err := AnalyzeFileQM(path)
+	require.NoError(t, err)
+
+	preview, err := PreviewBPM(path)
+	require.NoError(t, err)
+	assert.InDelta(t, full.BPM, preview, 3)
+}
+
+func TestDecimate(t *testing.T) {
+	out, rate := decimate([]float32{1, 3, 5, 7, 9}, 44100, 2)
+	assert.Equal(t, []float32{2, 6}, out)
+	assert.Equal(t, 22050, rate)
+
+	// Too low a rate to decimate further
+	in := []float32{1, 2}
+	out, rate = decimate(in, 16000, 2)
+	assert.Equal(t, in, out)
+	assert.Equal(t, 16000, rate)
+}
@@ -0,0 +1,84 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides progress reporting for single-file analysis.
+package analysis
+
+import (
+	"context"
+)
+
+// ProgressDone is the Stage of the final Progress of an analysis.
+const ProgressDone = "done"
+
+// Progress is an update on a running AnalyzeFileWithContext.
+type Progress struct {
+	Stage   string  `json:"stage"`   // Running stage: an analyzer type, "audio", "cues", "structure", or ProgressDone
+	Percent float64 `json:"percent"` // Overall completion, 0-100
+}
+
+type (
+	progressFuncKey    struct{}
+	progressTrackerKey struct{}
+)
+
+// WithProgress returns a copy of ctx that makes AnalyzeFileWithContext call fn
+// as each stage starts, and as mixx-extended processes frames while that
+// stage runs. Stages are weighted equally. fn is called on the analyzing
+// goroutine, so it should return quickly.
+func WithProgress(ctx context.Context, fn func(Progress)) context.Context {
+	return context.WithValue(ctx, progressFuncKey{}, fn)
+}
+
+// progressTracker converts stage starts and in-stage fractions to overall
+// percentages for one analysis. A nil tracker reports nothing.
+type progressTracker struct {
+	fn     func(Progress)
+	stages int
+	done   int
+	stage  string
+}
+
+// startProgress returns ctx with a tracker for an analysis of stages stages,
+// or ctx and nil if ctx has no WithProgress callback.
+func startProgress(ctx context.Context, stages int) (context.Context, *progressTracker) {
+	fn, _ := ctx.Value(progressFuncKey{}).(func(Progress))
+	if fn == nil {
+		return ctx, nil
+	}
+	t := &progressTracker{fn: fn, stages: max(stages, 1)}
+	return context.WithValue(ctx, progressTrackerKey{}, t), t
+}
+
+// progressFrom returns the tracker of the analysis running with ctx, if any.
+func progressFrom(ctx context.Context) *progressTracker {
+	t, _ := ctx.Value(progressTrackerKey{}).(*progressTracker)
+	return t
+}
+
+// begin reports the start of stage, completing the previous stage.
+func (t *progressTracker) begin(stage string) {
+	if t == nil {
+		return
+	}
+	if t.stage != "" {
+		t.done++
+	}
+	t.stage = stage
+	t.update(0)
+}
+
+// update reports that fraction (0-1) of the current stage is complete.
+func (t *progressTracker) update(fraction float64) {
+	if t == nil {
+		return
+	}
+	percent := 100 * (float64(t.done) + min(max(fraction, 0), 1)) / float64(t.stages)
+	t.fn(Progress{Stage: t.stage, Percent: min(percent, 100)})
+}
+
+// finish reports that the analysis is complete.
+func (t *progressTracker) finish() {
+	if t == nil {
+		return
+	}
+	t.fn(Progress{Stage: ProgressDone, Percent: 100})
+}
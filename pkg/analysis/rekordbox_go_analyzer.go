@@ -19,6 +19,9 @@ type TFAnalyzer struct {
 	inputOp    string
 	outputOps  []string
 	sampleRate int
+
+	// BPMRange bounds the reported BPM. Default: DefaultBPMRange
+	BPMRange BPMRange
 }
 
 // rekordboxModelsPath is the path to rekordbox's bundled ML models.
@@ -74,9 +77,19 @@ func (a *TFAnalyzer) AnalyzeFile(audioPath string) (*MLAnalyzeOut, error) {
 
 // AnalyzeSamples analyzes audio samples using TensorFlow beat detection.
 func (a *TFAnalyzer) AnalyzeSamples(samples []float32, sampleRate int) (*MLAnalyzeOut, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+
+	// Only the samples are known here; AnalyzeFileWithContext checks the duration
+	warnings := SampleRateWarnings(len(samples), sampleRate, 0)
+	if w := resampleRatioWarning(sampleRate, a.sampleRate); w != "" {
+		warnings = append(warnings, w)
+	}
+
 	// Resample to 44100 Hz if needed
 	if sampleRate != a.sampleRate {
-		samples = resampleAudio(samples, sampleRate, a.sampleRate)
+		samples = resampleLinear(samples, sampleRate, a.sampleRate)
 		sampleRate = a.sampleRate
 	}
 
@@ -145,9 +158,9 @@ func (a *TFAnalyzer) AnalyzeSamples(samples []float32, sampleRate int) (*MLAnaly
 	beats := extractBeats(beatsRaw, hopSizeSeconds, 0.1)
 
 	// Calculate BPM from beat intervals
-	bpm := calculateBPMFromBeats(beats)
+	bpm := calculateBPMFromBeats(beats, a.BPMRange)
 
-	duration := float64(len(samples)) / float64(sampleRate)
+	duration := FramesToSeconds(len(samples), float64(sampleRate))
 	bars := float64(len(beats)) / 4.0
 
 	return &MLAnalyzeOut{
@@ -158,12 +171,19 @@ func (a *TFAnalyzer) AnalyzeSamples(samples []float32, sampleRate int) (*MLAnaly
 		TotalFrames: int64(len(samples)),
 		NumBeats:    len(beats),
 		Bars:        bars,
+		Warnings:    warnings,
 	}, nil
 }
 
 // extractBeats converts model output probabilities to beat timestamps.
 // Parameters match Python's scipy.signal.find_peaks behavior.
+// Non-finite probabilities are treated as zero.
 func extractBeats(probs []float32, hopSizeSeconds float64, threshold float32) []float64 {
+	if hopSizeSeconds <= 0 {
+		return nil
+	}
+	probs = finiteActivation(probs)
+
 	var beats []float64
 
 	minDistance := 40 // 40 frames = 400ms at 10ms hop, allowing up to 150 BPM
@@ -201,7 +221,7 @@ func extractBeats(probs []float32, hopSizeSeconds float64, threshold float32) []
 
 		// Check minimum distance from previous beat
 		if len(beats) > 0 {
-			lastBeatFrame := int(beats[len(beats)-1] / hopSizeSeconds)
+			lastBeatFrame := Seconds(beats[len(beats)-1]).Frames(1 / hopSizeSeconds)
 			if i-lastBeatFrame < minDistance {
 				continue
 			}
@@ -220,8 +240,8 @@ func max(a, b float32) float32 {
 	return b
 }
 
-// calculateBPMFromBeats estimates BPM from beat timestamps.
-func calculateBPMFromBeats(beats []float64) float64 {
+// calculateBPMFromBeats estimates BPM from beat timestamps, normalized into bpmRange.
+func calculateBPMFromBeats(beats []float64, bpmRange BPMRange) float64 {
 	if len(beats) < 2 {
 		return 0
 	}
@@ -241,31 +261,32 @@ func calculateBPMFromBeats(beats []float64) float64 {
 
 	// Calculate median interval
 	median := medianFloat64(intervals)
+	if median <= 0 {
+		return 0
+	}
 
 	// Convert to BPM
 	bpm := 60.0 / median
 
-	// Normalize to reasonable BPM range (60-180)
-	for bpm < 60 {
-		bpm *= 2
-	}
-	for bpm > 180 {
-		bpm /= 2
-	}
+	// Normalize to the BPM range (60-180 by default)
+	bpm = bpmRange.Normalize(bpm)
 
 	return math.Round(bpm*100) / 100
 }
 
-// medianFloat64 returns the median of a slice of float64 values.
+// medianFloat64 returns the median of the finite values in a slice of float64 values.
 func medianFloat64(values []float64) float64 {
-	if len(values) == 0 {
+	// Make a copy to avoid modifying the original, skipping NaN and ±Inf
+	sorted := make([]float64, 0, len(values))
+	for _, v := range values {
+		if isFinite(v) {
+			sorted = append(sorted, v)
+		}
+	}
+	if len(sorted) == 0 {
 		return 0
 	}
 
-	// Make a copy to avoid modifying the original
-	sorted := make([]float64, len(values))
-	copy(sorted, values)
-
 	// Simple bubble sort for small arrays
 	for i := 0; i < len(sorted); i++ {
 		for j := i + 1; j < len(sorted); j++ {
@@ -281,28 +302,3 @@ func medianFloat64(values []float64) float64 {
 	}
 	return sorted[mid]
 }
-
-// resampleAudio resamples audio from srcRate to dstRate using linear interpolation.
-func resampleAudio(samples []float32, srcRate, dstRate int) []float32 {
-	if srcRate == dstRate {
-		return samples
-	}
-
-	ratio := float64(srcRate) / float64(dstRate)
-	newLen := int(float64(len(samples)) / ratio)
-	result := make([]float32, newLen)
-
-	for i := 0; i < newLen; i++ {
-		srcIdx := float64(i) * ratio
-		srcIdxInt := int(srcIdx)
-		frac := float32(srcIdx - float64(srcIdxInt))
-
-		if srcIdxInt+1 < len(samples) {
-			result[i] = samples[srcIdxInt]*(1-frac) + samples[srcIdxInt+1]*frac
-		} else if srcIdxInt < len(samples) {
-			result[i] = samples[srcIdxInt]
-		}
-	}
-
-	return result
-}
@@ -7,7 +7,10 @@ package analysis
 import "fmt"
 
 // TFAnalyzer is a stub when TensorFlow is not available.
-type TFAnalyzer struct{}
+type TFAnalyzer struct {
+	// BPMRange bounds the reported BPM. Default: DefaultBPMRange
+	BPMRange BPMRange
+}
 
 // NewTFAnalyzer returns an error when TensorFlow is not available.
 func NewTFAnalyzer() (*TFAnalyzer, error) {
@@ -16,10 +16,11 @@ type MLAnalyzeOut struct {
 	BPM         float64   `json:"bpm"`
 	Beats       []float64 `json:"beats"`
 	SampleRate  int       `json:"sample_rate"`
-	Duration    float64   `json:"duration"`
+	Duration    Seconds   `json:"duration"`
 	TotalFrames int64     `json:"total_frames"`
 	NumBeats    int       `json:"num_beats"`
 	Bars        float64   `json:"bars"`
+	Warnings    []string  `json:"warnings,omitempty"`
 }
 
 // MLAnalyzer performs beat detection using TensorFlow models via Python.
@@ -29,6 +30,9 @@ type MLAnalyzer struct {
 	modelPath  string
 }
 
+// rekordboxSampleRate is the rate beat_detector.py resamples to before inference.
+const rekordboxSampleRate = 44100
+
 // rekordboxModelsPath is the path to rekordbox's bundled ML models.
 const rekordboxModelsPathML = "/Applications/rekordbox 7/rekordbox.app/Contents/Resources/models"
 
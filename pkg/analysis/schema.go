@@ -0,0 +1,76 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides versioning and migration of the JSON sidecar format.
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// CurrentSchemaVersion is the TrackAnalysis.SchemaVersion of sidecars written
+// by this version of the package. Bump it, and migrate the old shape in
+// ParseTrackAnalysis, when a change would break readers of older sidecars.
+//
+//   - 0: one flat grid with top-level bpm and beats, and no grids map
+//   - 1: a grid per analyzer in grids
+const CurrentSchemaVersion = 1
+
+// flatSidecar is the version 0 sidecar: the fields of a single grid on the
+// track itself.
+type flatSidecar struct {
+	BPM        float64   `json:"bpm"`
+	Beats      []float64 `json:"beats"`
+	Downbeats  []int     `json:"downbeats"`
+	SampleRate int       `json:"sample_rate"`
+	Error      string    `json:"error"`
+}
+
+// ParseTrackAnalysis decodes a JSON sidecar, migrating sidecars from older
+// schema versions to the current TrackAnalysis. Version 0 sidecars carry a
+// single qm-dsp grid at the top level, which becomes the mixx grid. Sidecars
+// from a newer, unknown schema version are an error.
+func ParseTrackAnalysis(r io.Reader) (*TrackAnalysis, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var ta TrackAnalysis
+	if err := json.Unmarshal(data, &ta); err != nil {
+		return nil, err
+	}
+	if ta.SchemaVersion > CurrentSchemaVersion {
+		return nil, fmt.Errorf("schema version %d is newer than the supported version %d", ta.SchemaVersion, CurrentSchemaVersion)
+	}
+
+	// Sidecars from before versioning but with a grids key are version 1
+	var probe struct {
+		Grids json.RawMessage `json:"grids"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	if ta.SchemaVersion == 0 && probe.Grids == nil {
+		var flat flatSidecar
+		if err := json.Unmarshal(data, &flat); err != nil {
+			return nil, err
+		}
+		if flat.Beats != nil || flat.BPM != 0 || flat.Error != "" {
+			ta.Grids = map[string]*GridAnalysis{
+				string(AnalyzerMixx): {
+					BPM:                flat.BPM,
+					Beats:              flat.Beats,
+					Downbeats:          flat.Downbeats,
+					Error:              flat.Error,
+					AnalysisSampleRate: flat.SampleRate,
+				},
+			}
+		}
+	}
+	if ta.Grids == nil {
+		ta.Grids = make(map[string]*GridAnalysis)
+	}
+	ta.SchemaVersion = CurrentSchemaVersion
+	return &ta, nil
+}
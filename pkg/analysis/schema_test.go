@@ -0,0 +1,63 @@
+package analysis
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrackAnalysis(t *testing.T) {
+	// A version 0 sidecar: one flat qm-dsp grid and no grids map
+	ta, err := ParseTrackAnalysis(strings.NewReader(`{
+  "file": "track.mp3",
+  "duration": 2.1,
+  "sample_rate": 44100,
+  "bpm": 120,
+  "beats": [0.1, 0.6, 1.1, 1.6],
+  "downbeats": [0],
+  "waveform": {"pixels_per_sec": 100, "peaks": [0.5], "troughs": [-0.5]}
+}`))
+	require.NoError(t, err)
+	assert.Equal(t, CurrentSchemaVersion, ta.SchemaVersion)
+	assert.Equal(t, "track.mp3", ta.File)
+	assert.Equal(t, Seconds(2.1), ta.Duration)
+	require.NotNil(t, ta.Waveform)
+	assert.Equal(t, 100, ta.Waveform.PixelsPerSec)
+	assert.Equal(t, map[string]*GridAnalysis{
+		string(AnalyzerMixx): {
+			BPM:                120,
+			Beats:              []float64{0.1, 0.6, 1.1, 1.6},
+			Downbeats:          []int{0},
+			AnalysisSampleRate: 44100,
+		},
+	}, ta.Grids)
+	g := ta.DefaultGrid(nil)
+	require.NotNil(t, g)
+	assert.Equal(t, 120.0, g.BPM)
+
+	// Unversioned sidecars with grids are already current
+	ta, err = ParseTrackAnalysis(strings.NewReader(`{"file": "a.mp3", "grids": {"beatthis": {"bpm": 128, "beats": [0.5]}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, CurrentSchemaVersion, ta.SchemaVersion)
+	assert.Equal(t, []string{string(AnalyzerBeatThis)}, slices.Collect(maps.Keys(ta.Grids)))
+
+	// Including ones written without any grids
+	ta, err = ParseTrackAnalysis(strings.NewReader(`{"file": "a.mp3", "grids": null}`))
+	require.NoError(t, err)
+	assert.Empty(t, ta.Grids)
+
+	// Current sidecars round trip
+	ta, err = ParseTrackAnalysis(strings.NewReader(`{"schema_version": 1, "file": "a.mp3", "grids": {}}`))
+	require.NoError(t, err)
+	assert.NotNil(t, ta.Grids)
+
+	// Newer versions and invalid JSON are errors
+	_, err = ParseTrackAnalysis(strings.NewReader(`{"schema_version": 2, "grids": {}}`))
+	assert.ErrorContains(t, err, "schema version 2")
+	_, err = ParseTrackAnalysis(strings.NewReader(`not json`))
+	assert.Error(t, err)
+}
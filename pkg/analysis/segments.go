@@ -0,0 +1,77 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides structural segment conversion and per-type coloring.
+package analysis
+
+import (
+	"fmt"
+	"math"
+)
+
+// SegmentColors returns a hex color ("#rrggbb") for each segment, chosen by
+// segment type so identical types always share a color across tracks.
+// Hues are spaced evenly around the color wheel for numTypes types, with
+// alternating lightness so neighbouring types stay distinguishable when
+// numTypes is large. If numTypes <= 0 it is taken from the highest type seen.
+func SegmentColors(segments []Segment, numTypes int) []string {
+	if numTypes <= 0 {
+		for _, s := range segments {
+			numTypes = max(numTypes, s.Type+1)
+		}
+	}
+	numTypes = max(numTypes, 1)
+
+	colors := make([]string, len(segments))
+	for i, s := range segments {
+		t := ((s.Type % numTypes) + numTypes) % numTypes
+		hue := float64(t) * 360 / float64(numTypes)
+		lightness := 0.55
+		if t%2 == 1 {
+			lightness = 0.45
+		}
+		colors[i] = hslToHex(hue, 0.7, lightness)
+	}
+	return colors
+}
+
+// hslToHex converts a color in HSL space (hue in degrees, saturation and
+// lightness in [0, 1]) to a "#rrggbb" string.
+func hslToHex(h, s, l float64) string {
+	c := (1 - math.Abs(2*l-1)) * s
+	hp := math.Mod(h, 360) / 60
+	x := c * (1 - math.Abs(math.Mod(hp, 2)-1))
+
+	var r, g, b float64
+	switch {
+	case hp < 1:
+		r, g = c, x
+	case hp < 2:
+		r, g = x, c
+	case hp < 3:
+		g, b = c, x
+	case hp < 4:
+		g, b = x, c
+	case hp < 5:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+
+	m := l - c/2
+	to8 := func(v float64) int { return int(math.Round((v + m) * 255)) }
+	return fmt.Sprintf("#%02x%02x%02x", to8(r), to8(g), to8(b))
+}
+
+// qmSegments converts structural segments from QM analysis into colored segments.
+func qmSegments(r *QMResult, numTypes int) []Segment {
+	if len(r.Segments) == 0 {
+		return nil
+	}
+	segments := make([]Segment, len(r.Segments))
+	for i, s := range r.Segments {
+		segments[i] = Segment{Start: s.Start, End: s.End, Type: s.Type}
+	}
+	for i, color := range SegmentColors(segments, numTypes) {
+		segments[i].Color = color
+	}
+	return segments
+}
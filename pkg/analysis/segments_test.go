@@ -0,0 +1,49 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentColors(t *testing.T) {
+	segments := []Segment{
+		{Start: 0, End: 10, Type: 0},
+		{Start: 10, End: 20, Type: 1},
+		{Start: 20, End: 30, Type: 0},
+		{Start: 30, End: 40, Type: 2},
+		{Start: 40, End: 50, Type: 1},
+	}
+
+	colors := SegmentColors(segments, 10)
+	require.Len(t, colors, len(segments))
+	for _, c := range colors {
+		assert.Regexp(t, `^#[0-9a-f]{6}$`, c)
+	}
+
+	// Identical types share a color, distinct types differ
+	assert.Equal(t, colors[0], colors[2])
+	assert.Equal(t, colors[1], colors[4])
+	assert.NotEqual(t, colors[0], colors[1])
+	assert.NotEqual(t, colors[0], colors[3])
+	assert.NotEqual(t, colors[1], colors[3])
+
+	// Colors depend only on type, not on position in the track
+	assert.Equal(t, colors[3], SegmentColors([]Segment{{Type: 2}}, 10)[0])
+
+	// All types in range get distinct colors
+	all := make([]Segment, 10)
+	for i := range all {
+		all[i].Type = i
+	}
+	seen := map[string]bool{}
+	for _, c := range SegmentColors(all, 10) {
+		seen[c] = true
+	}
+	assert.Len(t, seen, 10)
+
+	// numTypes falls back to the highest type seen
+	assert.Len(t, SegmentColors(segments, 0), len(segments))
+	assert.Equal(t, "#d94a26", hslToHex(12, 0.7, 0.5))
+}
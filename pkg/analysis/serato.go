@@ -0,0 +1,178 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides Serato DJ cue and loop export as a Serato Markers2 tag.
+package analysis
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Serato Markers2 is stored in an ID3 GEOB frame with MIME type
+// "application/octet-stream", an empty filename, and the description
+// "Serato Markers2". The frame's object data is:
+//
+//	0x01 0x01                 version
+//	base64 payload            standard alphabet without '=' padding,
+//	                          a '\n' after every 72 characters
+//	0x00 ...                  NUL padding to at least 470 bytes
+//
+// The decoded payload is the version 0x01 0x01 followed by entries, then a
+// terminating 0x00. Each entry is a NUL-terminated ASCII type name, a
+// big-endian uint32 length, and that many bytes of data. Positions are
+// big-endian uint32 milliseconds.
+//
+//	COLOR    0x00, track color R G B
+//	CUE      0x00, index, position, 0x00, color R G B, 0x00 0x00,
+//	         NUL-terminated UTF-8 name
+//	LOOP     0x00, index, start, end, 0xFF 0xFF 0xFF 0xFF,
+//	         0x00 0x27 0xAA 0xE1 (loop color), 0x00, locked,
+//	         NUL-terminated UTF-8 name
+//	BPMLOCK  locked
+const (
+	seratoMarkersVersion = "\x01\x01"
+	seratoLineLength     = 72  // Base64 characters per line
+	seratoMinSize        = 470 // Serato pads the frame data to at least this size
+	seratoSlots          = 8   // Hot cue and loop slots
+)
+
+// seratoTrackColor is the COLOR entry Serato writes for an uncolored track,
+// and seratoLoopColor the fixed ARGB color of saved loops.
+var (
+	seratoTrackColor = []byte{0xFF, 0xFF, 0xFF}
+	seratoLoopColor  = []byte{0x00, 0x27, 0xAA, 0xE1}
+)
+
+// ExportSeratoMarkers encodes the markers of analysis as the object data of a
+// Serato Markers2 GEOB frame, ready to embed in an ID3 tag.
+//
+// Hot cue 1 anchors the beat grid: it is named "Grid" and sits on bar one of
+// the grid named gridKey (the default grid if gridKey is ""). The remaining
+// seven slots take the earliest cue points of the first marker analysis that
+// has any, named and colored by type with colors snapped to Serato's palette.
+// Phrases become saved loops spanning each section. A gridKey that isn't a
+// successful grid is an error, as is a grid that fails ValidateGrid unless
+// force is set.
+func ExportSeratoMarkers(analysis *TrackAnalysis, gridKey string, force bool) ([]byte, error) {
+	g := analysis.DefaultGrid(nil)
+	if gridKey != "" {
+		g = analysis.Grids[gridKey]
+	}
+	if g == nil || g.Error != "" || len(g.Beats) == 0 {
+		return nil, fmt.Errorf("no successful grid %q", gridKey)
+	}
+	if err := validateExportGrid(g, float64(analysis.Duration), force); err != nil {
+		return nil, err
+	}
+
+	var payload bytes.Buffer
+	payload.WriteString(seratoMarkersVersion)
+	writeSeratoEntry(&payload, "COLOR", append([]byte{0x00}, seratoTrackColor...))
+
+	// Hot cues: the grid anchor, then cue points by time
+	anchorColor, _ := SeratoCueColor(CueColor("downbeat"))
+	if err := writeSeratoCue(&payload, 0, seratoBarOne(g), anchorColor, "Grid"); err != nil {
+		return nil, err
+	}
+	cues := exportCuePoints(analysis)
+	for i, c := range cues[:min(len(cues), seratoSlots-1)] {
+		color := c.Color
+		if color == "" {
+			color = CueColor(c.Type)
+		}
+		color, err := SeratoCueColor(color)
+		if err != nil {
+			return nil, fmt.Errorf("cue %d: %w", i+1, err)
+		}
+		name := c.Name
+		if name == "" {
+			name = c.Type
+		}
+		if err := writeSeratoCue(&payload, i+1, float64(c.Time), color, name); err != nil {
+			return nil, err
+		}
+	}
+
+	// Saved loops: one per phrase
+	phrases := exportPhrases(analysis)
+	for i, p := range phrases[:min(len(phrases), seratoSlots)] {
+		var data bytes.Buffer
+		data.WriteByte(0x00)
+		data.WriteByte(byte(i))
+		data.Write(binary.BigEndian.AppendUint32(nil, seratoMillis(float64(p.Time))))
+		data.Write(binary.BigEndian.AppendUint32(nil, seratoMillis(float64(p.Time+p.Duration))))
+		data.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+		data.Write(seratoLoopColor)
+		data.WriteByte(0x00)
+		data.WriteByte(0x00) // Unlocked
+		data.WriteString(p.Label)
+		data.WriteByte(0x00)
+		writeSeratoEntry(&payload, "LOOP", data.Bytes())
+	}
+
+	writeSeratoEntry(&payload, "BPMLOCK", []byte{0x00})
+	payload.WriteByte(0x00)
+
+	// Frame data: version, then the payload as wrapped base64, NUL padded
+	encoded := base64.RawStdEncoding.EncodeToString(payload.Bytes())
+	out := []byte(seratoMarkersVersion)
+	for len(encoded) > seratoLineLength {
+		out = append(out, encoded[:seratoLineLength]...)
+		out = append(out, '\n')
+		encoded = encoded[seratoLineLength:]
+	}
+	out = append(out, encoded...)
+	out = append(out, 0x00)
+	for len(out) < seratoMinSize {
+		out = append(out, 0x00)
+	}
+	return out, nil
+}
+
+// writeSeratoEntry appends a Markers2 entry: NUL-terminated type, length, data.
+func writeSeratoEntry(buf *bytes.Buffer, kind string, data []byte) {
+	buf.WriteString(kind)
+	buf.WriteByte(0x00)
+	buf.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+	buf.Write(data)
+}
+
+// writeSeratoCue appends a CUE entry at t seconds with a "#rrggbb" color.
+func writeSeratoCue(buf *bytes.Buffer, index int, t float64, color, name string) error {
+	r, g, b, err := parseHexColor(color)
+	if err != nil {
+		return fmt.Errorf("cue %d: %w", index, err)
+	}
+	var data bytes.Buffer
+	data.WriteByte(0x00)
+	data.WriteByte(byte(index))
+	data.Write(binary.BigEndian.AppendUint32(nil, seratoMillis(t)))
+	data.WriteByte(0x00)
+	data.Write([]byte{r, g, b})
+	data.Write([]byte{0x00, 0x00})
+	data.WriteString(name)
+	data.WriteByte(0x00)
+	writeSeratoEntry(buf, "CUE", data.Bytes())
+	return nil
+}
+
+// seratoMillis converts seconds to Serato's millisecond positions, clamping
+// negative and non-finite times to 0.
+func seratoMillis(t float64) uint32 {
+	if !isFinite(t) || t <= 0 {
+		return 0
+	}
+	return uint32(math.Round(t * 1000))
+}
+
+// seratoBarOne returns the grid's bar one: its DownbeatOne if set, else its
+// first downbeat, else its first beat.
+func seratoBarOne(g *GridAnalysis) float64 {
+	if g.DownbeatOne > 0 {
+		return float64(g.DownbeatOne)
+	}
+	anchor, _ := computeGridAnchor(g)
+	return anchor
+}
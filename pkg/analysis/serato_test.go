@@ -0,0 +1,131 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seratoTestMarker is a decoded Serato Markers2 CUE or LOOP entry.
+type seratoTestMarker struct {
+	Kind  string
+	Index int
+	Start uint32 // Milliseconds
+	End   uint32 // Milliseconds, loops only
+	Color string // "#rrggbb", cues only
+	Name  string
+}
+
+// decodeSeratoMarkers parses Serato Markers2 GEOB frame data as Serato does.
+func decodeSeratoMarkers(t *testing.T, data []byte) []seratoTestMarker {
+	t.Helper()
+	require.Equal(t, seratoMarkersVersion, string(data[:2]))
+	encoded, _, ok := bytes.Cut(data[2:], []byte{0x00})
+	require.True(t, ok, "NUL terminated")
+	for _, line := range bytes.Split(encoded, []byte("\n")) {
+		require.LessOrEqual(t, len(line), seratoLineLength)
+	}
+	payload, err := base64.RawStdEncoding.DecodeString(string(bytes.ReplaceAll(encoded, []byte("\n"), nil)))
+	require.NoError(t, err)
+	require.Equal(t, seratoMarkersVersion, string(payload[:2]))
+
+	var markers []seratoTestMarker
+	p := payload[2:]
+	for len(p) > 0 && p[0] != 0x00 {
+		kind, rest, ok := bytes.Cut(p, []byte{0x00})
+		require.True(t, ok)
+		n := binary.BigEndian.Uint32(rest)
+		entry := rest[4 : 4+n]
+		p = rest[4+n:]
+
+		switch string(kind) {
+		case "CUE":
+			markers = append(markers, seratoTestMarker{
+				Kind:  "CUE",
+				Index: int(entry[1]),
+				Start: binary.BigEndian.Uint32(entry[2:]),
+				Color: fmt.Sprintf("#%02x%02x%02x", entry[7], entry[8], entry[9]),
+				Name:  string(bytes.TrimSuffix(entry[12:], []byte{0x00})),
+			})
+		case "LOOP":
+			assert.Equal(t, seratoLoopColor, entry[14:18])
+			markers = append(markers, seratoTestMarker{
+				Kind:  "LOOP",
+				Index: int(entry[1]),
+				Start: binary.BigEndian.Uint32(entry[2:]),
+				End:   binary.BigEndian.Uint32(entry[6:]),
+				Name:  string(bytes.TrimSuffix(entry[20:], []byte{0x00})),
+			})
+		}
+	}
+	require.Equal(t, []byte{0x00}, p, "payload terminator")
+	return markers
+}
+
+func TestExportSeratoMarkers(t *testing.T) {
+	ta := &TrackAnalysis{
+		Grids: map[string]*GridAnalysis{
+			string(AnalyzerMixx):     {BPM: 120, Beats: []float64{0.25, 0.75, 1.25, 1.75, 2.25}, Downbeats: []int{1}},
+			string(AnalyzerBeatThis): {BPM: 120, Beats: []float64{0.3, 0.8}, DownbeatOne: 0.8},
+		},
+		Markers: map[string]*MarkerAnalysis{
+			"mixx": {CuePoints: []CuePoint{
+				{Time: 64.5, Type: "drop", Name: "Drop"},
+				{Time: 1.25, Type: "intro", Name: "Intro", Color: "#0040d0"},
+				{Time: 200, Type: "mystery"},
+			}},
+			"songformer": {Phrases: []Phrase{
+				{Time: 32, Label: "verse", Duration: 32},
+				{Time: 0.75, Label: "intro", Duration: 31.25},
+				{Time: 64, Label: "empty"},
+			}},
+		},
+	}
+
+	data, err := ExportSeratoMarkers(ta, string(AnalyzerMixx), false)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, len(data), seratoMinSize)
+	assert.Equal(t, []seratoTestMarker{
+		{Kind: "CUE", Index: 0, Start: 750, Color: "#00cccc", Name: "Grid"},
+		{Kind: "CUE", Index: 1, Start: 1250, Color: "#0044cc", Name: "Intro"},
+		{Kind: "CUE", Index: 2, Start: 64500, Color: "#cc0000", Name: "Drop"},
+		{Kind: "CUE", Index: 3, Start: 200000, Color: "#cccc00", Name: "mystery"},
+		{Kind: "LOOP", Index: 0, Start: 750, End: 32000, Name: "intro"},
+		{Kind: "LOOP", Index: 1, Start: 32000, End: 64000, Name: "verse"},
+	}, decodeSeratoMarkers(t, data))
+
+	// The grid anchor follows the selected grid's bar one
+	data, err = ExportSeratoMarkers(ta, string(AnalyzerBeatThis), false)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(800), decodeSeratoMarkers(t, data)[0].Start)
+
+	// Cues beyond Serato's eight slots are dropped
+	for i := range 10 {
+		ta.Markers["mixx"].CuePoints = append(ta.Markers["mixx"].CuePoints, CuePoint{Time: Seconds(100 + i), Type: "phrase"})
+	}
+	data, err = ExportSeratoMarkers(ta, "", false)
+	require.NoError(t, err)
+	var cues int
+	for _, m := range decodeSeratoMarkers(t, data) {
+		if m.Kind == "CUE" {
+			cues++
+		}
+	}
+	assert.Equal(t, seratoSlots, cues)
+
+	_, err = ExportSeratoMarkers(ta, "missing", true)
+	assert.Error(t, err)
+
+	// A grid running past the end of the track is refused unless forced
+	ta.Duration = 2
+	_, err = ExportSeratoMarkers(ta, string(AnalyzerMixx), false)
+	assert.ErrorContains(t, err, "past the end")
+	data, err = ExportSeratoMarkers(ta, string(AnalyzerMixx), true)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(750), decodeSeratoMarkers(t, data)[0].Start)
+}
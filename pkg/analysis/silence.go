@@ -0,0 +1,81 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides trimming of silent intros and outros before analysis.
+package analysis
+
+import "math"
+
+// DefaultSilenceThresholdDB is the RMS level in dBFS below which TrimSilence
+// treats audio as silent.
+const DefaultSilenceThresholdDB = -60.0
+
+// silenceWindowSecs is the length of the windows TrimSilence measures RMS over.
+const silenceWindowSecs = 0.05
+
+// TrimSilence trims the silent intro and outro of mono samples: the windows
+// of 50ms whose RMS level is below thresholdDB dBFS (0 uses
+// DefaultSilenceThresholdDB). It returns the samples in between, sharing
+// samples' backing array, and the seconds trimmed from each end. Add
+// leadingSec to times in the trimmed audio to map them back to the original.
+// Audio that is silent throughout is returned untrimmed.
+func TrimSilence(samples []float32, sampleRate int, thresholdDB float64) (trimmed []float32, leadingSec, trailingSec float64) {
+	if thresholdDB == 0 {
+		thresholdDB = DefaultSilenceThresholdDB
+	}
+	window := max(1, int(silenceWindowSecs*float64(sampleRate)))
+	threshold := math.Pow(10, thresholdDB/20)
+	loud := func(start int) bool {
+		end := min(start+window, len(samples))
+		var sum float64
+		for _, s := range samples[start:end] {
+			sum += float64(s) * float64(s)
+		}
+		return math.Sqrt(sum/float64(end-start)) >= threshold
+	}
+
+	start := 0
+	for start < len(samples) && !loud(start) {
+		start += window
+	}
+	if start >= len(samples) {
+		return samples, 0, 0
+	}
+	end := len(samples)
+	for last := (len(samples) - 1) / window * window; last > start && !loud(last); last -= window {
+		end = last
+	}
+
+	rate := float64(sampleRate)
+	return samples[start:end], float64(start) / rate, float64(len(samples)-end) / rate
+}
+
+// shiftGrid adds offset seconds to the times of grid, mapping a grid of
+// trimmed audio back to the original timeline. The detection function and
+// beat periods stay relative to the trimmed audio.
+func shiftGrid(grid *GridAnalysis, offset float64) {
+	if grid == nil || offset == 0 {
+		return
+	}
+	for i := range grid.Beats {
+		grid.Beats[i] += offset
+	}
+	for i := range grid.TempoCurve {
+		grid.TempoCurve[i].Time += Seconds(offset)
+	}
+}
+
+// shiftMarkers adds offset seconds to the times of m, like shiftGrid.
+func shiftMarkers(m *MarkerAnalysis, offset float64) {
+	if m == nil || offset == 0 {
+		return
+	}
+	for i := range m.CuePoints {
+		m.CuePoints[i].Time += Seconds(offset)
+	}
+	for i := range m.Phrases {
+		m.Phrases[i].Time += Seconds(offset)
+	}
+	for i := range m.Segments {
+		m.Segments[i].Start += offset
+		m.Segments[i].End += offset
+	}
+}
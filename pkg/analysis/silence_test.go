@@ -0,0 +1,58 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// paddedTone returns 2s of silence, 4s of a 440 Hz tone, and 1s of near
+// silence (-80 dBFS noise floor) at 44.1 kHz.
+func paddedTone() []float32 {
+	const sampleRate = 44100
+	samples := make([]float32, 7*sampleRate)
+	for i := range samples {
+		switch {
+		case i >= 2*sampleRate && i < 6*sampleRate:
+			samples[i] = float32(0.5 * math.Sin(2*math.Pi*440*float64(i)/sampleRate))
+		case i >= 6*sampleRate:
+			samples[i] = float32(1e-4 * math.Sin(float64(i)))
+		}
+	}
+	return samples
+}
+
+func TestTrimSilence(t *testing.T) {
+	samples := paddedTone()
+	trimmed, lead, trail := TrimSilence(samples, 44100, DefaultSilenceThresholdDB)
+	assert.InDelta(t, 2.0, lead, 1e-9)
+	assert.InDelta(t, 1.0, trail, 1e-9)
+	assert.Len(t, trimmed, 4*44100)
+
+	// A threshold above the noise floor's level keeps it
+	_, _, trail = TrimSilence(samples, 44100, -90)
+	assert.Zero(t, trail)
+
+	// Silence throughout is left alone
+	silent := make([]float32, 44100)
+	trimmed, lead, trail = TrimSilence(silent, 44100, 0)
+	assert.Len(t, trimmed, len(silent))
+	assert.Zero(t, lead)
+	assert.Zero(t, trail)
+}
+
+func TestAnalyzeLoadedTrimSilence(t *testing.T) {
+	a := &Analyzer{grids: []GridAnalyzer{&fakeGridAnalyzer{}}, trimSilence: true}
+	ta, err := a.AnalyzeLoaded(paddedTone(), 44100, []AnalyzerType{"fake"})
+	require.NoError(t, err)
+	assert.Equal(t, Seconds(7), ta.Duration)
+	assert.InDelta(t, 2.0, float64(ta.TrimmedLeading), 1e-9)
+	assert.InDelta(t, 1.0, float64(ta.TrimmedTrailing), 1e-9)
+
+	// The fake analyzer beats every 0.5s of the audio it's given: the 4s tone,
+	// mapped back to the original timeline
+	require.Contains(t, ta.Grids, "fake")
+	assert.InDeltaSlice(t, []float64{2, 2.5, 3, 3.5, 4, 4.5, 5, 5.5}, ta.Grids["fake"].Beats, 1e-9)
+}
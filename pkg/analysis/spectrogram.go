@@ -0,0 +1,158 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides spectrogram computation and tiled image rendering for zoomable views.
+package analysis
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Spectrogram analysis parameters and tile geometry.
+const (
+	spectrogramFFTSize  = 2048
+	spectrogramHopSize  = 512
+	spectrogramFloorDB  = -80.0 // Levels this far below the loudest bin render black
+	spectrogramMinHz    = 20.0  // Lowest frequency shown on the log-frequency axis
+	SpectrogramTileSize = 512   // Tile width in pixels
+	SpectrogramMaxZoom  = 12    // Deepest zoom level (2^12 tiles across the track)
+)
+
+// Spectrogram holds a magnitude spectrogram quantized to 8-bit levels, from
+// black at spectrogramFloorDB below the loudest bin up to 255 at the loudest.
+// Quantizing keeps a long track's STFT small enough to cache per track.
+type Spectrogram struct {
+	Levels     [][]uint8 // [frames][bins]
+	SampleRate int
+	HopSize    int
+	FFTSize    int
+	Duration   Seconds
+}
+
+// ComputeSpectrogram computes the spectrogram of mono samples.
+func ComputeSpectrogram(samples []float32, sampleRate int) *Spectrogram {
+	s := &Spectrogram{
+		SampleRate: sampleRate,
+		HopSize:    spectrogramHopSize,
+		FFTSize:    spectrogramFFTSize,
+		Duration:   FramesToSeconds(len(samples), float64(sampleRate)),
+	}
+	if sampleRate <= 0 || len(samples) == 0 {
+		return s
+	}
+
+	window := defaultSTFT.window(s.FFTSize)
+	plan := defaultSTFT.plan(s.FFTSize)
+	defer defaultSTFT.release(plan)
+
+	// Levels are normalized to the loudest bin, so the first pass finds it and
+	// the second quantizes each frame as it is recomputed. This keeps only the
+	// 8-bit levels in memory rather than a float matrix for the whole track.
+	numFrames := (len(samples) + s.HopSize - 1) / s.HopSize
+	numBins := s.FFTSize/2 + 1
+	frameDB := func(i int, fn func(j int, db float64)) {
+		start := i * s.HopSize
+		for j := range plan.frame {
+			plan.frame[j] = 0
+			if start+j < len(samples) && isFinite(float64(samples[start+j])) {
+				plan.frame[j] = float64(samples[start+j]) * window[j]
+			}
+		}
+		plan.coeffs = plan.fft.Coefficients(plan.coeffs, plan.frame)
+		for j := range numBins {
+			re, im := real(plan.coeffs[j]), imag(plan.coeffs[j])
+			fn(j, 10*math.Log10(re*re+im*im+1e-12))
+		}
+	}
+
+	maxDB := math.Inf(-1)
+	for i := range numFrames {
+		frameDB(i, func(_ int, db float64) { maxDB = math.Max(maxDB, db) })
+	}
+
+	s.Levels = make([][]uint8, numFrames)
+	for i := range s.Levels {
+		row := make([]uint8, numBins)
+		frameDB(i, func(j int, db float64) {
+			level := (db - maxDB - spectrogramFloorDB) / -spectrogramFloorDB
+			row[j] = uint8(math.Round(255 * min(max(level, 0), 1)))
+		})
+		s.Levels[i] = row
+	}
+	return s
+}
+
+// TileRange returns the time span covered by tile x at zoom level z. Zoom 0
+// is one tile for the whole track and each level doubles the tile count.
+func (s *Spectrogram) TileRange(x, z int) (start, end Seconds) {
+	span := s.Duration / Seconds(int(1)<<z)
+	return Seconds(x) * span, Seconds(x+1) * span
+}
+
+// RenderTile renders tile x at zoom level z as a SpectrogramTileSize-wide
+// image of the given height, with time left to right and log frequency bottom
+// to top. Each pixel takes the loudest level among the STFT frames and bins
+// it covers so short transients survive zooming out.
+func (s *Spectrogram) RenderTile(x, z, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, SpectrogramTileSize, height))
+	if len(s.Levels) == 0 || height <= 0 {
+		return img
+	}
+
+	numBins := len(s.Levels[0])
+	nyquist := float64(s.SampleRate) / 2
+	binHz := float64(s.SampleRate) / float64(s.FFTSize)
+
+	// Bin range for each row, top row highest
+	rowBins := make([][2]int, height)
+	for r := range rowBins {
+		lo := spectrogramMinHz * math.Pow(nyquist/spectrogramMinHz, float64(height-1-r)/float64(height))
+		hi := spectrogramMinHz * math.Pow(nyquist/spectrogramMinHz, float64(height-r)/float64(height))
+		b0 := min(int(lo/binHz), numBins-1)
+		b1 := min(max(int(math.Ceil(hi/binHz)), b0+1), numBins)
+		rowBins[r] = [2]int{b0, b1}
+	}
+
+	start, end := s.TileRange(x, z)
+	framesPerSec := float64(s.SampleRate) / float64(s.HopSize)
+	colSecs := float64(end-start) / SpectrogramTileSize
+	for col := range SpectrogramTileSize {
+		t0 := float64(start) + float64(col)*colSecs
+		f0 := int(t0 * framesPerSec)
+		f1 := max(int((t0+colSecs)*framesPerSec), f0+1)
+		if f0 >= len(s.Levels) {
+			break
+		}
+		f1 = min(f1, len(s.Levels))
+
+		for r, bins := range rowBins {
+			var level uint8
+			for f := f0; f < f1; f++ {
+				for _, v := range s.Levels[f][bins[0]:bins[1]] {
+					level = max(level, v)
+				}
+			}
+			img.SetRGBA(col, r, spectrogramColor(level))
+		}
+	}
+	return img
+}
+
+// spectrogramPalette is a black-purple-orange-yellow heat map from quiet to loud.
+var spectrogramPalette = []color.RGBA{
+	{0, 0, 0, 255},
+	{60, 10, 100, 255},
+	{180, 40, 90, 255},
+	{250, 140, 30, 255},
+	{255, 250, 180, 255},
+}
+
+// spectrogramColor maps an 8-bit level onto the heat map.
+func spectrogramColor(level uint8) color.RGBA {
+	pos := float64(level) / 255 * float64(len(spectrogramPalette)-1)
+	i := min(int(pos), len(spectrogramPalette)-2)
+	frac := pos - float64(i)
+	a, b := spectrogramPalette[i], spectrogramPalette[i+1]
+	lerp := func(x, y uint8) uint8 { return uint8(math.Round(float64(x) + frac*(float64(y)-float64(x)))) }
+	return color.RGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), 255}
+}
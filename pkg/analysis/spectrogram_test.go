@@ -0,0 +1,50 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpectrogramTiles(t *testing.T) {
+	// 2 seconds of silence then 2 seconds of a 1 kHz tone
+	const sampleRate = 22050
+	samples := make([]float32, 4*sampleRate)
+	for i := 2 * sampleRate; i < len(samples); i++ {
+		samples[i] = float32(0.5 * math.Sin(2*math.Pi*1000*float64(i)/sampleRate))
+	}
+
+	spec := ComputeSpectrogram(samples, sampleRate)
+	require.NotEmpty(t, spec.Levels)
+	assert.InDelta(t, 4.0, float64(spec.Duration), 1e-9)
+
+	start, end := spec.TileRange(1, 1)
+	assert.InDelta(t, 2.0, float64(start), 1e-9)
+	assert.InDelta(t, 4.0, float64(end), 1e-9)
+
+	const height = 128
+	brightest := func(tile int) (int, uint8) {
+		img := spec.RenderTile(tile, 1, height)
+		require.Equal(t, SpectrogramTileSize, img.Bounds().Dx())
+		require.Equal(t, height, img.Bounds().Dy())
+		row, level := 0, uint8(0)
+		for r := range height {
+			if v := img.RGBAAt(SpectrogramTileSize/2, r).R; v > level {
+				row, level = r, v
+			}
+		}
+		return row, level
+	}
+
+	// The silent half renders black, the tone half peaks on the 1 kHz row
+	_, quiet := brightest(0)
+	assert.Zero(t, quiet)
+
+	row, loud := brightest(1)
+	assert.Greater(t, loud, uint8(200))
+	nyquist := float64(sampleRate) / 2
+	hz := spectrogramMinHz * math.Pow(nyquist/spectrogramMinHz, float64(height-1-row)/height)
+	assert.InDelta(t, 1000, hz, 100)
+}
@@ -0,0 +1,117 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides drum stem separation using Demucs via Python subprocess.
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// StemOutput contains the result of stem separation.
+type StemOutput struct {
+	Stem  string `json:"stem"`  // Extracted stem, e.g. "drums"
+	Model string `json:"model"` // Demucs model name
+	Path  string `json:"path"`  // Path of the extracted stem WAV
+}
+
+// StemSeparator extracts a single stem from a mix using Demucs.
+type StemSeparator struct {
+	uvPath     string
+	scriptPath string
+	stem       string
+}
+
+// NewStemSeparator creates a new Demucs drum stem separator.
+// It uses uv to run the stem_separator.py script with PEP 723 inline dependencies.
+func NewStemSeparator() (*StemSeparator, error) {
+	// Get the directory containing this source file
+	_, currentFile, _, ok := runtime.Caller(0)
+	if !ok {
+		return nil, fmt.Errorf("failed to get current file path")
+	}
+	// Go up from pkg/analysis to project root
+	baseDir := filepath.Dir(filepath.Dir(filepath.Dir(currentFile)))
+	scriptPath := filepath.Join(baseDir, "stem_separator.py")
+
+	// Verify uv is available
+	uvPath, err := exec.LookPath("uv")
+	if err != nil {
+		return nil, fmt.Errorf("uv not found - install with: curl -LsSf https://astral.sh/uv/install.sh | sh")
+	}
+
+	return &StemSeparator{
+		uvPath:     uvPath,
+		scriptPath: scriptPath,
+		stem:       "drums",
+	}, nil
+}
+
+// Separate extracts the stem from audioPath into outDir.
+func (s *StemSeparator) Separate(audioPath, outDir string) (*StemOutput, error) {
+	// Convert to absolute path if relative
+	if !filepath.IsAbs(audioPath) {
+		absPath, err := filepath.Abs(audioPath)
+		if err == nil {
+			audioPath = absPath
+		}
+	}
+
+	// Build command using uv run with PEP 723 script
+	cmd := exec.Command(
+		s.uvPath,
+		"run",
+		s.scriptPath,
+		"--json",
+		"--stem", s.stem,
+		"--out", outDir,
+		audioPath,
+	)
+
+	// Run and capture output
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr := string(exitErr.Stderr)
+			if stderr == "" {
+				stderr = "unknown error"
+			}
+			return nil, fmt.Errorf("stem separation failed: %s", stderr)
+		}
+		return nil, fmt.Errorf("stem separation failed: %w", err)
+	}
+
+	// Parse JSON output
+	var result StemOutput
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse stem separation output: %w", err)
+	}
+
+	return &result, nil
+}
+
+// analyzeDrumStem separates the drum stem of audioPath into a temporary directory
+// and runs qm-dsp-extended beat detection on it.
+func (a *Analyzer) analyzeDrumStem(audioPath string) *GridAnalysis {
+	dir, err := os.MkdirTemp("", "mixxxlab-stems-")
+	if err != nil {
+		return &GridAnalysis{Error: err.Error()}
+	}
+	defer os.RemoveAll(dir)
+
+	stem, err := a.stems.Separate(audioPath, dir)
+	if err != nil {
+		return &GridAnalysis{Error: err.Error(), Stem: a.stems.stem}
+	}
+
+	r, err := AnalyzeFileQMFull(stem.Path, a.qmConfig, nil)
+	if err != nil {
+		return &GridAnalysis{Error: err.Error(), Stem: stem.Stem}
+	}
+	grid := qmExtendedGrid(r)
+	grid.Stem = stem.Stem
+	return grid
+}
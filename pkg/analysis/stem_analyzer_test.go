@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubStemSeparator returns a StemSeparator whose uv is a shell script that
+// copies the input to <out>/drums.wav, or fails with stderr if fail is set.
+func stubStemSeparator(t *testing.T, fail bool) *StemSeparator {
+	t.Helper()
+
+	script := `#!/bin/sh
+# Invoked as: uv run stem_separator.py --json --stem drums --out DIR AUDIO
+while [ $# -gt 1 ]; do
+	[ "$1" = "--out" ] && out="$2"
+	shift
+done
+`
+	if fail {
+		script += "echo 'Error: demucs exploded' >&2\nexit 1\n"
+	} else {
+		script += `cp "$1" "$out/drums.wav"
+printf '{"stem": "drums", "model": "htdemucs", "path": "%s"}\n' "$out/drums.wav"
+`
+	}
+
+	uv := filepath.Join(t.TempDir(), "uv")
+	require.NoError(t, os.WriteFile(uv, []byte(script), 0755))
+	return &StemSeparator{uvPath: uv, scriptPath: "stem_separator.py", stem: "drums"}
+}
+
+func TestStemSeparatorSeparate(t *testing.T) {
+	audio := filepath.Join(t.TempDir(), "track.mp3")
+	writeSilentMonoMP3(t, audio, 10)
+
+	out := t.TempDir()
+	stem, err := stubStemSeparator(t, false).Separate(audio, out)
+	require.NoError(t, err)
+	assert.Equal(t, "drums", stem.Stem)
+	assert.Equal(t, "htdemucs", stem.Model)
+	assert.Equal(t, filepath.Join(out, "drums.wav"), stem.Path)
+	assert.FileExists(t, stem.Path)
+
+	_, err = stubStemSeparator(t, true).Separate(audio, out)
+	assert.ErrorContains(t, err, "demucs exploded")
+}
+
+func TestAnalyzeDrumStem(t *testing.T) {
+	audio := filepath.Join(t.TempDir(), "track.mp3")
+	writeSilentMonoMP3(t, audio, 10)
+
+	// Only the opt-in drum stem grid runs, and it records the stem used
+	a := &Analyzer{
+		stems:     stubStemSeparator(t, false),
+		analyzers: []AnalyzerType{AnalyzerMixxDrums},
+	}
+	ta, err := a.AnalyzeFileWithPath(audio)
+	require.NoError(t, err)
+	require.Contains(t, ta.Grids, string(AnalyzerMixxDrums))
+	assert.Len(t, ta.Grids, 1)
+	assert.Equal(t, "drums", ta.Grids[string(AnalyzerMixxDrums)].Stem)
+
+	// Separation failures are reported as a grid error
+	a.stems = stubStemSeparator(t, true)
+	ta, err = a.AnalyzeFileWithPath(audio)
+	require.NoError(t, err)
+	g := ta.Grids[string(AnalyzerMixxDrums)]
+	assert.Contains(t, g.Error, "demucs exploded")
+	assert.Equal(t, "drums", g.Stem)
+}
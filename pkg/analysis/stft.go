@@ -2,6 +2,7 @@ package analysis
 
 import (
 	"math"
+	"sync"
 
 	"gonum.org/v1/gonum/dsp/fourier"
 )
@@ -22,43 +23,111 @@ func DefaultSTFTConfigs() []GoSTFTConfig {
 	}
 }
 
-// STFT computes Short-Time Fourier Transform.
-// Returns [frames][bins] magnitude spectrum.
-func STFT(samples []float64, cfg GoSTFTConfig) [][]float64 {
-	window := hannWindow(cfg.WindowSize)
-	fft := fourier.NewFFT(cfg.FFTSize)
+// STFTProcessor computes STFTs, caching Hann windows and FFT plans per size so
+// repeated calls (multi-scale STFTs, spectrogram tiles) don't rebuild them.
+// It is safe for concurrent use; each call borrows its own FFT plan.
+type STFTProcessor struct {
+	mu      sync.Mutex
+	windows map[int][]float64
+	plans   map[int]*sync.Pool
+}
+
+// fftPlan is an FFT plan with its scratch buffers. Plans are not safe for
+// concurrent use, so they are pooled per size.
+type fftPlan struct {
+	fft    *fourier.FFT
+	frame  []float64
+	coeffs []complex128
+}
+
+// defaultSTFT backs the package-level STFT functions.
+var defaultSTFT = NewSTFTProcessor()
+
+// NewSTFTProcessor creates an STFT processor with empty caches.
+func NewSTFTProcessor() *STFTProcessor {
+	return &STFTProcessor{
+		windows: make(map[int][]float64),
+		plans:   make(map[int]*sync.Pool),
+	}
+}
+
+// window returns the cached Hann window of the given size. Callers must not modify it.
+func (p *STFTProcessor) window(size int) []float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w, ok := p.windows[size]
+	if !ok {
+		w = hannWindow(size)
+		p.windows[size] = w
+	}
+	return w
+}
+
+// plan borrows an FFT plan of the given size. Return it with release.
+func (p *STFTProcessor) plan(size int) *fftPlan {
+	p.mu.Lock()
+	pool, ok := p.plans[size]
+	if !ok {
+		pool = &sync.Pool{New: func() any {
+			return &fftPlan{fft: fourier.NewFFT(size), frame: make([]float64, size)}
+		}}
+		p.plans[size] = pool
+	}
+	p.mu.Unlock()
+	return pool.Get().(*fftPlan)
+}
 
-	// Number of output frames
+// release returns a plan borrowed with plan.
+func (p *STFTProcessor) release(plan *fftPlan) {
+	p.mu.Lock()
+	pool := p.plans[len(plan.frame)]
+	p.mu.Unlock()
+	pool.Put(plan)
+}
+
+// frames windows and transforms each full frame of samples, calling fn with
+// the frame index and its one-sided FFT coefficients. The coefficients are
+// reused between calls. Returns the number of frames.
+func (p *STFTProcessor) frames(samples []float64, cfg GoSTFTConfig, fn func(i int, coeffs []complex128)) int {
 	numFrames := (len(samples) - cfg.WindowSize) / cfg.HopSize
 	if numFrames <= 0 {
-		return nil
+		return 0
 	}
 
-	// Number of frequency bins (RFFT output)
-	numBins := cfg.FFTSize/2 + 1
-
-	result := make([][]float64, numFrames)
-	frame := make([]float64, cfg.FFTSize)
+	window := p.window(cfg.WindowSize)
+	plan := p.plan(cfg.FFTSize)
+	defer p.release(plan)
 
 	for i := 0; i < numFrames; i++ {
 		start := i * cfg.HopSize
 
 		// Clear frame and apply window
-		for j := range frame {
-			frame[j] = 0
+		for j := range plan.frame {
+			plan.frame[j] = 0
 		}
 		for j := 0; j < cfg.WindowSize && start+j < len(samples); j++ {
-			frame[j] = samples[start+j] * window[j]
+			plan.frame[j] = samples[start+j] * window[j]
 		}
 
-		// Compute FFT
-		coeffs := fft.Coefficients(nil, frame)
+		plan.coeffs = plan.fft.Coefficients(plan.coeffs, plan.frame)
+		fn(i, plan.coeffs)
+	}
+	return numFrames
+}
 
+// STFT computes Short-Time Fourier Transform.
+// Returns [frames][bins] magnitude spectrum.
+func (p *STFTProcessor) STFT(samples []float64, cfg GoSTFTConfig) [][]float64 {
+	// Number of frequency bins (RFFT output)
+	numBins := cfg.FFTSize/2 + 1
+
+	var result [][]float64
+	p.frames(samples, cfg, func(i int, coeffs []complex128) {
 		// Extract magnitude for positive frequencies only (RFFT)
 		// Normalize: 2/N for one-sided spectrum (except DC and Nyquist)
 		// scipy uses this normalization for single-sided spectra
 		scale := 2.0 / float64(cfg.FFTSize)
-		result[i] = make([]float64, numBins)
+		row := make([]float64, numBins)
 		for j := 0; j < numBins; j++ {
 			re := real(coeffs[j])
 			im := imag(coeffs[j])
@@ -66,56 +135,60 @@ func STFT(samples []float64, cfg GoSTFTConfig) [][]float64 {
 			if j == 0 || j == numBins-1 {
 				s = 1.0 / float64(cfg.FFTSize) // DC and Nyquist aren't doubled
 			}
-			result[i][j] = math.Sqrt(re*re+im*im) * s
+			row[j] = math.Sqrt(re*re+im*im) * s
 		}
-	}
+		result = append(result, row)
+	})
 
 	return result
 }
 
 // STFTComplex computes STFT and returns complex coefficients [frames][bins][2] (real, imag).
-func STFTComplex(samples []float64, cfg GoSTFTConfig) [][][2]float64 {
-	window := hannWindow(cfg.WindowSize)
-	fft := fourier.NewFFT(cfg.FFTSize)
-
-	numFrames := (len(samples) - cfg.WindowSize) / cfg.HopSize
-	if numFrames <= 0 {
-		return nil
-	}
-
+func (p *STFTProcessor) STFTComplex(samples []float64, cfg GoSTFTConfig) [][][2]float64 {
 	numBins := cfg.FFTSize/2 + 1
 
-	result := make([][][2]float64, numFrames)
-	frame := make([]float64, cfg.FFTSize)
-
-	for i := 0; i < numFrames; i++ {
-		start := i * cfg.HopSize
-
-		for j := range frame {
-			frame[j] = 0
-		}
-		for j := 0; j < cfg.WindowSize && start+j < len(samples); j++ {
-			frame[j] = samples[start+j] * window[j]
-		}
-
-		coeffs := fft.Coefficients(nil, frame)
-
+	var result [][][2]float64
+	p.frames(samples, cfg, func(i int, coeffs []complex128) {
 		// Normalize: 2/N for one-sided spectrum (except DC and Nyquist)
 		scale := 2.0 / float64(cfg.FFTSize)
-		result[i] = make([][2]float64, numBins)
+		row := make([][2]float64, numBins)
 		for j := 0; j < numBins; j++ {
 			s := scale
 			if j == 0 || j == numBins-1 {
 				s = 1.0 / float64(cfg.FFTSize)
 			}
-			result[i][j][0] = real(coeffs[j]) * s
-			result[i][j][1] = imag(coeffs[j]) * s
+			row[j][0] = real(coeffs[j]) * s
+			row[j][1] = imag(coeffs[j]) * s
 		}
-	}
+		result = append(result, row)
+	})
+
+	return result
+}
 
+// ComputeMultiScaleSTFT computes STFT at multiple scales as used by the beat detector.
+// Returns 3 magnitude spectrograms for FFT sizes 1024, 2048, 4096.
+func (p *STFTProcessor) ComputeMultiScaleSTFT(samples []float64) [3][][]float64 {
+	configs := DefaultSTFTConfigs()
+	var result [3][][]float64
+	for i, cfg := range configs {
+		result[i] = p.STFT(samples, cfg)
+	}
 	return result
 }
 
+// STFT computes Short-Time Fourier Transform with the shared processor.
+// Returns [frames][bins] magnitude spectrum.
+func STFT(samples []float64, cfg GoSTFTConfig) [][]float64 {
+	return defaultSTFT.STFT(samples, cfg)
+}
+
+// STFTComplex computes STFT with the shared processor and returns complex
+// coefficients [frames][bins][2] (real, imag).
+func STFTComplex(samples []float64, cfg GoSTFTConfig) [][][2]float64 {
+	return defaultSTFT.STFTComplex(samples, cfg)
+}
+
 // hannWindow generates a Hann window of given size.
 func hannWindow(size int) []float64 {
 	w := make([]float64, size)
@@ -125,13 +198,9 @@ func hannWindow(size int) []float64 {
 	return w
 }
 
-// ComputeMultiScaleSTFT computes STFT at multiple scales as used by the beat detector.
+// ComputeMultiScaleSTFT computes STFT at multiple scales as used by the beat
+// detector, with the shared processor.
 // Returns 3 magnitude spectrograms for FFT sizes 1024, 2048, 4096.
 func ComputeMultiScaleSTFT(samples []float64) [3][][]float64 {
-	configs := DefaultSTFTConfigs()
-	var result [3][][]float64
-	for i, cfg := range configs {
-		result[i] = STFT(samples, cfg)
-	}
-	return result
+	return defaultSTFT.ComputeMultiScaleSTFT(samples)
 }
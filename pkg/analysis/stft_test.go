@@ -172,3 +172,51 @@ func abs(x int) int {
 	}
 	return x
 }
+
+func TestSTFTProcessor(t *testing.T) {
+	samples := make([]float64, 44100)
+	for i := range samples {
+		samples[i] = rand.Float64()*2 - 1
+	}
+
+	// Cached plans give the same result as a fresh processor, call after call
+	p := NewSTFTProcessor()
+	for _, cfg := range DefaultSTFTConfigs() {
+		want := NewSTFTProcessor().STFT(samples, cfg)
+		for range 2 {
+			got := p.STFT(samples, cfg)
+			if len(got) != len(want) {
+				t.Fatalf("FFT %d: expected %d frames, got %d", cfg.FFTSize, len(want), len(got))
+			}
+			for i := range got {
+				for j := range got[i] {
+					if got[i][j] != want[i][j] {
+						t.Fatalf("FFT %d: frame %d bin %d: expected %g, got %g", cfg.FFTSize, i, j, want[i][j], got[i][j])
+					}
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkMultiScaleSTFT compares the shared processor's cached plans and
+// windows against building them on every call.
+func BenchmarkMultiScaleSTFT(b *testing.B) {
+	samples := make([]float64, 44100)
+	for i := range samples {
+		samples[i] = rand.Float64()*2 - 1
+	}
+
+	b.Run("cached", func(b *testing.B) {
+		p := NewSTFTProcessor()
+		for b.Loop() {
+			p.ComputeMultiScaleSTFT(samples)
+		}
+	})
+
+	b.Run("per-call", func(b *testing.B) {
+		for b.Loop() {
+			NewSTFTProcessor().ComputeMultiScaleSTFT(samples)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides Traktor NML export of beat grids and cues.
+package analysis
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Traktor CUE_V2 types.
+const (
+	traktorCueTypeCue  = 0
+	traktorCueTypeGrid = 4
+)
+
+// traktorHotCues is the number of Traktor hot cue slots. Cues past them are
+// written as memory cues with HOTCUE="-1".
+const traktorHotCues = 8
+
+type traktorNML struct {
+	XMLName    xml.Name          `xml:"NML"`
+	Version    int               `xml:"VERSION,attr"`
+	Head       traktorHead       `xml:"HEAD"`
+	Collection traktorCollection `xml:"COLLECTION"`
+}
+
+type traktorHead struct {
+	Company string `xml:"COMPANY,attr"`
+	Program string `xml:"PROGRAM,attr"`
+}
+
+type traktorCollection struct {
+	Entries int            `xml:"ENTRIES,attr"`
+	Entry   []traktorEntry `xml:"ENTRY"`
+}
+
+type traktorEntry struct {
+	Title    string          `xml:"TITLE,attr,omitempty"`
+	Artist   string          `xml:"ARTIST,attr,omitempty"`
+	Location traktorLocation `xml:"LOCATION"`
+	Tempo    traktorTempo    `xml:"TEMPO"`
+	Cues     []traktorCue    `xml:"CUE_V2"`
+}
+
+type traktorLocation struct {
+	File string `xml:"FILE,attr"`
+}
+
+type traktorTempo struct {
+	BPM        string `xml:"BPM,attr"`
+	BPMQuality string `xml:"BPM_QUALITY,attr"`
+}
+
+// traktorCue is a CUE_V2 marker. START and LEN are in milliseconds.
+type traktorCue struct {
+	Name       string `xml:"NAME,attr"`
+	DisplOrder int    `xml:"DISPL_ORDER,attr"`
+	Type       int    `xml:"TYPE,attr"`
+	Start      string `xml:"START,attr"`
+	Len        string `xml:"LEN,attr"`
+	Repeats    int    `xml:"REPEATS,attr"`
+	HotCue     int    `xml:"HOTCUE,attr"`
+
+	Grid *traktorGrid `xml:"GRID,omitempty"` // Tempo from a grid marker on, for variable tempo
+}
+
+type traktorGrid struct {
+	BPM string `xml:"BPM,attr"`
+}
+
+// ExportTraktorNML writes analysis as a Traktor NML collection with one
+// ENTRY: a TEMPO element with the BPM of the grid named gridKey (the default
+// grid if gridKey is ""), a GRID cue (TYPE 4) in hot cue 1 anchoring the grid
+// at its first downbeat, or its first beat if it has no downbeats, and the
+// cue points of the first marker analysis that has any as TYPE 0 cues in the
+// remaining hot cues, then as memory cues. LOCATION only names the file, so
+// Traktor needs the directory and volume filled in to match it on import.
+//
+// A grid with a tempo curve gets a GRID cue with its BPM at each tempo change,
+// snapped to the next beat, after the first as memory cues. Nothing is written
+// if the grid fails ValidateGrid, unless force is set.
+func ExportTraktorNML(analysis *TrackAnalysis, gridKey string, w io.Writer, force bool) error {
+	g := analysis.DefaultGrid(nil)
+	if gridKey != "" {
+		g = analysis.Grids[gridKey]
+	}
+	if g == nil || g.Error != "" || len(g.Beats) == 0 {
+		return fmt.Errorf("no successful grid %q", gridKey)
+	}
+	if err := validateExportGrid(g, float64(analysis.Duration), force); err != nil {
+		return err
+	}
+
+	anchor, _ := computeGridAnchor(g)
+	cues := []traktorCue{traktorMarker("AutoGrid", traktorCueTypeGrid, anchor, 0)}
+	if len(g.TempoCurve) > 1 {
+		cues = traktorTempoMarkers(g, anchor, cues[0])
+	}
+
+	points := exportCuePoints(analysis)
+	for i, c := range points {
+		hotCue := i + 1
+		if hotCue >= traktorHotCues {
+			hotCue = -1
+		}
+		name := c.Name
+		if name == "" {
+			name = c.Type
+		}
+		cues = append(cues, traktorMarker(name, traktorCueTypeCue, float64(c.Time), hotCue))
+	}
+
+	entry := traktorEntry{
+		Location: traktorLocation{File: analysis.File},
+		Tempo:    traktorTempo{BPM: fmt.Sprintf("%.6f", g.BPM), BPMQuality: "100.000000"},
+		Cues:     cues,
+	}
+	if md := analysis.Metadata; md != nil {
+		entry.Title, entry.Artist = md.Title, md.Artist
+	}
+
+	nml := traktorNML{
+		Version:    19,
+		Head:       traktorHead{Company: "www.native-instruments.com", Program: "Traktor"},
+		Collection: traktorCollection{Entries: 1, Entry: []traktorEntry{entry}},
+	}
+	if _, err := io.WriteString(w, `<?xml version="1.0" encoding="UTF-8" standalone="no" ?>`+"\n"); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(nml); err != nil {
+		return fmt.Errorf("encode NML: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// traktorTempoMarkers returns the grid cue first, then a grid cue at the first
+// beat at or after each tempo change past anchor, each with its tempo.
+func traktorTempoMarkers(g *GridAnalysis, anchor float64, first traktorCue) []traktorCue {
+	bpm := func(p TempoPoint) *traktorGrid { return &traktorGrid{BPM: fmt.Sprintf("%.6f", p.BPM)} }
+
+	first.Grid = bpm(g.TempoCurve[0])
+	cues := []traktorCue{first}
+	last := anchor
+	for _, p := range g.TempoCurve {
+		i, _ := slices.BinarySearch(g.Beats, float64(p.Time))
+		if i == len(g.Beats) {
+			break
+		}
+		if g.Beats[i] <= last {
+			// A later change by the same beat replaces the marker's tempo
+			cues[len(cues)-1].Grid = bpm(p)
+			continue
+		}
+		m := traktorMarker("AutoGrid", traktorCueTypeGrid, g.Beats[i], -1)
+		m.Grid = bpm(p)
+		cues = append(cues, m)
+		last = g.Beats[i]
+	}
+	return cues
+}
+
+// traktorMarker returns a zero-length CUE_V2 at t seconds.
+func traktorMarker(name string, cueType int, t float64, hotCue int) traktorCue {
+	return traktorCue{
+		Name:    name,
+		Type:    cueType,
+		Start:   fmt.Sprintf("%.6f", max(t, 0)*1000),
+		Len:     "0.000000",
+		Repeats: -1,
+		HotCue:  hotCue,
+	}
+}
@@ -0,0 +1,145 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportTraktorNML(t *testing.T) {
+	ta := &TrackAnalysis{
+		File:     "track.mp3",
+		Metadata: &TrackMetadata{Title: "Song", Artist: "Band"},
+		Grids: map[string]*GridAnalysis{
+			string(AnalyzerMixx):     {BPM: 128, Beats: []float64{0.2, 0.66875, 1.1375, 1.60625}, Downbeats: []int{2}},
+			string(AnalyzerBeatThis): {BPM: 127.5, Beats: []float64{0.25, 0.72}},
+		},
+		Markers: map[string]*MarkerAnalysis{"mixx": {CuePoints: []CuePoint{
+			{Time: 64.5, Type: "drop", Name: "Drop & Fill"},
+			{Time: 30, Type: "breakdown"},
+		}}},
+	}
+	for i := range 7 {
+		ta.Markers["mixx"].CuePoints = append(ta.Markers["mixx"].CuePoints, CuePoint{Time: Seconds(100 + i), Type: "phrase"})
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, ExportTraktorNML(ta, string(AnalyzerMixx), &buf, false))
+	assert.True(t, strings.HasPrefix(buf.String(), `<?xml version="1.0" encoding="UTF-8" standalone="no" ?>`))
+
+	var nml struct {
+		Version    string `xml:"VERSION,attr"`
+		Collection struct {
+			Entries string `xml:"ENTRIES,attr"`
+			Entry   []struct {
+				Title    string `xml:"TITLE,attr"`
+				Artist   string `xml:"ARTIST,attr"`
+				Location struct {
+					File string `xml:"FILE,attr"`
+				} `xml:"LOCATION"`
+				Tempo struct {
+					BPM string `xml:"BPM,attr"`
+				} `xml:"TEMPO"`
+				Cues []struct {
+					Name    string `xml:"NAME,attr"`
+					Type    string `xml:"TYPE,attr"`
+					Start   string `xml:"START,attr"`
+					Len     string `xml:"LEN,attr"`
+					Repeats string `xml:"REPEATS,attr"`
+					HotCue  string `xml:"HOTCUE,attr"`
+				} `xml:"CUE_V2"`
+			} `xml:"ENTRY"`
+		} `xml:"COLLECTION"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &nml))
+	assert.Equal(t, "19", nml.Version)
+	assert.Equal(t, "1", nml.Collection.Entries)
+	require.Len(t, nml.Collection.Entry, 1)
+	e := nml.Collection.Entry[0]
+	assert.Equal(t, "Song", e.Title)
+	assert.Equal(t, "Band", e.Artist)
+	assert.Equal(t, "track.mp3", e.Location.File)
+	assert.Equal(t, "128.000000", e.Tempo.BPM)
+
+	// The grid cue anchors bar one in the first hot cue, then cues by time
+	require.Len(t, e.Cues, 10)
+	assert.Equal(t, "4", e.Cues[0].Type)
+	assert.Equal(t, "1137.500000", e.Cues[0].Start)
+	assert.Equal(t, "0", e.Cues[0].HotCue)
+	assert.Equal(t, "breakdown", e.Cues[1].Name)
+	assert.Equal(t, "30000.000000", e.Cues[1].Start)
+	assert.Equal(t, "Drop & Fill", e.Cues[2].Name)
+	for i, c := range e.Cues[1:] {
+		assert.Equal(t, "0", c.Type)
+		assert.Equal(t, "0.000000", c.Len)
+		assert.Equal(t, "-1", c.Repeats)
+		if i+1 < traktorHotCues {
+			assert.Equal(t, strconv.Itoa(i+1), c.HotCue)
+		} else {
+			assert.Equal(t, "-1", c.HotCue, "memory cue past the hot cues")
+		}
+	}
+
+	assert.NotContains(t, buf.String(), "<GRID", "constant tempo needs no tempo markers")
+
+	// Without downbeats the grid is anchored on the first beat
+	buf.Reset()
+	require.NoError(t, ExportTraktorNML(ta, string(AnalyzerBeatThis), &buf, false))
+	assert.Contains(t, buf.String(), `TYPE="4" START="250.000000"`)
+
+	assert.Error(t, ExportTraktorNML(ta, "missing", &buf, true))
+
+	// A nonsense BPM is refused unless forced
+	ta.Grids[string(AnalyzerBeatThis)].BPM = 0
+	buf.Reset()
+	assert.ErrorContains(t, ExportTraktorNML(ta, string(AnalyzerBeatThis), &buf, false), "implausible BPM")
+	assert.Empty(t, buf.String())
+	require.NoError(t, ExportTraktorNML(ta, string(AnalyzerBeatThis), &buf, true))
+}
+
+func TestExportTraktorNMLTempoCurve(t *testing.T) {
+	g := &GridAnalysis{BPM: 124, Downbeats: []int{1}, TempoCurve: []TempoPoint{
+		{Time: 0, BPM: 120},
+		{Time: 3.2, BPM: 124},
+		{Time: 3.3, BPM: 126}, // Same beat as the last change, replacing it
+		{Time: 6, BPM: 130},
+		{Time: 20, BPM: 140}, // Past the last beat
+	}}
+	for bt := 0.5; bt <= 10; bt += 0.5 {
+		g.Beats = append(g.Beats, bt)
+	}
+	ta := &TrackAnalysis{File: "set.mp3", Grids: map[string]*GridAnalysis{string(AnalyzerMixxExtended): g}}
+
+	var buf bytes.Buffer
+	require.NoError(t, ExportTraktorNML(ta, string(AnalyzerMixxExtended), &buf, false))
+	var nml struct {
+		Cues []struct {
+			Type   string `xml:"TYPE,attr"`
+			Start  string `xml:"START,attr"`
+			HotCue string `xml:"HOTCUE,attr"`
+			Grid   struct {
+				BPM string `xml:"BPM,attr"`
+			} `xml:"GRID"`
+		} `xml:"COLLECTION>ENTRY>CUE_V2"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &nml))
+	require.Len(t, nml.Cues, 3)
+
+	// The anchor keeps the first hot cue, tempo changes are memory cues
+	want := []struct{ start, hotCue, bpm string }{
+		{"1000.000000", "0", "120.000000"},
+		{"3500.000000", "-1", "126.000000"},
+		{"6000.000000", "-1", "130.000000"},
+	}
+	for i, w := range want {
+		assert.Equal(t, "4", nml.Cues[i].Type)
+		assert.Equal(t, w.start, nml.Cues[i].Start)
+		assert.Equal(t, w.hotCue, nml.Cues[i].HotCue)
+		assert.Equal(t, w.bpm, nml.Cues[i].Grid.BPM)
+	}
+}
@@ -0,0 +1,32 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides the Seconds time unit and frame/second conversions.
+package analysis
+
+import (
+	"math"
+	"time"
+)
+
+// Seconds is a time position or duration in seconds.
+// It encodes to JSON as a plain number.
+type Seconds float64
+
+// FramesToSeconds converts a frame index or count to seconds at the given frame
+// rate, e.g. a sample rate in Hz or a model's hop-based frame rate.
+func FramesToSeconds(frames int, frameRate float64) Seconds {
+	if frameRate <= 0 {
+		return 0
+	}
+	return Seconds(float64(frames) / frameRate)
+}
+
+// Frames returns the nearest frame index at the given frame rate. Rounding
+// (rather than truncating) keeps FramesToSeconds(n, r).Frames(r) == n.
+func (s Seconds) Frames(frameRate float64) int {
+	return int(math.Round(float64(s) * frameRate))
+}
+
+// Duration converts s to a time.Duration.
+func (s Seconds) Duration() time.Duration {
+	return time.Duration(float64(s) * float64(time.Second))
+}
@@ -0,0 +1,31 @@
+package analysis
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeconds(t *testing.T) {
+	// Frame indices survive a round trip at sample and model frame rates,
+	// where truncating float division would drop a frame (e.g. 29 * 0.02 / 0.02)
+	for _, rate := range []float64{44100, 22050 / 441.0, 100} {
+		for n := range 1000 {
+			assert.Equal(t, n, FramesToSeconds(n, rate).Frames(rate))
+		}
+	}
+	assert.Equal(t, Seconds(0), FramesToSeconds(100, 0))
+	assert.Equal(t, 1500*time.Millisecond, Seconds(1.5).Duration())
+
+	// Seconds encode as plain JSON numbers
+	b, err := json.Marshal(Phrase{Time: 12.5, Label: "chorus", Duration: 30})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"time": 12.5, "label": "chorus", "duration": 30}`, string(b))
+
+	var p Phrase
+	require.NoError(t, json.Unmarshal(b, &p))
+	assert.Equal(t, Seconds(12.5), p.Time)
+}
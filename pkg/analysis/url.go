@@ -0,0 +1,97 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides analysis of audio downloaded from a URL.
+package analysis
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxURLBytes limits the size of audio downloaded by AnalyzeURL.
+var maxURLBytes int64 = 200 << 20
+
+// audioContentTypes maps audio MIME types to file extensions.
+var audioContentTypes = map[string]string{
+	"audio/mpeg":   ".mp3",
+	"audio/mp3":    ".mp3",
+	"audio/mp4":    ".m4a",
+	"audio/x-m4a":  ".m4a",
+	"audio/aac":    ".aac",
+	"audio/wav":    ".wav",
+	"audio/wave":   ".wav",
+	"audio/x-wav":  ".wav",
+	"audio/flac":   ".flac",
+	"audio/x-flac": ".flac",
+	"audio/ogg":    ".ogg",
+	"audio/aiff":   ".aiff",
+	"audio/x-aiff": ".aiff",
+}
+
+// AnalyzeURL downloads audio from an http(s) URL to a temporary file, analyzes
+// it with AnalyzeFileWithPath, and removes the download afterward. The format
+// is taken from the URL extension, then the response Content-Type, then the
+// file's magic bytes. Downloads larger than 200 MB are rejected.
+func (a *Analyzer) AnalyzeURL(rawURL string) (*TrackAnalysis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme: %q", u.Scheme)
+	}
+
+	dir, err := os.MkdirTemp("", "mixxxlab-url-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	download := filepath.Join(dir, "download")
+	contentType, err := fetch(rawURL, download, "", maxURLBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	name := path.Base(u.Path)
+	ext := strings.ToLower(path.Ext(name))
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if name == "" || name == "." || name == "/" {
+		name = "track"
+	}
+
+	if !isSupportedAudio(normalizeAudioExt(ext)) {
+		ext, err = downloadAudioExt(download, contentType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rawURL, err)
+		}
+	}
+
+	audioPath := filepath.Join(dir, name+ext)
+	if err := os.Rename(download, audioPath); err != nil {
+		return nil, err
+	}
+	return a.AnalyzeFileWithPath(audioPath)
+}
+
+// downloadAudioExt determines the extension of a downloaded file from its
+// Content-Type, falling back to sniffing its contents.
+func downloadAudioExt(path, contentType string) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if ext, ok := audioContentTypes[mediaType]; ok {
+		return ext, nil
+	}
+
+	ext, err := sniffAudioFormat(path)
+	if err != nil {
+		return "", err
+	}
+	if ext == "" {
+		return "", fmt.Errorf("not an audio file (content type %q)", contentType)
+	}
+	return ext, nil
+}
@@ -0,0 +1,71 @@
+package analysis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeURL(t *testing.T) {
+	mp3Path := filepath.Join(t.TempDir(), "fixture.mp3")
+	writeSilentMonoMP3(t, mp3Path, 100)
+	mp3, err := os.ReadFile(mp3Path)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tracks/song.mp3":
+			w.Header().Set("Content-Type", "application/octet-stream")
+		case "/download":
+			w.Header().Set("Content-Type", "audio/mpeg")
+		case "/blob":
+			w.Header().Set("Content-Type", "application/octet-stream")
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html></html>"))
+			return
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(mp3)
+	}))
+	defer srv.Close()
+
+	a := &Analyzer{analyzers: []AnalyzerType{AnalyzerMixx}}
+
+	// Extension from the URL path
+	ta, err := a.AnalyzeURL(srv.URL + "/tracks/song.mp3")
+	require.NoError(t, err)
+	assert.Equal(t, "song.mp3", ta.File)
+	require.NotNil(t, ta.Waveform)
+	assert.NotEmpty(t, ta.Waveform.Peaks)
+
+	// Extension from the Content-Type, then from the file contents
+	ta, err = a.AnalyzeURL(srv.URL + "/download?id=42")
+	require.NoError(t, err)
+	assert.Equal(t, "download.mp3", ta.File)
+
+	ta, err = a.AnalyzeURL(srv.URL + "/blob")
+	require.NoError(t, err)
+	assert.Equal(t, "blob.mp3", ta.File)
+
+	// Non-audio responses, missing files, and other schemes are rejected
+	_, err = a.AnalyzeURL(srv.URL + "/page")
+	assert.ErrorContains(t, err, "not an audio file")
+	_, err = a.AnalyzeURL(srv.URL + "/missing.mp3")
+	assert.ErrorContains(t, err, "404")
+	_, err = a.AnalyzeURL("file:///etc/passwd")
+	assert.ErrorContains(t, err, "unsupported URL scheme")
+
+	// Downloads over the size limit are rejected
+	defer func(n int64) { maxURLBytes = n }(maxURLBytes)
+	maxURLBytes = int64(len(mp3)) - 1
+	_, err = a.AnalyzeURL(srv.URL + "/tracks/song.mp3")
+	assert.ErrorContains(t, err, "too large")
+}
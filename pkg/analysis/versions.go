@@ -0,0 +1,111 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides comparison of two versions of the same track, e.g. masters or edits.
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Thresholds above which two versions are reported as structurally different.
+// Analyzers can gain or lose a beat at either end of a track, so a couple of
+// beats of difference is tolerated.
+const (
+	versionBeatTolerance = 2
+	versionMinAgreement  = 0.8
+	versionTempoEpsilon  = 1e-3 // Tempo ratios this close to 1 are BPM estimation noise
+)
+
+// TrackComparison compares the default grids of two versions of the same song.
+// B's beats are scaled by TempoRatio onto A's timeline before comparing, so a
+// time-stretched copy matches its original.
+type TrackComparison struct {
+	FileA        string  `json:"file_a"`
+	FileB        string  `json:"file_b"`
+	BPMA         float64 `json:"bpm_a"`
+	BPMB         float64 `json:"bpm_b"`
+	BPMDiff      float64 `json:"bpm_diff"`    // BPMB - BPMA
+	TempoRatio   float64 `json:"tempo_ratio"` // BPMB / BPMA, 1 unless B was time-stretched
+	DurationA    Seconds `json:"duration_a"`
+	DurationB    Seconds `json:"duration_b"`
+	DurationDiff Seconds `json:"duration_diff"` // DurationB - DurationA
+	BeatDiff     int     `json:"beat_diff"`     // Beats in B minus beats in A, e.g. 4 for an inserted bar
+	FMeasure     float64 `json:"f_measure"`     // Agreement of A's beats with B's aligned beats
+
+	// StructureChanged is set when beats were added or removed, or the aligned
+	// grids disagree, rather than the track only being sped up or slowed down.
+	StructureChanged bool `json:"structure_changed"`
+}
+
+// CompareTracks analyzes two versions of the same track and compares them
+// with CompareVersions.
+func (a *Analyzer) CompareTracks(pathA, pathB string) (*TrackComparison, error) {
+	ta, err := a.AnalyzeFileWithPath(pathA)
+	if err != nil {
+		return nil, fmt.Errorf("analyze %s: %w", pathA, err)
+	}
+	tb, err := a.AnalyzeFileWithPath(pathB)
+	if err != nil {
+		return nil, fmt.Errorf("analyze %s: %w", pathB, err)
+	}
+	return CompareVersions(ta, tb)
+}
+
+// CompareVersions compares the default grids of two analyses of the same song.
+func CompareVersions(ta, tb *TrackAnalysis) (*TrackComparison, error) {
+	ga, gb := ta.DefaultGrid(nil), tb.DefaultGrid(nil)
+	if ga == nil || ga.BPM <= 0 || len(ga.Beats) == 0 {
+		return nil, fmt.Errorf("%s: no beat grid", ta.File)
+	}
+	if gb == nil || gb.BPM <= 0 || len(gb.Beats) == 0 {
+		return nil, fmt.Errorf("%s: no beat grid", tb.File)
+	}
+
+	c := &TrackComparison{
+		FileA:        ta.File,
+		FileB:        tb.File,
+		BPMA:         ga.BPM,
+		BPMB:         gb.BPM,
+		BPMDiff:      gb.BPM - ga.BPM,
+		TempoRatio:   gb.BPM / ga.BPM,
+		DurationA:    ta.Duration,
+		DurationB:    tb.Duration,
+		DurationDiff: tb.Duration - ta.Duration,
+		BeatDiff:     len(gb.Beats) - len(ga.Beats),
+	}
+	if diff := c.TempoRatio - 1; diff > -versionTempoEpsilon && diff < versionTempoEpsilon {
+		c.TempoRatio = 1
+	}
+
+	// Align B's first beat with A's and undo any time-stretch
+	aligned := make([]float64, len(gb.Beats))
+	for i, t := range gb.Beats {
+		aligned[i] = ga.Beats[0] + (t-gb.Beats[0])*c.TempoRatio
+	}
+	c.FMeasure = GridAgreement(ga.Beats, aligned)
+
+	c.StructureChanged = c.BeatDiff > versionBeatTolerance || c.BeatDiff < -versionBeatTolerance ||
+		c.FMeasure < versionMinAgreement
+	return c, nil
+}
+
+// WriteTable prints the version comparison as an aligned text table.
+func (c *TrackComparison) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tA\tB\tDIFF")
+	fmt.Fprintf(tw, "FILE\t%s\t%s\t\n", c.FileA, c.FileB)
+	fmt.Fprintf(tw, "BPM\t%.2f\t%.2f\t%+.2f (x%.4f)\n", c.BPMA, c.BPMB, c.BPMDiff, c.TempoRatio)
+	fmt.Fprintf(tw, "DURATION\t%.2fs\t%.2fs\t%+.2fs\n", c.DurationA, c.DurationB, c.DurationDiff)
+	fmt.Fprintf(tw, "BEATS\t\t\t%+d\n", c.BeatDiff)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	verdict := "same structure"
+	if c.StructureChanged {
+		verdict = "structure changed"
+	}
+	_, err := fmt.Fprintf(w, "\nAligned beat F-measure: %.3f (%s)\n", c.FMeasure, verdict)
+	return err
+}
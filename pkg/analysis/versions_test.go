@@ -0,0 +1,77 @@
+package analysis
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareVersions(t *testing.T) {
+	// grid builds a slightly jittery beat grid, as an analyzer would return,
+	// optionally with insertBeats beats inserted at insertAt
+	grid := func(file string, bpm float64, duration Seconds, insertAt float64, insertBeats int) *TrackAnalysis {
+		period := 60 / bpm
+		var beats []float64
+		for i := 0; ; i++ {
+			t := 0.3 + float64(i)*period + 0.004*float64(i%3-1)
+			if t >= float64(duration) {
+				break
+			}
+			beats = append(beats, t)
+		}
+		if insertBeats > 0 {
+			shift := float64(insertBeats) * period
+			var edited []float64
+			for _, t := range beats {
+				if t >= insertAt {
+					t += shift
+				}
+				edited = append(edited, t)
+			}
+			for i := range insertBeats {
+				edited = append(edited, insertAt+float64(i)*period)
+			}
+			beats = edited
+			sort.Float64s(beats)
+			duration += Seconds(shift)
+		}
+		return &TrackAnalysis{
+			File:     file,
+			Duration: duration,
+			Grids:    map[string]*GridAnalysis{string(AnalyzerBeatThisFull): {BPM: bpm, Beats: beats}},
+		}
+	}
+
+	original := grid("original.mp3", 120, 180, 0, 0)
+
+	// Time-stretched copy: faster tempo, shorter, same structure
+	stretched := grid("stretched.mp3", 126, 180*120.0/126, 0, 0)
+	c, err := CompareVersions(original, stretched)
+	require.NoError(t, err)
+	assert.InDelta(t, 6.0, c.BPMDiff, 1e-9)
+	assert.InDelta(t, 1.05, c.TempoRatio, 1e-9)
+	assert.InDelta(t, float64(180*120.0/126-180), float64(c.DurationDiff), 1e-9)
+	assert.LessOrEqual(t, abs(c.BeatDiff), 1)
+	assert.Greater(t, c.FMeasure, 0.95)
+	assert.False(t, c.StructureChanged)
+
+	// Edit with one bar inserted at 60s
+	edit := grid("edit.mp3", 120, 180, 60.3, 4)
+	c, err = CompareVersions(original, edit)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, c.TempoRatio)
+	assert.Equal(t, 4, c.BeatDiff)
+	assert.InDelta(t, 2.0, float64(c.DurationDiff), 1e-9)
+	assert.True(t, c.StructureChanged)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.WriteTable(&buf))
+	assert.Contains(t, buf.String(), "structure changed")
+
+	// Versions without a grid can't be compared
+	_, err = CompareVersions(original, &TrackAnalysis{File: "empty.mp3"})
+	assert.ErrorContains(t, err, "empty.mp3")
+}
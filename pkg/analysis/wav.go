@@ -0,0 +1,129 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides WAV file parsing and sample format conversion.
+package analysis
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+)
+
+// WAV format tags from the fmt chunk. Extensible files carry the real tag in
+// the first two bytes of their subformat GUID.
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// loadWAV loads a RIFF WAV file and returns float32 channel buffers and the
+// sample rate. The frame count is the data chunk size over the frame size, as
+// libsndfile reports it, so durations agree with the QM analyzer.
+func loadWAV(path string, opts LoadAudioMonoOptions) ([][]float32, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	data = data[min(id3v2Size(data), len(data)):]
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, fmt.Errorf("not a RIFF WAVE file")
+	}
+
+	var format *wavSampleFormat
+	var sampleRate int
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		body := data[pos+8:]
+		// Streamed files may leave the data size unset or too large
+		size = min(size, len(body))
+		body = body[:size]
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, fmt.Errorf("WAV fmt chunk too short: %d bytes", size)
+			}
+			format = &wavSampleFormat{
+				Format:        binary.LittleEndian.Uint16(body[0:]),
+				Channels:      int(binary.LittleEndian.Uint16(body[2:])),
+				BitsPerSample: int(binary.LittleEndian.Uint16(body[14:])),
+			}
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			if format.Format == wavFormatExtensible {
+				if size < 26 {
+					return nil, 0, fmt.Errorf("WAV extensible fmt chunk too short: %d bytes", size)
+				}
+				format.Format = binary.LittleEndian.Uint16(body[24:])
+			}
+		case "data":
+			if format == nil {
+				return nil, 0, fmt.Errorf("WAV data chunk before fmt chunk")
+			}
+			if n, frameSize := opts.maxFrames(sampleRate), format.Channels*format.BitsPerSample/8; n > 0 && frameSize > 0 {
+				body = body[:min(len(body), n*frameSize)]
+			}
+			channels, err := decodeWAVChannels(body, *format)
+			if err != nil {
+				return nil, 0, err
+			}
+			return channels, sampleRate, nil
+		}
+
+		// Chunks are padded to an even size
+		pos += 8 + size + size%2
+	}
+	return nil, 0, fmt.Errorf("WAV file has no data chunk")
+}
+
+// wavSampleFormat describes how frames are encoded in a WAV data chunk.
+type wavSampleFormat struct {
+	Format        uint16 // wavFormatPCM or wavFormatFloat
+	Channels      int
+	BitsPerSample int
+}
+
+// decodeWAVChannels converts interleaved little-endian frames to float32
+// channel buffers in [-1, 1], whatever the source bit depth, so 16-bit, 24-bit, 32-bit, and
+// float files of the same signal decode identically. Integer PCM is scaled by
+// its full-scale value (e.g. 2^23 for 24-bit) and 8-bit PCM is unsigned, per
+// the WAV spec. A trailing partial frame is ignored.
+func decodeWAVChannels(data []byte, f wavSampleFormat) ([][]float32, error) {
+	if f.Channels <= 0 {
+		return nil, fmt.Errorf("invalid WAV channel count: %d", f.Channels)
+	}
+
+	var sample func(b []byte) float32
+	switch {
+	case f.Format == wavFormatPCM && f.BitsPerSample == 8:
+		sample = func(b []byte) float32 { return (float32(b[0]) - 128) / 128 }
+	case f.Format == wavFormatPCM && f.BitsPerSample == 16:
+		sample = func(b []byte) float32 { return float32(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }
+	case f.Format == wavFormatPCM && f.BitsPerSample == 24:
+		sample = func(b []byte) float32 {
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8 // Sign-extend
+			return float32(v) / (1 << 23)
+		}
+	case f.Format == wavFormatPCM && f.BitsPerSample == 32:
+		sample = func(b []byte) float32 { return float32(float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)) }
+	case f.Format == wavFormatFloat && f.BitsPerSample == 32:
+		sample = func(b []byte) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(b)) }
+	case f.Format == wavFormatFloat && f.BitsPerSample == 64:
+		sample = func(b []byte) float32 { return float32(math.Float64frombits(binary.LittleEndian.Uint64(b))) }
+	default:
+		return nil, fmt.Errorf("unsupported WAV sample format: format %d, %d bits", f.Format, f.BitsPerSample)
+	}
+
+	bytesPerSample := f.BitsPerSample / 8
+	frameSize := bytesPerSample * f.Channels
+	numFrames := len(data) / frameSize
+	channels := make([][]float32, f.Channels)
+	for ch := range channels {
+		channels[ch] = make([]float32, numFrames)
+		for i := range numFrames {
+			channels[ch][i] = sample(data[i*frameSize+ch*bytesPerSample:])
+		}
+	}
+	return channels, nil
+}
@@ -0,0 +1,222 @@
+package analysis
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeWAVChannels(t *testing.T) {
+	// A 440 Hz tone quantized to 16 bits, so every format below can represent
+	// it exactly, including full-scale negative
+	signal := make([]float32, 1000)
+	for i := range signal {
+		signal[i] = float32(math.Round(0.9*math.Sin(2*math.Pi*440*float64(i)/44100)*(1<<15))) / (1 << 15)
+	}
+	signal[0], signal[1] = -1, 1-1.0/(1<<15)
+
+	// encode writes signal as stereo frames with identical channels
+	encode := func(bits int, put func(b []byte, v float32)) []byte {
+		size := bits / 8
+		data := make([]byte, len(signal)*2*size)
+		for i, v := range signal {
+			put(data[2*i*size:], v)
+			put(data[(2*i+1)*size:], v)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name   string
+		format wavSampleFormat
+		data   []byte
+	}{
+		{"16-bit", wavSampleFormat{wavFormatPCM, 2, 16}, encode(16, func(b []byte, v float32) {
+			binary.LittleEndian.PutUint16(b, uint16(int16(v*(1<<15))))
+		})},
+		{"24-bit", wavSampleFormat{wavFormatPCM, 2, 24}, encode(24, func(b []byte, v float32) {
+			x := uint32(int32(v * (1 << 23)))
+			b[0], b[1], b[2] = byte(x), byte(x>>8), byte(x>>16)
+		})},
+		{"32-bit", wavSampleFormat{wavFormatPCM, 2, 32}, encode(32, func(b []byte, v float32) {
+			binary.LittleEndian.PutUint32(b, uint32(int32(float64(v)*(1<<31))))
+		})},
+		{"float32", wavSampleFormat{wavFormatFloat, 2, 32}, encode(32, func(b []byte, v float32) {
+			binary.LittleEndian.PutUint32(b, math.Float32bits(v))
+		})},
+		{"float64", wavSampleFormat{wavFormatFloat, 2, 64}, encode(64, func(b []byte, v float32) {
+			binary.LittleEndian.PutUint64(b, math.Float64bits(float64(v)))
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeWAVChannels(tt.data, tt.format)
+			require.NoError(t, err)
+			assert.Equal(t, [][]float32{signal, signal}, got)
+		})
+	}
+
+	// 8-bit is unsigned and coarser, but lands on the same scale
+	got, err := decodeWAVChannels([]byte{0, 64, 128, 192, 255}, wavSampleFormat{wavFormatPCM, 1, 8})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{-1, -0.5, 0, 0.5, 127.0 / 128}}, got)
+
+	// Channels are split, averaging to mono, and a trailing partial frame is dropped
+	data := make([]byte, 9)
+	binary.LittleEndian.PutUint16(data[0:], uint16(1<<14))
+	binary.LittleEndian.PutUint16(data[2:], 0)
+	binary.LittleEndian.PutUint16(data[4:], uint16(0x8000))
+	binary.LittleEndian.PutUint16(data[6:], uint16(0x8000))
+	got, err = decodeWAVChannels(data, wavSampleFormat{wavFormatPCM, 2, 16})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{0.5, -1}, {0, -1}}, got)
+	assert.Equal(t, []float32{0.25, -1}, mixDown(got))
+
+	_, err = decodeWAVChannels(data, wavSampleFormat{wavFormatFloat, 2, 16})
+	assert.ErrorContains(t, err, "unsupported WAV sample format")
+}
+
+func TestLoadWAVMono(t *testing.T) {
+	const sampleRate, duration = 48000, 1.5
+	n := int(duration * sampleRate)
+	signal := make([]float64, n)
+	for i := range signal {
+		signal[i] = 0.5 * math.Sin(2*math.Pi*440*float64(i)/sampleRate)
+	}
+
+	// write builds a WAV of signal on every channel, preceded by an odd-sized
+	// chunk to exercise padding
+	write := func(t *testing.T, tag uint16, channels, bits int, put func(b []byte, v float64)) string {
+		size := bits / 8
+		data := make([]byte, n*channels*size)
+		for i, v := range signal {
+			for ch := range channels {
+				put(data[(i*channels+ch)*size:], v)
+			}
+		}
+
+		fmtChunk := binary.LittleEndian.AppendUint16(nil, tag)
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(channels))
+		fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, sampleRate)
+		fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, uint32(sampleRate*channels*size))
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(channels*size))
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(bits))
+		if tag == wavFormatExtensible {
+			fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, 22)
+			fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(bits))
+			fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, 0)
+			fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, wavFormatPCM)
+			fmtChunk = append(fmtChunk, make([]byte, 14)...) // Rest of the GUID
+		}
+
+		var body []byte
+		chunk := func(id string, b []byte) {
+			body = append(body, id...)
+			body = binary.LittleEndian.AppendUint32(body, uint32(len(b)))
+			body = append(body, b...)
+			if len(b)%2 == 1 {
+				body = append(body, 0)
+			}
+		}
+		chunk("fmt ", fmtChunk)
+		chunk("LIST", []byte("INFOodd"))
+		chunk("data", data)
+
+		file := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(4+len(body)))...)
+		file = append(append(file, "WAVE"...), body...)
+		path := filepath.Join(t.TempDir(), "sine.wav")
+		require.NoError(t, os.WriteFile(path, file, 0644))
+		return path
+	}
+
+	tests := []struct {
+		name      string
+		path      func(t *testing.T) string
+		tolerance float64
+	}{
+		{"16-bit stereo", func(t *testing.T) string {
+			return write(t, wavFormatPCM, 2, 16, func(b []byte, v float64) {
+				binary.LittleEndian.PutUint16(b, uint16(int16(math.Round(v*(1<<15)))))
+			})
+		}, 1.0 / (1 << 15)},
+		{"24-bit extensible mono", func(t *testing.T) string {
+			return write(t, wavFormatExtensible, 1, 24, func(b []byte, v float64) {
+				x := uint32(int32(math.Round(v * (1 << 23))))
+				b[0], b[1], b[2] = byte(x), byte(x>>8), byte(x>>16)
+			})
+		}, 1.0 / (1 << 23)},
+		{"float32 5.1", func(t *testing.T) string {
+			return write(t, wavFormatFloat, 6, 32, func(b []byte, v float64) {
+				binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
+			})
+		}, 1e-6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path(t)
+			samples, rate, err := LoadAudioMono(path)
+			require.NoError(t, err)
+			assert.Equal(t, sampleRate, rate)
+			require.Len(t, samples, int(duration*sampleRate))
+			for i, v := range signal {
+				if math.Abs(float64(samples[i])-v) > tt.tolerance {
+					t.Fatalf("sample %d: got %v, want %v", i, samples[i], v)
+				}
+			}
+
+			// MaxDuration decodes only the start of the data chunk
+			start, _, err := LoadAudioMonoWithOptions(path, LoadAudioMonoOptions{MaxDuration: 0.5})
+			require.NoError(t, err)
+			assert.Equal(t, samples[:sampleRate/2], start)
+		})
+	}
+
+	// A header without a data chunk is an error, not an empty track
+	path := filepath.Join(t.TempDir(), "empty.wav")
+	require.NoError(t, os.WriteFile(path, []byte("RIFF\x04\x00\x00\x00WAVE"), 0644))
+	_, _, err := loadWAV(path, LoadAudioMonoOptions{})
+	assert.ErrorContains(t, err, "no data chunk")
+}
+
+func TestLoadAudioStereo(t *testing.T) {
+	// Stereo 16-bit WAV with a different ramp on each channel
+	const frames = 100
+	data := make([]byte, frames*4)
+	left, right := make([]float32, frames), make([]float32, frames)
+	for i := range frames {
+		left[i], right[i] = float32(i)/(1<<10), -float32(i)/(1<<11)
+		binary.LittleEndian.PutUint16(data[4*i:], uint16(int16(left[i]*(1<<15))))
+		binary.LittleEndian.PutUint16(data[4*i+2:], uint16(int16(right[i]*(1<<15))))
+	}
+	file := []byte("RIFF\x00\x00\x00\x00WAVEfmt \x10\x00\x00\x00")
+	file = binary.LittleEndian.AppendUint16(file, wavFormatPCM)
+	file = binary.LittleEndian.AppendUint16(file, 2)
+	file = binary.LittleEndian.AppendUint32(file, 44100)
+	file = binary.LittleEndian.AppendUint32(file, 44100*4)
+	file = binary.LittleEndian.AppendUint16(file, 4)
+	file = binary.LittleEndian.AppendUint16(file, 16)
+	file = append(file, "data"...)
+	file = binary.LittleEndian.AppendUint32(file, uint32(len(data)))
+	file = append(file, data...)
+	path := filepath.Join(t.TempDir(), "stereo.wav")
+	require.NoError(t, os.WriteFile(path, file, 0644))
+
+	channels, rate, err := LoadAudioStereo(path)
+	require.NoError(t, err)
+	assert.Equal(t, 44100, rate)
+	assert.Equal(t, [][]float32{left, right}, channels)
+
+	mono, _, err := LoadAudioMono(path)
+	require.NoError(t, err)
+	assert.Equal(t, mixDown(channels), mono)
+	assert.Equal(t, (left[10]+right[10])/2, mono[10])
+
+	interleaved := InterleaveChannels(channels)
+	require.Len(t, interleaved, 2*frames)
+	assert.Equal(t, []float32{left[3], right[3]}, interleaved[6:8])
+}
@@ -0,0 +1,154 @@
+// Package analysis provides beat detection and audio analysis.
+// This file provides multi-resolution and frequency-band waveforms.
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Crossover frequencies of BandedWaveform.
+const (
+	waveformLowHz  = 200.0
+	waveformHighHz = 2000.0
+)
+
+// maxWaveformLevel bounds the configured waveform pyramid resolutions, in
+// pixels per second.
+const maxWaveformLevel = 1000
+
+// GenerateWaveformPyramid decodes an audio file once and returns its waveform
+// at each resolution in levels (pixels per second), keyed by level, so a
+// client can pick the level matching its zoom.
+func GenerateWaveformPyramid(audioPath string, levels []int) (map[int]*Waveform, error) {
+	samples, sampleRate, err := LoadAudioMono(audioPath)
+	if err != nil {
+		return nil, fmt.Errorf("load audio: %w", err)
+	}
+	return waveformPyramidFromSamples(samples, sampleRate, levels)
+}
+
+// waveformPyramidFromSamples computes the finest level from the samples and
+// derives each coarser level by taking the extremes of the finest pixels that
+// start within its pixels, so all levels come from a single pass.
+func waveformPyramidFromSamples(samples []float32, sampleRate int, levels []int) (map[int]*Waveform, error) {
+	if len(levels) == 0 {
+		return nil, errors.New("no waveform levels")
+	}
+	if lowest := slices.Min(levels); lowest < 1 {
+		return nil, fmt.Errorf("invalid waveform level: %d pixels per second", lowest)
+	}
+
+	finest := slices.Max(levels)
+	fine, err := waveformFromSamples(samples, sampleRate, finest, WaveformOptions{})
+	if err != nil {
+		return nil, err
+	}
+	fineSamples := max(1, sampleRate/finest) // Samples per finest pixel
+
+	pyramid := map[int]*Waveform{finest: fine}
+	for _, px := range levels {
+		if _, ok := pyramid[px]; ok {
+			continue
+		}
+		pixelSamples := max(1, sampleRate/px)
+		n := len(samples) / pixelSamples
+		if n == 0 {
+			return nil, fmt.Errorf("audio too short")
+		}
+
+		w := &Waveform{PixelsPerSec: px, Peaks: make([]float64, n), Troughs: make([]float64, n)}
+		for i := range n {
+			// Finest pixels starting in [i, i+1) pixels, rounding the bounds up
+			lo := min((i*pixelSamples+fineSamples-1)/fineSamples, len(fine.Peaks)-1)
+			hi := max(min(((i+1)*pixelSamples+fineSamples-1)/fineSamples, len(fine.Peaks)), lo+1)
+			w.Peaks[i] = slices.Max(fine.Peaks[lo:hi])
+			w.Troughs[i] = slices.Min(fine.Troughs[lo:hi])
+		}
+		pyramid[px] = w
+	}
+	return pyramid, nil
+}
+
+// BandedWaveform holds the energy of three frequency bands per pixel, for
+// waveforms tinted by frequency content like Rekordbox's. Values are RMS
+// levels in the same full-scale units as Waveform peaks.
+type BandedWaveform struct {
+	PixelsPerSec int       `json:"pixels_per_sec"`
+	Low          []float64 `json:"low"`  // Below 200 Hz
+	Mid          []float64 `json:"mid"`  // 200 Hz to 2 kHz
+	High         []float64 `json:"high"` // Above 2 kHz
+}
+
+// GenerateWaveformBands decodes an audio file and returns the energy of its
+// low, mid, and high bands at pixelsPerSec.
+func GenerateWaveformBands(audioPath string, pixelsPerSec int) (*BandedWaveform, error) {
+	samples, sampleRate, err := LoadAudioMono(audioPath)
+	if err != nil {
+		return nil, fmt.Errorf("load audio: %w", err)
+	}
+	return waveformBandsFromSamples(samples, sampleRate, pixelsPerSec)
+}
+
+// waveformBandsFromSamples splits samples with second-order Butterworth
+// filters, a low pass and a high pass at the crossovers and both in series
+// for the mid band, running all three in one pass over the samples.
+func waveformBandsFromSamples(samples []float32, sampleRate, pixelsPerSec int) (*BandedWaveform, error) {
+	if sampleRate <= 0 || pixelsPerSec < 1 {
+		return nil, fmt.Errorf("invalid rate: %d Hz at %d pixels per second", sampleRate, pixelsPerSec)
+	}
+	samplesPerPixel := max(1, sampleRate/pixelsPerSec)
+	numPixels := len(samples) / samplesPerPixel
+	if numPixels == 0 {
+		return nil, fmt.Errorf("audio too short")
+	}
+
+	low := biquadFilter{biquad: butterworth(waveformLowHz, sampleRate, false)}
+	high := biquadFilter{biquad: butterworth(waveformHighHz, sampleRate, true)}
+	midHigh := biquadFilter{biquad: butterworth(waveformLowHz, sampleRate, true)}
+	midLow := biquadFilter{biquad: butterworth(waveformHighHz, sampleRate, false)}
+
+	w := &BandedWaveform{
+		PixelsPerSec: pixelsPerSec,
+		Low:          make([]float64, numPixels),
+		Mid:          make([]float64, numPixels),
+		High:         make([]float64, numPixels),
+	}
+	for i := range numPixels {
+		var l, m, h float64
+		for _, s := range samples[i*samplesPerPixel : (i+1)*samplesPerPixel] {
+			v := float64(s)
+			l += math.Pow(low.next(v), 2)
+			m += math.Pow(midLow.next(midHigh.next(v)), 2)
+			h += math.Pow(high.next(v), 2)
+		}
+		n := float64(samplesPerPixel)
+		w.Low[i] = min(math.Sqrt(l/n), 1)
+		w.Mid[i] = min(math.Sqrt(m/n), 1)
+		w.High[i] = min(math.Sqrt(h/n), 1)
+	}
+	return w, nil
+}
+
+// butterworth returns a second-order Butterworth low pass, or high pass if
+// highPass, at f0 Hz (RBJ Audio EQ Cookbook).
+func butterworth(f0 float64, sampleRate int, highPass bool) biquad {
+	w0 := 2 * math.Pi * min(f0, 0.49*float64(sampleRate)) / float64(sampleRate)
+	alpha := math.Sin(w0) / math.Sqrt2 // Q = 1/sqrt(2)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+
+	b1 := 1 - cos
+	if highPass {
+		b1 = -(1 + cos)
+	}
+	return biquad{
+		b0: math.Abs(b1) / 2 / a0,
+		b1: b1 / a0,
+		b2: math.Abs(b1) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
@@ -0,0 +1,133 @@
+package analysis
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaveformPyramid(t *testing.T) {
+	// A rising sine at 1 kHz, so pixels divide evenly at every level
+	const rate = 1000
+	samples := make([]float32, 5*rate)
+	for i := range samples {
+		samples[i] = float32(float64(i) / float64(len(samples)) * math.Sin(float64(i)/7))
+	}
+
+	pyramid, err := waveformPyramidFromSamples(samples, rate, []int{10, 100, 1, 100})
+	require.NoError(t, err)
+	require.Len(t, pyramid, 3)
+
+	// Each level matches computing it directly from the samples
+	for _, px := range []int{1, 10, 100} {
+		direct, err := waveformFromSamples(samples, rate, px, WaveformOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, direct, pyramid[px], "level %d", px)
+	}
+
+	// Levels that don't divide evenly still cover the audio
+	pyramid, err = waveformPyramidFromSamples(samples, rate, []int{3, 7, 100})
+	require.NoError(t, err)
+	for _, px := range []int{3, 7} {
+		direct, err := waveformFromSamples(samples, rate, px, WaveformOptions{})
+		require.NoError(t, err)
+		require.Len(t, pyramid[px].Peaks, len(direct.Peaks))
+		for i := range direct.Peaks {
+			assert.InDelta(t, direct.Peaks[i], pyramid[px].Peaks[i], 0.02, "level %d pixel %d", px, i)
+			assert.InDelta(t, direct.Troughs[i], pyramid[px].Troughs[i], 0.02, "level %d pixel %d", px, i)
+		}
+	}
+
+	_, err = waveformPyramidFromSamples(samples, rate, nil)
+	assert.Error(t, err)
+	_, err = waveformPyramidFromSamples(samples, rate, []int{0, 10})
+	assert.Error(t, err)
+	_, err = waveformPyramidFromSamples(samples[:5], rate, []int{1, 10})
+	assert.Error(t, err)
+}
+
+func TestWaveformRMS(t *testing.T) {
+	// A full-scale square wave has RMS 1, a half-scale sine 0.5/sqrt(2)
+	const rate = 1000
+	samples := make([]float32, 2*rate)
+	for i := range rate {
+		samples[i] = float32(1 - 2*(i%2))
+		samples[rate+i] = float32(0.5 * math.Sin(2*math.Pi*float64(i)/20))
+	}
+
+	w, err := waveformFromSamples(samples, rate, 10, WaveformOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, w.RMS, "RMS is opt-in")
+
+	w, err = waveformFromSamples(samples, rate, 10, WaveformOptions{RMS: true})
+	require.NoError(t, err)
+	require.Len(t, w.RMS, 20)
+	for i, v := range w.RMS {
+		want := 1.0
+		if i >= 10 {
+			want = 0.5 / math.Sqrt2
+		}
+		assert.InDelta(t, want, v, 1e-3, "pixel %d", i)
+		assert.LessOrEqual(t, v, w.Peaks[i]+1e-9)
+	}
+}
+
+func TestWaveformBands(t *testing.T) {
+	const rate = 44100
+	mean := func(v []float64) float64 {
+		var sum float64
+		for _, x := range v[len(v)/10:] { // Skip the filters settling
+			sum += x
+		}
+		return sum / float64(len(v)-len(v)/10)
+	}
+
+	// Pink noise (Paul Kellet's filter) has equal energy per octave, and the
+	// three bands span about as many octaves each
+	rng := rand.New(rand.NewPCG(1, 2))
+	pink := make([]float32, 10*rate)
+	var b0, b1, b2, b3, b4, b5, b6 float64
+	for i := range pink {
+		white := rng.Float64()*2 - 1
+		b0 = 0.99886*b0 + white*0.0555179
+		b1 = 0.99332*b1 + white*0.0750759
+		b2 = 0.96900*b2 + white*0.1538520
+		b3 = 0.86650*b3 + white*0.3104856
+		b4 = 0.55000*b4 + white*0.5329522
+		b5 = -0.7616*b5 - white*0.0168980
+		pink[i] = float32((b0 + b1 + b2 + b3 + b4 + b5 + b6 + white*0.5362) * 0.05)
+		b6 = white * 0.115926
+	}
+	w, err := waveformBandsFromSamples(pink, rate, 10)
+	require.NoError(t, err)
+	require.Len(t, w.Low, 100)
+	require.Len(t, w.Mid, 100)
+	require.Len(t, w.High, 100)
+	low, mid, high := mean(w.Low), mean(w.Mid), mean(w.High)
+	t.Logf("pink noise: low %.4f mid %.4f high %.4f", low, mid, high)
+	for _, pair := range [][2]float64{{low, mid}, {mid, high}, {low, high}} {
+		assert.InDelta(t, 1, pair[0]/pair[1], 0.5)
+	}
+
+	// A bass sweep from 40 to 120 Hz sits in the low band
+	sweep := make([]float32, 5*rate)
+	var phase float64
+	for i := range sweep {
+		phase += 2 * math.Pi * (40 + 80*float64(i)/float64(len(sweep))) / rate
+		sweep[i] = float32(0.5 * math.Sin(phase))
+	}
+	w, err = waveformBandsFromSamples(sweep, rate, 10)
+	require.NoError(t, err)
+	low, mid, high = mean(w.Low), mean(w.Mid), mean(w.High)
+	t.Logf("bass sweep: low %.4f mid %.4f high %.4f", low, mid, high)
+	assert.Greater(t, low, 3*mid)
+	assert.Greater(t, mid, high)
+
+	_, err = waveformBandsFromSamples(sweep[:10], rate, 10)
+	assert.Error(t, err)
+	_, err = waveformBandsFromSamples(sweep, rate, 0)
+	assert.Error(t, err)
+}
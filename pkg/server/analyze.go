@@ -0,0 +1,81 @@
+// Package server provides the Echo web server for the beat grid visualizer.
+// This file provides on-demand analysis of a single track.
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nzoschke/mixxxlab/pkg/analysis"
+)
+
+// analyzeRequest is the body of POST /api/analyze.
+type analyzeRequest struct {
+	Path  string `json:"path"`  // Audio file relative to music/
+	Force bool   `json:"force"` // Reanalyze even if a JSON sidecar exists
+}
+
+// trackPath validates an audio file path relative to music/ and returns its
+// path on disk, or an HTTP error.
+func trackPath(path string) (string, error) {
+	// Security: prevent directory traversal
+	if path == "" || strings.Contains(path, "..") {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid path")
+	}
+	if !isAudioFile(strings.ToLower(filepath.Ext(path))) {
+		return "", echo.NewHTTPError(http.StatusForbidden, "file type not allowed")
+	}
+	fullPath := filepath.Join("music", path)
+	if info, err := os.Stat(fullPath); err != nil || info.IsDir() {
+		return "", echo.NewHTTPError(http.StatusNotFound, "file not found")
+	}
+	return fullPath, nil
+}
+
+// analyze analyzes one audio file under music/, writes its JSON sidecar, and
+// returns the TrackAnalysis. An existing sidecar is a 409 Conflict unless
+// force is set. The library manifest is updated if it exists.
+func (s *Server) analyze(c echo.Context) error {
+	var req analyzeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	fullPath, err := trackPath(req.Path)
+	if err != nil {
+		return err
+	}
+	jsonPath := strings.TrimSuffix(fullPath, filepath.Ext(fullPath)) + ".json"
+	if _, err := os.Stat(jsonPath); err == nil && !req.Force {
+		return echo.NewHTTPError(http.StatusConflict, "already analyzed")
+	}
+
+	ctx, a, unlock, err := s.lockAnalyzer(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ta, err := a.AnalyzeFileWithContext(ctx, fullPath)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := ta.WriteJSON(jsonPath); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	if _, err := os.Stat(filepath.Join("music", analysis.ManifestFileName)); err == nil {
+		m, err := analysis.ReadManifest("music")
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		m.Update("music", fullPath, jsonPath, ta)
+		if err := m.Write("music"); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	return c.JSON(http.StatusOK, ta)
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nzoschke/mixxxlab/pkg/analysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSilentWAV writes a 16-bit mono PCM WAV of frames silent samples at 44.1 kHz.
+func writeSilentWAV(t *testing.T, path string, frames int) {
+	t.Helper()
+
+	const rate = 44100
+	data := make([]byte, 44+2*frames)
+	copy(data, "RIFF")
+	binary.LittleEndian.PutUint32(data[4:], uint32(36+2*frames))
+	copy(data[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(data[16:], 16)
+	binary.LittleEndian.PutUint16(data[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(data[22:], 1) // Mono
+	binary.LittleEndian.PutUint32(data[24:], rate)
+	binary.LittleEndian.PutUint32(data[28:], 2*rate)
+	binary.LittleEndian.PutUint16(data[32:], 2)
+	binary.LittleEndian.PutUint16(data[34:], 16)
+	copy(data[36:], "data")
+	binary.LittleEndian.PutUint32(data[40:], uint32(2*frames))
+	require.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+func TestAnalyze(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.Mkdir("music", 0755))
+	writeSilentWAV(t, filepath.Join("music", "silent.wav"), 44100*5)
+
+	cfg := analysis.DefaultConfig()
+	cfg.Analyzers = []analysis.AnalyzerType{analysis.AnalyzerMixxExtended}
+	a, err := analysis.NewWithConfig(cfg)
+	require.NoError(t, err)
+	s := NewServer(a)
+	e := echo.New()
+	e.POST("/api/analyze", s.analyze)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/analyze", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Analyzes and writes the sidecar
+	rec := post(`{"path": "silent.wav"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	ta, err := analysis.ReadTrackAnalysis(filepath.Join("music", "silent.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "silent.wav", ta.File)
+	var got analysis.TrackAnalysis
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, ta.Grids, got.Grids)
+
+	// An existing sidecar is only replaced with force
+	assert.Equal(t, http.StatusConflict, post(`{"path": "silent.wav"}`).Code)
+	assert.Equal(t, http.StatusOK, post(`{"path": "silent.wav", "force": true}`).Code)
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"path": "../silent.wav"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{}`).Code)
+	assert.Equal(t, http.StatusForbidden, post(`{"path": "silent.json"}`).Code)
+	assert.Equal(t, http.StatusNotFound, post(`{"path": "missing.wav"}`).Code)
+
+	// After Close the analyzer is released
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close())
+	assert.Equal(t, http.StatusServiceUnavailable, post(`{"path": "silent.wav", "force": true}`).Code)
+}
@@ -0,0 +1,78 @@
+// Package server provides the Echo web server for the beat grid visualizer.
+// This file provides file analysis with progress streamed over a WebSocket.
+package server
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nzoschke/mixxxlab/pkg/analysis"
+	"golang.org/x/net/websocket"
+)
+
+// AnalyzeMessage is a JSON message sent on the analysis WebSocket. Progress
+// messages only carry the stage and percent. The last message has stage
+// analysis.ProgressDone and the full analysis in Result, or Error if the
+// analysis failed.
+type AnalyzeMessage struct {
+	analysis.Progress
+	Result *analysis.TrackAnalysis `json:"result,omitempty"`
+	Error  string                  `json:"error,omitempty"`
+}
+
+// analyzeWS upgrades to a WebSocket, analyzes the audio file at the path
+// query parameter (relative to music/) with the shared analyzer, and sends
+// AnalyzeMessages as it runs. The analysis is cancelled when the client
+// disconnects. The sidecar is not written. The auth token may be passed in
+// the token query parameter.
+func (s *Server) analyzeWS(c echo.Context) error {
+	fullPath, err := trackPath(c.QueryParam("path"))
+	if err != nil {
+		return err
+	}
+
+	websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		ctx, a, unlock, err := s.lockAnalyzer(context.Background())
+		if err != nil {
+			websocket.JSON.Send(ws, AnalyzeMessage{Progress: analysis.Progress{Stage: analysis.ProgressDone}, Error: err.Error()})
+			return
+		}
+		defer unlock()
+
+		// The client sends nothing, so a failed read means it disconnected
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			var discard string
+			for websocket.Message.Receive(ws, &discard) == nil {
+			}
+			cancel()
+		}()
+
+		send := func(msg AnalyzeMessage) {
+			if err := websocket.JSON.Send(ws, msg); err != nil {
+				cancel()
+			}
+		}
+
+		// The final progress is sent with the result instead
+		ctx = analysis.WithProgress(ctx, func(p analysis.Progress) {
+			if p.Stage != analysis.ProgressDone {
+				send(AnalyzeMessage{Progress: p})
+			}
+		})
+		result, err := a.AnalyzeFileWithContext(ctx, fullPath)
+		if ctx.Err() != nil {
+			return
+		}
+		done := analysis.Progress{Stage: analysis.ProgressDone, Percent: 100}
+		if err != nil {
+			send(AnalyzeMessage{Progress: done, Error: err.Error()})
+			return
+		}
+		send(AnalyzeMessage{Progress: done, Result: result})
+	}).ServeHTTP(c.Response(), c.Request())
+	return nil
+}
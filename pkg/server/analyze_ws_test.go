@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nzoschke/mixxxlab/pkg/analysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestAnalyzeWS(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.Mkdir("music", 0755))
+	writeSilentMP3(t, filepath.Join("music", "silent.mp3"), 200)
+
+	cfg := analysis.DefaultConfig()
+	cfg.Analyzers = []analysis.AnalyzerType{analysis.AnalyzerMixxExtended}
+	a, err := analysis.NewWithConfig(cfg)
+	require.NoError(t, err)
+	s := NewServer(a)
+	defer s.Close()
+	e := echo.New()
+	e.GET("/api/analyze/ws", s.analyzeWS)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	ws, err := websocket.Dial(strings.Replace(srv.URL, "http", "ws", 1)+"/api/analyze/ws?path=silent.mp3", "", srv.URL)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	var progress []analysis.Progress
+	for {
+		var msg AnalyzeMessage
+		require.NoError(t, websocket.JSON.Receive(ws, &msg))
+		if msg.Stage == analysis.ProgressDone {
+			require.Empty(t, msg.Error)
+			require.NotNil(t, msg.Result)
+			assert.Equal(t, "silent.mp3", msg.Result.File)
+			assert.Contains(t, msg.Result.Grids, string(analysis.AnalyzerMixxExtended))
+			assert.Equal(t, 100.0, msg.Percent)
+			break
+		}
+		assert.Nil(t, msg.Result)
+		progress = append(progress, msg.Progress)
+	}
+	require.NotEmpty(t, progress)
+	assert.Equal(t, string(analysis.AnalyzerMixxExtended), progress[0].Stage)
+	for i := 1; i < len(progress); i++ {
+		assert.GreaterOrEqual(t, progress[i].Percent, progress[i-1].Percent)
+	}
+
+	// Paths are checked before upgrading
+	get := func(url string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusBadRequest, get("/api/analyze/ws?path=../secret.mp3"))
+	assert.Equal(t, http.StatusForbidden, get("/api/analyze/ws?path=silent.json"))
+	assert.Equal(t, http.StatusNotFound, get("/api/analyze/ws?path=missing.mp3"))
+}
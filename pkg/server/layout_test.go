@@ -22,10 +22,11 @@ func TestLayout(t *testing.T) {
 	// Start server on test port
 	e := echo.New()
 	e.HideBanner = true
-	e.GET("/", serveIndex)
+	s := NewServer(nil)
+	e.GET("/", s.serveIndex)
 	e.Static("/src", "src")
-	e.GET("/api/music", listMusic)
-	e.GET("/api/music/*", serveMusic)
+	e.GET("/api/music", s.listMusic)
+	e.GET("/api/music/*", s.serveMusic)
 
 	go func() {
 		e.Start(":18080")
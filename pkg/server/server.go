@@ -2,16 +2,24 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/nzoschke/mixxxlab/pkg/analysis"
 )
 
 // Track represents a track in the music library.
@@ -22,8 +30,96 @@ type Track struct {
 	JSONPath string `json:"json_path,omitempty"`
 }
 
-// Run starts the web server on :8080.
-func Run() error {
+// TrackList is a page of tracks from the music library.
+type TrackList struct {
+	Tracks []Track `json:"tracks"`
+	Total  int     `json:"total"` // Tracks matching the filters, across all pages
+}
+
+// maxTrackLimit bounds the page size a client can request from /api/music.
+const maxTrackLimit = 1000
+
+// Server serves the visualizer and analyzes tracks on demand with one
+// analyzer created at startup, so its models and CGO state are loaded once
+// and reused by every analysis.
+type Server struct {
+	ctx    context.Context // Cancelled by Close to stop running analyses
+	cancel context.CancelFunc
+
+	mu       sync.Mutex // Serializes analyses, as analyzers aren't safe for concurrent use
+	analyzer *analysis.Analyzer
+
+	waveforms    waveformCache    // Recently computed waveforms
+	spectrograms spectrogramCache // Recently viewed spectrograms
+}
+
+// NewServer creates a server that analyzes with a, which it closes on Close.
+// With a nil analyzer the analyze endpoints respond 503 Service Unavailable.
+func NewServer(a *analysis.Analyzer) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{ctx: ctx, cancel: cancel, analyzer: a}
+}
+
+// Close stops running analyses, waits for them to return, and releases the
+// analyzer. It is safe to call more than once.
+func (s *Server) Close() error {
+	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.analyzer == nil {
+		return nil
+	}
+	err := s.analyzer.Close()
+	s.analyzer = nil
+	return err
+}
+
+// lockAnalyzer returns the analyzer locked for the caller until it calls
+// unlock, and a context derived from parent that is also cancelled when the
+// server closes. The caller must call unlock, which also releases ctx.
+func (s *Server) lockAnalyzer(parent context.Context) (ctx context.Context, a *analysis.Analyzer, unlock func(), err error) {
+	s.mu.Lock()
+	if s.analyzer == nil {
+		s.mu.Unlock()
+		return nil, nil, nil, echo.NewHTTPError(http.StatusServiceUnavailable, "analyzer not available")
+	}
+	ctx, cancel := context.WithCancel(parent)
+	stop := context.AfterFunc(s.ctx, cancel)
+	return ctx, s.analyzer, func() {
+		stop()
+		cancel()
+		s.mu.Unlock()
+	}, nil
+}
+
+// Run starts the web server on :8080 until ctx is cancelled. If authToken is
+// non-empty, mutating endpoints require it as a bearer token; read endpoints
+// stay open.
+func Run(ctx context.Context, authToken string) error {
+	a, err := analysis.New()
+	if err != nil {
+		return fmt.Errorf("create analyzer: %w", err)
+	}
+	s := NewServer(a)
+	defer s.Close()
+
+	e := s.newEcho(authToken)
+	e.Server.RegisterOnShutdown(s.cancel)
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		e.Shutdown(shutdownCtx)
+	})
+	defer stop()
+
+	if err := e.Start(":8080"); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// newEcho builds the Echo instance with middleware and routes.
+func (s *Server) newEcho(authToken string) *echo.Echo {
 	e := echo.New()
 	e.HideBanner = true
 
@@ -33,24 +129,77 @@ func Run() error {
 	e.Use(middleware.CORS())
 
 	// Routes
-	e.GET("/", serveIndex)
+	e.GET("/", s.serveIndex)
 	e.Static("/src", "src")
-	e.GET("/api/music", listMusic)
-	e.GET("/api/music/*", serveMusic)
+	e.GET("/api/music", s.listMusic)
+	e.GET("/api/library", s.serveLibrary)
+	e.GET("/api/music/*", s.serveMusic)
+	e.GET("/api/waveform/*", s.serveWaveformPath)
 
-	return e.Start(":8080")
+	// Mutating routes
+	auth := requireToken(authToken, "")
+	e.POST("/api/analyze/stream", analyzeStream, auth)
+	e.POST("/api/analyze", s.analyze, auth)
+	// Browsers cannot set headers on a WebSocket handshake
+	e.GET("/api/analyze/ws", s.analyzeWS, requireToken(authToken, "token"))
+
+	return e
+}
+
+// requireToken returns middleware that rejects requests without an
+// "Authorization: Bearer <token>" header matching token. If query is
+// non-empty, the token is also accepted in that query parameter. An empty
+// token disables the check.
+func requireToken(token, query string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if token == "" {
+				return next(c)
+			}
+			got, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok && query != "" {
+				got = c.QueryParam(query)
+				ok = got != ""
+			}
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="mixxxlab"`)
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing or invalid auth token")
+			}
+			return next(c)
+		}
+	}
 }
 
 // serveIndex serves the main index.html page.
-func serveIndex(c echo.Context) error {
+func (s *Server) serveIndex(c echo.Context) error {
 	return c.File("src/index.html")
 }
 
-// listMusic returns a list of all tracks in the music directory.
-func listMusic(c echo.Context) error {
-	var tracks []Track
+// listMusic returns a page of the tracks in the music directory, in path order.
+// Query parameters: limit (default 100, at most maxTrackLimit), offset,
+// analyzed (true or false to filter on whether a JSON sidecar exists), and q
+// (case-insensitive substring of the path). Total counts every match.
+func (s *Server) listMusic(c echo.Context) error {
+	limit, err := queryInt(c, "limit", 100)
+	if err != nil || limit < 1 || limit > maxTrackLimit {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit must be 1 to %d", maxTrackLimit))
+	}
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid offset")
+	}
+	var analyzed *bool
+	if v := c.QueryParam("analyzed"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "analyzed must be true or false")
+		}
+		analyzed = &b
+	}
+	q := strings.ToLower(c.QueryParam("q"))
 
-	err := filepath.WalkDir("music", func(path string, d fs.DirEntry, err error) error {
+	list := TrackList{Tracks: []Track{}}
+	err = filepath.WalkDir("music", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -65,6 +214,9 @@ func listMusic(c echo.Context) error {
 
 		// Convert path to URL path (relative to music/)
 		relPath := strings.TrimPrefix(path, "music/")
+		if q != "" && !strings.Contains(strings.ToLower(relPath), q) {
+			return nil
+		}
 		jsonPath := strings.TrimSuffix(path, ext) + ".json"
 
 		track := Track{
@@ -78,7 +230,13 @@ func listMusic(c echo.Context) error {
 			track.JSONPath = strings.TrimPrefix(jsonPath, "music/")
 		}
 
-		tracks = append(tracks, track)
+		if analyzed != nil && track.HasJSON != *analyzed {
+			return nil
+		}
+		if list.Total >= offset && len(list.Tracks) < limit {
+			list.Tracks = append(list.Tracks, track)
+		}
+		list.Total++
 		return nil
 	})
 
@@ -86,31 +244,47 @@ func listMusic(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
-	return c.JSON(http.StatusOK, tracks)
+	return c.JSON(http.StatusOK, list)
 }
 
-// serveMusic serves audio files and JSON analysis files from the music directory.
-func serveMusic(c echo.Context) error {
-	// Get the path after /api/music/ and URL-decode it
-	path := c.Param("*")
-	decodedPath, err := url.PathUnescape(path)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid path encoding")
+// serveLibrary returns the library manifest summarizing every analyzed track,
+// served from music/library.json when present and built from sidecars otherwise.
+func (s *Server) serveLibrary(c echo.Context) error {
+	path := filepath.Join("music", analysis.ManifestFileName)
+	if _, err := os.Stat(path); err == nil {
+		return c.File(path)
 	}
-	fullPath := filepath.Join("music", decodedPath)
 
-	// Security: prevent directory traversal
-	if strings.Contains(decodedPath, "..") {
-		return echo.NewHTTPError(http.StatusForbidden, "invalid path")
+	m, err := analysis.BuildManifest("music")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
+	return c.JSON(http.StatusOK, m)
+}
 
-	// Check file exists
-	info, err := os.Stat(fullPath)
+// audioViews are the derived views of an audio file served at <path>/<view>.
+var audioViews = map[string]func(s *Server, c echo.Context, fullPath string, info os.FileInfo) error{
+	"spectrogram": (*Server).serveSpectrogram,
+	"waveform":    (*Server).serveWaveform,
+}
+
+// serveMusic serves audio files and JSON analysis files from the music directory,
+// and derived views of audio files: spectrogram tiles at <path>/spectrogram and
+// waveforms at <path>/waveform. JSON is served without its waveforms when
+// requested with ?waveform=false, for clients that fetch them separately.
+func (s *Server) serveMusic(c echo.Context) error {
+	decodedPath, err := musicParam(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "file not found")
+		return err
 	}
-	if info.IsDir() {
-		return echo.NewHTTPError(http.StatusForbidden, "cannot serve directory")
+	if i := strings.LastIndex(decodedPath, "/"); i >= 0 {
+		if _, ok := audioViews[decodedPath[i+1:]]; ok {
+			return s.serveAudioView(c, decodedPath[:i], decodedPath[i+1:])
+		}
+	}
+	fullPath, _, err := musicFile(decodedPath)
+	if err != nil {
+		return err
 	}
 
 	// Only serve allowed file types
@@ -128,11 +302,56 @@ func serveMusic(c echo.Context) error {
 		if err := json.Unmarshal(data, &analysis); err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "invalid JSON")
 		}
+		if c.QueryParam("waveform") == "false" {
+			delete(analysis, "waveform")
+			delete(analysis, "waveform_levels")
+		}
 		return c.JSON(http.StatusOK, analysis)
 	}
 	return echo.NewHTTPError(http.StatusForbidden, "file type not allowed")
 }
 
+// musicParam returns the URL-decoded path after the route prefix, e.g.
+// /api/music/.
+func musicParam(c echo.Context) (string, error) {
+	decodedPath, err := url.PathUnescape(c.Param("*"))
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid path encoding")
+	}
+	return decodedPath, nil
+}
+
+// musicFile resolves decodedPath in the music directory to an existing file.
+func musicFile(decodedPath string) (string, os.FileInfo, error) {
+	// Security: prevent directory traversal
+	if strings.Contains(decodedPath, "..") {
+		return "", nil, echo.NewHTTPError(http.StatusForbidden, "invalid path")
+	}
+
+	fullPath := filepath.Join("music", decodedPath)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return "", nil, echo.NewHTTPError(http.StatusNotFound, "file not found")
+	}
+	if info.IsDir() {
+		return "", nil, echo.NewHTTPError(http.StatusForbidden, "cannot serve directory")
+	}
+	return fullPath, info, nil
+}
+
+// serveAudioView serves the derived view named view (see audioViews) of the
+// audio file at decodedPath in the music directory.
+func (s *Server) serveAudioView(c echo.Context, decodedPath, view string) error {
+	fullPath, info, err := musicFile(decodedPath)
+	if err != nil {
+		return err
+	}
+	if !isAudioFile(strings.ToLower(filepath.Ext(decodedPath))) {
+		return echo.NewHTTPError(http.StatusForbidden, "file type not allowed")
+	}
+	return audioViews[view](s, c, fullPath, info)
+}
+
 // isAudioFile returns true if the extension is a supported audio format.
 func isAudioFile(ext string) bool {
 	switch ext {
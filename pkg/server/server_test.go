@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthToken(t *testing.T) {
+	e := NewServer(nil).newEcho("secret")
+
+	do := func(method, path, auth string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(""))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Write requests without the token are rejected
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/analyze/stream?sample_rate=44100", ""))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/analyze/stream?sample_rate=44100", "Bearer wrong"))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/analyze", ""))
+
+	// With the token the request reaches the handler, which rejects the empty stream
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/analyze/stream?sample_rate=44100", "Bearer secret"))
+
+	// The WebSocket accepts the token as a query parameter, which other routes do not
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/analyze/ws", ""))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/analyze/ws?token=wrong", ""))
+	assert.NotEqual(t, http.StatusUnauthorized, do(http.MethodGet, "/api/analyze/ws?token=secret", ""))
+	assert.NotEqual(t, http.StatusUnauthorized, do(http.MethodGet, "/api/analyze/ws", "Bearer secret"))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/analyze?token=secret", ""))
+
+	// Read endpoints stay open
+	assert.NotEqual(t, http.StatusUnauthorized, do(http.MethodGet, "/api/music", ""))
+
+	// No token disables auth
+	e = NewServer(nil).newEcho("")
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/analyze/stream?sample_rate=44100", ""))
+}
+
+func TestListMusic(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, name := range []string{"a.mp3", "b.mp3", "b.json", "notes.txt", "sub/Club Mix.flac"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join("music", name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join("music", name), nil, 0644))
+	}
+
+	e := echo.New()
+	e.GET("/api/music", NewServer(nil).listMusic)
+	list := func(query string) (TrackList, int) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/music"+query, nil))
+		var l TrackList
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &l))
+		}
+		return l, rec.Code
+	}
+	paths := func(l TrackList) []string {
+		out := []string{}
+		for _, tr := range l.Tracks {
+			out = append(out, tr.Path)
+		}
+		return out
+	}
+
+	l, _ := list("")
+	assert.Equal(t, []string{"a.mp3", "b.mp3", "sub/Club Mix.flac"}, paths(l))
+	assert.Equal(t, 3, l.Total)
+	assert.Equal(t, "b.json", l.Tracks[1].JSONPath)
+
+	// Pages count every match
+	l, _ = list("?limit=1&offset=1")
+	assert.Equal(t, []string{"b.mp3"}, paths(l))
+	assert.Equal(t, 3, l.Total)
+	l, _ = list("?offset=5")
+	assert.Empty(t, l.Tracks)
+	assert.Equal(t, 3, l.Total)
+
+	// Filters
+	l, _ = list("?analyzed=true")
+	assert.Equal(t, []string{"b.mp3"}, paths(l))
+	l, _ = list("?analyzed=false")
+	assert.Equal(t, []string{"a.mp3", "sub/Club Mix.flac"}, paths(l))
+	l, _ = list("?q=club")
+	assert.Equal(t, []string{"sub/Club Mix.flac"}, paths(l))
+	assert.Equal(t, 1, l.Total)
+
+	for _, q := range []string{"?limit=0", "?limit=5000", "?offset=-1", "?analyzed=maybe"} {
+		_, code := list(q)
+		assert.Equal(t, http.StatusBadRequest, code, q)
+	}
+}
@@ -0,0 +1,116 @@
+// Package server provides the Echo web server for the beat grid visualizer.
+// This file provides tiled spectrogram images for zoomable views.
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nzoschke/mixxxlab/pkg/analysis"
+)
+
+// maxCachedSpectrograms bounds how many tracks' spectrograms stay in memory.
+const maxCachedSpectrograms = 8
+
+// spectrogramEntry is a cached spectrogram, invalidated when the audio file
+// changes. ready is closed once spec and err are set, so concurrent tile
+// requests for the same track wait for one decode rather than each decoding it.
+type spectrogramEntry struct {
+	modTime time.Time
+	ready   chan struct{}
+	spec    *analysis.Spectrogram
+	err     error
+}
+
+// spectrogramCache holds a server's recently viewed spectrograms keyed by file
+// path, oldest first in order. The zero value is ready to use.
+type spectrogramCache struct {
+	mu      sync.Mutex
+	entries map[string]*spectrogramEntry
+	order   []string
+}
+
+// get returns the spectrogram for path, computing it on first use. Decoding
+// happens outside the lock, so tiles of other tracks aren't held up. Failures
+// are not cached.
+func (c *spectrogramCache) get(path string, modTime time.Time) (*analysis.Spectrogram, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[path]; ok && e.modTime.Equal(modTime) {
+		c.mu.Unlock()
+		<-e.ready
+		return e.spec, e.err
+	}
+
+	e := &spectrogramEntry{modTime: modTime, ready: make(chan struct{})}
+	if c.entries == nil {
+		c.entries = make(map[string]*spectrogramEntry)
+	}
+	if _, ok := c.entries[path]; !ok {
+		c.order = append(c.order, path)
+	}
+	c.entries[path] = e
+	for len(c.order) > maxCachedSpectrograms {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.mu.Unlock()
+
+	samples, sampleRate, err := analysis.LoadAudioMono(path)
+	if err == nil {
+		e.spec = analysis.ComputeSpectrogram(samples, sampleRate)
+	}
+	e.err = err
+	close(e.ready)
+	if e.err != nil {
+		c.mu.Lock()
+		if c.entries[path] == e {
+			delete(c.entries, path)
+			c.order = slices.DeleteFunc(c.order, func(p string) bool { return p == path })
+		}
+		c.mu.Unlock()
+	}
+	return e.spec, e.err
+}
+
+// serveSpectrogram renders one JPEG tile of an audio file's spectrogram.
+// Query parameters: z (zoom level, default 0), x (tile index at that zoom,
+// 0 to 2^z-1, default 0), and h (tile height in pixels, default 256). The
+// tile's time span is reported in the X-Tile-Start and X-Tile-End headers.
+func (s *Server) serveSpectrogram(c echo.Context, fullPath string, info os.FileInfo) error {
+	z, err := queryInt(c, "z", 0)
+	if err != nil || z < 0 || z > analysis.SpectrogramMaxZoom {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("z must be 0 to %d", analysis.SpectrogramMaxZoom))
+	}
+	x, err := queryInt(c, "x", 0)
+	if err != nil || x < 0 || x >= 1<<z {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("x must be 0 to %d at zoom %d", 1<<z-1, z))
+	}
+	height, err := queryInt(c, "h", 256)
+	if err != nil || height < 16 || height > 1024 {
+		return echo.NewHTTPError(http.StatusBadRequest, "h must be 16 to 1024")
+	}
+
+	spec, err := s.spectrograms.get(fullPath, info.ModTime())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, spec.RenderTile(x, z, height), &jpeg.Options{Quality: 85}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	start, end := spec.TileRange(x, z)
+	h := c.Response().Header()
+	h.Set("X-Tile-Start", fmt.Sprintf("%.3f", float64(start)))
+	h.Set("X-Tile-End", fmt.Sprintf("%.3f", float64(end)))
+	h.Set("Cache-Control", "max-age=3600")
+	return c.Blob(http.StatusOK, "image/jpeg", buf.Bytes())
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nzoschke/mixxxlab/pkg/analysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpectrogramTile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.Mkdir("music", 0755))
+	writeSilentMP3(t, filepath.Join("music", "silent.mp3"), 200)
+
+	e := echo.New()
+	e.GET("/api/music/*", NewServer(nil).serveMusic)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec
+	}
+
+	rec := get("/api/music/silent.mp3/spectrogram?z=2&x=1&h=64")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+
+	img, err := jpeg.Decode(rec.Body)
+	require.NoError(t, err)
+	assert.Equal(t, analysis.SpectrogramTileSize, img.Bounds().Dx())
+	assert.Equal(t, 64, img.Bounds().Dy())
+
+	// Second of four tiles covers the second quarter of the track
+	duration := 200 * 1152 / 44100.0
+	start, err := strconv.ParseFloat(rec.Header().Get("X-Tile-Start"), 64)
+	require.NoError(t, err)
+	end, err := strconv.ParseFloat(rec.Header().Get("X-Tile-End"), 64)
+	require.NoError(t, err)
+	assert.InDelta(t, duration/4, start, 0.05)
+	assert.InDelta(t, duration/2, end, 0.05)
+
+	// Tiles outside the zoom level and non-audio files are rejected
+	assert.Equal(t, http.StatusBadRequest, get("/api/music/silent.mp3/spectrogram?z=2&x=4").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/music/silent.mp3/spectrogram?z=99").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/music/missing.mp3/spectrogram").Code)
+
+	// Concurrent requests for the same track share one decode, until it changes
+	fullPath := filepath.Join("music", "silent.mp3")
+	info, err := os.Stat(fullPath)
+	require.NoError(t, err)
+	var cache spectrogramCache
+	specs := make([]*analysis.Spectrogram, 8)
+	var wg sync.WaitGroup
+	for i := range specs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			specs[i], _ = cache.get(fullPath, info.ModTime())
+		}()
+	}
+	wg.Wait()
+	for _, spec := range specs {
+		assert.Same(t, specs[0], spec)
+	}
+	spec, err := cache.get(fullPath, info.ModTime().Add(time.Second))
+	require.NoError(t, err)
+	assert.False(t, specs[0] == spec)
+
+	// Failures aren't cached
+	_, err = cache.get(filepath.Join("music", "missing.mp3"), info.ModTime())
+	assert.Error(t, err)
+	assert.Len(t, cache.entries, 1)
+	assert.Len(t, cache.order, 1)
+}
+
+// writeSilentMP3 writes frames frames of silent 44.1kHz mono MPEG-1 Layer III
+// (1152 samples each) to path.
+func writeSilentMP3(t *testing.T, path string, frames int) {
+	t.Helper()
+
+	frame := make([]byte, 104)
+	copy(frame, []byte{0xFF, 0xFB, 0x10, 0xC0})
+	var data []byte
+	for range frames {
+		data = append(data, frame...)
+	}
+	require.NoError(t, os.WriteFile(path, data, 0644))
+}
@@ -0,0 +1,132 @@
+// Package server provides the Echo web server for the beat grid visualizer.
+// This file provides chunked-upload streaming analysis with the QM-DSP analyzer.
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nzoschke/mixxxlab/pkg/analysis"
+)
+
+// Streaming upload framing: each block is a little-endian uint32 sample count
+// followed by that many little-endian float32 samples (interleaved if stereo).
+// A block with a count of 0 signals end-of-stream.
+
+// maxStreamBlockSamples bounds a single block so a bad header can't exhaust memory.
+const maxStreamBlockSamples = 1 << 20
+
+// WriteStreamBlock writes one framed block of samples. An empty block signals end-of-stream.
+func WriteStreamBlock(w io.Writer, samples []float32) error {
+	buf := make([]byte, 4+4*len(samples))
+	binary.LittleEndian.PutUint32(buf, uint32(len(samples)))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint32(buf[4+4*i:], math.Float32bits(s))
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadStreamBlock reads one framed block of samples. Returns an empty slice at end-of-stream.
+func ReadStreamBlock(r io.Reader) ([]float32, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(header[:])
+	if n > maxStreamBlockSamples {
+		return nil, fmt.Errorf("block too large: %d samples", n)
+	}
+
+	buf := make([]byte, 4*n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("read block: %w", err)
+	}
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return samples, nil
+}
+
+// analyzeStream feeds framed audio blocks from the request body to a streaming
+// QM analyzer and returns the grid once the client sends the end-of-stream block.
+// Query parameters: sample_rate (default 44100) and channels (1 or 2, default 1).
+func analyzeStream(c echo.Context) error {
+	sampleRate, err := queryInt(c, "sample_rate", 44100)
+	if err != nil || sampleRate <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid sample_rate")
+	}
+	channels, err := queryInt(c, "channels", 1)
+	if err != nil || channels < 1 || channels > 2 {
+		return echo.NewHTTPError(http.StatusBadRequest, "channels must be 1 or 2")
+	}
+
+	qm, err := analysis.NewQMAnalyzer(sampleRate, channels, nil)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	defer qm.Close()
+
+	body := bufio.NewReader(c.Request().Body)
+	for {
+		block, err := ReadStreamBlock(body)
+		if errors.Is(err, io.EOF) {
+			return echo.NewHTTPError(http.StatusBadRequest, "stream ended without end-of-stream block")
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if len(block) == 0 {
+			break
+		}
+		if len(block)%channels != 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "block is not a whole number of frames")
+		}
+		if err := qm.ProcessFrames(block, len(block)/channels); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	result, err := qm.Finalize(nil)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, &analysis.TrackAnalysis{
+		SchemaVersion: analysis.CurrentSchemaVersion,
+		File:          "stream",
+		Duration:      result.Duration,
+		SampleRate:    result.SampleRate,
+		Grids: map[string]*analysis.GridAnalysis{
+			string(analysis.AnalyzerMixxExtended): {
+				BPM:               result.BPM,
+				Beats:             result.Beats,
+				Downbeats:         result.Downbeats,
+				BeatsPerBar:       result.BeatsPerBar,
+				BeatConfidence:    result.BeatConfidence,
+				DetectionFunction: result.DetectionFunction,
+				BeatPeriods:       result.BeatPeriods,
+				ModalBPM:          analysis.ModalBPM(result.BeatPeriods, result),
+				StepSizeFrames:    result.StepSizeFrames,
+				WindowSize:        result.WindowSize,
+			},
+		},
+	})
+}
+
+// queryInt parses an integer query parameter, returning def if it is absent.
+func queryInt(c echo.Context, name string, def int) (int, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nzoschke/mixxxlab/pkg/analysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeStream(t *testing.T) {
+	e := echo.New()
+	e.POST("/api/analyze/stream", analyzeStream)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	// 20 seconds of 120 BPM clicks at 44.1kHz
+	const sampleRate = 44100
+	samples := make([]float32, 20*sampleRate)
+	for start := 0; start < len(samples); start += sampleRate / 2 {
+		for j := start; j < start+200 && j < len(samples); j++ {
+			samples[j] = 0.9
+		}
+	}
+
+	// Stream in uneven pieces, as a browser capture would
+	pr, pw := io.Pipe()
+	go func() {
+		for off := 0; off < len(samples); off += 10007 {
+			end := min(off+10007, len(samples))
+			if err := WriteStreamBlock(pw, samples[off:end]); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(WriteStreamBlock(pw, nil))
+	}()
+
+	resp, err := http.Post(srv.URL+"/api/analyze/stream?sample_rate=44100", "application/octet-stream", pr)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var ta analysis.TrackAnalysis
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&ta))
+	assert.InDelta(t, 20.0, float64(ta.Duration), 0.01)
+
+	g := ta.Grids[string(analysis.AnalyzerMixxExtended)]
+	require.NotNil(t, g)
+	assert.InDelta(t, 120.0, g.BPM, 2.0)
+	assert.NotEmpty(t, g.Beats)
+
+	// A stream cut off before the end-of-stream block is rejected
+	pr, pw = io.Pipe()
+	go func() {
+		WriteStreamBlock(pw, samples[:1000])
+		pw.Close()
+	}()
+	resp, err = http.Post(srv.URL+"/api/analyze/stream", "application/octet-stream", pr)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
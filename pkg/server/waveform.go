@@ -0,0 +1,122 @@
+// Package server provides the Echo web server for the beat grid visualizer.
+// This file provides waveforms served separately from the analysis JSON.
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nzoschke/mixxxlab/pkg/analysis"
+)
+
+// maxWaveformPixelsPerSec bounds the waveform resolution a client can request.
+const maxWaveformPixelsPerSec = 1000
+
+// maxCachedWaveforms bounds how many computed waveforms stay in memory.
+const maxCachedWaveforms = 32
+
+// waveformKey identifies a computed waveform by file and resolution.
+type waveformKey struct {
+	path string
+	px   int
+	rms  bool
+}
+
+// waveformEntry is a cached waveform, invalidated when the audio file changes.
+// ready is closed once waveform and err are set, so concurrent requests for
+// the same waveform wait for one decode rather than each decoding it.
+type waveformEntry struct {
+	modTime  time.Time
+	ready    chan struct{}
+	waveform *analysis.Waveform
+	err      error
+}
+
+// waveformCache holds a server's recently computed waveforms, oldest first in
+// order. The zero value is ready to use.
+type waveformCache struct {
+	mu      sync.Mutex
+	entries map[waveformKey]*waveformEntry
+	order   []waveformKey
+}
+
+// get returns the waveform for path at px pixels per second, computing it on
+// first use. Decoding happens outside the lock, so requests for other
+// waveforms aren't held up. Failures are not cached.
+func (c *waveformCache) get(path string, modTime time.Time, px int, opts analysis.WaveformOptions) (*analysis.Waveform, error) {
+	key := waveformKey{path: path, px: px, rms: opts.RMS}
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && e.modTime.Equal(modTime) {
+		c.mu.Unlock()
+		<-e.ready
+		return e.waveform, e.err
+	}
+
+	e := &waveformEntry{modTime: modTime, ready: make(chan struct{})}
+	if c.entries == nil {
+		c.entries = make(map[waveformKey]*waveformEntry)
+	}
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = e
+	for len(c.order) > maxCachedWaveforms {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.mu.Unlock()
+
+	e.waveform, e.err = analysis.GenerateWaveformWithOptions(path, px, opts)
+	close(e.ready)
+	if e.err != nil {
+		c.mu.Lock()
+		if c.entries[key] == e {
+			delete(c.entries, key)
+			c.order = slices.DeleteFunc(c.order, func(k waveformKey) bool { return k == key })
+		}
+		c.mu.Unlock()
+	}
+	return e.waveform, e.err
+}
+
+// serveWaveformPath serves /api/waveform/<path>, the same waveform as
+// /api/music/<path>/waveform, for clients that re-request it while zooming.
+func (s *Server) serveWaveformPath(c echo.Context) error {
+	decodedPath, err := musicParam(c)
+	if err != nil {
+		return err
+	}
+	return s.serveAudioView(c, decodedPath, "waveform")
+}
+
+// serveWaveform returns the waveform of an audio file at px pixels per second
+// (default 100), with its RMS envelope if rms=true. It is read from the JSON
+// sidecar when that was generated at the same resolution, has any requested
+// RMS, and is newer than the audio, and computed (and cached) otherwise.
+func (s *Server) serveWaveform(c echo.Context, fullPath string, info os.FileInfo) error {
+	px, err := queryInt(c, "px", 100)
+	if err != nil || px < 1 || px > maxWaveformPixelsPerSec {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("px must be 1 to %d", maxWaveformPixelsPerSec))
+	}
+	opts := analysis.WaveformOptions{RMS: c.QueryParam("rms") == "true"}
+
+	jsonPath := strings.TrimSuffix(fullPath, filepath.Ext(fullPath)) + ".json"
+	if jsonInfo, err := os.Stat(jsonPath); err == nil && !info.ModTime().After(jsonInfo.ModTime()) {
+		if ta, err := analysis.ReadTrackAnalysis(jsonPath); err == nil && ta.Waveform != nil && ta.Waveform.PixelsPerSec == px && (!opts.RMS || ta.Waveform.RMS != nil) {
+			return c.JSON(http.StatusOK, ta.Waveform)
+		}
+	}
+
+	w, err := s.waveforms.get(fullPath, info.ModTime(), px, opts)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, w)
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nzoschke/mixxxlab/pkg/analysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaveform(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.Mkdir("music", 0755))
+	writeSilentMP3(t, filepath.Join("music", "silent.mp3"), 200)
+
+	e := echo.New()
+	e.GET("/api/music/*", NewServer(nil).serveMusic)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec
+	}
+	getWaveform := func(url string) analysis.Waveform {
+		rec := get(url)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var w analysis.Waveform
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &w))
+		return w
+	}
+
+	// Computed from the audio at the requested resolution
+	duration := 200 * 1152 / 44100.0
+	for _, px := range []int{10, 50} {
+		w := getWaveform(fmt.Sprintf("/api/music/silent.mp3/waveform?px=%d", px))
+		assert.Equal(t, px, w.PixelsPerSec)
+		assert.InDelta(t, duration*float64(px), len(w.Peaks), float64(px)/10+1)
+		assert.Len(t, w.Troughs, len(w.Peaks))
+		assert.Nil(t, w.RMS)
+	}
+
+	// Read from an up-to-date sidecar at the same resolution
+	ta := &analysis.TrackAnalysis{
+		File:     "silent.mp3",
+		Waveform: &analysis.Waveform{PixelsPerSec: 100, Peaks: []float64{0.5}, Troughs: []float64{-0.5}},
+		WaveformLevels: map[int]*analysis.Waveform{
+			10: {PixelsPerSec: 10, Peaks: []float64{0.5}, Troughs: []float64{-0.5}},
+		},
+	}
+	jsonPath := filepath.Join("music", "silent.json")
+	require.NoError(t, ta.WriteJSON(jsonPath))
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(jsonPath, future, future))
+	assert.Equal(t, *ta.Waveform, getWaveform("/api/music/silent.mp3/waveform"))
+
+	// Unless the sidecar lacks a requested RMS envelope
+	w := getWaveform("/api/music/silent.mp3/waveform?rms=true")
+	assert.NotEqual(t, ta.Waveform.Peaks, w.Peaks)
+	assert.Len(t, w.RMS, len(w.Peaks))
+
+	// The analysis JSON can be served without its waveform
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(get("/api/music/silent.json").Body.Bytes(), &doc))
+	assert.Contains(t, doc, "waveform")
+	doc = nil
+	require.NoError(t, json.Unmarshal(get("/api/music/silent.json?waveform=false").Body.Bytes(), &doc))
+	assert.NotContains(t, doc, "waveform")
+	assert.NotContains(t, doc, "waveform_levels")
+	assert.Equal(t, "silent.mp3", doc["file"])
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/music/silent.mp3/waveform?px=0").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/music/silent.mp3/waveform?px=5000").Code)
+	assert.Equal(t, http.StatusForbidden, get("/api/music/silent.json/waveform").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/music/missing.mp3/waveform").Code)
+}
+
+func TestWaveformPath(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.Mkdir("music", 0755))
+	writeSilentMP3(t, filepath.Join("music", "silent.mp3"), 200)
+	require.NoError(t, os.WriteFile(filepath.Join("music", "notes.txt"), nil, 0644))
+
+	s := NewServer(nil)
+	e := echo.New()
+	e.GET("/api/music/*", s.serveMusic)
+	e.GET("/api/waveform/*", s.serveWaveformPath)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec
+	}
+
+	// Same waveform as the per-track view
+	rec := get("/api/waveform/silent.mp3?px=20")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.JSONEq(t, get("/api/music/silent.mp3/waveform?px=20").Body.String(), rec.Body.String())
+
+	// Cached per server by path and resolution until the audio changes
+	fullPath := filepath.Join("music", "silent.mp3")
+	info, err := os.Stat(fullPath)
+	require.NoError(t, err)
+	get20 := func(cache *waveformCache, modTime time.Time) *analysis.Waveform {
+		w, err := cache.get(fullPath, modTime, 20, analysis.WaveformOptions{})
+		require.NoError(t, err)
+		return w
+	}
+	w1 := get20(&s.waveforms, info.ModTime())
+	assert.Same(t, w1, get20(&s.waveforms, info.ModTime()))
+	w3, err := s.waveforms.get(fullPath, info.ModTime(), 40, analysis.WaveformOptions{})
+	require.NoError(t, err)
+	assert.False(t, w1 == w3)
+	assert.False(t, w1 == get20(&s.waveforms, info.ModTime().Add(time.Second)))
+	assert.False(t, w1 == get20(&NewServer(nil).waveforms, info.ModTime()))
+
+	// Concurrent requests for the same waveform share one decode
+	var cache waveformCache
+	ws := make([]*analysis.Waveform, 8)
+	var wg sync.WaitGroup
+	for i := range ws {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ws[i], _ = cache.get(fullPath, info.ModTime(), 20, analysis.WaveformOptions{})
+		}()
+	}
+	wg.Wait()
+	for _, w := range ws {
+		assert.Same(t, ws[0], w)
+	}
+
+	// Failures aren't cached
+	_, err = cache.get(filepath.Join("music", "missing.mp3"), info.ModTime(), 20, analysis.WaveformOptions{})
+	assert.Error(t, err)
+	assert.Len(t, cache.entries, 1)
+	assert.Len(t, cache.order, 1)
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/waveform/silent.mp3?px=0").Code)
+	assert.Equal(t, http.StatusBadRequest, get(fmt.Sprintf("/api/waveform/silent.mp3?px=%d", maxWaveformPixelsPerSec+1)).Code)
+	assert.Equal(t, http.StatusForbidden, get("/api/waveform/notes.txt").Code)
+	assert.Equal(t, http.StatusForbidden, get("/api/waveform/..%2Fsilent.mp3").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/waveform/missing.mp3").Code)
+}
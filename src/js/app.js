@@ -270,8 +270,15 @@ class MixxApp extends LitElement {
 
   async fetchTracks() {
     try {
-      const response = await fetch('/api/music');
-      this.tracks = await response.json();
+      // Page through the library until every track is loaded
+      const tracks = [];
+      for (;;) {
+        const response = await fetch(`/api/music?limit=1000&offset=${tracks.length}`);
+        const page = await response.json();
+        tracks.push(...page.tracks);
+        if (page.tracks.length === 0 || tracks.length >= page.total) break;
+      }
+      this.tracks = tracks;
     } catch (e) {
       console.error('Failed to fetch tracks:', e);
     } finally {
@@ -286,8 +293,10 @@ class MixxApp extends LitElement {
 
     if (track.has_json) {
       try {
-        const response = await fetch(`/api/music/${track.json_path}`);
+        // Fetch the waveform separately so grids and markers show first
+        const response = await fetch(`/api/music/${track.json_path}?waveform=false`);
         this.analysis = await response.json();
+        this.loadWaveform(track);
 
         // Select first available grid
         if (this.analysis.grids) {
@@ -310,6 +319,19 @@ class MixxApp extends LitElement {
     }
   }
 
+  async loadWaveform(track) {
+    try {
+      const response = await fetch(`/api/music/${track.path}/waveform?px=100`);
+      if (!response.ok) return;
+      const waveform = await response.json();
+      if (this.currentTrack === track && this.analysis) {
+        this.analysis = { ...this.analysis, waveform };
+      }
+    } catch (e) {
+      console.error('Failed to fetch waveform:', e);
+    }
+  }
+
   selectGrid(name) {
     this.selectedGrid = name;
   }
@@ -339,7 +361,15 @@ class MixxApp extends LitElement {
 
   get currentPhrases() {
     if (!this.selectedMarker) return [];
-    return this.analysis?.markers?.[this.selectedMarker]?.phrases || [];
+    const marker = this.analysis?.markers?.[this.selectedMarker];
+    if (marker?.phrases) return marker.phrases;
+    // Structural segments draw as section bands in their backend-assigned colors
+    return (marker?.segments || []).map((segment) => ({
+      time: segment.start,
+      duration: segment.end - segment.start,
+      label: `section-${segment.type}`,
+      color: segment.color,
+    }));
   }
 
   get availableGrids() {
@@ -360,6 +390,8 @@ class MixxApp extends LitElement {
       'rekordbox-go': 'RekordboxGo',
       'beatthis': 'BeatThis',
       'beatthis-full': 'BeatThis+',
+      'forced': 'Forced',
+      'consensus': 'Consensus',
     };
     return names[name] || name;
   }
@@ -370,6 +402,7 @@ class MixxApp extends LitElement {
       'beats': 'Beats',
       'songformer': 'SongFormer',
       'rekordbox': 'Rekordbox',
+      'merged': 'Merged',
     };
     return names[name] || name;
   }
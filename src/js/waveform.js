@@ -188,7 +188,7 @@ class MixxWaveform extends LitElement {
 
         if (phraseWidth < 1) return;
 
-        const color = MixxWaveform.PHRASE_COLORS[phrase.label] || '#666666';
+        const color = phrase.color || MixxWaveform.PHRASE_COLORS[phrase.label] || '#666666';
 
         // Draw background region with transparency
         this.ctx.fillStyle = color;
@@ -321,7 +321,7 @@ class MixxWaveform extends LitElement {
         if (cue.time < viewport.start || cue.time > viewport.end) return;
 
         const x = this.timeToX(cue.time, width);
-        const color = MixxWaveform.CUE_COLORS[cue.type] || '#ffffff';
+        const color = cue.color || MixxWaveform.CUE_COLORS[cue.type] || '#ffffff';
 
         // Draw cue marker line
         this.ctx.strokeStyle = color;
@@ -371,7 +371,7 @@ class MixxWaveform extends LitElement {
         if (phrase.time > viewport.end || phrase.time < viewport.start) return;
 
         const x = this.timeToX(phrase.time, width);
-        const color = MixxWaveform.PHRASE_COLORS[phrase.label] || '#666666';
+        const color = phrase.color || MixxWaveform.PHRASE_COLORS[phrase.label] || '#666666';
 
         // Draw phrase marker line
         this.ctx.strokeStyle = color;
@@ -636,7 +636,7 @@ class MixxWaveformOverview extends LitElement {
     if (this.cuePoints && this.cuePoints.length > 0) {
       this.cuePoints.forEach((cue) => {
         const x = (cue.time / this.duration) * width;
-        const color = MixxWaveform.CUE_COLORS[cue.type] || '#ffffff';
+        const color = cue.color || MixxWaveform.CUE_COLORS[cue.type] || '#ffffff';
 
         // Draw vertical line
         this.ctx.strokeStyle = color;
@@ -664,7 +664,7 @@ class MixxWaveformOverview extends LitElement {
     if (this.phrases && this.phrases.length > 0) {
       this.phrases.forEach((phrase) => {
         const x = (phrase.time / this.duration) * width;
-        const color = MixxWaveform.PHRASE_COLORS[phrase.label] || '#666666';
+        const color = phrase.color || MixxWaveform.PHRASE_COLORS[phrase.label] || '#666666';
 
         // Draw vertical line
         this.ctx.strokeStyle = color;
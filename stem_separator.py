@@ -0,0 +1,69 @@
+#!/usr/bin/env -S uv run
+# /// script
+# requires-python = ">=3.9"
+# dependencies = [
+#     "demucs",
+#     "soundfile",
+# ]
+# ///
+"""
+Stem separation using Demucs.
+
+Extracts a single stem (drums by default) so beat trackers can run on the
+percussive part of tracks where the full mix confuses them. Slow: expect
+roughly real time on CPU.
+
+Reference: https://github.com/facebookresearch/demucs
+"""
+
+from __future__ import annotations
+
+import argparse
+import contextlib
+import json
+import sys
+from pathlib import Path
+
+
+def separate(audio_path: Path, out_dir: Path, stem: str, model: str) -> Path:
+    """Run Demucs two-stem separation and return the path of the extracted stem."""
+    import demucs.separate
+
+    # Demucs prints progress to stdout, which is reserved for JSON output
+    with contextlib.redirect_stdout(sys.stderr):
+        demucs.separate.main([
+            "--two-stems", stem,
+            "-n", model,
+            "-o", str(out_dir),
+            str(audio_path),
+        ])
+
+    stem_path = out_dir / model / audio_path.stem / f"{stem}.wav"
+    if not stem_path.exists():
+        raise FileNotFoundError(f"demucs did not produce {stem_path}")
+    return stem_path
+
+
+def main():
+    parser = argparse.ArgumentParser(description="Extract a stem with Demucs")
+    parser.add_argument("audio", help="Audio file to separate")
+    parser.add_argument("--out", required=True, help="Output directory for stems")
+    parser.add_argument("--stem", default="drums", help="Stem to extract (drums, bass, vocals, other)")
+    parser.add_argument("--model", default="htdemucs", help="Demucs model name")
+    parser.add_argument("--json", action="store_true", help="Output JSON")
+    args = parser.parse_args()
+
+    try:
+        stem_path = separate(Path(args.audio), Path(args.out), args.stem, args.model)
+    except Exception as e:
+        print(f"Error: {e}", file=sys.stderr)
+        sys.exit(1)
+
+    if args.json:
+        print(json.dumps({"stem": args.stem, "model": args.model, "path": str(stem_path)}))
+    else:
+        print(f"{args.stem}: {stem_path}")
+
+
+if __name__ == "__main__":
+    main()